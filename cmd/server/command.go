@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/database"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/utils"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// runCommand 执行运维子命令
+func runCommand(cfg *config.Config, name string, args []string) error {
+	switch name {
+	case "provision":
+		return runProvision(cfg, args)
+	case "rekey-secrets":
+		return runRekeySecrets(cfg)
+	case "operator":
+		return runOperator(cfg, args)
+	default:
+		return fmt.Errorf("unknown command: %s", name)
+	}
+}
+
+// initCommand 初始化运维子命令依赖的日志、数据库和SN校验使用的机型注册表，返回仓储集合
+func initCommand(cfg *config.Config) (repository.Store, error) {
+	if err := logger.Init(cfg.Log); err != nil {
+		return nil, fmt.Errorf("init logger error: %v", err)
+	}
+	if err := database.Init(cfg.Database); err != nil {
+		return nil, fmt.Errorf("init database error: %v", err)
+	}
+	store := repository.NewStore(database.DB)
+	validator.SetModelRegistry(service.PrinterModelRegistry(store))
+	return store, nil
+}
+
+// runProvision 导入出厂预置数据
+// 用法: server -config configs/config.yaml provision -file devices.csv -batch B20240101
+func runProvision(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("provision", flag.ExitOnError)
+	file := fs.String("file", "", "出厂数据文件(.csv或签名的.json清单)")
+	batchNo := fs.String("batch", "", "批次号(CSV导入时必填)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("missing -file")
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return fmt.Errorf("read file error: %v", err)
+	}
+
+	store, err := initCommand(cfg)
+	if err != nil {
+		return err
+	}
+
+	cipher, err := utils.NewSecretCipher(cfg.Server.AESKeyVersion, cfg.Server.AESKeys())
+	if err != nil {
+		return fmt.Errorf("init secret cipher error: %v", err)
+	}
+
+	provisionService := service.NewProvisionService(store, cfg.Provision.ManifestKey, cipher)
+
+	var records []service.ProvisionRecord
+	if strings.ToLower(filepath.Ext(*file)) == ".csv" {
+		if *batchNo == "" {
+			return fmt.Errorf("missing -batch for csv import")
+		}
+		if records, err = provisionService.ParseCSV(bytes.NewReader(data)); err != nil {
+			return err
+		}
+	} else {
+		manifest, err := provisionService.ParseManifest(data)
+		if err != nil {
+			return err
+		}
+		*batchNo = manifest.BatchNo
+		records = manifest.Devices
+	}
+
+	result, err := provisionService.Import(*batchNo, records)
+	if err != nil {
+		return err
+	}
+
+	output, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(output))
+	return nil
+}
+
+// runRekeySecrets 使用当前版本AES密钥重新加密设备密钥
+// 用法: server -config configs/config.yaml rekey-secrets
+func runRekeySecrets(cfg *config.Config) error {
+	cipher, err := utils.NewSecretCipher(cfg.Server.AESKeyVersion, cfg.Server.AESKeys())
+	if err != nil {
+		return fmt.Errorf("init secret cipher error: %v", err)
+	}
+
+	store, err := initCommand(cfg)
+	if err != nil {
+		return err
+	}
+
+	result, err := service.NewSecretService(store, cipher, cfg.Auth).ReencryptSecrets()
+	if err != nil {
+		return err
+	}
+
+	output, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(output))
+	return nil
+}
+
+// runOperator 管理运维账号，用于创建首个管理员
+// 用法: server -config configs/config.yaml operator create -username admin -password xxxxxxxx -role admin
+func runOperator(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "create" {
+		return fmt.Errorf("usage: operator create -username <name> -password <password> -role <admin|support|viewer>")
+	}
+
+	fs := flag.NewFlagSet("operator create", flag.ExitOnError)
+	username := fs.String("username", "", "登录名")
+	password := fs.String("password", "", "登录密码(至少8位)")
+	role := fs.String("role", "admin", "角色(admin/support/viewer)")
+	displayName := fs.String("name", "", "显示名称")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *username == "" || len(*password) < 8 {
+		return fmt.Errorf("missing -username or -password shorter than 8 characters")
+	}
+
+	store, err := initCommand(cfg)
+	if err != nil {
+		return err
+	}
+
+	operator, err := service.NewOperatorService(store, cfg.Operator, cfg.Auth).CreateOperator(&service.CreateOperatorRequest{
+		Username:    *username,
+		Password:    *password,
+		DisplayName: *displayName,
+		Role:        *role,
+	})
+	if err != nil {
+		return err
+	}
+
+	output, _ := json.MarshalIndent(operator, "", "  ")
+	fmt.Println(string(output))
+	return nil
+}
@@ -19,6 +19,14 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// 运维子命令，例如: server -config configs/config.yaml provision -file devices.csv -batch B20240101
+	if flag.NArg() > 0 {
+		if err := runCommand(cfg, flag.Arg(0), flag.Args()[1:]); err != nil {
+			log.Fatalf("Failed to run command %s: %v", flag.Arg(0), err)
+		}
+		return
+	}
+
 	// 初始化应用
 	app, err := app.NewApp(cfg)
 	if err != nil {
@@ -1,8 +1,10 @@
 package app
 
 import (
+	"crypto/rsa"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"mingda_cloud_service/internal/pkg/config"
@@ -11,12 +13,23 @@ import (
 	"mingda_cloud_service/internal/pkg/redis"
 	"mingda_cloud_service/internal/pkg/rabbitmq"
 	"mingda_cloud_service/internal/app/handler"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
 	"mingda_cloud_service/internal/pkg/middleware"
+	"mingda_cloud_service/internal/pkg/storage"
+	"mingda_cloud_service/internal/pkg/utils"
+	"mingda_cloud_service/internal/pkg/validator"
 )
 
 type App struct {
-	config *config.Config
-	engine *gin.Engine
+	config       *config.Config
+	engine       *gin.Engine
+	keyRing      *utils.RSAKeyRing
+	secretCipher *utils.SecretCipher
+	store        repository.Store
+	objectStore  storage.ObjectStorage
+	otaKey       *rsa.PrivateKey
 }
 
 func NewApp(cfg *config.Config) (*App, error) {
@@ -40,6 +53,47 @@ func NewApp(cfg *config.Config) (*App, error) {
 		return nil, fmt.Errorf("init rabbitmq error: %v", err)
 	}
 
+	// 加载服务器RSA密钥
+	keyRing, err := utils.LoadRSAKeyRing(cfg.Crypto)
+	if err != nil {
+		return nil, fmt.Errorf("init crypto keys error: %v", err)
+	}
+
+	// 初始化设备密钥加密器
+	secretCipher, err := utils.NewSecretCipher(cfg.Server.AESKeyVersion, cfg.Server.AESKeys())
+	if err != nil {
+		return nil, fmt.Errorf("init secret cipher error: %v", err)
+	}
+
+	// 初始化对象存储，未配置时不能上传和下发升级包
+	var objectStore storage.ObjectStorage
+	if cfg.Minio.Endpoint != "" {
+		minioStorage, err := storage.NewMinioStorage(&cfg.Minio)
+		if err != nil {
+			return nil, fmt.Errorf("init minio error: %v", err)
+		}
+		objectStore = minioStorage
+	}
+
+	// 加载升级包签名密钥
+	var otaKey *rsa.PrivateKey
+	if cfg.OTA.SigningKeyFile != "" {
+		otaKey, err = utils.LoadRSAPrivateKey(cfg.OTA.SigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load ota signing key error: %v", err)
+		}
+	}
+
+	// 运维令牌与设备令牌必须使用不同的签名密钥
+	if cfg.Operator.JWTSecret != "" && cfg.Operator.JWTSecret == cfg.Server.JWTSecret {
+		return nil, fmt.Errorf("operator jwt_secret must differ from server jwt_secret")
+	}
+
+	// Broker认证回调必须校验调用方，否则任何人都能调用认证接口
+	if cfg.MQTT.Enabled && cfg.MQTT.AuthSecret == "" {
+		return nil, fmt.Errorf("mqtt auth_secret is required when mqtt is enabled")
+	}
+
 	// 设置gin模式
 	gin.SetMode(cfg.Server.Mode)
 
@@ -53,15 +107,48 @@ func NewApp(cfg *config.Config) (*App, error) {
 	engine.Static("/images", "./uploads/images")
 
 	return &App{
-		config: cfg,
-		engine: engine,
+		config:       cfg,
+		engine:       engine,
+		keyRing:      keyRing,
+		secretCipher: secretCipher,
+		store:        repository.NewStore(database.DB),
+		objectStore:  objectStore,
+		otaKey:       otaKey,
 	}, nil
 }
 
 func (a *App) Run() error {
+	// SN校验使用数据库中登记的机型，机型变更时通知各实例失效缓存
+	validator.SetModelRegistry(service.PrinterModelRegistry(a.store))
+	modelSyncService := service.NewPrinterModelSyncService()
+	defer modelSyncService.Stop()
+
 	// 注册路由
 	a.registerRoutes()
 
+	// 启动过期令牌清理任务
+	tokenPurgeService := service.NewTokenPurgeService(a.store, a.config.Auth)
+	defer tokenPurgeService.Stop()
+
+	// 启动升级活动监控任务
+	campaignMonitor := service.NewOTACampaignMonitorService(a.store, time.Duration(a.config.OTA.CampaignCheckInterval)*time.Second)
+	defer campaignMonitor.Stop()
+
+	// 订阅指令下发通知并启动过期指令检查任务
+	commandNotifyService := service.NewDeviceCommandNotifyService()
+	defer commandNotifyService.Stop()
+	// 订阅设备停用通知，断开本实例持有的长连接
+	kickNotifyService := service.NewDeviceKickNotifyService()
+	defer kickNotifyService.Stop()
+	commandSweepService := service.NewDeviceCommandSweepService(a.store, a.config.Command)
+	defer commandSweepService.Stop()
+
+	// 启动MQTT接入
+	if a.config.MQTT.Enabled {
+		mqttBridge := service.NewMQTTBridgeService(a.store, a.config.MQTT, a.config.Command)
+		defer mqttBridge.Stop()
+	}
+
 	// 启动HTTP服务
 	addr := fmt.Sprintf(":%d", a.config.Server.Port)
 	return http.ListenAndServe(addr, a.engine)
@@ -73,36 +160,75 @@ func (a *App) registerRoutes() {
 	a.engine.Use(gin.Recovery())
 
 	// 创建处理器
-	authHandler := handler.NewAuthHandler(a.config.Server.JWTSecret, a.config.Server.AESKey)
-	deviceInfoHandler := handler.NewDeviceInfoHandler()
-	deviceStatusHandler := handler.NewDeviceStatusHandler()
-	deviceAlarmHandler := handler.NewDeviceAlarmHandler()
-	printTaskHandler := handler.NewPrintTaskHandler()
-	printImageHandler := handler.NewPrintImageHandler(database.DB, a.config)
+	store := a.store
+	authHandler := handler.NewAuthHandler(store, a.config.Server.JWTSecret, a.secretCipher, a.config.Auth)
+	deviceInfoHandler := handler.NewDeviceInfoHandler(store)
+	deviceStatusHandler := handler.NewDeviceStatusHandler(store)
+	deviceNetworkHandler := handler.NewDeviceNetworkHandler(store)
+	deviceAlarmHandler := handler.NewDeviceAlarmHandler(store)
+	printTaskHandler := handler.NewPrintTaskHandler(store)
+	printImageHandler := handler.NewPrintImageHandler(store, a.config)
 	aiCallbackHandler := handler.NewAICallbackHandler(database.DB)
+	cryptoHandler := handler.NewCryptoHandler(a.keyRing)
+	lockoutHandler := handler.NewLockoutHandler(store, a.config.Auth)
+	secretHandler := handler.NewSecretHandler(store, a.secretCipher, a.config.Auth)
+	lifecycleHandler := handler.NewDeviceLifecycleHandler(store)
+	provisionHandler := handler.NewProvisionHandler(store, a.config.Provision.ManifestKey, a.secretCipher)
+	operatorHandler := handler.NewOperatorHandler(store, a.config.Operator, a.config.Auth)
+	deviceAdminHandler := handler.NewDeviceAdminHandler(store)
+	orgHandler := handler.NewOrganizationHandler(store, a.config.Auth)
+	apiKeyHandler := handler.NewAPIKeyHandler(store)
+	authAuditHandler := handler.NewAuthAuditHandler(store)
+	sessionHandler := handler.NewSessionHandler(store)
+	printerModelHandler := handler.NewPrinterModelHandler(store)
+	versionReportHandler := handler.NewVersionReportHandler(store)
+	otaHandler := handler.NewOTAHandler(store, a.objectStore, a.otaKey, a.config.OTA)
+	otaCampaignHandler := handler.NewOTACampaignHandler(store)
+	shadowHandler := handler.NewDeviceShadowHandler(store)
+	commandHandler := handler.NewDeviceCommandHandler(store, a.config.Command)
+	gatewayHandler := handler.NewDeviceGatewayHandler(store, a.config.Gateway, a.config.Command)
+	mqttHandler := handler.NewMQTTHandler(store, a.config.Server.JWTSecret, a.secretCipher, a.config.Auth, a.config.MQTT)
 
 	// API v1 路由组
 	v1 := a.engine.Group("/api/v1")
 	{
 		// 公开接口
 		v1.GET("/health", handler.HealthCheck)
+		v1.GET("/crypto/public-key", cryptoHandler.GetPublicKey)
+		v1.GET("/ota/public-key", otaHandler.GetPublicKey)
 		
 		// 设备认证接口
 		v1.POST("/devices/register", authHandler.Register)
 		v1.POST("/devices/auth", authHandler.Authenticate)
 		v1.POST("/devices/refresh", authHandler.RefreshToken)
+		v1.POST("/devices/logout", middleware.AuthRequired(a.config.Server.JWTSecret, store), authHandler.Logout)
 
 		// AI回调接口 - 不需要认证
 		v1.POST("/ai/callback", aiCallbackHandler.HandleCallback)
 
+		// MQTT Broker认证回调，通过共享密钥校验调用方，未启用MQTT接入时不注册
+		if a.config.MQTT.Enabled {
+			v1.POST("/mqtt/auth", mqttHandler.Authenticate)
+			v1.POST("/mqtt/acl", mqttHandler.Authorize)
+		}
+
 		// 需要认证的接口
-		auth := v1.Group("/", middleware.AuthRequired())
+		auth := v1.Group("/", middleware.AuthRequired(a.config.Server.JWTSecret, store))
 		{
-			// 设备信息相关路由
-			deviceGroup := auth.Group("/device")
+			// 设备长连接，复用访问令牌认证，连接建立后消息不再逐条签名
+			auth.GET("/device/ws", gatewayHandler.Connect)
+
+			// 设备信息相关路由，先解密加密数据包，再按配置校验请求签名
+			deviceGroup := auth.Group("/device", middleware.DecryptEnvelope(a.keyRing, a.config.Crypto.EncryptResponse), middleware.SignRequired(middleware.SignOptions{
+				Mode:     a.config.Sign.DeviceMode,
+				MaxSkew:  time.Duration(a.config.Sign.MaxSkew) * time.Second,
+				NonceTTL: time.Duration(a.config.Sign.NonceTTL) * time.Second,
+				Cipher:   a.secretCipher,
+			}))
 			{
 				deviceGroup.POST("/info", deviceInfoHandler.ReportDeviceInfo)
 				deviceGroup.POST("/status", deviceStatusHandler.ReportDeviceStatus)
+				deviceGroup.POST("/network", deviceNetworkHandler.ReportDeviceNetwork)
 				// 设备告警相关路由
 				deviceGroup.POST("/alarm", deviceAlarmHandler.ReportDeviceAlarm)
 				deviceGroup.GET("/alarms", deviceAlarmHandler.GetDeviceAlarms)
@@ -115,7 +241,120 @@ func (a *App) registerRoutes() {
 				// 打印图片相关路由
 				deviceGroup.POST("/print/image", printImageHandler.UploadPrintImage)
 				deviceGroup.GET("/print/images", printImageHandler.GetPrintImages)
+				// 设备密钥轮换
+				deviceGroup.POST("/secret/rotate", secretHandler.RotateSecret)
+				// 固件和软件升级
+				deviceGroup.GET("/ota/check", otaHandler.CheckUpdate)
+				deviceGroup.POST("/ota/progress", otaHandler.ReportProgress)
+				// 设备影子
+				deviceGroup.GET("/shadow", shadowHandler.GetDelta)
+				deviceGroup.POST("/shadow/reported", shadowHandler.ReportState)
+				// 设备指令
+				deviceGroup.GET("/commands", commandHandler.PollCommands)
+				deviceGroup.POST("/commands/:id/ack", commandHandler.AckCommand)
 			}
 		}
+
+		// 运维登录
+		v1.POST("/admin/login", operatorHandler.Login)
+
+		// 运维接口，使用运维令牌认证并按角色校验权限
+		// 组织运维人员只能访问本组织的设备及其数据，平台级管理接口仅限平台运维人员
+		admin := v1.Group("/admin", middleware.OperatorRequired(a.config.Operator.JWTSecret, store))
+		{
+			admin.POST("/logout", operatorHandler.Logout)
+			admin.GET("/profile", operatorHandler.Profile)
+			// 运维账号
+			admin.GET("/operators", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOperatorManage), operatorHandler.ListOperators)
+			admin.POST("/operators", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOperatorManage), operatorHandler.CreateOperator)
+			admin.PUT("/operators/:id", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOperatorManage), operatorHandler.UpdateOperator)
+			// 组织
+			admin.GET("/organizations", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOrgManage), orgHandler.ListOrganizations)
+			admin.POST("/organizations", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOrgManage), orgHandler.CreateOrganization)
+			// 设备
+			admin.GET("/devices", middleware.PermissionRequired(model.PermDeviceRead), deviceAdminHandler.ListDevices)
+			admin.GET("/devices/:sn", middleware.PermissionRequired(model.PermDeviceRead), middleware.DeviceAccessRequired(store), deviceAdminHandler.GetDevice)
+			admin.POST("/devices/:sn/revoke-tokens", middleware.PermissionRequired(model.PermDeviceWrite), middleware.DeviceAccessRequired(store), authHandler.RevokeDeviceTokens)
+			admin.GET("/devices/:sn/sessions", middleware.PermissionRequired(model.PermDeviceRead), middleware.DeviceAccessRequired(store), sessionHandler.ListSessions)
+			admin.POST("/devices/:sn/sessions/:family_id/revoke", middleware.PermissionRequired(model.PermDeviceWrite), middleware.DeviceAccessRequired(store), sessionHandler.RevokeSession)
+			admin.POST("/devices/:sn/rotate-secret", middleware.PermissionRequired(model.PermDeviceWrite), middleware.DeviceAccessRequired(store), secretHandler.RequireRotation)
+			admin.POST("/devices/rotate-secret", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermDeviceWrite), secretHandler.RequireRotationByModel)
+			// 设备生命周期
+			admin.POST("/devices/:sn/state", middleware.PermissionRequired(model.PermDeviceWrite), middleware.DeviceAccessRequired(store), lifecycleHandler.ChangeState)
+			admin.GET("/devices/:sn/state-history", middleware.PermissionRequired(model.PermDeviceRead), middleware.DeviceAccessRequired(store), lifecycleHandler.GetStateHistory)
+			admin.GET("/devices/:sn/network", middleware.PermissionRequired(model.PermDeviceRead), middleware.DeviceAccessRequired(store), deviceNetworkHandler.GetNetworkHistory)
+			admin.GET("/devices/:sn/ota-updates", middleware.PermissionRequired(model.PermDeviceRead), middleware.DeviceAccessRequired(store), otaHandler.ListDeviceUpdates)
+			admin.GET("/devices/:sn/versions", middleware.PermissionRequired(model.PermDeviceRead), middleware.DeviceAccessRequired(store), deviceInfoHandler.GetVersionTimeline)
+			// 设备影子
+			admin.GET("/devices/:sn/shadow", middleware.PermissionRequired(model.PermDeviceRead), middleware.DeviceAccessRequired(store), shadowHandler.GetShadow)
+			admin.PUT("/devices/:sn/shadow/desired", middleware.PermissionRequired(model.PermDeviceWrite), middleware.DeviceAccessRequired(store), shadowHandler.UpdateDesired)
+			admin.POST("/devices/shadow/desired", middleware.PermissionRequired(model.PermDeviceWrite), shadowHandler.UpdateDesiredBatch)
+			// 设备指令
+			admin.POST("/devices/:sn/commands", middleware.PermissionRequired(model.PermDeviceWrite), middleware.DeviceAccessRequired(store), commandHandler.IssueCommand)
+			admin.GET("/devices/:sn/commands", middleware.PermissionRequired(model.PermDeviceRead), middleware.DeviceAccessRequired(store), commandHandler.ListCommands)
+			admin.GET("/devices/:sn/commands/:id", middleware.PermissionRequired(model.PermDeviceRead), middleware.DeviceAccessRequired(store), commandHandler.GetCommand)
+			admin.GET("/devices/:sn/connection", middleware.PermissionRequired(model.PermDeviceRead), middleware.DeviceAccessRequired(store), gatewayHandler.GetConnection)
+			// 设备归属
+			admin.POST("/devices/claim", middleware.PermissionRequired(model.PermOrgManage), orgHandler.ClaimDevice)
+			admin.POST("/devices/:sn/transfer", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOrgManage), orgHandler.TransferDevice)
+			admin.POST("/devices/:sn/unbind", middleware.PermissionRequired(model.PermOrgManage), middleware.DeviceAccessRequired(store), orgHandler.UnbindDevice)
+			admin.POST("/devices/:sn/claim-code", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOrgManage), orgHandler.IssueClaimCode)
+			admin.GET("/devices/:sn/ownership-history", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermDeviceRead), orgHandler.GetOwnershipHistory)
+			// 机型
+			admin.GET("/printer-models", middleware.PermissionRequired(model.PermDeviceRead), printerModelHandler.ListPrinterModels)
+			admin.GET("/printer-models/:code", middleware.PermissionRequired(model.PermDeviceRead), printerModelHandler.GetPrinterModel)
+			admin.POST("/printer-models", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermModelManage), printerModelHandler.CreatePrinterModel)
+			admin.PUT("/printer-models/:code", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermModelManage), printerModelHandler.UpdatePrinterModel)
+			admin.DELETE("/printer-models/:code", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermModelManage), printerModelHandler.DeletePrinterModel)
+			// 第三方API密钥
+			admin.GET("/api-keys", middleware.PermissionRequired(model.PermAPIKeyManage), apiKeyHandler.ListAPIKeys)
+			admin.POST("/api-keys", middleware.PermissionRequired(model.PermAPIKeyManage), apiKeyHandler.CreateAPIKey)
+			admin.POST("/api-keys/:id/revoke", middleware.PermissionRequired(model.PermAPIKeyManage), apiKeyHandler.RevokeAPIKey)
+			// 升级包
+			admin.GET("/ota/packages", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermDeviceRead), otaHandler.ListPackages)
+			admin.GET("/ota/packages/:id", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermDeviceRead), otaHandler.GetPackage)
+			admin.POST("/ota/packages", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOTAManage), otaHandler.UploadPackage)
+			admin.PUT("/ota/packages/:id", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOTAManage), otaHandler.UpdatePackage)
+			// 升级活动
+			admin.GET("/ota/campaigns", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermDeviceRead), otaCampaignHandler.ListCampaigns)
+			admin.GET("/ota/campaigns/:id", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermDeviceRead), otaCampaignHandler.GetCampaign)
+			admin.POST("/ota/campaigns", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOTAManage), otaCampaignHandler.CreateCampaign)
+			admin.POST("/ota/campaigns/:id/start", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOTAManage), otaCampaignHandler.StartCampaign)
+			admin.POST("/ota/campaigns/:id/pause", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOTAManage), otaCampaignHandler.PauseCampaign)
+			admin.POST("/ota/campaigns/:id/resume", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOTAManage), otaCampaignHandler.ResumeCampaign)
+			admin.POST("/ota/campaigns/:id/abort", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermOTAManage), otaCampaignHandler.AbortCampaign)
+			// 统计报表
+			admin.GET("/reports/versions", middleware.PermissionRequired(model.PermDeviceRead), versionReportHandler.GetVersionDistribution)
+			admin.GET("/reports/versions/export", middleware.PermissionRequired(model.PermDeviceRead), versionReportHandler.ExportVersionDistribution)
+			// 告警
+			admin.GET("/alarms", middleware.PermissionRequired(model.PermAlarmRead), deviceAlarmHandler.ListAlarms)
+			admin.POST("/alarms/:id/resolve", middleware.PermissionRequired(model.PermAlarmWrite), deviceAlarmHandler.ResolveAlarm)
+			admin.POST("/alarms/:id/ignore", middleware.PermissionRequired(model.PermAlarmWrite), deviceAlarmHandler.IgnoreAlarm)
+			// 打印任务和图片
+			admin.GET("/print/tasks", middleware.PermissionRequired(model.PermDeviceRead), printTaskHandler.ListPrintTasks)
+			admin.GET("/print/task/:task_id/history", middleware.PermissionRequired(model.PermDeviceRead), printTaskHandler.GetTaskHistory)
+			admin.GET("/print/images", middleware.PermissionRequired(model.PermDeviceRead), printImageHandler.ListPrintImages)
+			// 出厂预置
+			admin.POST("/provisions/import", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermProvisionWrite), provisionHandler.Import)
+			admin.GET("/provisions/:sn", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermProvisionRead), provisionHandler.GetProvision)
+			// 认证审计
+			admin.GET("/auth/audit", middleware.PermissionRequired(model.PermAuthRead), authAuditHandler.ListAuthAudits)
+			// 认证锁定
+			admin.GET("/auth/lockouts", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermAuthRead), lockoutHandler.ListLockouts)
+			admin.POST("/auth/lockouts/clear", middleware.PlatformRequired(), middleware.PermissionRequired(model.PermAuthWrite), lockoutHandler.ClearLockout)
+		}
+
+		// 开放接口，供MES、BI等第三方系统使用API密钥访问，按密钥授权范围校验
+		open := v1.Group("/open", middleware.APIKeyRequired(store))
+		{
+			open.GET("/devices", middleware.ScopeRequired(model.ScopeDevicesRead), deviceAdminHandler.ListDevices)
+			open.GET("/devices/:sn", middleware.ScopeRequired(model.ScopeDevicesRead), deviceAdminHandler.GetDevice)
+			open.GET("/print/tasks", middleware.ScopeRequired(model.ScopeTasksRead), printTaskHandler.ListPrintTasks)
+			open.GET("/print/task/:task_id/history", middleware.ScopeRequired(model.ScopeTasksRead), printTaskHandler.GetTaskHistory)
+			open.GET("/print/images", middleware.ScopeRequired(model.ScopeTasksRead), printImageHandler.ListPrintImages)
+			open.GET("/alarms", middleware.ScopeRequired(model.ScopeAlarmsRead), deviceAlarmHandler.ListAlarms)
+			open.POST("/alarms/:id/resolve", middleware.ScopeRequired(model.ScopeAlarmsWrite), deviceAlarmHandler.ResolveAlarm)
+			open.POST("/alarms/:id/ignore", middleware.ScopeRequired(model.ScopeAlarmsWrite), deviceAlarmHandler.IgnoreAlarm)
+		}
 	}
 } 
\ No newline at end of file
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// APIKeyHandler API密钥管理处理器
+type APIKeyHandler struct {
+	apiKeyService *service.APIKeyService
+}
+
+// NewAPIKeyHandler 创建API密钥管理处理器实例
+func NewAPIKeyHandler(store repository.Store) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: service.NewAPIKeyService(store),
+	}
+}
+
+// CreateAPIKey 运维接口：创建API密钥，完整密钥只在响应中返回一次
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var req service.CreateAPIKeyRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	result, err := h.apiKeyService.CreateAPIKey(operator.OrganizationID, &req, operator.Username)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// ListAPIKeys 运维接口：查询API密钥列表
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	tenant, ok := requestTenant(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	keys, err := h.apiKeyService.ListAPIKeys(tenant)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, keys)
+}
+
+// RevokeAPIKey 运维接口：撤销API密钥
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "无效的密钥ID"))
+		return
+	}
+
+	tenant, ok := requestTenant(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	key, err := h.apiKeyService.RevokeAPIKey(tenant, uint(id))
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, key)
+}
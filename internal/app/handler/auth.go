@@ -2,20 +2,29 @@ package handler
 
 import (
 	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
 	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/utils"
 	"mingda_cloud_service/internal/pkg/response"
 	"mingda_cloud_service/internal/pkg/validator"
 	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/app/model"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type AuthHandler struct {
-	authService *service.AuthService
+	authService  *service.AuthService
+	auditService *service.AuthAuditService
 }
 
-func NewAuthHandler(jwtSecret, aesKey string) *AuthHandler {
+func NewAuthHandler(store repository.Store, jwtSecret string, cipher *utils.SecretCipher, authCfg config.AuthConfig) *AuthHandler {
 	return &AuthHandler{
-		authService: service.NewAuthService(jwtSecret, aesKey),
+		authService:  service.NewAuthService(store, jwtSecret, cipher, authCfg),
+		auditService: service.NewAuthAuditService(store),
 	}
 }
 
@@ -30,73 +39,199 @@ type AuthRequest struct {
 	Timestamp int64  `json:"timestamp" binding:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// DeviceResponse 返回给设备的设备信息，不包含密钥等敏感字段
+type DeviceResponse struct {
+	SN          string    `json:"sn"`
+	Model       string    `json:"model"`
+	Name        string    `json:"name"`
+	Status      int       `json:"status"`
+	LastOnline  time.Time `json:"last_online"`
+	FirmwareVer string    `json:"firmware_ver"`
+}
+
+// RegisterResponse 设备注册响应
+// Secret仅在服务器生成密钥时返回一次，出厂预置的设备不返回
+type RegisterResponse struct {
+	DeviceResponse
+	Secret string `json:"secret,omitempty"`
+}
+
+func newDeviceResponse(device *model.Device) DeviceResponse {
+	return DeviceResponse{
+		SN:          device.SN,
+		Model:       device.DeviceModel,
+		Name:        device.Name,
+		Status:      device.Status,
+		LastOnline:  device.LastOnline,
+		FirmwareVer: device.FirmwareVer,
+	}
+}
+
 // Register 设备注册
 func (h *AuthHandler) Register(c *gin.Context) {
+	entry := h.startAudit(model.AuthEventRegister)
+	defer h.finishAudit(c, entry)
+
 	var req RegisterRequest
 	if err := validator.BindAndValid(c, &req); err != nil {
-		response.Error(c, err)
+		h.fail(c, entry, err)
 		return
 	}
+	entry.DeviceSN = req.SN
 
-	device, err := h.authService.RegisterDevice(req.SN, req.Model)
+	device, secret, err := h.authService.RegisterDevice(req.SN, req.Model)
 	if err != nil {
-		response.Error(c, err)
+		h.fail(c, entry, err)
 		return
 	}
+	entry.DeviceID = device.ID
 
-	response.Success(c, device)
+	response.Success(c, RegisterResponse{
+		DeviceResponse: newDeviceResponse(device),
+		Secret:         secret,
+	})
 }
 
 // Authenticate 设备认证
 func (h *AuthHandler) Authenticate(c *gin.Context) {
+	entry := h.startAudit(model.AuthEventAuthenticate)
+	defer h.finishAudit(c, entry)
+
 	var req AuthRequest
 	if err := validator.BindAndValid(c, &req); err != nil {
-		response.Error(c, err)
+		h.fail(c, entry, err)
 		return
 	}
+	entry.DeviceSN = req.SN
 
-	device, err := h.authService.AuthenticateDevice(req.SN, req.Sign, req.Timestamp)
+	device, err := h.authService.AuthenticateDevice(req.SN, req.Sign, req.Timestamp, requestMeta(c))
 	if err != nil {
-		response.Error(c, err)
+		// 被锁定时通过Retry-After告知设备重试等待时间
+		if errors.IsErrorCode(err, errors.ErrTooManyReq) {
+			if retryAfter := h.authService.LockoutRetryAfter(req.SN, c.ClientIP()); retryAfter > 0 {
+				c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+			}
+		}
+		h.fail(c, entry, err)
 		return
 	}
+	entry.DeviceID = device.ID
 
-	// 生成访问令牌
-	token, err := h.authService.GenerateToken(device)
+	// 生成访问令牌和刷新令牌
+	pair, err := h.authService.GenerateToken(device, requestMeta(c))
 	if err != nil {
-		response.Error(c, err)
+		h.fail(c, entry, err)
 		return
 	}
 
 	response.Success(c, gin.H{
-		"token": token,
-		"device": device,
+		"token":                  pair.AccessToken,
+		"refresh_token":          pair.RefreshToken,
+		"expires_in":             pair.ExpiresIn,
+		"refresh_expires_in":     pair.RefreshExpiresIn,
+		"device":                 newDeviceResponse(device),
+		"secret_rotate_required": device.SecretRotateRequired,
 	})
 }
 
-// RefreshToken 刷新访问令牌
+// RefreshToken 使用刷新令牌换取新的令牌对
+// 刷新令牌优先从请求体获取，兼容通过Authorization头传递
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
-	// 从请求头获取当前token
-	auth := c.GetHeader("Authorization")
-	if auth == "" {
-		response.Error(c, errors.New(errors.ErrUnauthorized, "missing authorization header"))
+	entry := h.startAudit(model.AuthEventRefresh)
+	defer h.finishAudit(c, entry)
+
+	var req RefreshRequest
+	_ = c.ShouldBindJSON(&req)
+
+	refreshToken := req.RefreshToken
+	if refreshToken == "" {
+		auth := c.GetHeader("Authorization")
+		if auth == "" {
+			h.fail(c, entry, errors.New(errors.ErrUnauthorized, "missing refresh token"))
+			return
+		}
+
+		parts := strings.SplitN(auth, " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			h.fail(c, entry, errors.New(errors.ErrUnauthorized, "invalid authorization format"))
+			return
+		}
+		refreshToken = parts[1]
+	}
+	entry.DeviceSN, entry.DeviceID = h.authService.TokenSubject(refreshToken)
+
+	// 轮换令牌
+	pair, err := h.authService.RefreshToken(refreshToken, requestMeta(c))
+	if err != nil {
+		h.fail(c, entry, err)
+		return
+	}
+
+	response.Success(c, pair)
+}
+
+// Logout 设备登出
+func (h *AuthHandler) Logout(c *gin.Context) {
+	entry := h.startAudit(model.AuthEventLogout)
+	defer h.finishAudit(c, entry)
+
+	value, _ := c.Get(constants.ContextTokenClaims)
+	claims, ok := value.(*utils.Claims)
+	if !ok {
+		h.fail(c, entry, errors.New(errors.ErrUnauthorized, "未授权的访问"))
 		return
 	}
+	entry.DeviceSN, entry.DeviceID = claims.DeviceSN, claims.DeviceID
 
-	parts := strings.SplitN(auth, " ", 2)
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		response.Error(c, errors.New(errors.ErrUnauthorized, "invalid authorization format"))
+	if err := h.authService.Logout(claims, c.GetString(constants.ContextToken)); err != nil {
+		h.fail(c, entry, err)
 		return
 	}
 
-	// 刷新token
-	newToken, err := h.authService.RefreshToken(parts[1])
-	if err != nil {
+	response.Success(c, gin.H{"success": true})
+}
+
+// RevokeDeviceTokens 运维接口：撤销设备的全部令牌
+func (h *AuthHandler) RevokeDeviceTokens(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	if err := h.authService.RevokeDeviceTokens(sn); err != nil {
 		response.Error(c, err)
 		return
 	}
 
-	response.Success(c, gin.H{
-		"token": newToken,
-	})
-} 
\ No newline at end of file
+	response.Success(c, gin.H{"success": true})
+}
+
+// startAudit 开始记录一次认证活动
+func (h *AuthHandler) startAudit(event string) *service.AuthAuditEntry {
+	return &service.AuthAuditEntry{Event: event, Start: time.Now()}
+}
+
+// finishAudit 写入认证审计记录
+func (h *AuthHandler) finishAudit(c *gin.Context, entry *service.AuthAuditEntry) {
+	entry.Meta = requestMeta(c)
+	h.auditService.Record(entry)
+}
+
+// fail 返回错误响应并记录到认证审计
+func (h *AuthHandler) fail(c *gin.Context, entry *service.AuthAuditEntry, err error) {
+	entry.Err = err
+	response.Error(c, err)
+}
+
+// requestMeta 获取请求来源信息
+func requestMeta(c *gin.Context) service.RequestMeta {
+	return service.RequestMeta{
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
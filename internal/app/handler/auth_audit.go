@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+)
+
+// AuthAuditHandler 认证审计处理器
+type AuthAuditHandler struct {
+	auditService *service.AuthAuditService
+}
+
+// NewAuthAuditHandler 创建认证审计处理器实例
+func NewAuthAuditHandler(store repository.Store) *AuthAuditHandler {
+	return &AuthAuditHandler{
+		auditService: service.NewAuthAuditService(store),
+	}
+}
+
+// ListAuthAudits 运维接口：按SN、时间范围和结果分页查询认证审计记录
+func (h *AuthAuditHandler) ListAuthAudits(c *gin.Context) {
+	tenant, ok := requestTenant(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var query service.AuthAuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "参数绑定错误"))
+		return
+	}
+
+	result, err := h.auditService.ListAuthAudits(tenant, &query)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// CryptoHandler 数据加密处理器
+type CryptoHandler struct {
+	keyRing *utils.RSAKeyRing
+}
+
+// NewCryptoHandler 创建数据加密处理器实例
+func NewCryptoHandler(keyRing *utils.RSAKeyRing) *CryptoHandler {
+	return &CryptoHandler{
+		keyRing: keyRing,
+	}
+}
+
+// GetPublicKey 获取服务器公钥，设备使用该公钥加密AES密钥
+func (h *CryptoHandler) GetPublicKey(c *gin.Context) {
+	if !h.keyRing.Enabled() {
+		response.Error(c, errors.New(errors.ErrEncrypt, "服务器未启用数据加密"))
+		return
+	}
+
+	// 不指定密钥ID时返回当前密钥
+	keyID := c.Query("kid")
+	if keyID == "" {
+		keyID = h.keyRing.ActiveID()
+	}
+
+	publicKey, err := h.keyRing.PublicKeyPEM(keyID)
+	if err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "密钥不存在"))
+		return
+	}
+
+	response.Success(c, gin.H{
+		"kid":        keyID,
+		"public_key": publicKey,
+	})
+}
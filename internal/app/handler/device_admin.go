@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+)
+
+// DeviceAdminHandler 运维设备查询处理器
+type DeviceAdminHandler struct {
+	deviceService *service.DeviceAdminService
+}
+
+// NewDeviceAdminHandler 创建运维设备查询处理器实例
+func NewDeviceAdminHandler(store repository.Store) *DeviceAdminHandler {
+	return &DeviceAdminHandler{
+		deviceService: service.NewDeviceAdminService(store),
+	}
+}
+
+// ListDevices 运维和开放接口：分页查询本组织的设备，平台运维人员可查询全部设备
+func (h *DeviceAdminHandler) ListDevices(c *gin.Context) {
+	tenant, ok := requestTenant(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var query service.DeviceQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "参数绑定错误"))
+		return
+	}
+
+	result, err := h.deviceService.ListDevices(tenant, &query)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// GetDevice 运维和开放接口：查询设备详情
+func (h *DeviceAdminHandler) GetDevice(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	tenant, ok := requestTenant(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	device, err := h.deviceService.GetDevice(tenant, sn)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, device)
+}
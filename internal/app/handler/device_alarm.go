@@ -3,6 +3,7 @@ package handler
 import (
 	"strconv"
 	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
 	"mingda_cloud_service/internal/app/service"
 	"mingda_cloud_service/internal/pkg/constants"
 	"mingda_cloud_service/internal/pkg/response"
@@ -15,9 +16,9 @@ type DeviceAlarmHandler struct {
 }
 
 // NewDeviceAlarmHandler 创建设备告警处理器实例
-func NewDeviceAlarmHandler() *DeviceAlarmHandler {
+func NewDeviceAlarmHandler(store repository.Store) *DeviceAlarmHandler {
 	return &DeviceAlarmHandler{
-		alarmService: service.NewDeviceAlarmService(),
+		alarmService: service.NewDeviceAlarmService(store),
 	}
 }
 
@@ -62,8 +63,14 @@ func (h *DeviceAlarmHandler) ResolveAlarm(c *gin.Context) {
 		return
 	}
 
+	tenant, resolver, ok := alarmResolver(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
 	// 处理请求
-	if err := h.alarmService.ResolveAlarm(alarmID, &req); err != nil {
+	if err := h.alarmService.ResolveAlarm(alarmID, tenant, resolver, &req); err != nil {
 		response.Error(c, err)
 		return
 	}
@@ -80,8 +87,14 @@ func (h *DeviceAlarmHandler) IgnoreAlarm(c *gin.Context) {
 		return
 	}
 
+	tenant, resolver, ok := alarmResolver(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
 	// 处理请求
-	if err := h.alarmService.IgnoreAlarm(alarmID); err != nil {
+	if err := h.alarmService.IgnoreAlarm(alarmID, tenant, resolver); err != nil {
 		response.Error(c, err)
 		return
 	}
@@ -110,11 +123,51 @@ func (h *DeviceAlarmHandler) GetDeviceAlarms(c *gin.Context) {
 	}
 
 	// 获取告警列表
-	alarms, err := h.alarmService.GetDeviceAlarms(deviceSN, status)
+	alarms, err := h.alarmService.GetDeviceAlarms(service.DeviceTenant(deviceSN), status)
 	if err != nil {
 		response.Error(c, err)
 		return
 	}
 
 	response.Success(c, alarms)
-} 
\ No newline at end of file
+}
+
+// ListAlarms 运维和开放接口：分页查询本组织设备的告警，平台运维人员可查询全部设备
+func (h *DeviceAlarmHandler) ListAlarms(c *gin.Context) {
+	tenant, ok := requestTenant(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var query service.AlarmQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "参数绑定错误"))
+		return
+	}
+
+	result, err := h.alarmService.ListAlarms(tenant, &query)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// alarmResolver 获取告警访问范围和处理人
+// 运维人员和API密钥可以处理本组织设备的告警，设备只能处理自己的告警
+func alarmResolver(c *gin.Context) (tenant service.Tenant, resolver string, ok bool) {
+	tenant, ok = requestTenant(c)
+	if !ok {
+		return tenant, "", false
+	}
+
+	if operator, exists := currentOperator(c); exists {
+		return tenant, operator.Username, true
+	}
+	if key, exists := currentAPIKey(c); exists {
+		return tenant, service.AlarmResolverAPIKeyPrefix + key.Prefix, true
+	}
+	return tenant, service.AlarmResolverDevice, true
+}
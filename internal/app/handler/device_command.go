@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// DeviceCommandHandler 设备指令处理器
+type DeviceCommandHandler struct {
+	commandService *service.DeviceCommandService
+}
+
+// NewDeviceCommandHandler 创建设备指令处理器实例
+func NewDeviceCommandHandler(store repository.Store, cfg config.CommandConfig) *DeviceCommandHandler {
+	return &DeviceCommandHandler{
+		commandService: service.NewDeviceCommandService(store, cfg),
+	}
+}
+
+// PollCommands 设备长轮询拉取待执行的指令，wait为最长等待秒数，为0时立即返回
+func (h *DeviceCommandHandler) PollCommands(c *gin.Context) {
+	deviceSN := c.GetString(constants.ContextDeviceSN)
+	if deviceSN == "" {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	wait, err := strconv.Atoi(c.DefaultQuery("wait", "0"))
+	if err != nil || wait < 0 {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "无效的等待时间"))
+		return
+	}
+
+	commands, err := h.commandService.PollCommands(c.Request.Context(), deviceSN, time.Duration(wait)*time.Second)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"commands": commands})
+}
+
+// AckCommand 设备确认收到指令或上报执行结果
+func (h *DeviceCommandHandler) AckCommand(c *gin.Context) {
+	id, ok := commandID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CommandAckRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	deviceSN := c.GetString(constants.ContextDeviceSN)
+	if deviceSN == "" {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	if err := h.commandService.AckCommand(deviceSN, id, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"success": true})
+}
+
+// IssueCommand 运维接口：向设备下发指令
+func (h *DeviceCommandHandler) IssueCommand(c *gin.Context) {
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var req service.IssueCommandRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	command, err := h.commandService.IssueCommand(c.Param("sn"), &req, operator.Username)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, command)
+}
+
+// ListCommands 运维接口：查询设备指令列表
+func (h *DeviceCommandHandler) ListCommands(c *gin.Context) {
+	var query service.CommandQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "参数绑定错误"))
+		return
+	}
+
+	result, err := h.commandService.ListCommands(c.Param("sn"), &query)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// GetCommand 运维接口：查询指令执行状态
+func (h *DeviceCommandHandler) GetCommand(c *gin.Context) {
+	id, ok := commandID(c)
+	if !ok {
+		return
+	}
+
+	command, err := h.commandService.GetCommand(c.Param("sn"), id)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, command)
+}
+
+// commandID 解析路径中的指令ID，解析失败时直接返回错误响应
+func commandID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "无效的指令ID"))
+		return 0, false
+	}
+	return uint(id), true
+}
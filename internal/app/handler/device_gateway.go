@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+const (
+	gatewayWriteTimeout = 10 * time.Second // 单条消息写入超时
+	gatewaySendBuffer   = 16               // 待发送应答的缓冲数
+)
+
+// gatewayUpgrader 设备客户端不是浏览器，不校验Origin
+var gatewayUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// DeviceGatewayHandler 设备长连接处理器
+type DeviceGatewayHandler struct {
+	gatewayService    *service.DeviceGatewayService
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+	redeliverAfter    time.Duration
+	maxMessageSize    int64
+}
+
+// NewDeviceGatewayHandler 创建设备长连接处理器实例
+func NewDeviceGatewayHandler(store repository.Store, cfg config.GatewayConfig, commandCfg config.CommandConfig) *DeviceGatewayHandler {
+	return &DeviceGatewayHandler{
+		gatewayService:    service.NewDeviceGatewayService(store, cfg, commandCfg),
+		heartbeatInterval: time.Duration(cfg.HeartbeatInterval) * time.Second,
+		heartbeatTimeout:  time.Duration(cfg.HeartbeatTimeout) * time.Second,
+		redeliverAfter:    time.Duration(commandCfg.RedeliverAfter) * time.Second,
+		maxMessageSize:    cfg.MaxMessageSize,
+	}
+}
+
+// Connect 设备建立WebSocket长连接，使用设备访问令牌认证
+// 连接在访问令牌过期时关闭，设备刷新令牌后重新连接
+// 设备被停用或令牌被注销、撤销时以策略违规关闭，令牌在刷新在线记录时重新检查
+func (h *DeviceGatewayHandler) Connect(c *gin.Context) {
+	deviceSN := c.GetString(constants.ContextDeviceSN)
+	token := c.GetString(constants.ContextToken)
+	value, ok := c.Get(constants.ContextTokenClaims)
+	if deviceSN == "" || token == "" || !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+	claims := value.(*utils.Claims)
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+
+	conn, err := gatewayUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade失败时已写入HTTP错误响应
+		return
+	}
+	defer conn.Close()
+
+	session, err := h.gatewayService.Connect(deviceSN, claims, token)
+	if err != nil {
+		logger.Log.Error("device gateway connect failed", zap.String("device_sn", deviceSN), zap.Error(err))
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "connect failed"),
+			time.Now().Add(gatewayWriteTimeout))
+		return
+	}
+	defer h.gatewayService.Disconnect(session)
+
+	send := make(chan *service.GatewayMessage, gatewaySendBuffer)
+	go h.writeLoop(conn, session, send, expiresAt)
+	h.readLoop(conn, session, send)
+}
+
+// GetConnection 运维接口：查询设备长连接所在节点
+func (h *DeviceGatewayHandler) GetConnection(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	presence, err := h.gatewayService.GetPresence(sn)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, presence)
+}
+
+// readLoop 读取设备消息并将应答交给写协程，超过心跳超时时间未收到消息时断开
+func (h *DeviceGatewayHandler) readLoop(conn *websocket.Conn, session *service.GatewaySession, send chan<- *service.GatewayMessage) {
+	defer session.Close("closed")
+
+	conn.SetReadLimit(h.maxMessageSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(h.heartbeatTimeout))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				session.Close(service.GatewayCloseHeartbeatTimeout)
+			}
+			return
+		}
+
+		var reply *service.GatewayMessage
+		var msg service.GatewayMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			reply = service.GatewayReply("", errors.New(errors.ErrInvalidParams, "消息格式错误"))
+		} else {
+			// 被新连接替换或令牌失效时会话已关闭，其他错误只记录日志，不影响消息处理
+			if err := h.gatewayService.Touch(session); err != nil {
+				select {
+				case <-session.Done():
+					return
+				default:
+					logger.Log.Warn("refresh device presence failed", zap.String("device_sn", session.DeviceSN), zap.Error(err))
+				}
+			}
+			reply = h.gatewayService.HandleMessage(session, &msg)
+		}
+
+		select {
+		case send <- reply:
+		case <-session.Done():
+			return
+		}
+	}
+}
+
+// writeLoop 连接上唯一的写协程，发送应答和指令，会话关闭时发送关闭帧
+func (h *DeviceGatewayHandler) writeLoop(conn *websocket.Conn, session *service.GatewaySession, send <-chan *service.GatewayMessage, expiresAt time.Time) {
+	defer conn.Close()
+
+	write := func(msg *service.GatewayMessage) bool {
+		conn.SetWriteDeadline(time.Now().Add(gatewayWriteTimeout))
+		if err := conn.WriteJSON(msg); err != nil {
+			session.Close("write_error")
+			return false
+		}
+		return true
+	}
+	pushCommands := func() bool {
+		commands, err := h.gatewayService.PendingCommands(session)
+		if err != nil {
+			logger.Log.Error("load pending commands failed", zap.String("device_sn", session.DeviceSN), zap.Error(err))
+			return true
+		}
+		for i := range commands {
+			data, _ := json.Marshal(&commands[i])
+			if !write(&service.GatewayMessage{Type: service.GatewayMsgCommand, Data: data}) {
+				return false
+			}
+		}
+		return true
+	}
+
+	welcome, _ := json.Marshal(gin.H{
+		"conn_id":            session.ConnID,
+		"heartbeat_interval": int(h.heartbeatInterval.Seconds()),
+		"heartbeat_timeout":  int(h.heartbeatTimeout.Seconds()),
+	})
+	if !write(&service.GatewayMessage{Type: service.GatewayMsgWelcome, Data: welcome}) || !pushCommands() {
+		return
+	}
+
+	expiry := time.NewTimer(time.Until(expiresAt))
+	defer expiry.Stop()
+	// 已推送但设备未确认的指令到期后重新推送
+	redeliver := time.NewTicker(h.redeliverAfter)
+	defer redeliver.Stop()
+
+	for {
+		select {
+		case msg := <-send:
+			if !write(msg) {
+				return
+			}
+		case <-session.Commands:
+			if !pushCommands() {
+				return
+			}
+		case <-redeliver.C:
+			if !pushCommands() {
+				return
+			}
+		case <-expiry.C:
+			session.Close(service.GatewayCloseTokenExpired)
+		case <-session.Kicked:
+			session.Close(service.GatewayCloseRevoked)
+		case <-session.Done():
+			code := websocket.CloseNormalClosure
+			if session.CloseReason() == service.GatewayCloseRevoked {
+				code = websocket.ClosePolicyViolation
+			}
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(code, session.CloseReason()),
+				time.Now().Add(gatewayWriteTimeout))
+			return
+		}
+	}
+}
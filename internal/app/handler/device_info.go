@@ -2,8 +2,10 @@ package handler
 
 import (
 	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
 	"mingda_cloud_service/internal/app/service"
 	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
 	"mingda_cloud_service/internal/pkg/response"
 )
 
@@ -13,9 +15,9 @@ type DeviceInfoHandler struct {
 }
 
 // NewDeviceInfoHandler 创建设备信息处理器实例
-func NewDeviceInfoHandler() *DeviceInfoHandler {
+func NewDeviceInfoHandler(store repository.Store) *DeviceInfoHandler {
 	return &DeviceInfoHandler{
-		deviceInfoService: service.NewDeviceInfoService(),
+		deviceInfoService: service.NewDeviceInfoService(store),
 	}
 }
 
@@ -41,4 +43,27 @@ func (h *DeviceInfoHandler) ReportDeviceInfo(c *gin.Context) {
 	}
 
 	response.Success(c, gin.H{"success": true})
-} 
\ No newline at end of file
+}
+
+// GetVersionTimeline 运维接口：查询设备当前软件版本和版本变更时间线
+func (h *DeviceInfoHandler) GetVersionTimeline(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	var query service.VersionTimelineQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "参数绑定错误"))
+		return
+	}
+
+	timeline, err := h.deviceInfoService.GetVersionTimeline(sn, &query)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, timeline)
+}
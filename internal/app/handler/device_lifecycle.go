@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// DeviceLifecycleHandler 设备生命周期处理器
+type DeviceLifecycleHandler struct {
+	lifecycleService *service.DeviceLifecycleService
+}
+
+// NewDeviceLifecycleHandler 创建设备生命周期处理器实例
+func NewDeviceLifecycleHandler(store repository.Store) *DeviceLifecycleHandler {
+	return &DeviceLifecycleHandler{
+		lifecycleService: service.NewDeviceLifecycleService(store),
+	}
+}
+
+// ChangeStateRequest 设备状态变更请求
+type ChangeStateRequest struct {
+	Status *int   `json:"status" binding:"required,min=0,max=4"` // 目标状态
+	Reason string `json:"reason" binding:"required,max=255"`     // 变更原因
+}
+
+// ChangeState 运维接口：变更设备生命周期状态
+func (h *DeviceLifecycleHandler) ChangeState(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var req ChangeStateRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	history, err := h.lifecycleService.ChangeState(sn, *req.Status, req.Reason, operator.Username)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, history)
+}
+
+// GetStateHistory 运维接口：查询设备状态变更历史
+func (h *DeviceLifecycleHandler) GetStateHistory(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	histories, err := h.lifecycleService.GetStateHistory(sn)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, histories)
+}
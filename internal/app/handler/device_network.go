@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+)
+
+// DeviceNetworkHandler 设备网络信息处理器
+type DeviceNetworkHandler struct {
+	networkService *service.DeviceNetworkService
+}
+
+// NewDeviceNetworkHandler 创建设备网络信息处理器实例
+func NewDeviceNetworkHandler(store repository.Store) *DeviceNetworkHandler {
+	return &DeviceNetworkHandler{
+		networkService: service.NewDeviceNetworkService(store),
+	}
+}
+
+// ReportDeviceNetwork 处理设备网络信息上报请求
+func (h *DeviceNetworkHandler) ReportDeviceNetwork(c *gin.Context) {
+	var req service.DeviceNetworkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "参数绑定错误"))
+		return
+	}
+
+	// 从上下文获取设备SN
+	deviceSN := c.GetString(constants.ContextDeviceSN)
+	if deviceSN == "" {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	if err := h.networkService.ReportDeviceNetwork(deviceSN, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"success": true})
+}
+
+// GetNetworkHistory 运维接口：查询设备网络信息和信号强度变化
+func (h *DeviceNetworkHandler) GetNetworkHistory(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	var query service.NetworkHistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "参数绑定错误"))
+		return
+	}
+
+	history, err := h.networkService.GetNetworkHistory(sn, &query)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, history)
+}
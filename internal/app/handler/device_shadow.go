@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// DeviceShadowHandler 设备影子处理器
+type DeviceShadowHandler struct {
+	shadowService *service.DeviceShadowService
+}
+
+// NewDeviceShadowHandler 创建设备影子处理器实例
+func NewDeviceShadowHandler(store repository.Store) *DeviceShadowHandler {
+	return &DeviceShadowHandler{
+		shadowService: service.NewDeviceShadowService(store),
+	}
+}
+
+// GetDelta 设备查询自指定版本以来需要应用的配置差异
+func (h *DeviceShadowHandler) GetDelta(c *gin.Context) {
+	deviceSN := c.GetString(constants.ContextDeviceSN)
+	if deviceSN == "" {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var version int64
+	if v := c.Query("version"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 0 {
+			response.Error(c, errors.New(errors.ErrInvalidParams, "无效的版本号"))
+			return
+		}
+		version = parsed
+	}
+
+	delta, err := h.shadowService.GetDelta(deviceSN, version)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, delta)
+}
+
+// ReportState 设备上报当前配置
+func (h *DeviceShadowHandler) ReportState(c *gin.Context) {
+	var req service.ShadowReportRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	deviceSN := c.GetString(constants.ContextDeviceSN)
+	if deviceSN == "" {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	delta, err := h.shadowService.ReportState(deviceSN, &req)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, delta)
+}
+
+// GetShadow 运维接口：查询设备影子
+func (h *DeviceShadowHandler) GetShadow(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	shadow, err := h.shadowService.GetShadow(sn)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, shadow)
+}
+
+// UpdateDesired 运维接口：修改设备期望配置
+func (h *DeviceShadowHandler) UpdateDesired(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	var req service.ShadowDesiredRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	shadow, err := h.shadowService.UpdateDesired(sn, &req)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, shadow)
+}
+
+// UpdateDesiredBatch 运维接口：按SN列表、型号或组织批量修改设备期望配置
+func (h *DeviceShadowHandler) UpdateDesiredBatch(c *gin.Context) {
+	tenant, ok := requestTenant(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var req service.ShadowBatchDesiredRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	affected, err := h.shadowService.UpdateDesiredBatch(tenant, &req)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"affected": affected})
+}
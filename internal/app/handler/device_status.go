@@ -2,6 +2,7 @@ package handler
 
 import (
 	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
 	"mingda_cloud_service/internal/app/service"
 	"mingda_cloud_service/internal/pkg/constants"
 	"mingda_cloud_service/internal/pkg/response"
@@ -14,9 +15,9 @@ type DeviceStatusHandler struct {
 }
 
 // NewDeviceStatusHandler 创建设备状态处理器实例
-func NewDeviceStatusHandler() *DeviceStatusHandler {
+func NewDeviceStatusHandler(store repository.Store) *DeviceStatusHandler {
 	return &DeviceStatusHandler{
-		statusService: service.NewDeviceStatusService(),
+		statusService: service.NewDeviceStatusService(store),
 	}
 }
 
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// LockoutHandler 认证锁定管理处理器
+type LockoutHandler struct {
+	lockoutService *service.LockoutService
+}
+
+// NewLockoutHandler 创建认证锁定管理处理器实例
+func NewLockoutHandler(store repository.Store, authCfg config.AuthConfig) *LockoutHandler {
+	return &LockoutHandler{
+		lockoutService: service.NewLockoutService(store, authCfg),
+	}
+}
+
+// ClearLockoutRequest 解除锁定请求
+type ClearLockoutRequest struct {
+	Scope string `json:"scope" binding:"required,oneof=sn ip"` // 锁定维度：sn/ip
+	Value string `json:"value" binding:"required"`             // 设备SN或客户端IP
+}
+
+// ListLockouts 查询当前全部认证锁定
+func (h *LockoutHandler) ListLockouts(c *gin.Context) {
+	lockouts, err := h.lockoutService.ListLockouts()
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, lockouts)
+}
+
+// ClearLockout 解除认证锁定
+func (h *LockoutHandler) ClearLockout(c *gin.Context) {
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var req ClearLockoutRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	if err := h.lockoutService.ClearLockout(req.Scope, req.Value, operator.Username); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"success": true})
+}
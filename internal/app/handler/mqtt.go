@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// HeaderMQTTAuthSecret Broker调用认证接口时携带的密钥
+const HeaderMQTTAuthSecret = "X-MQTT-Auth-Secret"
+
+// MQTTHandler Broker认证回调处理器
+// 结果按Broker的HTTP认证格式直接返回，不使用统一响应结构
+type MQTTHandler struct {
+	authService *service.MQTTAuthService
+	authSecret  string
+}
+
+// NewMQTTHandler 创建Broker认证回调处理器实例
+func NewMQTTHandler(store repository.Store, jwtSecret string, cipher *utils.SecretCipher, authCfg config.AuthConfig, cfg config.MQTTConfig) *MQTTHandler {
+	return &MQTTHandler{
+		authService: service.NewMQTTAuthService(store, jwtSecret, cipher, authCfg, cfg),
+		authSecret:  cfg.AuthSecret,
+	}
+}
+
+// Authenticate 设备连接Broker时的认证回调
+func (h *MQTTHandler) Authenticate(c *gin.Context) {
+	var req service.MQTTAuthRequest
+	if !h.checkSecret(c) || c.ShouldBindJSON(&req) != nil {
+		c.JSON(http.StatusOK, &service.MQTTAuthResult{Result: service.MQTTResultDeny})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.authService.Authenticate(&req))
+}
+
+// Authorize 设备发布或订阅主题时的权限回调
+func (h *MQTTHandler) Authorize(c *gin.Context) {
+	var req service.MQTTACLRequest
+	if !h.checkSecret(c) || c.ShouldBindJSON(&req) != nil {
+		c.JSON(http.StatusOK, &service.MQTTAuthResult{Result: service.MQTTResultDeny})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.authService.Authorize(&req))
+}
+
+// checkSecret 校验调用方是否为Broker，未配置密钥时拒绝全部请求
+func (h *MQTTHandler) checkSecret(c *gin.Context) bool {
+	if h.authSecret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.GetHeader(HeaderMQTTAuthSecret)), []byte(h.authSecret)) == 1
+}
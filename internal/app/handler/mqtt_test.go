@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+)
+
+// serveMQTT 以指定密钥请求Broker回调接口，返回回调结果
+func serveMQTT(t *testing.T, authSecret, path, secret, body string) *service.MQTTAuthResult {
+	gin.SetMode(gin.TestMode)
+	h := NewMQTTHandler(nil, "test_jwt_secret", nil, config.AuthConfig{}, config.MQTTConfig{
+		Username:    "mingda_cloud",
+		Password:    "bridge_password",
+		TopicPrefix: "mingda",
+		AuthSecret:  authSecret,
+	})
+	router := gin.New()
+	router.POST("/mqtt/auth", h.Authenticate)
+	router.POST("/mqtt/acl", h.Authorize)
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(HeaderMQTTAuthSecret, secret)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result service.MQTTAuthResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	return &result
+}
+
+func TestMQTTHandler_CheckSecret(t *testing.T) {
+	authBody := `{"username":"mingda_cloud","password":"bridge_password"}`
+	aclBody := `{"username":"mingda_cloud","topic":"mingda/M4D2401A0100013/command","action":"publish"}`
+
+	tests := []struct {
+		name       string
+		authSecret string
+		path       string
+		secret     string
+		body       string
+		result     string
+	}{
+		{"认证密钥正确", "broker_secret", "/mqtt/auth", "broker_secret", authBody, service.MQTTResultAllow},
+		{"权限密钥正确", "broker_secret", "/mqtt/acl", "broker_secret", aclBody, service.MQTTResultAllow},
+		{"认证缺少密钥", "broker_secret", "/mqtt/auth", "", authBody, service.MQTTResultDeny},
+		{"认证密钥错误", "broker_secret", "/mqtt/auth", "wrong_secret", authBody, service.MQTTResultDeny},
+		{"权限缺少密钥", "broker_secret", "/mqtt/acl", "", aclBody, service.MQTTResultDeny},
+		{"权限密钥错误", "broker_secret", "/mqtt/acl", "wrong_secret", aclBody, service.MQTTResultDeny},
+		{"未配置密钥时拒绝认证", "", "/mqtt/auth", "", authBody, service.MQTTResultDeny},
+		{"未配置密钥时拒绝权限", "", "/mqtt/acl", "", aclBody, service.MQTTResultDeny},
+		{"请求体格式错误", "broker_secret", "/mqtt/auth", "broker_secret", `{`, service.MQTTResultDeny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serveMQTT(t, tt.authSecret, tt.path, tt.secret, tt.body)
+			assert.Equal(t, tt.result, result.Result)
+		})
+	}
+}
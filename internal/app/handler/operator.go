@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/utils"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// OperatorHandler 运维账号处理器
+type OperatorHandler struct {
+	operatorService *service.OperatorService
+}
+
+// NewOperatorHandler 创建运维账号处理器实例
+func NewOperatorHandler(store repository.Store, cfg config.OperatorConfig, authCfg config.AuthConfig) *OperatorHandler {
+	return &OperatorHandler{
+		operatorService: service.NewOperatorService(store, cfg, authCfg),
+	}
+}
+
+// OperatorLoginRequest 运维登录请求
+type OperatorLoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Login 运维人员登录
+func (h *OperatorHandler) Login(c *gin.Context) {
+	var req OperatorLoginRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	result, err := h.operatorService.Login(req.Username, req.Password, requestMeta(c))
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Logout 运维人员登出
+func (h *OperatorHandler) Logout(c *gin.Context) {
+	value, _ := c.Get(constants.ContextOperatorClaims)
+	claims, ok := value.(*utils.OperatorClaims)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	if err := h.operatorService.Logout(claims, c.GetString(constants.ContextToken)); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"success": true})
+}
+
+// Profile 当前运维人员信息
+func (h *OperatorHandler) Profile(c *gin.Context) {
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	response.Success(c, operator)
+}
+
+// CreateOperator 创建运维账号
+func (h *OperatorHandler) CreateOperator(c *gin.Context) {
+	var req service.CreateOperatorRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	operator, err := h.operatorService.CreateOperator(&req)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, operator)
+}
+
+// ListOperators 查询运维账号列表
+func (h *OperatorHandler) ListOperators(c *gin.Context) {
+	operators, err := h.operatorService.ListOperators()
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, operators)
+}
+
+// UpdateOperator 更新运维账号
+func (h *OperatorHandler) UpdateOperator(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "无效的账号ID"))
+		return
+	}
+
+	var req service.UpdateOperatorRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	operator, err := h.operatorService.UpdateOperator(uint(id), &req)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, operator)
+}
+
+// currentOperator 获取当前登录的运维人员
+func currentOperator(c *gin.Context) (*model.Operator, bool) {
+	value, exists := c.Get(constants.ContextOperator)
+	if !exists {
+		return nil, false
+	}
+	operator, ok := value.(model.Operator)
+	if !ok {
+		return nil, false
+	}
+	return &operator, true
+}
+
+// currentAPIKey 获取当前请求使用的API密钥
+func currentAPIKey(c *gin.Context) (*model.APIKey, bool) {
+	value, exists := c.Get(constants.ContextAPIKey)
+	if !exists {
+		return nil, false
+	}
+	key, ok := value.(model.APIKey)
+	if !ok {
+		return nil, false
+	}
+	return &key, true
+}
+
+// requestTenant 获取当前请求的数据访问范围
+// 运维人员和API密钥按所属组织限定，设备只能访问自己的数据
+func requestTenant(c *gin.Context) (service.Tenant, bool) {
+	if operator, exists := currentOperator(c); exists {
+		return service.OrganizationTenant(operator.OrganizationID), true
+	}
+	if key, exists := currentAPIKey(c); exists {
+		return service.OrganizationTenant(key.OrganizationID), true
+	}
+
+	deviceSN := c.GetString(constants.ContextDeviceSN)
+	if deviceSN == "" {
+		return service.Tenant{}, false
+	}
+	return service.DeviceTenant(deviceSN), true
+}
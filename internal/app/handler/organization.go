@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// OrganizationHandler 组织与设备归属处理器
+type OrganizationHandler struct {
+	orgService *service.OrganizationService
+}
+
+// NewOrganizationHandler 创建组织处理器实例
+func NewOrganizationHandler(store repository.Store, authCfg config.AuthConfig) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgService: service.NewOrganizationService(store, authCfg),
+	}
+}
+
+// CreateOrganization 运维接口：创建组织
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req service.CreateOrganizationRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	org, err := h.orgService.CreateOrganization(&req)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, org)
+}
+
+// ListOrganizations 运维接口：查询组织列表
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+	orgs, err := h.orgService.ListOrganizations()
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, orgs)
+}
+
+// ClaimDevice 运维接口：使用认领码将设备绑定到当前组织
+func (h *OrganizationHandler) ClaimDevice(c *gin.Context) {
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var req service.ClaimDeviceRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	device, err := h.orgService.ClaimDevice(operator.OrganizationID, &req, operator.Username, requestMeta(c))
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, device)
+}
+
+// TransferDevice 运维接口：将设备转移到其他组织
+func (h *OrganizationHandler) TransferDevice(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var req service.TransferDeviceRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	device, err := h.orgService.TransferDevice(service.OrganizationTenant(operator.OrganizationID), sn, req.OrganizationID, operator.Username)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, device)
+}
+
+// UnbindDevice 运维接口：解除设备绑定，返回新的认领码
+func (h *OrganizationHandler) UnbindDevice(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	result, err := h.orgService.UnbindDevice(service.OrganizationTenant(operator.OrganizationID), sn, operator.Username)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// IssueClaimCode 运维接口：为未绑定的设备重新生成认领码
+func (h *OrganizationHandler) IssueClaimCode(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	result, err := h.orgService.IssueClaimCode(sn)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// GetOwnershipHistory 运维接口：查询设备归属变更历史
+func (h *OrganizationHandler) GetOwnershipHistory(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	histories, err := h.orgService.GetOwnershipHistory(sn)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, histories)
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"crypto/rsa"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/storage"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// OTAHandler 固件和软件升级处理器
+type OTAHandler struct {
+	otaService *service.OTAService
+}
+
+// NewOTAHandler 创建升级处理器实例
+func NewOTAHandler(store repository.Store, objectStorage storage.ObjectStorage, signingKey *rsa.PrivateKey, cfg config.OTAConfig) *OTAHandler {
+	return &OTAHandler{
+		otaService: service.NewOTAService(store, objectStorage, signingKey, cfg),
+	}
+}
+
+// GetPublicKey 获取升级包验签公钥
+func (h *OTAHandler) GetPublicKey(c *gin.Context) {
+	keyID, publicKey, err := h.otaService.PublicKeyPEM()
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{
+		"kid":        keyID,
+		"public_key": publicKey,
+	})
+}
+
+// CheckUpdate 设备检查可用升级
+func (h *OTAHandler) CheckUpdate(c *gin.Context) {
+	deviceSN := c.GetString(constants.ContextDeviceSN)
+	if deviceSN == "" {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	result, err := h.otaService.CheckUpdate(deviceSN, c.Query("component"))
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// ReportProgress 设备上报升级进度和结果
+func (h *OTAHandler) ReportProgress(c *gin.Context) {
+	var req service.OTAProgressRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	deviceSN := c.GetString(constants.ContextDeviceSN)
+	if deviceSN == "" {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	if err := h.otaService.ReportProgress(deviceSN, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"success": true})
+}
+
+// UploadPackage 运维接口：上传升级包
+func (h *OTAHandler) UploadPackage(c *gin.Context) {
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var req service.UploadOTAPackageRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "获取上传文件失败"))
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "打开上传文件失败"))
+		return
+	}
+	defer src.Close()
+
+	pkg, err := h.otaService.UploadPackage(&req, src, file.Filename, file.Size, operator.Username)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, pkg)
+}
+
+// ListPackages 运维接口：查询升级包列表
+func (h *OTAHandler) ListPackages(c *gin.Context) {
+	var query service.OTAPackageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "参数绑定错误"))
+		return
+	}
+
+	result, err := h.otaService.ListPackages(&query)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// GetPackage 运维接口：查询升级包详情
+func (h *OTAHandler) GetPackage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "无效的升级包ID"))
+		return
+	}
+
+	pkg, err := h.otaService.GetPackage(uint(id))
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, pkg)
+}
+
+// UpdatePackage 运维接口：修改升级包适用范围或发布状态
+func (h *OTAHandler) UpdatePackage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "无效的升级包ID"))
+		return
+	}
+
+	var req service.UpdateOTAPackageRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	pkg, err := h.otaService.UpdatePackage(uint(id), &req)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, pkg)
+}
+
+// ListDeviceUpdates 运维接口：查询设备升级记录
+func (h *OTAHandler) ListDeviceUpdates(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	updates, err := h.otaService.ListDeviceUpdates(sn)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, updates)
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// OTACampaignHandler 分阶段升级活动处理器
+type OTACampaignHandler struct {
+	campaignService *service.OTACampaignService
+}
+
+// NewOTACampaignHandler 创建分阶段升级活动处理器实例
+func NewOTACampaignHandler(store repository.Store) *OTACampaignHandler {
+	return &OTACampaignHandler{
+		campaignService: service.NewOTACampaignService(store),
+	}
+}
+
+// CreateCampaign 运维接口：创建升级活动
+func (h *OTACampaignHandler) CreateCampaign(c *gin.Context) {
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	var req service.CreateOTACampaignRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	campaign, err := h.campaignService.CreateCampaign(&req, operator.Username)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, campaign)
+}
+
+// ListCampaigns 运维接口：查询升级活动列表
+func (h *OTACampaignHandler) ListCampaigns(c *gin.Context) {
+	var query service.OTACampaignQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "参数绑定错误"))
+		return
+	}
+
+	result, err := h.campaignService.ListCampaigns(&query)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// GetCampaign 运维接口：查询升级活动详情和各阶段统计
+func (h *OTACampaignHandler) GetCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	detail, err := h.campaignService.GetCampaign(id)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, detail)
+}
+
+// StartCampaign 运维接口：开始升级活动
+func (h *OTACampaignHandler) StartCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	campaign, err := h.campaignService.StartCampaign(id)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, campaign)
+}
+
+// PauseCampaign 运维接口：暂停升级活动
+func (h *OTACampaignHandler) PauseCampaign(c *gin.Context) {
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	campaign, err := h.campaignService.PauseCampaign(id, operator.Username)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, campaign)
+}
+
+// ResumeCampaign 运维接口：恢复已暂停的升级活动
+func (h *OTACampaignHandler) ResumeCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	campaign, err := h.campaignService.ResumeCampaign(id)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, campaign)
+}
+
+// AbortCampaign 运维接口：终止升级活动
+func (h *OTACampaignHandler) AbortCampaign(c *gin.Context) {
+	operator, ok := currentOperator(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	campaign, err := h.campaignService.AbortCampaign(id, operator.Username)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, campaign)
+}
+
+// campaignID 解析路径中的升级活动ID，解析失败时直接返回错误响应
+func campaignID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "无效的升级活动ID"))
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -5,7 +5,7 @@ import (
     "mingda_cloud_service/internal/pkg/errors"
     "mingda_cloud_service/internal/pkg/response"
     "github.com/gin-gonic/gin"
-    "gorm.io/gorm"
+    "mingda_cloud_service/internal/app/repository"
     "mingda_cloud_service/internal/pkg/config"
 	"mingda_cloud_service/internal/pkg/constants"
 )
@@ -16,9 +16,9 @@ type PrintImageHandler struct {
 }
 
 // NewPrintImageHandler 创建打印图片处理器
-func NewPrintImageHandler(db *gorm.DB, cfg *config.Config) *PrintImageHandler {
+func NewPrintImageHandler(store repository.Store, cfg *config.Config) *PrintImageHandler {
     return &PrintImageHandler{
-        imageService: service.NewPrintImageService(db, cfg),
+        imageService: service.NewPrintImageService(store, cfg),
     }
 }
 
@@ -67,11 +67,34 @@ func (h *PrintImageHandler) GetPrintImages(c *gin.Context) {
     taskID := c.Query("task_id")
 
     // 获取图片列表
-    images, err := h.imageService.GetPrintImages(deviceSN, taskID)
+    images, err := h.imageService.GetPrintImages(service.DeviceTenant(deviceSN), taskID)
     if err != nil {
         response.Error(c, err)
         return
     }
 
     response.Success(c, images)
-} 
\ No newline at end of file
+} 
+
+// ListPrintImages 运维和开放接口：查询指定设备的打印图片
+func (h *PrintImageHandler) ListPrintImages(c *gin.Context) {
+    tenant, ok := requestTenant(c)
+    if !ok {
+        response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+        return
+    }
+
+    deviceSN := c.Query("device_sn")
+    if deviceSN == "" {
+        response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+        return
+    }
+
+    images, err := h.imageService.GetPrintImages(tenant.WithDevice(deviceSN), c.Query("task_id"))
+    if err != nil {
+        response.Error(c, err)
+        return
+    }
+
+    response.Success(c, images)
+}
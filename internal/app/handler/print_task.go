@@ -2,6 +2,7 @@ package handler
 
 import (
 	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
 	"mingda_cloud_service/internal/app/service"
 	"mingda_cloud_service/internal/pkg/constants"
 	"mingda_cloud_service/internal/pkg/response"
@@ -14,9 +15,9 @@ type PrintTaskHandler struct {
 }
 
 // NewPrintTaskHandler 创建打印任务处理器实例
-func NewPrintTaskHandler() *PrintTaskHandler {
+func NewPrintTaskHandler(store repository.Store) *PrintTaskHandler {
 	return &PrintTaskHandler{
-		printTaskService: service.NewPrintTaskService(),
+		printTaskService: service.NewPrintTaskService(store),
 	}
 }
 
@@ -58,7 +59,7 @@ func (h *PrintTaskHandler) GetDevicePrintTasks(c *gin.Context) {
 	status := c.Query("status")
 
 	// 3. 查询打印任务列表
-	tasks, err := h.printTaskService.GetDevicePrintTasks(deviceSN, status)
+	tasks, err := h.printTaskService.GetDevicePrintTasks(service.DeviceTenant(deviceSN), status)
 	if err != nil {
 		response.Error(c, err)
 		return
@@ -68,20 +69,51 @@ func (h *PrintTaskHandler) GetDevicePrintTasks(c *gin.Context) {
 }
 
 // GetTaskHistory 获取任务状态变更历史
+// 设备只能查询自己的任务，运维人员只能查询本组织设备的任务
 func (h *PrintTaskHandler) GetTaskHistory(c *gin.Context) {
-	// 1. 获取任务ID
+	// 1. 获取访问范围
+	tenant, ok := requestTenant(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	// 2. 获取任务ID
 	taskID := c.Param("task_id")
 	if taskID == "" {
 		response.Error(c, errors.New(errors.ErrInvalidParams, "未提供任务ID"))
 		return
 	}
 
-	// 2. 查询任务历史
-	history, err := h.printTaskService.GetTaskHistory(taskID)
+	// 3. 查询任务历史
+	history, err := h.printTaskService.GetTaskHistory(tenant, taskID)
 	if err != nil {
 		response.Error(c, err)
 		return
 	}
 
 	response.Success(c, history)
-} 
\ No newline at end of file
+} 
+
+// ListPrintTasks 运维和开放接口：查询指定设备的打印任务
+func (h *PrintTaskHandler) ListPrintTasks(c *gin.Context) {
+	tenant, ok := requestTenant(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	deviceSN := c.Query("device_sn")
+	if deviceSN == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	tasks, err := h.printTaskService.GetDevicePrintTasks(tenant.WithDevice(deviceSN), c.Query("status"))
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, tasks)
+}
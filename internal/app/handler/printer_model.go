@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// PrinterModelHandler 打印机机型管理处理器
+type PrinterModelHandler struct {
+	modelService *service.PrinterModelService
+}
+
+// NewPrinterModelHandler 创建机型管理处理器实例
+func NewPrinterModelHandler(store repository.Store) *PrinterModelHandler {
+	return &PrinterModelHandler{
+		modelService: service.NewPrinterModelService(store),
+	}
+}
+
+// CreatePrinterModel 运维接口：登记新机型
+func (h *PrinterModelHandler) CreatePrinterModel(c *gin.Context) {
+	var req service.CreatePrinterModelRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	m, err := h.modelService.CreatePrinterModel(&req)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, m)
+}
+
+// ListPrinterModels 运维接口：查询机型列表
+func (h *PrinterModelHandler) ListPrinterModels(c *gin.Context) {
+	list, err := h.modelService.ListPrinterModels()
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, list)
+}
+
+// GetPrinterModel 运维接口：查询机型详情
+func (h *PrinterModelHandler) GetPrinterModel(c *gin.Context) {
+	code := c.Param("code")
+	if code == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "机型代码不能为空"))
+		return
+	}
+
+	m, err := h.modelService.GetPrinterModel(code)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, m)
+}
+
+// UpdatePrinterModel 运维接口：更新机型信息
+func (h *PrinterModelHandler) UpdatePrinterModel(c *gin.Context) {
+	code := c.Param("code")
+	if code == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "机型代码不能为空"))
+		return
+	}
+
+	var req service.UpdatePrinterModelRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	m, err := h.modelService.UpdatePrinterModel(code, &req)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, m)
+}
+
+// DeletePrinterModel 运维接口：删除未使用的机型
+func (h *PrinterModelHandler) DeletePrinterModel(c *gin.Context) {
+	code := c.Param("code")
+	if code == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "机型代码不能为空"))
+		return
+	}
+
+	if err := h.modelService.DeletePrinterModel(code); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"success": true})
+}
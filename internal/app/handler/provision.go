@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// ProvisionHandler 出厂预置处理器
+type ProvisionHandler struct {
+	provisionService *service.ProvisionService
+}
+
+// NewProvisionHandler 创建出厂预置处理器实例
+func NewProvisionHandler(store repository.Store, manifestKey string, cipher *utils.SecretCipher) *ProvisionHandler {
+	return &ProvisionHandler{
+		provisionService: service.NewProvisionService(store, manifestKey, cipher),
+	}
+}
+
+// Import 导入出厂预置数据
+// 支持直接提交签名JSON清单，或通过file字段上传CSV文件(需同时提供batch_no)或JSON清单文件
+func (h *ProvisionHandler) Import(c *gin.Context) {
+	var (
+		data    []byte
+		isCSV   bool
+		batchNo = c.PostForm("batch_no")
+		readErr error
+	)
+
+	if strings.Contains(c.ContentType(), "json") {
+		data, readErr = io.ReadAll(c.Request.Body)
+	} else {
+		file, err := c.FormFile("file")
+		if err != nil {
+			response.Error(c, errors.New(errors.ErrInvalidParams, "获取上传文件失败"))
+			return
+		}
+		isCSV = strings.ToLower(filepath.Ext(file.Filename)) == ".csv"
+
+		src, err := file.Open()
+		if err != nil {
+			response.Error(c, errors.New(errors.ErrInvalidParams, "打开上传文件失败"))
+			return
+		}
+		defer src.Close()
+		data, readErr = io.ReadAll(src)
+	}
+	if readErr != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "读取导入数据失败"))
+		return
+	}
+
+	var records []service.ProvisionRecord
+	if isCSV {
+		if batchNo == "" {
+			response.Error(c, errors.New(errors.ErrInvalidParams, "批次号不能为空"))
+			return
+		}
+		parsed, err := h.provisionService.ParseCSV(strings.NewReader(string(data)))
+		if err != nil {
+			response.Error(c, err)
+			return
+		}
+		records = parsed
+	} else {
+		manifest, err := h.provisionService.ParseManifest(data)
+		if err != nil {
+			response.Error(c, err)
+			return
+		}
+		batchNo = manifest.BatchNo
+		records = manifest.Devices
+	}
+
+	result, err := h.provisionService.Import(batchNo, records)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// GetProvision 查询设备出厂预置信息
+func (h *ProvisionHandler) GetProvision(c *gin.Context) {
+	provision, err := h.provisionService.GetProvision(c.Param("sn"))
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, provision)
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+	"mingda_cloud_service/internal/pkg/utils"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// SecretHandler 设备密钥处理器
+type SecretHandler struct {
+	secretService *service.SecretService
+}
+
+// NewSecretHandler 创建设备密钥处理器实例
+func NewSecretHandler(store repository.Store, cipher *utils.SecretCipher, authCfg config.AuthConfig) *SecretHandler {
+	return &SecretHandler{
+		secretService: service.NewSecretService(store, cipher, authCfg),
+	}
+}
+
+// RequireRotationRequest 按型号要求轮换密钥请求
+type RequireRotationRequest struct {
+	Model string `json:"model" binding:"required"` // 设备型号
+}
+
+// RotateSecret 设备申请轮换密钥
+func (h *SecretHandler) RotateSecret(c *gin.Context) {
+	deviceID := c.GetUint(constants.ContextDeviceID)
+	if deviceID == 0 {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return
+	}
+
+	rotation, err := h.secretService.RotateSecret(deviceID)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, rotation)
+}
+
+// RequireRotation 运维接口：要求指定设备轮换密钥
+func (h *SecretHandler) RequireRotation(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	if err := h.secretService.RequireRotation(sn); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"success": true})
+}
+
+// RequireRotationByModel 运维接口：要求指定型号的全部设备轮换密钥
+func (h *SecretHandler) RequireRotationByModel(c *gin.Context) {
+	var req RequireRotationRequest
+	if err := validator.BindAndValid(c, &req); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	affected, err := h.secretService.RequireRotationByModel(req.Model)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"affected": affected})
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+)
+
+// SessionHandler 设备会话管理处理器
+type SessionHandler struct {
+	sessionService *service.SessionService
+}
+
+// NewSessionHandler 创建设备会话管理处理器实例
+func NewSessionHandler(store repository.Store) *SessionHandler {
+	return &SessionHandler{
+		sessionService: service.NewSessionService(store),
+	}
+}
+
+// ListSessions 运维接口：查询设备当前有效的会话
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	sn := c.Param("sn")
+	if sn == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN不能为空"))
+		return
+	}
+
+	sessions, err := h.sessionService.ListSessions(sn)
+	if err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, sessions)
+}
+
+// RevokeSession 运维接口：撤销设备的指定会话
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	sn := c.Param("sn")
+	familyID := c.Param("family_id")
+	if sn == "" || familyID == "" {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "设备SN和会话ID不能为空"))
+		return
+	}
+
+	if err := h.sessionService.RevokeSession(sn, familyID); err != nil {
+		response.Error(c, err)
+		return
+	}
+
+	response.Success(c, gin.H{"success": true})
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/app/service"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/response"
+)
+
+// VersionReportHandler 软件版本分布统计处理器
+type VersionReportHandler struct {
+	reportService *service.VersionReportService
+}
+
+// NewVersionReportHandler 创建软件版本分布统计处理器实例
+func NewVersionReportHandler(store repository.Store) *VersionReportHandler {
+	return &VersionReportHandler{
+		reportService: service.NewVersionReportService(store),
+	}
+}
+
+// GetVersionDistribution 运维接口：按机型统计各组件版本的设备数
+func (h *VersionReportHandler) GetVersionDistribution(c *gin.Context) {
+	report, ok := h.buildReport(c)
+	if !ok {
+		return
+	}
+
+	response.Success(c, report)
+}
+
+// ExportVersionDistribution 运维接口：导出版本分布统计CSV
+func (h *VersionReportHandler) ExportVersionDistribution(c *gin.Context) {
+	report, ok := h.buildReport(c)
+	if !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("version_distribution_%s.csv", report.GeneratedAt.Format("20060102150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := service.WriteVersionReportCSV(c.Writer, report); err != nil {
+		c.Error(err)
+	}
+}
+
+// buildReport 解析访问范围和统计条件并生成统计结果，失败时已写入错误响应
+func (h *VersionReportHandler) buildReport(c *gin.Context) (*service.VersionReport, bool) {
+	tenant, ok := requestTenant(c)
+	if !ok {
+		response.Error(c, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+		return nil, false
+	}
+
+	var query service.VersionReportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "参数绑定错误"))
+		return nil, false
+	}
+	if query.ReportAfter != nil && query.ReportBefore != nil && !query.ReportAfter.Before(*query.ReportBefore) {
+		response.Error(c, errors.New(errors.ErrInvalidParams, "开始时间必须早于结束时间"))
+		return nil, false
+	}
+
+	report, err := h.reportService.GetVersionDistribution(tenant, &query)
+	if err != nil {
+		response.Error(c, err)
+		return nil, false
+	}
+	return report, true
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey 第三方系统(MES、BI等)使用的API密钥
+// 密钥格式为 mdk_<前缀>_<密文>，数据库只保存前缀和完整密钥的摘要
+type APIKey struct {
+	gorm.Model
+	Name           string     `gorm:"type:varchar(64);not null" json:"name"`               // 密钥名称
+	Prefix         string     `gorm:"type:varchar(16);uniqueIndex;not null" json:"prefix"` // 密钥前缀，用于识别密钥
+	KeyHash        string     `gorm:"type:varchar(64);not null" json:"-"`                  // 完整密钥的SHA-256摘要
+	Scopes         string     `gorm:"type:varchar(255);not null" json:"scopes"`            // 授权范围，逗号分隔
+	AllowedIPs     string     `gorm:"type:varchar(512)" json:"allowed_ips"`                // 允许的来源IP或CIDR，逗号分隔，为空不限制
+	OrganizationID *uint      `gorm:"index" json:"organization_id"`                        // 所属组织，为空表示平台密钥
+	ExpiresAt      *time.Time `gorm:"type:datetime" json:"expires_at"`                     // 过期时间，为空表示永不过期
+	LastUsedAt     *time.Time `gorm:"type:datetime" json:"last_used_at"`                   // 最后使用时间
+	LastUsedIP     string     `gorm:"type:varchar(64)" json:"last_used_ip"`                // 最后使用的来源IP
+	RevokedAt      *time.Time `gorm:"type:datetime" json:"revoked_at"`                     // 撤销时间
+	CreatedBy      string     `gorm:"type:varchar(64)" json:"created_by"`                  // 创建人
+}
+
+// TableName 指定表名
+func (APIKey) TableName() string {
+	return "md_api_keys"
+}
+
+// APIKeyPrefix API密钥固定前缀
+const APIKeyPrefix = "mdk_"
+
+// API密钥授权范围
+const (
+	ScopeDevicesRead = "devices:read" // 查看设备
+	ScopeTasksRead   = "tasks:read"   // 查看打印任务和打印图片
+	ScopeAlarmsRead  = "alarms:read"  // 查看告警
+	ScopeAlarmsWrite = "alarms:write" // 处理告警
+)
+
+var apiKeyScopes = []string{ScopeDevicesRead, ScopeTasksRead, ScopeAlarmsRead, ScopeAlarmsWrite}
+
+// IsValidScope 是否为有效的授权范围
+func IsValidScope(scope string) bool {
+	for _, s := range apiKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeList 授权范围列表
+func (k *APIKey) ScopeList() []string {
+	return splitList(k.Scopes)
+}
+
+// AllowedIPList 允许的来源IP列表
+func (k *APIKey) AllowedIPList() []string {
+	return splitList(k.AllowedIPs)
+}
+
+// HasScope 是否拥有指定授权范围
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUsable 密钥是否未撤销且未过期
+func (k *APIKey) IsUsable(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
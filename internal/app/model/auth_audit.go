@@ -0,0 +1,66 @@
+package model
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// AuthAudit 认证安全审计记录
+type AuthAudit struct {
+	ID         int64     `gorm:"primaryKey;column:id" json:"id"`
+	Event      string    `gorm:"column:event;type:varchar(32);index" json:"event"`         // 事件类型
+	Scope      string    `gorm:"column:scope;type:varchar(16)" json:"scope"`               // 锁定维度：sn/ip
+	DeviceSN   string    `gorm:"column:device_sn;type:varchar(32);index" json:"device_sn"` // 设备SN
+	DeviceID   uint      `gorm:"column:device_id" json:"device_id"`                        // 设备ID
+	ClientIP   string    `gorm:"column:client_ip;type:varchar(64);index" json:"client_ip"` // 客户端IP
+	UserAgent  string    `gorm:"column:user_agent;type:varchar(255)" json:"user_agent"`    // 客户端UA
+	Result     string    `gorm:"column:result;type:varchar(16);index" json:"result"`       // 结果：success/failure
+	ResultCode int       `gorm:"column:result_code" json:"result_code"`                    // 响应码，成功为200，失败为错误码
+	LatencyMs  int64     `gorm:"column:latency_ms" json:"latency_ms"`                      // 处理耗时(毫秒)
+	Detail     string    `gorm:"column:detail;type:varchar(255)" json:"detail"`            // 事件详情
+	CreateTime time.Time `gorm:"column:create_time;autoCreateTime;index" json:"create_time"`
+}
+
+// TableName 表名
+func (AuthAudit) TableName() string {
+	return "md_auth_audit"
+}
+
+// BeforeCreate 截断超长字段，避免审计记录因客户端传入超长UA等写入失败
+func (a *AuthAudit) BeforeCreate(tx *gorm.DB) error {
+	a.UserAgent = truncateRunes(a.UserAgent, 255)
+	a.Detail = truncateRunes(a.Detail, 255)
+	return nil
+}
+
+// 认证审计事件类型
+const (
+	AuthEventRegister       = "register"        // 设备注册
+	AuthEventAuthenticate   = "authenticate"    // 设备认证
+	AuthEventRefresh        = "refresh"         // 刷新令牌
+	AuthEventLogout         = "logout"          // 设备登出
+	AuthEventRejected       = "rejected"        // 访问令牌被拒绝
+	AuthEventLockout        = "lockout"         // 认证失败次数过多被锁定
+	AuthEventLockoutCleared = "lockout_cleared" // 运维人员解除锁定
+)
+
+// 认证审计结果
+const (
+	AuthResultSuccess = "success" // 成功
+	AuthResultFailure = "failure" // 失败
+)
+
+// 锁定维度
+const (
+	LockoutScopeSN = "sn" // 按设备SN锁定
+	LockoutScopeIP = "ip" // 按客户端IP锁定
+)
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
@@ -8,25 +8,79 @@ import (
 // Device 设备模型
 type Device struct {
 	gorm.Model
-	SN          string    `gorm:"type:varchar(32);uniqueIndex;not null" json:"sn"`           // 设备序列号
-	DeviceModel string    `gorm:"type:varchar(32);not null" json:"model"`                    // 设备型号
-	Name        string    `gorm:"type:varchar(64)" json:"name"`                              // 设备名称
-	Secret      string    `gorm:"type:varchar(64);not null" json:"secret"`                        // 设备密钥
-	Status      int       `gorm:"type:tinyint;default:0" json:"status"`                      // 设备状态
-	LastOnline  time.Time `gorm:"type:datetime;not null" json:"last_online"`                 // 最后在线时间
-	FirmwareVer string    `gorm:"type:varchar(32)" json:"firmware_ver"`                      // 固件版本
-	IP          string    `gorm:"type:varchar(64)" json:"ip"`                                // IP地址
-	MAC         string    `gorm:"type:varchar(32)" json:"mac"`                               // MAC地址
+	SN                   string     `gorm:"type:varchar(32);uniqueIndex;not null" json:"sn"` // 设备序列号
+	DeviceModel          string     `gorm:"type:varchar(32);not null" json:"model"`          // 设备型号
+	Name                 string     `gorm:"type:varchar(64)" json:"name"`                    // 设备名称
+	Secret               string     `gorm:"type:varchar(128);not null" json:"-"`             // 设备密钥(加密存储)
+	Status               int        `gorm:"type:tinyint;default:0" json:"status"`            // 设备状态，见DeviceStatus常量
+	LastOnline           time.Time  `gorm:"type:datetime;not null" json:"last_online"`       // 最后在线时间
+	FirmwareVer          string     `gorm:"type:varchar(32)" json:"firmware_ver"`            // 固件版本
+	IP                   string     `gorm:"type:varchar(64)" json:"ip"`                      // IP地址
+	MAC                  string     `gorm:"type:varchar(32)" json:"mac"`                     // MAC地址
+	TokensValidAfter     *time.Time `gorm:"type:datetime" json:"-"`                          // 早于该时间签发的令牌全部失效
+	PrevSecret           string     `gorm:"type:varchar(128)" json:"-"`                      // 轮换前的设备密钥(加密存储)，宽限期内仍可使用
+	PrevSecretExpireAt   *time.Time `gorm:"type:datetime" json:"-"`                          // 旧密钥宽限期截止时间
+	SecretRotateRequired bool       `gorm:"not null;default:false" json:"-"`                 // 运维要求设备轮换密钥
+	OrganizationID       *uint      `gorm:"index" json:"organization_id"`                    // 所属组织，为空表示未绑定
+	ClaimCodeHash        string     `gorm:"type:varchar(64);index" json:"-"`                 // 认领码SHA-256摘要，使用后清空
+	ClaimedAt            *time.Time `gorm:"type:datetime" json:"claimed_at"`                 // 绑定到当前组织的时间
 }
 
 // DeviceToken 设备令牌模型
 type DeviceToken struct {
 	gorm.Model
-	DeviceID uint      `gorm:"index;not null" json:"device_id"`                // 设备ID
-	Token    string    `gorm:"type:varchar(256);not null" json:"token"`        // 访问令牌
-	ExpireAt time.Time `gorm:"not null" json:"expire_at"`                      // 过期时间
+	DeviceID  uint      `gorm:"index;not null" json:"device_id"`                            // 设备ID
+	TokenType string    `gorm:"type:varchar(16);not null;default:access" json:"token_type"` // 令牌类型：access/refresh
+	TokenHash string    `gorm:"type:varchar(64);index;not null" json:"-"`                   // 令牌SHA-256摘要
+	FamilyID  string    `gorm:"type:varchar(32);index;not null" json:"family_id"`           // 令牌族ID，同一次认证后轮换产生的令牌共享
+	Revoked   bool      `gorm:"not null;default:false" json:"revoked"`                      // 是否已撤销
+	ExpireAt  time.Time `gorm:"not null;index" json:"expire_at"`                            // 过期时间
+	ClientIP  string    `gorm:"type:varchar(64)" json:"client_ip"`                          // 签发令牌时的客户端IP
 }
 
+// 设备生命周期状态
+const (
+	DeviceStatusProvisioned    = 0 // 已注册未激活
+	DeviceStatusActive         = 1 // 正常
+	DeviceStatusSuspended      = 2 // 已停用
+	DeviceStatusDecommissioned = 3 // 已退役
+	DeviceStatusRMA            = 4 // 返厂维修
+)
+
+// DeviceStatusName 设备状态名称
+func DeviceStatusName(status int) string {
+	switch status {
+	case DeviceStatusProvisioned:
+		return "provisioned"
+	case DeviceStatusActive:
+		return "active"
+	case DeviceStatusSuspended:
+		return "suspended"
+	case DeviceStatusDecommissioned:
+		return "decommissioned"
+	case DeviceStatusRMA:
+		return "rma"
+	default:
+		return "unknown"
+	}
+}
+
+// SecretCandidates 返回当前可用于验证签名的密钥密文，新密钥在前
+// 旧密钥仅在宽限期内有效
+func (d *Device) SecretCandidates(now time.Time) []string {
+	candidates := []string{d.Secret}
+	if d.PrevSecret != "" && d.PrevSecretExpireAt != nil && now.Before(*d.PrevSecretExpireAt) {
+		candidates = append(candidates, d.PrevSecret)
+	}
+	return candidates
+}
+
+// 令牌类型常量
+const (
+	TokenTypeAccess  = "access"  // 访问令牌
+	TokenTypeRefresh = "refresh" // 刷新令牌
+)
+
 // TableName 指定表名
 func (Device) TableName() string {
 	return "md_devices"
@@ -17,6 +17,7 @@ type DeviceAlarm struct {
 	UpdateTime  time.Time `gorm:"column:update_time;autoUpdateTime" json:"update_time"`
 	ResolveTime *time.Time `gorm:"column:resolve_time" json:"resolve_time"`          // 告警解除时间
 	ResolveDesc string    `gorm:"column:resolve_desc" json:"resolve_desc"`           // 告警解除说明
+	ResolveBy   string    `gorm:"column:resolve_by;type:varchar(64)" json:"resolve_by"` // 处理人：device表示设备自行解除，否则为运维账号
 }
 
 // TableName 表名
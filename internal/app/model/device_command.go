@@ -0,0 +1,59 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 设备指令类型
+const (
+	CommandPausePrint      = "pause_print"      // 暂停打印
+	CommandResumePrint     = "resume_print"     // 继续打印
+	CommandCancelPrint     = "cancel_print"     // 取消打印
+	CommandReboot          = "reboot"           // 重启设备
+	CommandCaptureSnapshot = "capture_snapshot" // 摄像头抓拍
+	CommandUploadLogs      = "upload_logs"      // 上传日志
+)
+
+// 设备指令状态
+const (
+	CommandStatusPending   = "pending"   // 等待设备拉取
+	CommandStatusDelivered = "delivered" // 已下发，等待设备确认
+	CommandStatusAcked     = "acked"     // 设备已确认，执行中
+	CommandStatusSucceeded = "succeeded" // 执行成功
+	CommandStatusFailed    = "failed"    // 执行失败
+	CommandStatusExpired   = "expired"   // 超过有效期未执行完成
+)
+
+// CommandActiveStatuses 未结束的指令状态
+var CommandActiveStatuses = []string{CommandStatusPending, CommandStatusDelivered, CommandStatusAcked}
+
+// DeviceCommand 云端下发给设备的指令
+type DeviceCommand struct {
+	ID           uint            `gorm:"primarykey" json:"id"`
+	DeviceSN     string          `gorm:"type:varchar(64);not null;index:idx_command_device_status" json:"device_sn"`
+	CommandType  string          `gorm:"type:varchar(32);not null" json:"command_type"`
+	Params       json.RawMessage `gorm:"type:text" json:"params"` // 指令参数(JSON对象)
+	Status       string          `gorm:"type:varchar(16);not null;index:idx_command_device_status" json:"status"`
+	ExpireAt     time.Time       `gorm:"not null;index" json:"expire_at"`         // 有效期，到期未执行完成的指令置为过期
+	DeliverCount int             `gorm:"not null;default:0" json:"deliver_count"` // 下发次数，设备未确认时会重新下发
+	DeliveredAt  *time.Time      `json:"delivered_at"`
+	AckedAt      *time.Time      `json:"acked_at"`
+	FinishedAt   *time.Time      `json:"finished_at"`
+	Result       json.RawMessage `gorm:"type:text" json:"result"` // 设备返回的执行结果(JSON对象)
+	ErrorCode    string          `gorm:"type:varchar(32)" json:"error_code"`
+	ErrorMessage string          `gorm:"type:varchar(255)" json:"error_message"`
+	CreatedBy    string          `gorm:"type:varchar(64)" json:"created_by"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (DeviceCommand) TableName() string {
+	return "md_device_commands"
+}
+
+// Finished 指令是否已结束
+func (c *DeviceCommand) Finished() bool {
+	return c.Status == CommandStatusSucceeded || c.Status == CommandStatusFailed || c.Status == CommandStatusExpired
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+// 网络类型
+const (
+	NetworkTypeWifi     = "wifi"
+	NetworkTypeEthernet = "ethernet"
+)
+
+// DeviceNetwork 设备网络信息上报记录
+type DeviceNetwork struct {
+	ID             int64     `gorm:"primaryKey;column:id" json:"id"`
+	DeviceSN       string    `gorm:"column:device_sn;type:varchar(64);not null;index" json:"device_sn"`
+	IPAddress      string    `gorm:"column:ip_address;type:varchar(64)" json:"ip_address"`
+	MACAddress     string    `gorm:"column:mac_address;type:varchar(32)" json:"mac_address"`
+	NetworkType    string    `gorm:"column:network_type;type:varchar(32)" json:"network_type"`
+	SignalStrength *int      `gorm:"column:signal_strength" json:"signal_strength"` // 信号强度(dBm)，有线网络为空
+	ReportTime     time.Time `gorm:"column:report_time;not null;index" json:"report_time"`
+	CreateTime     time.Time `gorm:"column:create_time;autoCreateTime" json:"create_time"`
+}
+
+// TableName 表名
+func (DeviceNetwork) TableName() string {
+	return "md_device_network"
+}
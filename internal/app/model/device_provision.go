@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeviceProvision 出厂预置设备信息，由生产管理系统批量导入
+type DeviceProvision struct {
+	gorm.Model
+	SN            string     `gorm:"type:varchar(32);uniqueIndex;not null" json:"sn"` // 设备序列号
+	DeviceModel   string     `gorm:"type:varchar(32);not null" json:"model"`          // 设备型号
+	Secret        string     `gorm:"type:varchar(128);not null" json:"-"`             // 出厂预置密钥
+	BatchNo       string     `gorm:"type:varchar(64);index" json:"batch_no"`          // 导入批次号
+	Status        int        `gorm:"type:tinyint;default:0" json:"status"`            // 状态：0-已预置未注册，1-已注册
+	RegisteredAt  *time.Time `gorm:"type:datetime" json:"registered_at"`              // 注册时间
+	ClaimCodeHash string     `gorm:"type:varchar(64)" json:"-"`                       // 出厂认领码SHA-256摘要，注册时复制到设备
+}
+
+// TableName 指定表名
+func (DeviceProvision) TableName() string {
+	return "md_device_provisions"
+}
+
+// 预置状态常量
+const (
+	ProvisionStatusPending    = 0 // 已预置未注册
+	ProvisionStatusRegistered = 1 // 已注册
+)
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+)
+
+// 设备影子配置项
+const (
+	ShadowKeyInfoReportInterval     = "info_report_interval"     // 设备信息上报间隔(秒)
+	ShadowKeyStatusReportInterval   = "status_report_interval"   // 设备状态上报间隔(秒)
+	ShadowKeyCameraSnapshotInterval = "camera_snapshot_interval" // 摄像头抓拍间隔(秒)，0表示关闭
+	ShadowKeyAIDetectionEnabled     = "ai_detection_enabled"     // 是否开启AI检测
+	ShadowKeyTimezone               = "timezone"                 // 设备时区(IANA名称)
+)
+
+// DeviceShadow 设备影子，保存云端期望配置和设备上报的当前配置
+// 期望配置每次变更版本号加1，DesiredMeta记录各配置项最后一次变更时的版本号，用于计算设备自某版本以来需要应用的差异
+type DeviceShadow struct {
+	ID              uint       `gorm:"primarykey" json:"id"`
+	DeviceSN        string     `gorm:"column:device_sn;type:varchar(64);not null;uniqueIndex" json:"device_sn"`
+	Desired         string     `gorm:"column:desired;type:text" json:"-"`      // 期望配置(JSON对象)
+	DesiredMeta     string     `gorm:"column:desired_meta;type:text" json:"-"` // 各期望配置项的变更版本号(JSON对象)
+	DesiredVersion  int64      `gorm:"column:desired_version;not null;default:0" json:"desired_version"`
+	DesiredTime     *time.Time `gorm:"column:desired_time" json:"desired_time"` // 期望配置最后修改时间
+	Reported        string     `gorm:"column:reported;type:text" json:"-"`      // 设备上报配置(JSON对象)
+	ReportedVersion int64      `gorm:"column:reported_version;not null;default:0" json:"reported_version"`
+	ReportedTime    *time.Time `gorm:"column:reported_time" json:"reported_time"` // 设备最后上报时间
+	CreateTime      time.Time  `gorm:"column:create_time;autoCreateTime" json:"create_time"`
+	UpdateTime      time.Time  `gorm:"column:update_time;autoUpdateTime" json:"update_time"`
+}
+
+// TableName 表名
+func (DeviceShadow) TableName() string {
+	return "md_device_shadow"
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+// DeviceStateHistory 设备生命周期状态变更记录
+type DeviceStateHistory struct {
+	ID         int64     `gorm:"primaryKey;column:id" json:"id"`
+	DeviceID   uint      `gorm:"column:device_id;index" json:"device_id"`                  // 设备ID
+	DeviceSN   string    `gorm:"column:device_sn;type:varchar(32);index" json:"device_sn"` // 设备SN
+	FromStatus int       `gorm:"column:from_status" json:"from_status"`                    // 变更前状态
+	ToStatus   int       `gorm:"column:to_status" json:"to_status"`                        // 变更后状态
+	Reason     string    `gorm:"column:reason;type:varchar(255)" json:"reason"`            // 变更原因
+	Operator   string    `gorm:"column:operator;type:varchar(64)" json:"operator"`         // 操作人，设备自动激活时为system
+	CreateTime time.Time `gorm:"column:create_time;autoCreateTime" json:"create_time"`
+}
+
+// TableName 表名
+func (DeviceStateHistory) TableName() string {
+	return "md_device_state_history"
+}
+
+// OperatorSystem 系统自动操作
+const OperatorSystem = "system"
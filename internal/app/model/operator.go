@@ -0,0 +1,90 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Operator 运维人员账号
+type Operator struct {
+	gorm.Model
+	Username         string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"username"` // 登录名
+	PasswordHash     string     `gorm:"type:varchar(100);not null" json:"-"`                   // bcrypt密码摘要
+	DisplayName      string     `gorm:"type:varchar(64)" json:"display_name"`                  // 显示名称
+	Role             string     `gorm:"type:varchar(16);not null" json:"role"`                 // 角色：admin/support/viewer
+	OrganizationID   *uint      `gorm:"index" json:"organization_id"`                          // 所属组织，为空表示平台运维人员
+	Status           int        `gorm:"type:tinyint;default:1" json:"status"`                  // 状态：0-禁用，1-启用
+	LastLoginAt      *time.Time `gorm:"type:datetime" json:"last_login_at"`                    // 最后登录时间
+	TokensValidAfter *time.Time `gorm:"type:datetime" json:"-"`                                // 早于该时间签发的令牌全部失效
+}
+
+// TableName 指定表名
+func (Operator) TableName() string {
+	return "md_operators"
+}
+
+// 运维人员状态
+const (
+	OperatorStatusDisabled = 0 // 禁用
+	OperatorStatusEnabled  = 1 // 启用
+)
+
+// 运维角色
+const (
+	RoleAdmin   = "admin"   // 管理员，拥有全部权限
+	RoleSupport = "support" // 技术支持，可查看数据并处理设备和告警
+	RoleViewer  = "viewer"  // 只读
+)
+
+// 运维权限
+const (
+	PermDeviceRead     = "device:read"     // 查看设备
+	PermDeviceWrite    = "device:write"    // 变更设备状态、撤销令牌、要求轮换密钥
+	PermAlarmRead      = "alarm:read"      // 查看告警
+	PermAlarmWrite     = "alarm:write"     // 处理告警
+	PermAuthRead       = "auth:read"       // 查看认证锁定和认证审计
+	PermAuthWrite      = "auth:write"      // 解除认证锁定
+	PermProvisionRead  = "provision:read"  // 查看出厂预置
+	PermProvisionWrite = "provision:write" // 导入出厂预置
+	PermOperatorManage = "operator:manage" // 管理运维账号
+	PermOrgManage      = "org:manage"      // 管理组织、认领和转移设备
+	PermAPIKeyManage   = "apikey:manage"   // 管理第三方API密钥
+	PermModelManage    = "model:manage"    // 管理打印机机型
+	PermOTAManage      = "ota:manage"      // 管理升级包
+)
+
+// rolePermissions 角色权限表，管理员拥有全部权限不在此列出
+var rolePermissions = map[string][]string{
+	RoleSupport: {
+		PermDeviceRead, PermDeviceWrite,
+		PermAlarmRead, PermAlarmWrite,
+		PermAuthRead, PermAuthWrite,
+		PermProvisionRead,
+	},
+	RoleViewer: {
+		PermDeviceRead, PermAlarmRead, PermAuthRead, PermProvisionRead,
+	},
+}
+
+// IsValidRole 是否为有效角色
+func IsValidRole(role string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission 判断角色是否拥有指定权限
+func HasPermission(role, permission string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Organization 组织(经销商、打印农场等租户)
+type Organization struct {
+	gorm.Model
+	Name   string `gorm:"type:varchar(64);uniqueIndex;not null" json:"name"` // 组织名称
+	Status int    `gorm:"type:tinyint;default:1" json:"status"`              // 状态：0-禁用，1-启用
+	Remark string `gorm:"type:varchar(255)" json:"remark"`                   // 备注
+}
+
+// TableName 指定表名
+func (Organization) TableName() string {
+	return "md_organizations"
+}
+
+// 组织状态
+const (
+	OrganizationStatusDisabled = 0 // 禁用
+	OrganizationStatusEnabled  = 1 // 启用
+)
+
+// DeviceOwnershipHistory 设备归属变更记录
+type DeviceOwnershipHistory struct {
+	ID         int64     `gorm:"primaryKey;column:id" json:"id"`
+	DeviceID   uint      `gorm:"column:device_id;index" json:"device_id"`                  // 设备ID
+	DeviceSN   string    `gorm:"column:device_sn;type:varchar(32);index" json:"device_sn"` // 设备SN
+	Action     string    `gorm:"column:action;type:varchar(16)" json:"action"`             // 操作：claim/transfer/unbind
+	FromOrgID  *uint     `gorm:"column:from_org_id" json:"from_org_id"`                    // 变更前组织
+	ToOrgID    *uint     `gorm:"column:to_org_id" json:"to_org_id"`                        // 变更后组织
+	Operator   string    `gorm:"column:operator;type:varchar(64)" json:"operator"`         // 操作人
+	CreateTime time.Time `gorm:"column:create_time;autoCreateTime" json:"create_time"`
+}
+
+// TableName 表名
+func (DeviceOwnershipHistory) TableName() string {
+	return "md_device_ownership_history"
+}
+
+// 设备归属变更操作
+const (
+	OwnershipActionClaim    = "claim"    // 使用认领码绑定
+	OwnershipActionTransfer = "transfer" // 转移到其他组织
+	OwnershipActionUnbind   = "unbind"   // 解除绑定
+)
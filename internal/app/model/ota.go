@@ -0,0 +1,101 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OTAPackage 升级包，同一组件的版本号唯一
+type OTAPackage struct {
+	gorm.Model
+	Component    string `gorm:"type:varchar(32);not null;uniqueIndex:idx_component_version" json:"component"` // 升级的组件，取值同软件版本变更记录的组件名称
+	Version      string `gorm:"type:varchar(32);not null;uniqueIndex:idx_component_version" json:"version"`   // 升级后的版本
+	TargetModels string `gorm:"type:varchar(255);not null" json:"target_models"`                              // 适用的型号名称，多个用逗号分隔
+	MinVersion   string `gorm:"type:varchar(32)" json:"min_version"`                                          // 允许升级的最低当前版本，为空表示不限
+	MaxVersion   string `gorm:"type:varchar(32)" json:"max_version"`                                          // 允许升级的最高当前版本，为空表示不限
+	FileName     string `gorm:"type:varchar(128);not null" json:"file_name"`                                  // 原始文件名
+	ObjectKey    string `gorm:"type:varchar(255);not null" json:"-"`                                          // 对象存储中的路径
+	FileSize     int64  `gorm:"not null" json:"file_size"`                                                    // 文件大小(字节)
+	SHA256       string `gorm:"column:sha256;type:char(64);not null" json:"sha256"`                           // 文件SHA-256(十六进制)
+	Signature    string `gorm:"type:text;not null" json:"signature"`                                          // 对SHA-256摘要的RSA签名(Base64)
+	SignKeyID    string `gorm:"type:varchar(32)" json:"sign_key_id"`                                          // 签名密钥ID
+	ReleaseNotes string `gorm:"type:text" json:"release_notes"`                                               // 更新说明
+	Status       int    `gorm:"type:tinyint;default:0" json:"status"`                                         // 状态：0-停用，1-发布
+	CreatedBy    string `gorm:"type:varchar(64)" json:"created_by"`                                           // 上传人
+}
+
+// TableName 指定表名
+func (OTAPackage) TableName() string {
+	return "md_ota_packages"
+}
+
+// 升级包状态
+const (
+	OTAPackageStatusDisabled = 0 // 停用，不再下发
+	OTAPackageStatusEnabled  = 1 // 发布
+)
+
+// Targets 适用的型号名称列表
+func (p *OTAPackage) Targets() []string {
+	var targets []string
+	for _, name := range strings.Split(p.TargetModels, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			targets = append(targets, name)
+		}
+	}
+	return targets
+}
+
+// SupportsModel 升级包是否适用于指定型号，忽略大小写
+func (p *OTAPackage) SupportsModel(name string) bool {
+	for _, target := range p.Targets() {
+		if strings.EqualFold(target, strings.TrimSpace(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// OTA升级状态
+const (
+	OTAUpdatePending     = "pending"     // 已下发，等待设备下载
+	OTAUpdateDownloading = "downloading" // 下载中
+	OTAUpdateInstalling  = "installing"  // 安装中
+	OTAUpdateInstalled   = "installed"   // 设备上报安装完成，等待重启后上报的版本确认
+	OTAUpdateSuccess     = "success"     // 设备上报的版本与目标版本一致
+	OTAUpdateFailed      = "failed"      // 升级失败
+)
+
+// OTAUpdate 设备升级记录
+type OTAUpdate struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	DeviceSN      string     `gorm:"type:varchar(64);not null;index" json:"device_sn"`
+	PackageID     uint       `gorm:"not null;index" json:"package_id"`
+	CampaignID    *uint      `gorm:"index" json:"campaign_id"`                 // 所属升级活动，直接发布的升级包为空
+	CampaignStage int        `gorm:"not null;default:0" json:"campaign_stage"` // 下发时升级活动所处阶段
+	Component     string     `gorm:"type:varchar(32);not null" json:"component"`
+	FromVersion   string     `gorm:"type:varchar(32)" json:"from_version"`
+	ToVersion     string     `gorm:"type:varchar(32);not null" json:"to_version"`
+	Status        string     `gorm:"type:varchar(16);not null;index" json:"status"`
+	Progress      int        `gorm:"not null;default:0" json:"progress"` // 进度百分比
+	ErrorCode     string     `gorm:"type:varchar(32)" json:"error_code"`
+	ErrorMessage  string     `gorm:"type:varchar(255)" json:"error_message"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+}
+
+// TableName 指定表名
+func (OTAUpdate) TableName() string {
+	return "md_ota_updates"
+}
+
+// Finished 升级是否已结束
+func (u *OTAUpdate) Finished() bool {
+	return u.Status == OTAUpdateSuccess || u.Status == OTAUpdateFailed
+}
+
+// OTAUpdateActiveStatuses 未结束的升级状态
+var OTAUpdateActiveStatuses = []string{OTAUpdatePending, OTAUpdateDownloading, OTAUpdateInstalling, OTAUpdateInstalled}
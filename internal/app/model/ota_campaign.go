@@ -0,0 +1,74 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 升级活动状态
+const (
+	OTACampaignDraft     = "draft"     // 草稿
+	OTACampaignRunning   = "running"   // 进行中
+	OTACampaignPaused    = "paused"    // 已暂停(手动或失败率、告警率超过阈值自动暂停)
+	OTACampaignCompleted = "completed" // 已完成，升级包转为全量发布
+	OTACampaignAborted   = "aborted"   // 已终止
+)
+
+// OTACampaignOpenStatuses 未结束的升级活动状态，同一升级包同时只能有一个
+var OTACampaignOpenStatuses = []string{OTACampaignDraft, OTACampaignRunning, OTACampaignPaused}
+
+// OTACampaign 分阶段灰度升级活动
+// 设备按SN哈希分桶，当前阶段覆盖比例内的设备才能检查到升级包
+type OTACampaign struct {
+	gorm.Model
+	Name             string     `gorm:"type:varchar(64);not null" json:"name"`
+	PackageID        uint       `gorm:"not null;index" json:"package_id"`        // 升级包
+	TargetModel      string     `gorm:"type:varchar(32)" json:"target_model"`    // 目标型号，为空表示升级包适用的全部型号
+	FromVersion      string     `gorm:"type:varchar(32)" json:"from_version"`    // 目标设备的当前版本，为空表示不限
+	Stages           string     `gorm:"type:varchar(64);not null" json:"stages"` // 各阶段覆盖设备的百分比，逗号分隔，如1,10,100
+	CurrentStage     int        `gorm:"not null;default:0" json:"current_stage"` // 当前阶段序号，从0开始
+	StageDuration    int        `gorm:"not null" json:"stage_duration"`          // 每阶段观察时间(分钟)，期间未触发阈值则进入下一阶段
+	StageStartedAt   *time.Time `json:"stage_started_at"`                        // 当前阶段开始时间
+	FailureThreshold float64    `gorm:"not null" json:"failure_threshold"`       // 升级失败率阈值(%)
+	AlarmThreshold   float64    `gorm:"not null" json:"alarm_threshold"`         // 升级成功后产生告警的设备比例阈值(%)
+	MinSamples       int        `gorm:"not null" json:"min_samples"`             // 样本数达到该值后才按阈值判断，避免少量设备导致误暂停
+	Status           string     `gorm:"type:varchar(16);not null;index" json:"status"`
+	PauseReason      string     `gorm:"type:varchar(255)" json:"pause_reason"`
+	CreatedBy        string     `gorm:"type:varchar(64)" json:"created_by"`
+	StartedAt        *time.Time `json:"started_at"`
+	MetricsSince     *time.Time `json:"metrics_since"` // 自动暂停只统计该时间之后下发的升级，开始和恢复时更新
+	FinishedAt       *time.Time `json:"finished_at"`
+}
+
+// TableName 指定表名
+func (OTACampaign) TableName() string {
+	return "md_ota_campaigns"
+}
+
+// StagePercents 解析各阶段覆盖比例，格式错误的项被忽略
+func (c *OTACampaign) StagePercents() []int {
+	var percents []int
+	for _, item := range strings.Split(c.Stages, ",") {
+		if percent, err := strconv.Atoi(strings.TrimSpace(item)); err == nil {
+			percents = append(percents, percent)
+		}
+	}
+	return percents
+}
+
+// CurrentPercent 当前阶段覆盖比例
+func (c *OTACampaign) CurrentPercent() int {
+	percents := c.StagePercents()
+	if c.CurrentStage < 0 || c.CurrentStage >= len(percents) {
+		return 0
+	}
+	return percents[c.CurrentStage]
+}
+
+// IsLastStage 是否为最后一个阶段
+func (c *OTACampaign) IsLastStage() bool {
+	return c.CurrentStage >= len(c.StagePercents())-1
+}
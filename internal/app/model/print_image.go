@@ -17,7 +17,7 @@ type PrintImage struct {
     Confidence  float64   `gorm:"type:decimal(5,4);comment:检测置信度"`
     PredictModel string    `gorm:"type:varchar(32);comment:预测模型"`
     CreateTime  time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;comment:创建时间"`
-    UpdateTime  time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;comment:更新时间"`
+    UpdateTime  time.Time `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP;autoUpdateTime;comment:更新时间"`
 }
 
 // TableName 表名
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// PrinterModel 打印机机型，SN前三位为机型代码
+type PrinterModel struct {
+	gorm.Model
+	Code        string `gorm:"type:varchar(3);uniqueIndex;not null" json:"code"`  // 机型代码，如M1P
+	Name        string `gorm:"type:varchar(32);uniqueIndex;not null" json:"name"` // 型号名称，与设备注册时上报的型号一致，如MD-1000 PRO
+	BuildX      int    `gorm:"not null;default:0" json:"build_x"`                 // 成型尺寸X(mm)
+	BuildY      int    `gorm:"not null;default:0" json:"build_y"`                 // 成型尺寸Y(mm)
+	BuildZ      int    `gorm:"not null;default:0" json:"build_z"`                 // 成型尺寸Z(mm)
+	NozzleCount int    `gorm:"not null;default:1" json:"nozzle_count"`            // 喷头数量
+	MinFirmware string `gorm:"type:varchar(32)" json:"min_firmware"`              // 支持的最低固件版本，为空表示不限
+	MaxFirmware string `gorm:"type:varchar(32)" json:"max_firmware"`              // 支持的最高固件版本，为空表示不限
+	Status      int    `gorm:"type:tinyint;default:1" json:"status"`              // 状态：0-停用(不再接受新设备注册)，1-启用
+	Remark      string `gorm:"type:varchar(255)" json:"remark"`                   // 备注
+}
+
+// TableName 指定表名
+func (PrinterModel) TableName() string {
+	return "md_printer_models"
+}
+
+// 机型状态
+const (
+	PrinterModelStatusDisabled = 0 // 停用
+	PrinterModelStatusEnabled  = 1 // 启用
+)
+
+// MatchesName 判断设备上报的型号是否为该机型，忽略大小写和首尾空白
+func (m *PrinterModel) MatchesName(name string) bool {
+	return strings.EqualFold(strings.TrimSpace(name), m.Name)
+}
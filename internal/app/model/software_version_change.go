@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+)
+
+// 软件组件名称
+const (
+	ComponentKlipper           = "klipper"
+	ComponentKlipperScreen     = "klipper_screen"
+	ComponentMoonraker         = "moonraker"
+	ComponentMainsail          = "mainsail"
+	ComponentCrowsnest         = "crowsnest"
+	ComponentMainboardFirmware = "mainboard_firmware"
+	ComponentPrintheadFirmware = "printhead_firmware"
+	ComponentLevelingFirmware  = "leveling_firmware"
+)
+
+// SoftwareVersionChange 软件版本变更记录，设备首次上报时旧版本为空
+type SoftwareVersionChange struct {
+	ID         int64     `gorm:"primaryKey;column:id" json:"id"`
+	DeviceSN   string    `gorm:"column:device_sn;type:varchar(64);not null;index:idx_sn_change_time" json:"device_sn"`  // 设备SN码
+	Component  string    `gorm:"column:component;type:varchar(32);not null" json:"component"`                           // 组件名称
+	OldVersion string    `gorm:"column:old_version;type:varchar(32)" json:"old_version"`                                // 变更前版本
+	NewVersion string    `gorm:"column:new_version;type:varchar(32)" json:"new_version"`                                // 变更后版本
+	ChangeTime time.Time `gorm:"column:change_time;type:datetime;not null;index:idx_sn_change_time" json:"change_time"` // 变更时间(检测到变更的上报时间)
+	CreateTime time.Time `gorm:"column:create_time;autoCreateTime" json:"create_time"`                                  // 创建时间
+}
+
+// TableName 表名
+func (SoftwareVersionChange) TableName() string {
+	return "md_software_version_changes"
+}
+
+// Components 按组件名称列出各组件版本
+func (v *SoftwareVersions) Components() []ComponentVersion {
+	return []ComponentVersion{
+		{Component: ComponentKlipper, Version: v.KlipperVersion},
+		{Component: ComponentKlipperScreen, Version: v.KlipperScreenVersion},
+		{Component: ComponentMoonraker, Version: v.MoonrakerVersion},
+		{Component: ComponentMainsail, Version: v.MainsailVersion},
+		{Component: ComponentCrowsnest, Version: v.CrowsnestVersion},
+		{Component: ComponentMainboardFirmware, Version: v.MainboardFirmware},
+		{Component: ComponentPrintheadFirmware, Version: v.PrintheadFirmware},
+		{Component: ComponentLevelingFirmware, Version: v.LevelingFirmware},
+	}
+}
+
+// ComponentVersion 组件版本
+type ComponentVersion struct {
+	Component string `json:"component"`
+	Version   string `json:"version"`
+}
+
+// VersionOf 返回指定组件的版本，组件名称无效时ok为false
+func (v *SoftwareVersions) VersionOf(component string) (version string, ok bool) {
+	for _, c := range v.Components() {
+		if c.Component == component {
+			return c.Version, true
+		}
+	}
+	return "", false
+}
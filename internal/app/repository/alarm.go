@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// AlarmFilter 告警查询条件，字段为空时不限制
+type AlarmFilter struct {
+	Status     *int
+	AlarmLevel *int
+}
+
+// AlarmRepository 设备告警仓储
+type AlarmRepository interface {
+	Create(alarm *model.DeviceAlarm) error
+	// UpdatePending 更新访问范围内未处理的告警
+	UpdatePending(tenant Tenant, id int64, fields map[string]interface{}) error
+
+	// List 分页查询访问范围内的告警，按上报时间倒序，同时返回总数
+	List(tenant Tenant, filter AlarmFilter, page Page) ([]model.DeviceAlarm, int64, error)
+	// ListAll 查询访问范围内的全部告警，status为空时不限状态，按上报时间倒序
+	ListAll(tenant Tenant, status *int) ([]model.DeviceAlarm, error)
+}
+
+// gormAlarmRepository 基于GORM的告警仓储
+type gormAlarmRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAlarmRepository) Create(alarm *model.DeviceAlarm) error {
+	return r.db.Create(alarm).Error
+}
+
+func (r *gormAlarmRepository) UpdatePending(tenant Tenant, id int64, fields map[string]interface{}) error {
+	return tenant.Scope(r.db.Model(&model.DeviceAlarm{})).
+		Where("id = ? AND status = ?", id, model.AlarmStatusPending).
+		Updates(fields).Error
+}
+
+func (r *gormAlarmRepository) List(tenant Tenant, filter AlarmFilter, page Page) ([]model.DeviceAlarm, int64, error) {
+	db := tenant.Scope(r.db.Model(&model.DeviceAlarm{}))
+	if filter.Status != nil {
+		db = db.Where("status = ?", *filter.Status)
+	}
+	if filter.AlarmLevel != nil {
+		db = db.Where("alarm_level = ?", *filter.AlarmLevel)
+	}
+
+	var alarms []model.DeviceAlarm
+	total, err := findPage(db, "create_time DESC", page, &alarms)
+	return alarms, total, err
+}
+
+func (r *gormAlarmRepository) ListAll(tenant Tenant, status *int) ([]model.DeviceAlarm, error) {
+	var alarms []model.DeviceAlarm
+	db := tenant.Scope(r.db)
+	if status != nil {
+		db = db.Where("status = ?", *status)
+	}
+	err := db.Order("create_time DESC").Find(&alarms).Error
+	return alarms, err
+}
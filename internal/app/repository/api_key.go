@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// APIKeyRepository 第三方API密钥仓储
+// 组织运维人员只能管理本组织的密钥，访问范围只按组织限定
+type APIKeyRepository interface {
+	Create(key *model.APIKey) error
+	FindByPrefix(prefix string) (*model.APIKey, error)
+	// FindInScope 查询访问范围内的密钥
+	FindInScope(tenant Tenant, id uint) (*model.APIKey, error)
+	// List 查询访问范围内的密钥，按ID倒序
+	List(tenant Tenant) ([]model.APIKey, error)
+	Update(key *model.APIKey, fields map[string]interface{}) error
+	// Touch 记录使用情况，不更新updated_at
+	Touch(key *model.APIKey, fields map[string]interface{}) error
+}
+
+// gormAPIKeyRepository 基于GORM的API密钥仓储
+type gormAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAPIKeyRepository) Create(key *model.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *gormAPIKeyRepository) FindByPrefix(prefix string) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := r.db.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &key, nil
+}
+
+func (r *gormAPIKeyRepository) FindInScope(tenant Tenant, id uint) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := r.scope(tenant).First(&key, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &key, nil
+}
+
+func (r *gormAPIKeyRepository) List(tenant Tenant) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := r.scope(tenant).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *gormAPIKeyRepository) Update(key *model.APIKey, fields map[string]interface{}) error {
+	return r.db.Model(key).Updates(fields).Error
+}
+
+func (r *gormAPIKeyRepository) Touch(key *model.APIKey, fields map[string]interface{}) error {
+	return r.db.Model(key).UpdateColumns(fields).Error
+}
+
+// scope 按组织限定密钥的访问范围
+func (r *gormAPIKeyRepository) scope(tenant Tenant) *gorm.DB {
+	db := r.db.Model(&model.APIKey{})
+	if tenant.OrganizationID != nil {
+		db = db.Where("organization_id = ?", *tenant.OrganizationID)
+	}
+	return db
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// AuthAuditFilter 认证审计查询条件，字段为空时不限制
+type AuthAuditFilter struct {
+	Event     string
+	Result    string
+	StartTime *time.Time
+	EndTime   *time.Time
+}
+
+// AuthAuditRepository 认证审计仓储
+type AuthAuditRepository interface {
+	Create(audit *model.AuthAudit) error
+	// List 分页查询访问范围内的审计记录，按时间倒序，同时返回总数
+	List(tenant Tenant, filter AuthAuditFilter, page Page) ([]model.AuthAudit, int64, error)
+}
+
+// gormAuthAuditRepository 基于GORM的认证审计仓储
+type gormAuthAuditRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAuthAuditRepository) Create(audit *model.AuthAudit) error {
+	return r.db.Create(audit).Error
+}
+
+func (r *gormAuthAuditRepository) List(tenant Tenant, filter AuthAuditFilter, page Page) ([]model.AuthAudit, int64, error) {
+	db := tenant.Scope(r.db.Model(&model.AuthAudit{}))
+	if filter.Event != "" {
+		db = db.Where("event = ?", filter.Event)
+	}
+	if filter.Result != "" {
+		db = db.Where("result = ?", filter.Result)
+	}
+	if filter.StartTime != nil {
+		db = db.Where("create_time >= ?", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		db = db.Where("create_time < ?", *filter.EndTime)
+	}
+
+	var audits []model.AuthAudit
+	total, err := findPage(db, "id DESC", page, &audits)
+	return audits, total, err
+}
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// DeviceRepository 设备聚合仓储：设备、出厂预置信息和状态变更历史
+type DeviceRepository interface {
+	FindBySN(sn string) (*model.Device, error)
+	FindByID(id uint) (*model.Device, error)
+	// FindBySNForUpdate 查询并锁定设备，需在事务中使用
+	FindBySNForUpdate(sn string) (*model.Device, error)
+	// FindByIDForUpdate 按ID查询并锁定设备，需在事务中使用
+	FindByIDForUpdate(id uint) (*model.Device, error)
+	// FindInScope 查询访问范围内的设备
+	FindInScope(tenant Tenant, sn string) (*model.Device, error)
+	// FindInScopeForUpdate 查询并锁定访问范围内的设备，需在事务中使用
+	FindInScopeForUpdate(tenant Tenant, sn string) (*model.Device, error)
+	// List 分页查询访问范围内的设备，按ID倒序，同时返回总数
+	List(tenant Tenant, filter DeviceFilter, page Page) ([]model.Device, int64, error)
+	// Count 统计访问范围内符合条件的设备数
+	Count(tenant Tenant, filter DeviceFilter) (int64, error)
+	// EachBatch 按ID顺序分批遍历全部设备
+	EachBatch(size int, fn func(devices []model.Device) error) error
+	// EachBatchInScope 按ID顺序分批遍历访问范围内符合条件的设备
+	EachBatchInScope(tenant Tenant, filter DeviceFilter, size int, fn func(devices []model.Device) error) error
+	Create(device *model.Device) error
+	Update(device *model.Device, fields map[string]interface{}) error
+	// UpdateBySN 按SN更新设备，返回更新条数
+	UpdateBySN(sn string, fields map[string]interface{}) (int64, error)
+	// UpdateByModel 更新指定型号的全部设备，返回更新条数
+	UpdateByModel(deviceModel string, fields map[string]interface{}) (int64, error)
+
+	FindProvision(sn string) (*model.DeviceProvision, error)
+	// FindProvisionForUpdate 查询并锁定出厂预置记录，需在事务中使用
+	FindProvisionForUpdate(sn string) (*model.DeviceProvision, error)
+	CreateProvision(provision *model.DeviceProvision) error
+	UpdateProvision(provision *model.DeviceProvision, fields map[string]interface{}) error
+	// EachProvisionBatch 按ID顺序分批遍历全部出厂预置记录
+	EachProvisionBatch(size int, fn func(provisions []model.DeviceProvision) error) error
+
+	CreateStateHistory(history *model.DeviceStateHistory) error
+	// ListStateHistory 查询设备状态变更历史，按时间倒序
+	ListStateHistory(sn string) ([]model.DeviceStateHistory, error)
+
+	CreateOwnershipHistory(history *model.DeviceOwnershipHistory) error
+	// ListOwnershipHistory 查询设备归属变更历史，按时间倒序
+	ListOwnershipHistory(sn string) ([]model.DeviceOwnershipHistory, error)
+}
+
+// DeviceFilter 设备查询条件，字段为空时不限制
+type DeviceFilter struct {
+	SNs         []string
+	SNPrefix    string
+	DeviceModel string
+	Status      *int
+}
+
+// apply 将查询条件添加到db
+func (f DeviceFilter) apply(db *gorm.DB) *gorm.DB {
+	if len(f.SNs) > 0 {
+		db = db.Where("sn IN ?", f.SNs)
+	}
+	if f.SNPrefix != "" {
+		db = db.Where("sn LIKE ?", f.SNPrefix+"%")
+	}
+	if f.DeviceModel != "" {
+		db = db.Where("device_model = ?", f.DeviceModel)
+	}
+	if f.Status != nil {
+		db = db.Where("status = ?", *f.Status)
+	}
+	return db
+}
+
+// gormDeviceRepository 基于GORM的设备仓储
+type gormDeviceRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormDeviceRepository) FindBySN(sn string) (*model.Device, error) {
+	var device model.Device
+	if err := r.db.Where("sn = ?", sn).First(&device).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepository) FindByID(id uint) (*model.Device, error) {
+	var device model.Device
+	if err := r.db.First(&device, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepository) FindBySNForUpdate(sn string) (*model.Device, error) {
+	var device model.Device
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("sn = ?", sn).First(&device).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepository) FindByIDForUpdate(id uint) (*model.Device, error) {
+	var device model.Device
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&device, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepository) FindInScope(tenant Tenant, sn string) (*model.Device, error) {
+	var device model.Device
+	if err := tenant.WithDevice(sn).DeviceScope(r.db).First(&device).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepository) FindInScopeForUpdate(tenant Tenant, sn string) (*model.Device, error) {
+	var device model.Device
+	if err := tenant.WithDevice(sn).DeviceScope(r.db.Clauses(clause.Locking{Strength: "UPDATE"})).First(&device).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepository) List(tenant Tenant, filter DeviceFilter, page Page) ([]model.Device, int64, error) {
+	db := filter.apply(tenant.DeviceScope(r.db.Model(&model.Device{})))
+
+	var devices []model.Device
+	total, err := findPage(db, "id DESC", page, &devices)
+	return devices, total, err
+}
+
+func (r *gormDeviceRepository) Count(tenant Tenant, filter DeviceFilter) (int64, error) {
+	var count int64
+	err := filter.apply(tenant.DeviceScope(r.db.Model(&model.Device{}))).Count(&count).Error
+	return count, err
+}
+
+func (r *gormDeviceRepository) EachBatch(size int, fn func(devices []model.Device) error) error {
+	var devices []model.Device
+	return r.db.Model(&model.Device{}).FindInBatches(&devices, size, func(tx *gorm.DB, batch int) error {
+		return fn(devices)
+	}).Error
+}
+
+func (r *gormDeviceRepository) EachBatchInScope(tenant Tenant, filter DeviceFilter, size int, fn func(devices []model.Device) error) error {
+	var devices []model.Device
+	return filter.apply(tenant.DeviceScope(r.db.Model(&model.Device{}))).FindInBatches(&devices, size, func(tx *gorm.DB, batch int) error {
+		return fn(devices)
+	}).Error
+}
+
+func (r *gormDeviceRepository) Create(device *model.Device) error {
+	return r.db.Create(device).Error
+}
+
+func (r *gormDeviceRepository) Update(device *model.Device, fields map[string]interface{}) error {
+	return r.db.Model(device).Updates(fields).Error
+}
+
+func (r *gormDeviceRepository) UpdateBySN(sn string, fields map[string]interface{}) (int64, error) {
+	result := r.db.Model(&model.Device{}).Where("sn = ?", sn).Updates(fields)
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormDeviceRepository) UpdateByModel(deviceModel string, fields map[string]interface{}) (int64, error) {
+	result := r.db.Model(&model.Device{}).Where("device_model = ?", deviceModel).Updates(fields)
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormDeviceRepository) FindProvision(sn string) (*model.DeviceProvision, error) {
+	var provision model.DeviceProvision
+	if err := r.db.Where("sn = ?", sn).First(&provision).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &provision, nil
+}
+
+func (r *gormDeviceRepository) FindProvisionForUpdate(sn string) (*model.DeviceProvision, error) {
+	var provision model.DeviceProvision
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Where("sn = ?", sn).First(&provision).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &provision, nil
+}
+
+func (r *gormDeviceRepository) CreateProvision(provision *model.DeviceProvision) error {
+	return r.db.Create(provision).Error
+}
+
+func (r *gormDeviceRepository) UpdateProvision(provision *model.DeviceProvision, fields map[string]interface{}) error {
+	return r.db.Model(provision).Updates(fields).Error
+}
+
+func (r *gormDeviceRepository) EachProvisionBatch(size int, fn func(provisions []model.DeviceProvision) error) error {
+	var provisions []model.DeviceProvision
+	return r.db.Model(&model.DeviceProvision{}).FindInBatches(&provisions, size, func(tx *gorm.DB, batch int) error {
+		return fn(provisions)
+	}).Error
+}
+
+func (r *gormDeviceRepository) CreateStateHistory(history *model.DeviceStateHistory) error {
+	return r.db.Create(history).Error
+}
+
+func (r *gormDeviceRepository) ListStateHistory(sn string) ([]model.DeviceStateHistory, error) {
+	var histories []model.DeviceStateHistory
+	err := r.db.Where("device_sn = ?", sn).Order("id DESC").Find(&histories).Error
+	return histories, err
+}
+
+func (r *gormDeviceRepository) CreateOwnershipHistory(history *model.DeviceOwnershipHistory) error {
+	return r.db.Create(history).Error
+}
+
+func (r *gormDeviceRepository) ListOwnershipHistory(sn string) ([]model.DeviceOwnershipHistory, error) {
+	var histories []model.DeviceOwnershipHistory
+	err := r.db.Where("device_sn = ?", sn).Order("id DESC").Find(&histories).Error
+	return histories, err
+}
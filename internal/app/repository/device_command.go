@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// DeviceCommandRepository 设备指令仓储
+type DeviceCommandRepository interface {
+	Create(command *model.DeviceCommand) error
+	Update(command *model.DeviceCommand, fields map[string]interface{}) error
+	// FindDeviceCommand 查询设备的指令
+	FindDeviceCommand(sn string, id uint) (*model.DeviceCommand, error)
+	// List 分页查询设备指令，status为空时不限状态，按ID倒序，同时返回总数
+	List(sn, status string, page Page) ([]model.DeviceCommand, int64, error)
+	// ListDeliverable 按ID顺序查询设备未过期的待拉取指令，以及redeliverBefore之前下发仍未确认的指令
+	ListDeliverable(sn string, now, redeliverBefore time.Time, limit int) ([]model.DeviceCommand, error)
+
+	// Deliver 状态和下发次数与读取时一致才更新，返回是否更新成功
+	Deliver(command *model.DeviceCommand, fields map[string]interface{}) (bool, error)
+	// Transition 更新处于from状态之一的指令，返回是否更新成功
+	Transition(id uint, from []string, fields map[string]interface{}) (bool, error)
+	// UpdateExpired 更新有效期已过仍未结束的指令，返回更新条数
+	UpdateExpired(now time.Time, fields map[string]interface{}) (int64, error)
+}
+
+// gormDeviceCommandRepository 基于GORM的设备指令仓储
+type gormDeviceCommandRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormDeviceCommandRepository) Create(command *model.DeviceCommand) error {
+	return r.db.Create(command).Error
+}
+
+func (r *gormDeviceCommandRepository) Update(command *model.DeviceCommand, fields map[string]interface{}) error {
+	return r.db.Model(command).Updates(fields).Error
+}
+
+func (r *gormDeviceCommandRepository) FindDeviceCommand(sn string, id uint) (*model.DeviceCommand, error) {
+	var command model.DeviceCommand
+	if err := r.db.Where("id = ? AND device_sn = ?", id, sn).First(&command).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &command, nil
+}
+
+func (r *gormDeviceCommandRepository) List(sn, status string, page Page) ([]model.DeviceCommand, int64, error) {
+	db := r.db.Model(&model.DeviceCommand{}).Where("device_sn = ?", sn)
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+
+	var commands []model.DeviceCommand
+	total, err := findPage(db, "id DESC", page, &commands)
+	return commands, total, err
+}
+
+func (r *gormDeviceCommandRepository) ListDeliverable(sn string, now, redeliverBefore time.Time, limit int) ([]model.DeviceCommand, error) {
+	var commands []model.DeviceCommand
+	err := r.db.Where("device_sn = ? AND expire_at > ?", sn, now).
+		Where("status = ? OR (status = ? AND delivered_at < ?)",
+			model.CommandStatusPending, model.CommandStatusDelivered, redeliverBefore).
+		Order("id").Limit(limit).Find(&commands).Error
+	return commands, err
+}
+
+func (r *gormDeviceCommandRepository) Deliver(command *model.DeviceCommand, fields map[string]interface{}) (bool, error) {
+	result := r.db.Model(&model.DeviceCommand{}).
+		Where("id = ? AND status = ? AND deliver_count = ?", command.ID, command.Status, command.DeliverCount).
+		Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormDeviceCommandRepository) Transition(id uint, from []string, fields map[string]interface{}) (bool, error) {
+	result := r.db.Model(&model.DeviceCommand{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormDeviceCommandRepository) UpdateExpired(now time.Time, fields map[string]interface{}) (int64, error) {
+	result := r.db.Model(&model.DeviceCommand{}).
+		Where("status IN ? AND expire_at <= ?", model.CommandActiveStatuses, now).
+		Updates(fields)
+	return result.RowsAffected, result.Error
+}
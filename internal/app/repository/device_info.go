@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// VersionChangeFilter 版本变更记录查询条件，字段为空时不限制
+type VersionChangeFilter struct {
+	Component string
+	StartTime *time.Time
+	EndTime   *time.Time
+}
+
+// VersionDistributionFilter 版本分布统计条件，字段为空时不限制
+type VersionDistributionFilter struct {
+	DeviceModel  string
+	Online       *bool
+	ReportAfter  *time.Time // 设备信息最后更新时间下限
+	ReportBefore *time.Time // 设备信息最后更新时间上限
+}
+
+// VersionCount 某机型某组件版本的设备数
+type VersionCount struct {
+	DeviceModel string
+	Version     string
+	Count       int64
+}
+
+// versionColumns 组件在md_software_versions中的列名
+var versionColumns = map[string]string{
+	model.ComponentKlipper:           "klipper_version",
+	model.ComponentKlipperScreen:     "klipper_screen_version",
+	model.ComponentMoonraker:         "moonraker_version",
+	model.ComponentMainsail:          "mainsail_version",
+	model.ComponentCrowsnest:         "crowsnest_version",
+	model.ComponentMainboardFirmware: "mainboard_firmware",
+	model.ComponentPrintheadFirmware: "printhead_firmware",
+	model.ComponentLevelingFirmware:  "leveling_firmware",
+}
+
+// DeviceInfoRepository 设备信息与软件版本仓储
+type DeviceInfoRepository interface {
+	// SaveInfo 保存设备基础信息，没有记录时创建
+	SaveInfo(info *model.DeviceInfo) error
+	// FindVersions 查询设备最近上报的软件版本
+	FindVersions(sn string) (*model.SoftwareVersions, error)
+	CreateVersions(versions *model.SoftwareVersions) error
+	UpdateVersions(sn string, fields map[string]interface{}) error
+
+	CreateVersionChanges(changes []model.SoftwareVersionChange) error
+	// ListVersionChanges 分页查询设备的版本变更记录，按变更时间倒序，同时返回总数
+	ListVersionChanges(sn string, filter VersionChangeFilter, page Page) ([]model.SoftwareVersionChange, int64, error)
+
+	// CountVersions 按机型统计访问范围内设备某组件各版本的设备数，按机型、设备数倒序
+	CountVersions(tenant Tenant, component string, filter VersionDistributionFilter) ([]VersionCount, error)
+}
+
+// gormDeviceInfoRepository 基于GORM的设备信息仓储
+type gormDeviceInfoRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormDeviceInfoRepository) SaveInfo(info *model.DeviceInfo) error {
+	return r.db.Where("device_sn = ?", info.DeviceSN).
+		Assign(info).
+		FirstOrCreate(info).Error
+}
+
+func (r *gormDeviceInfoRepository) FindVersions(sn string) (*model.SoftwareVersions, error) {
+	var versions model.SoftwareVersions
+	if err := r.db.Where("device_sn = ?", sn).First(&versions).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &versions, nil
+}
+
+func (r *gormDeviceInfoRepository) CreateVersions(versions *model.SoftwareVersions) error {
+	return r.db.Create(versions).Error
+}
+
+func (r *gormDeviceInfoRepository) UpdateVersions(sn string, fields map[string]interface{}) error {
+	return r.db.Model(&model.SoftwareVersions{}).Where("device_sn = ?", sn).Updates(fields).Error
+}
+
+func (r *gormDeviceInfoRepository) CreateVersionChanges(changes []model.SoftwareVersionChange) error {
+	return r.db.Create(&changes).Error
+}
+
+func (r *gormDeviceInfoRepository) ListVersionChanges(sn string, filter VersionChangeFilter, page Page) ([]model.SoftwareVersionChange, int64, error) {
+	db := r.db.Model(&model.SoftwareVersionChange{}).Where("device_sn = ?", sn)
+	if filter.Component != "" {
+		db = db.Where("component = ?", filter.Component)
+	}
+	if filter.StartTime != nil {
+		db = db.Where("change_time >= ?", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		db = db.Where("change_time < ?", *filter.EndTime)
+	}
+
+	var changes []model.SoftwareVersionChange
+	total, err := findPage(db, "change_time DESC, id DESC", page, &changes)
+	return changes, total, err
+}
+
+func (r *gormDeviceInfoRepository) CountVersions(tenant Tenant, component string, filter VersionDistributionFilter) ([]VersionCount, error) {
+	column, ok := versionColumns[component]
+	if !ok {
+		return nil, fmt.Errorf("unknown component: %s", component)
+	}
+
+	// 设备最后上报时间以设备信息的更新时间为准
+	db := r.db.Table("md_software_versions AS sv").
+		Joins("JOIN md_device_info AS di ON di.device_sn = sv.device_sn AND di.deleted_at IS NULL").
+		Where("sv.deleted_at IS NULL")
+	if !tenant.IsPlatform() {
+		db = db.Where("sv.device_sn IN (?)", tenant.DeviceScope(r.db.Model(&model.Device{})).Select("sn"))
+	}
+	if filter.DeviceModel != "" {
+		db = db.Where("di.device_model = ?", filter.DeviceModel)
+	}
+	if filter.Online != nil {
+		db = db.Joins("LEFT JOIN md_device_online AS o ON o.device_sn = sv.device_sn")
+		if *filter.Online {
+			db = db.Where("o.is_online = ?", true)
+		} else {
+			db = db.Where("o.is_online IS NULL OR o.is_online = ?", false)
+		}
+	}
+	if filter.ReportAfter != nil {
+		db = db.Where("di.update_time >= ?", *filter.ReportAfter)
+	}
+	if filter.ReportBefore != nil {
+		db = db.Where("di.update_time < ?", *filter.ReportBefore)
+	}
+
+	var counts []VersionCount
+	err := db.Select(fmt.Sprintf("di.device_model AS device_model, sv.%s AS version, COUNT(*) AS count", column)).
+		Group("di.device_model, sv." + column).
+		Order("di.device_model, count DESC").
+		Scan(&counts).Error
+	return counts, err
+}
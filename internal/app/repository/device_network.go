@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// DeviceNetworkRepository 设备网络信息上报记录仓储
+type DeviceNetworkRepository interface {
+	CreateNetwork(network *model.DeviceNetwork) error
+	// ListNetwork 查询设备在[start, end)内的网络上报记录，按上报时间正序，最多返回limit条
+	ListNetwork(sn string, start, end time.Time, limit int) ([]model.DeviceNetwork, error)
+}
+
+// gormDeviceNetworkRepository 基于GORM的设备网络信息仓储
+type gormDeviceNetworkRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormDeviceNetworkRepository) CreateNetwork(network *model.DeviceNetwork) error {
+	return r.db.Create(network).Error
+}
+
+func (r *gormDeviceNetworkRepository) ListNetwork(sn string, start, end time.Time, limit int) ([]model.DeviceNetwork, error) {
+	var records []model.DeviceNetwork
+	err := r.db.Where("device_sn = ? AND report_time >= ? AND report_time < ?", sn, start, end).
+		Order("report_time ASC, id ASC").
+		Limit(limit).
+		Find(&records).Error
+	return records, err
+}
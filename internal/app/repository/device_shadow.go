@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// DeviceShadowRepository 设备影子仓储
+type DeviceShadowRepository interface {
+	Find(sn string) (*model.DeviceShadow, error)
+	// CreateIfAbsent 创建设备影子，已存在时不做修改
+	CreateIfAbsent(shadow *model.DeviceShadow) error
+	// UpdateVersioned 期望配置和上报配置版本与读取时一致才更新，返回是否更新成功
+	UpdateVersioned(id uint, desiredVersion, reportedVersion int64, fields map[string]interface{}) (bool, error)
+}
+
+// gormDeviceShadowRepository 基于GORM的设备影子仓储
+type gormDeviceShadowRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormDeviceShadowRepository) Find(sn string) (*model.DeviceShadow, error) {
+	var shadow model.DeviceShadow
+	if err := r.db.Where("device_sn = ?", sn).First(&shadow).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &shadow, nil
+}
+
+func (r *gormDeviceShadowRepository) CreateIfAbsent(shadow *model.DeviceShadow) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(shadow).Error
+}
+
+func (r *gormDeviceShadowRepository) UpdateVersioned(id uint, desiredVersion, reportedVersion int64, fields map[string]interface{}) (bool, error) {
+	result := r.db.Model(&model.DeviceShadow{}).
+		Where("id = ? AND desired_version = ? AND reported_version = ?", id, desiredVersion, reportedVersion).
+		Updates(fields)
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// DeviceStatusRepository 设备运行状态与在线状态仓储
+type DeviceStatusRepository interface {
+	CreateStatus(status *model.DeviceStatus) error
+	// CountStatus 统计设备的状态上报记录数
+	CountStatus(sn string) (int64, error)
+	FindOnline(sn string) (*model.DeviceOnline, error)
+	// MarkOnline 将设备标记为在线，没有在线记录时创建
+	MarkOnline(sn string, at time.Time) error
+	// MarkOffline 将最后上报时间早于before的在线设备标记为离线，返回更新条数
+	MarkOffline(before, at time.Time) (int64, error)
+	// MarkDeviceOffline 将指定设备标记为离线
+	MarkDeviceOffline(sn string, at time.Time) error
+}
+
+// gormDeviceStatusRepository 基于GORM的设备状态仓储
+type gormDeviceStatusRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormDeviceStatusRepository) CreateStatus(status *model.DeviceStatus) error {
+	return r.db.Create(status).Error
+}
+
+func (r *gormDeviceStatusRepository) CountStatus(sn string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.DeviceStatus{}).Where("device_sn = ?", sn).Count(&count).Error
+	return count, err
+}
+
+func (r *gormDeviceStatusRepository) FindOnline(sn string) (*model.DeviceOnline, error) {
+	var online model.DeviceOnline
+	if err := r.db.Where("device_sn = ?", sn).First(&online).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &online, nil
+}
+
+func (r *gormDeviceStatusRepository) MarkOnline(sn string, at time.Time) error {
+	var online model.DeviceOnline
+	err := r.db.Where("device_sn = ?", sn).First(&online).Error
+	if err == gorm.ErrRecordNotFound {
+		online = model.DeviceOnline{
+			DeviceSN:       sn,
+			IsOnline:       true,
+			LastReportTime: at,
+			CreateTime:     at,
+			UpdateTime:     at,
+		}
+		return r.db.Create(&online).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.db.Model(&online).Updates(map[string]interface{}{
+		"is_online":        true,
+		"last_report_time": at,
+		"offline_time":     gorm.Expr("NULL"), // 设备上线时，清除离线时间
+		"update_time":      at,
+	}).Error
+}
+
+func (r *gormDeviceStatusRepository) MarkOffline(before, at time.Time) (int64, error) {
+	result := r.db.Model(&model.DeviceOnline{}).
+		Where("is_online = ? AND last_report_time < ?", true, before).
+		Updates(map[string]interface{}{
+			"is_online":    false,
+			"offline_time": at,
+			"update_time":  at,
+		})
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormDeviceStatusRepository) MarkDeviceOffline(sn string, at time.Time) error {
+	return r.db.Model(&model.DeviceOnline{}).
+		Where("device_sn = ? AND is_online = ?", sn, true).
+		Updates(map[string]interface{}{
+			"is_online":    false,
+			"offline_time": at,
+			"update_time":  at,
+		}).Error
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// OperatorRepository 运维账号仓储
+type OperatorRepository interface {
+	FindByID(id uint) (*model.Operator, error)
+	// FindByIDForUpdate 查询并锁定运维账号，需在事务中使用
+	FindByIDForUpdate(id uint) (*model.Operator, error)
+	FindByUsername(username string) (*model.Operator, error)
+	ExistsByUsername(username string) (bool, error)
+	Create(operator *model.Operator) error
+	Update(operator *model.Operator, fields map[string]interface{}) error
+	// List 查询全部运维账号，按ID正序
+	List() ([]model.Operator, error)
+	// CountPlatformAdmins 统计除excludeID外启用的平台管理员数量
+	CountPlatformAdmins(excludeID uint) (int64, error)
+}
+
+// gormOperatorRepository 基于GORM的运维账号仓储
+type gormOperatorRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormOperatorRepository) FindByID(id uint) (*model.Operator, error) {
+	var operator model.Operator
+	if err := r.db.First(&operator, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &operator, nil
+}
+
+func (r *gormOperatorRepository) FindByIDForUpdate(id uint) (*model.Operator, error) {
+	var operator model.Operator
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).First(&operator, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &operator, nil
+}
+
+func (r *gormOperatorRepository) FindByUsername(username string) (*model.Operator, error) {
+	var operator model.Operator
+	if err := r.db.Where("username = ?", username).First(&operator).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &operator, nil
+}
+
+func (r *gormOperatorRepository) ExistsByUsername(username string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.Operator{}).Where("username = ?", username).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormOperatorRepository) Create(operator *model.Operator) error {
+	return r.db.Create(operator).Error
+}
+
+func (r *gormOperatorRepository) Update(operator *model.Operator, fields map[string]interface{}) error {
+	return r.db.Model(operator).Updates(fields).Error
+}
+
+func (r *gormOperatorRepository) List() ([]model.Operator, error) {
+	var operators []model.Operator
+	err := r.db.Order("id ASC").Find(&operators).Error
+	return operators, err
+}
+
+func (r *gormOperatorRepository) CountPlatformAdmins(excludeID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Operator{}).
+		Where("role = ? AND status = ? AND organization_id IS NULL AND id <> ?", model.RoleAdmin, model.OperatorStatusEnabled, excludeID).
+		Count(&count).Error
+	return count, err
+}
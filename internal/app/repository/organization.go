@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// OrganizationRepository 组织仓储
+type OrganizationRepository interface {
+	FindByID(id uint) (*model.Organization, error)
+	ExistsByName(name string) (bool, error)
+	Create(org *model.Organization) error
+	// List 查询全部组织，按ID正序
+	List() ([]model.Organization, error)
+}
+
+// gormOrganizationRepository 基于GORM的组织仓储
+type gormOrganizationRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormOrganizationRepository) FindByID(id uint) (*model.Organization, error) {
+	var org model.Organization
+	if err := r.db.First(&org, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &org, nil
+}
+
+func (r *gormOrganizationRepository) ExistsByName(name string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.Organization{}).Where("name = ?", name).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormOrganizationRepository) Create(org *model.Organization) error {
+	return r.db.Create(org).Error
+}
+
+func (r *gormOrganizationRepository) List() ([]model.Organization, error) {
+	var orgs []model.Organization
+	err := r.db.Order("id ASC").Find(&orgs).Error
+	return orgs, err
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// OTAPackageFilter 升级包查询条件，字段为空时不限制
+type OTAPackageFilter struct {
+	Component string
+	Status    *int
+}
+
+// OTARepository 升级包与设备升级记录仓储
+type OTARepository interface {
+	CreatePackage(pkg *model.OTAPackage) error
+	FindPackage(id uint) (*model.OTAPackage, error)
+	// PackageExists 组件的该版本是否已存在，包含已删除的升级包
+	PackageExists(component, version string) (bool, error)
+	UpdatePackage(pkg *model.OTAPackage, fields map[string]interface{}) error
+	// ListPackages 分页查询升级包，按ID倒序，同时返回总数
+	ListPackages(filter OTAPackageFilter, page Page) ([]model.OTAPackage, int64, error)
+	// ListEnabledPackages 查询已发布的升级包，component为空时不限组件
+	ListEnabledPackages(component string) ([]model.OTAPackage, error)
+	// ListPackagesByID 按ID查询升级包，component为空时不限组件
+	ListPackagesByID(ids []uint, component string) ([]model.OTAPackage, error)
+
+	CreateUpdate(update *model.OTAUpdate) error
+	// FindDeviceUpdate 查询设备的升级记录
+	FindDeviceUpdate(sn string, id uint) (*model.OTAUpdate, error)
+	// FindActiveUpdate 查询设备对升级包未结束的最近一条升级记录
+	FindActiveUpdate(sn string, packageID uint) (*model.OTAUpdate, error)
+	// ModifyUpdate 更新升级记录的状态或进度
+	ModifyUpdate(update *model.OTAUpdate, fields map[string]interface{}) error
+	// ListDeviceUpdates 查询设备最近的limit条升级记录，按ID倒序
+	ListDeviceUpdates(sn string, limit int) ([]model.OTAUpdate, error)
+	// ListActiveUpdates 查询设备全部未结束的升级记录
+	ListActiveUpdates(sn string) ([]model.OTAUpdate, error)
+}
+
+// gormOTARepository 基于GORM的升级仓储
+type gormOTARepository struct {
+	db *gorm.DB
+}
+
+func (r *gormOTARepository) CreatePackage(pkg *model.OTAPackage) error {
+	return r.db.Create(pkg).Error
+}
+
+func (r *gormOTARepository) FindPackage(id uint) (*model.OTAPackage, error) {
+	var pkg model.OTAPackage
+	if err := r.db.First(&pkg, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &pkg, nil
+}
+
+func (r *gormOTARepository) PackageExists(component, version string) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&model.OTAPackage{}).
+		Where("component = ? AND version = ?", component, version).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormOTARepository) UpdatePackage(pkg *model.OTAPackage, fields map[string]interface{}) error {
+	return r.db.Model(pkg).Updates(fields).Error
+}
+
+func (r *gormOTARepository) ListPackages(filter OTAPackageFilter, page Page) ([]model.OTAPackage, int64, error) {
+	db := r.db.Model(&model.OTAPackage{})
+	if filter.Component != "" {
+		db = db.Where("component = ?", filter.Component)
+	}
+	if filter.Status != nil {
+		db = db.Where("status = ?", *filter.Status)
+	}
+
+	var packages []model.OTAPackage
+	total, err := findPage(db, "id DESC", page, &packages)
+	return packages, total, err
+}
+
+func (r *gormOTARepository) ListEnabledPackages(component string) ([]model.OTAPackage, error) {
+	db := r.db.Where("status = ?", model.OTAPackageStatusEnabled)
+	if component != "" {
+		db = db.Where("component = ?", component)
+	}
+	var packages []model.OTAPackage
+	err := db.Find(&packages).Error
+	return packages, err
+}
+
+func (r *gormOTARepository) ListPackagesByID(ids []uint, component string) ([]model.OTAPackage, error) {
+	db := r.db.Where("id IN ?", ids)
+	if component != "" {
+		db = db.Where("component = ?", component)
+	}
+	var packages []model.OTAPackage
+	err := db.Find(&packages).Error
+	return packages, err
+}
+
+func (r *gormOTARepository) CreateUpdate(update *model.OTAUpdate) error {
+	return r.db.Create(update).Error
+}
+
+func (r *gormOTARepository) FindDeviceUpdate(sn string, id uint) (*model.OTAUpdate, error) {
+	var update model.OTAUpdate
+	if err := r.db.Where("id = ? AND device_sn = ?", id, sn).First(&update).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &update, nil
+}
+
+func (r *gormOTARepository) FindActiveUpdate(sn string, packageID uint) (*model.OTAUpdate, error) {
+	var update model.OTAUpdate
+	err := r.db.Where("device_sn = ? AND package_id = ? AND status IN ?", sn, packageID, model.OTAUpdateActiveStatuses).
+		Order("id DESC").
+		First(&update).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &update, nil
+}
+
+func (r *gormOTARepository) ModifyUpdate(update *model.OTAUpdate, fields map[string]interface{}) error {
+	return r.db.Model(update).Updates(fields).Error
+}
+
+func (r *gormOTARepository) ListDeviceUpdates(sn string, limit int) ([]model.OTAUpdate, error) {
+	var updates []model.OTAUpdate
+	err := r.db.Where("device_sn = ?", sn).Order("id DESC").Limit(limit).Find(&updates).Error
+	return updates, err
+}
+
+func (r *gormOTARepository) ListActiveUpdates(sn string) ([]model.OTAUpdate, error) {
+	var updates []model.OTAUpdate
+	err := r.db.Where("device_sn = ? AND status IN ?", sn, model.OTAUpdateActiveStatuses).Find(&updates).Error
+	return updates, err
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// OTACampaignFilter 升级活动查询条件，字段为空时不限制
+type OTACampaignFilter struct {
+	Status    string
+	PackageID uint
+}
+
+// OTAStageCount 升级活动某阶段某状态的升级记录数
+type OTAStageCount struct {
+	CampaignStage int
+	Status        string
+	Count         int64
+}
+
+// OTACampaignRepository 灰度升级活动仓储
+type OTACampaignRepository interface {
+	Create(campaign *model.OTACampaign) error
+	Find(id uint) (*model.OTACampaign, error)
+	// List 分页查询升级活动，按ID倒序，同时返回总数
+	List(filter OTACampaignFilter, page Page) ([]model.OTACampaign, int64, error)
+	// ListRunning 查询全部进行中的升级活动
+	ListRunning() ([]model.OTACampaign, error)
+	// HasOpen 升级包是否有exceptID以外未结束的升级活动
+	HasOpen(packageID, exceptID uint) (bool, error)
+
+	// Transition 更新处于from状态之一的升级活动，返回是否更新成功
+	Transition(id uint, from []string, fields map[string]interface{}) (bool, error)
+	// AdvanceStage 更新进行中且处于stage阶段的升级活动，返回是否更新成功
+	AdvanceStage(id uint, stage int, fields map[string]interface{}) (bool, error)
+	// UpdatePendingUpdates 更新升级活动中尚未开始下载的升级记录
+	UpdatePendingUpdates(id uint, fields map[string]interface{}) error
+
+	// CountUpdates 按阶段和状态统计升级活动的升级记录，since不为空时只统计该时间之后下发的升级
+	CountUpdates(id uint, since *time.Time) ([]OTAStageCount, error)
+	// CountAlarmDevices 按阶段统计升级成功后产生minLevel及以上级别告警的设备数，返回结果的Status为空
+	CountAlarmDevices(id uint, since *time.Time, minLevel int) ([]OTAStageCount, error)
+}
+
+// gormOTACampaignRepository 基于GORM的升级活动仓储
+type gormOTACampaignRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormOTACampaignRepository) Create(campaign *model.OTACampaign) error {
+	return r.db.Create(campaign).Error
+}
+
+func (r *gormOTACampaignRepository) Find(id uint) (*model.OTACampaign, error) {
+	var campaign model.OTACampaign
+	if err := r.db.First(&campaign, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &campaign, nil
+}
+
+func (r *gormOTACampaignRepository) List(filter OTACampaignFilter, page Page) ([]model.OTACampaign, int64, error) {
+	db := r.db.Model(&model.OTACampaign{})
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	if filter.PackageID != 0 {
+		db = db.Where("package_id = ?", filter.PackageID)
+	}
+
+	var campaigns []model.OTACampaign
+	total, err := findPage(db, "id DESC", page, &campaigns)
+	return campaigns, total, err
+}
+
+func (r *gormOTACampaignRepository) ListRunning() ([]model.OTACampaign, error) {
+	var campaigns []model.OTACampaign
+	err := r.db.Where("status = ?", model.OTACampaignRunning).Find(&campaigns).Error
+	return campaigns, err
+}
+
+func (r *gormOTACampaignRepository) HasOpen(packageID, exceptID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.OTACampaign{}).
+		Where("package_id = ? AND id <> ? AND status IN ?", packageID, exceptID, model.OTACampaignOpenStatuses).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormOTACampaignRepository) Transition(id uint, from []string, fields map[string]interface{}) (bool, error) {
+	result := r.db.Model(&model.OTACampaign{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormOTACampaignRepository) AdvanceStage(id uint, stage int, fields map[string]interface{}) (bool, error) {
+	result := r.db.Model(&model.OTACampaign{}).
+		Where("id = ? AND status = ? AND current_stage = ?", id, model.OTACampaignRunning, stage).
+		Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormOTACampaignRepository) UpdatePendingUpdates(id uint, fields map[string]interface{}) error {
+	return r.db.Model(&model.OTAUpdate{}).
+		Where("campaign_id = ? AND status = ?", id, model.OTAUpdatePending).
+		Updates(fields).Error
+}
+
+func (r *gormOTACampaignRepository) CountUpdates(id uint, since *time.Time) ([]OTAStageCount, error) {
+	db := r.db.Model(&model.OTAUpdate{}).Where("campaign_id = ?", id)
+	if since != nil {
+		db = db.Where("created_at >= ?", *since)
+	}
+
+	var counts []OTAStageCount
+	err := db.Select("campaign_stage, status, COUNT(*) AS count").
+		Group("campaign_stage, status").
+		Scan(&counts).Error
+	return counts, err
+}
+
+func (r *gormOTACampaignRepository) CountAlarmDevices(id uint, since *time.Time, minLevel int) ([]OTAStageCount, error) {
+	db := r.db.Table("md_ota_updates AS u").
+		Joins("JOIN md_device_alarm AS a ON a.device_sn = u.device_sn AND a.create_time >= u.finished_at AND a.alarm_level >= ?", minLevel).
+		Where("u.campaign_id = ? AND u.status = ?", id, model.OTAUpdateSuccess)
+	if since != nil {
+		db = db.Where("u.created_at >= ?", *since)
+	}
+
+	var counts []OTAStageCount
+	err := db.Select("u.campaign_stage AS campaign_stage, COUNT(DISTINCT u.device_sn) AS count").
+		Group("u.campaign_stage").
+		Scan(&counts).Error
+	return counts, err
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// PrintImageRepository 打印图片仓储
+type PrintImageRepository interface {
+	Create(image *model.PrintImage) error
+	// UpdateByTask 更新设备指定任务的图片
+	UpdateByTask(taskID, sn string, fields map[string]interface{}) error
+	// List 查询访问范围内的打印图片，taskID为空时不限任务
+	List(tenant Tenant, taskID string) ([]model.PrintImage, error)
+}
+
+// gormPrintImageRepository 基于GORM的打印图片仓储
+type gormPrintImageRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPrintImageRepository) Create(image *model.PrintImage) error {
+	return r.db.Create(image).Error
+}
+
+func (r *gormPrintImageRepository) UpdateByTask(taskID, sn string, fields map[string]interface{}) error {
+	return r.db.Model(&model.PrintImage{}).
+		Where("task_id = ? AND device_sn = ?", taskID, sn).
+		Updates(fields).Error
+}
+
+func (r *gormPrintImageRepository) List(tenant Tenant, taskID string) ([]model.PrintImage, error) {
+	var images []model.PrintImage
+	db := tenant.Scope(r.db)
+	if taskID != "" {
+		db = db.Where("task_id = ?", taskID)
+	}
+	err := db.Find(&images).Error
+	return images, err
+}
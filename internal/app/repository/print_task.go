@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// PrintTaskRepository 打印任务及状态变更历史仓储
+type PrintTaskRepository interface {
+	// FindTask 查询设备的打印任务
+	FindTask(taskID, sn string) (*model.PrintTask, error)
+	CreateTask(task *model.PrintTask) error
+	UpdateTask(task *model.PrintTask, fields map[string]interface{}) error
+	CreateHistory(history *model.PrintTaskHistory) error
+
+	// ListTasks 查询访问范围内的打印任务，status为空时不限状态，按创建时间倒序
+	ListTasks(tenant Tenant, status string) ([]model.PrintTask, error)
+	// ListHistory 查询访问范围内任务的状态变更历史，按变更时间倒序
+	ListHistory(tenant Tenant, taskID string) ([]model.PrintTaskHistory, error)
+}
+
+// gormPrintTaskRepository 基于GORM的打印任务仓储
+type gormPrintTaskRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPrintTaskRepository) FindTask(taskID, sn string) (*model.PrintTask, error) {
+	var task model.PrintTask
+	if err := r.db.Where("task_id = ? AND device_sn = ?", taskID, sn).First(&task).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &task, nil
+}
+
+func (r *gormPrintTaskRepository) CreateTask(task *model.PrintTask) error {
+	return r.db.Create(task).Error
+}
+
+func (r *gormPrintTaskRepository) UpdateTask(task *model.PrintTask, fields map[string]interface{}) error {
+	return r.db.Model(task).Updates(fields).Error
+}
+
+func (r *gormPrintTaskRepository) CreateHistory(history *model.PrintTaskHistory) error {
+	return r.db.Create(history).Error
+}
+
+func (r *gormPrintTaskRepository) ListTasks(tenant Tenant, status string) ([]model.PrintTask, error) {
+	var tasks []model.PrintTask
+	query := tenant.Scope(r.db)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("create_time DESC").Find(&tasks).Error
+	return tasks, err
+}
+
+func (r *gormPrintTaskRepository) ListHistory(tenant Tenant, taskID string) ([]model.PrintTaskHistory, error) {
+	var history []model.PrintTaskHistory
+	err := tenant.Scope(r.db).Where("task_id = ?", taskID).
+		Order("change_time DESC").
+		Find(&history).Error
+	return history, err
+}
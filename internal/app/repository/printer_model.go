@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// PrinterModelRepository 打印机机型仓储，机型删除为物理删除，唯一性校验包含已删除的记录
+type PrinterModelRepository interface {
+	FindByCode(code string) (*model.PrinterModel, error)
+	// ExistsByCodeOrName 机型代码或名称是否已被使用
+	ExistsByCodeOrName(code, name string) (bool, error)
+	// ExistsByName 名称是否已被excludeID以外的机型使用
+	ExistsByName(name string, excludeID uint) (bool, error)
+	// InUse 是否有设备或出厂预置记录使用该机型
+	InUse(code string) (bool, error)
+	Create(m *model.PrinterModel) error
+	Update(m *model.PrinterModel, fields map[string]interface{}) error
+	Delete(m *model.PrinterModel) error
+	// List 查询全部机型，按机型代码排序
+	List() ([]model.PrinterModel, error)
+}
+
+// gormPrinterModelRepository 基于GORM的机型仓储
+type gormPrinterModelRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPrinterModelRepository) FindByCode(code string) (*model.PrinterModel, error) {
+	var m model.PrinterModel
+	if err := r.db.Where("code = ?", code).First(&m).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &m, nil
+}
+
+func (r *gormPrinterModelRepository) ExistsByCodeOrName(code, name string) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&model.PrinterModel{}).
+		Where("code = ? OR name = ?", code, name).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormPrinterModelRepository) ExistsByName(name string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&model.PrinterModel{}).
+		Where("name = ? AND id <> ?", name, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormPrinterModelRepository) InUse(code string) (bool, error) {
+	var devices, provisions int64
+	if err := r.db.Model(&model.Device{}).Where("sn LIKE ?", code+"%").Count(&devices).Error; err != nil {
+		return false, err
+	}
+	if err := r.db.Model(&model.DeviceProvision{}).Where("sn LIKE ?", code+"%").Count(&provisions).Error; err != nil {
+		return false, err
+	}
+	return devices+provisions > 0, nil
+}
+
+func (r *gormPrinterModelRepository) Create(m *model.PrinterModel) error {
+	return r.db.Create(m).Error
+}
+
+func (r *gormPrinterModelRepository) Update(m *model.PrinterModel, fields map[string]interface{}) error {
+	return r.db.Model(m).Updates(fields).Error
+}
+
+func (r *gormPrinterModelRepository) Delete(m *model.PrinterModel) error {
+	return r.db.Unscoped().Delete(m).Error
+}
+
+func (r *gormPrinterModelRepository) List() ([]model.PrinterModel, error) {
+	var list []model.PrinterModel
+	err := r.db.Order("code ASC").Find(&list).Error
+	return list, err
+}
@@ -0,0 +1,143 @@
+// Package repository 数据访问层，按聚合定义仓储接口，默认实现基于GORM，同时支持MySQL和SQLite
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound 记录不存在
+var ErrNotFound = errors.New("record not found")
+
+// Page 分页范围
+type Page struct {
+	Offset int
+	Limit  int
+}
+
+// Store 仓储集合，Transaction回调中的仓储共享同一个数据库事务
+type Store interface {
+	Devices() DeviceRepository
+	Tokens() TokenRepository
+	DeviceStatus() DeviceStatusRepository
+	DeviceNetwork() DeviceNetworkRepository
+	DeviceInfo() DeviceInfoRepository
+	DeviceShadows() DeviceShadowRepository
+	DeviceCommands() DeviceCommandRepository
+	PrintTasks() PrintTaskRepository
+	PrintImages() PrintImageRepository
+	Alarms() AlarmRepository
+	AuthAudits() AuthAuditRepository
+	Organizations() OrganizationRepository
+	Operators() OperatorRepository
+	APIKeys() APIKeyRepository
+	PrinterModels() PrinterModelRepository
+	OTA() OTARepository
+	OTACampaigns() OTACampaignRepository
+
+	// Transaction 在事务中执行fn，fn返回错误或发生panic时回滚
+	Transaction(fn func(store Store) error) error
+}
+
+// gormStore 基于GORM的仓储集合
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewStore 创建基于GORM的仓储集合
+func NewStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Devices() DeviceRepository {
+	return &gormDeviceRepository{db: s.db}
+}
+
+func (s *gormStore) Tokens() TokenRepository {
+	return &gormTokenRepository{db: s.db}
+}
+
+func (s *gormStore) DeviceStatus() DeviceStatusRepository {
+	return &gormDeviceStatusRepository{db: s.db}
+}
+
+func (s *gormStore) DeviceNetwork() DeviceNetworkRepository {
+	return &gormDeviceNetworkRepository{db: s.db}
+}
+
+func (s *gormStore) DeviceInfo() DeviceInfoRepository {
+	return &gormDeviceInfoRepository{db: s.db}
+}
+
+func (s *gormStore) DeviceShadows() DeviceShadowRepository {
+	return &gormDeviceShadowRepository{db: s.db}
+}
+
+func (s *gormStore) DeviceCommands() DeviceCommandRepository {
+	return &gormDeviceCommandRepository{db: s.db}
+}
+
+func (s *gormStore) PrintTasks() PrintTaskRepository {
+	return &gormPrintTaskRepository{db: s.db}
+}
+
+func (s *gormStore) PrintImages() PrintImageRepository {
+	return &gormPrintImageRepository{db: s.db}
+}
+
+func (s *gormStore) Alarms() AlarmRepository {
+	return &gormAlarmRepository{db: s.db}
+}
+
+func (s *gormStore) AuthAudits() AuthAuditRepository {
+	return &gormAuthAuditRepository{db: s.db}
+}
+
+func (s *gormStore) Organizations() OrganizationRepository {
+	return &gormOrganizationRepository{db: s.db}
+}
+
+func (s *gormStore) Operators() OperatorRepository {
+	return &gormOperatorRepository{db: s.db}
+}
+
+func (s *gormStore) APIKeys() APIKeyRepository {
+	return &gormAPIKeyRepository{db: s.db}
+}
+
+func (s *gormStore) PrinterModels() PrinterModelRepository {
+	return &gormPrinterModelRepository{db: s.db}
+}
+
+func (s *gormStore) OTA() OTARepository {
+	return &gormOTARepository{db: s.db}
+}
+
+func (s *gormStore) OTACampaigns() OTACampaignRepository {
+	return &gormOTACampaignRepository{db: s.db}
+}
+
+func (s *gormStore) Transaction(fn func(store Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx})
+	})
+}
+
+// translateError 将GORM的记录不存在错误转换为ErrNotFound
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// findPage 统计总数后按order排序查询一页数据到dest
+func findPage(db *gorm.DB, order string, page Page, dest interface{}) (int64, error) {
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return 0, err
+	}
+	err := db.Order(order).Offset(page.Offset).Limit(page.Limit).Find(dest).Error
+	return total, err
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// Tenant 数据访问范围
+// 设备只能访问自己的数据；组织运维人员只能访问本组织设备的数据；
+// 两者都为空表示平台运维人员，可以访问全部数据
+type Tenant struct {
+	DeviceSN       string // 限定设备SN
+	OrganizationID *uint  // 限定组织
+}
+
+// IsPlatform 是否为平台范围(不限定设备和组织)
+func (t Tenant) IsPlatform() bool {
+	return t.DeviceSN == "" && t.OrganizationID == nil
+}
+
+// WithDevice 在当前范围内进一步限定设备SN，sn为空时保持不变
+func (t Tenant) WithDevice(sn string) Tenant {
+	if sn != "" {
+		t.DeviceSN = sn
+	}
+	return t
+}
+
+// Scope 为包含device_sn列的表添加访问范围条件
+func (t Tenant) Scope(db *gorm.DB) *gorm.DB {
+	if t.DeviceSN != "" {
+		db = db.Where("device_sn = ?", t.DeviceSN)
+	}
+	if t.OrganizationID != nil {
+		db = db.Where("device_sn IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&model.Device{}).
+			Select("sn").Where("organization_id = ?", *t.OrganizationID))
+	}
+	return db
+}
+
+// DeviceScope 为设备表添加访问范围条件
+func (t Tenant) DeviceScope(db *gorm.DB) *gorm.DB {
+	if t.DeviceSN != "" {
+		db = db.Where("sn = ?", t.DeviceSN)
+	}
+	if t.OrganizationID != nil {
+		db = db.Where("organization_id = ?", *t.OrganizationID)
+	}
+	return db
+}
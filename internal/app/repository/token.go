@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// TokenRepository 设备令牌仓储，令牌只保存摘要
+type TokenRepository interface {
+	Create(tokens []model.DeviceToken) error
+	// FindByHashForUpdate 按摘要查询并锁定令牌记录，需在事务中使用
+	FindByHashForUpdate(hash, tokenType string) (*model.DeviceToken, error)
+	// ListActive 查询设备未撤销且未过期的令牌，按签发时间倒序
+	ListActive(deviceID uint, tokenType string) ([]model.DeviceToken, error)
+	// ListActiveInFamilies 查询指定令牌族中未撤销且未过期的令牌
+	ListActiveInFamilies(deviceID uint, families []string, tokenType string) ([]model.DeviceToken, error)
+	CountFamily(deviceID uint, familyID string) (int64, error)
+	// IsRevoked 按摘要检查令牌记录是否已撤销，没有记录时视为已撤销
+	IsRevoked(hash string) (bool, error)
+
+	Revoke(token *model.DeviceToken) error
+	RevokeFamilies(deviceID uint, families []string) error
+	RevokeAll(deviceID uint) error
+
+	// DeleteExpired 物理删除一批过期时间早于before的令牌记录，返回删除条数
+	DeleteExpired(before time.Time, limit int) (int64, error)
+}
+
+// gormTokenRepository 基于GORM的令牌仓储
+type gormTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormTokenRepository) Create(tokens []model.DeviceToken) error {
+	return r.db.Create(&tokens).Error
+}
+
+func (r *gormTokenRepository) FindByHashForUpdate(hash, tokenType string) (*model.DeviceToken, error) {
+	var token model.DeviceToken
+	if err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND token_type = ?", hash, tokenType).
+		First(&token).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+func (r *gormTokenRepository) ListActive(deviceID uint, tokenType string) ([]model.DeviceToken, error) {
+	var tokens []model.DeviceToken
+	err := r.db.Where("device_id = ? AND token_type = ? AND revoked = ? AND expire_at > ?",
+		deviceID, tokenType, false, time.Now()).
+		Order("created_at DESC, id DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *gormTokenRepository) ListActiveInFamilies(deviceID uint, families []string, tokenType string) ([]model.DeviceToken, error) {
+	var tokens []model.DeviceToken
+	err := r.db.Where("device_id = ? AND family_id IN ? AND token_type = ? AND revoked = ? AND expire_at > ?",
+		deviceID, families, tokenType, false, time.Now()).
+		Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *gormTokenRepository) CountFamily(deviceID uint, familyID string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.DeviceToken{}).
+		Where("device_id = ? AND family_id = ?", deviceID, familyID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormTokenRepository) IsRevoked(hash string) (bool, error) {
+	var token model.DeviceToken
+	err := r.db.Select("revoked").Where("token_hash = ?", hash).First(&token).Error
+	if translateError(err) == ErrNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return token.Revoked, nil
+}
+
+func (r *gormTokenRepository) Revoke(token *model.DeviceToken) error {
+	if err := r.db.Model(token).Update("revoked", true).Error; err != nil {
+		return err
+	}
+	token.Revoked = true
+	return nil
+}
+
+func (r *gormTokenRepository) RevokeFamilies(deviceID uint, families []string) error {
+	return r.db.Model(&model.DeviceToken{}).
+		Where("device_id = ? AND family_id IN ?", deviceID, families).
+		Update("revoked", true).Error
+}
+
+func (r *gormTokenRepository) RevokeAll(deviceID uint) error {
+	return r.db.Model(&model.DeviceToken{}).
+		Where("device_id = ? AND revoked = ?", deviceID, false).
+		Update("revoked", true).Error
+}
+
+func (r *gormTokenRepository) DeleteExpired(before time.Time, limit int) (int64, error) {
+	// 按ID分批删除，避免单条语句锁定过多行
+	var ids []uint
+	if err := r.db.Unscoped().Model(&model.DeviceToken{}).
+		Where("expire_at < ?", before).
+		Limit(limit).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result := r.db.Unscoped().Delete(&model.DeviceToken{}, ids)
+	return result.RowsAffected, result.Error
+}
+
+// TokenRevokedByDevice 令牌是否已被设备级撤销(早于设备令牌生效时间签发)
+// JWT签发时间只精确到秒，与撤销同一秒签发的令牌无法按时间区分先后，按令牌记录的撤销标记判断
+func TokenRevokedByDevice(tokens TokenRepository, device *model.Device, issuedAt int64, tokenHash string) bool {
+	if device.TokensValidAfter == nil {
+		return false
+	}
+	validAfter := device.TokensValidAfter.Unix()
+	if issuedAt != validAfter {
+		return issuedAt < validAfter
+	}
+	revoked, err := tokens.IsRevoked(tokenHash)
+	return err != nil || revoked
+}
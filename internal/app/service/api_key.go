@@ -0,0 +1,114 @@
+package service
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// API密钥前缀和密文长度(十六进制字符)
+const (
+	apiKeyPrefixLength = 8
+	apiKeySecretLength = 40
+)
+
+// APIKeyService 第三方API密钥服务
+type APIKeyService struct {
+	store repository.Store
+}
+
+// NewAPIKeyService 创建API密钥服务实例
+func NewAPIKeyService(store repository.Store) *APIKeyService {
+	return &APIKeyService{store: store}
+}
+
+// CreateAPIKeyRequest 创建API密钥请求
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" binding:"required,max=64"`
+	Scopes     []string   `json:"scopes" binding:"required,min=1"`
+	AllowedIPs []string   `json:"allowed_ips"` // 允许的来源IP或CIDR
+	ExpiresAt  *time.Time `json:"expires_at"`  // 过期时间，为空表示永不过期
+}
+
+// APIKeyCreateResult 创建API密钥结果，完整密钥只返回一次
+type APIKeyCreateResult struct {
+	Key    string        `json:"key"`
+	APIKey *model.APIKey `json:"api_key"`
+}
+
+// CreateAPIKey 为当前组织创建API密钥，平台运维人员创建的密钥可访问全部设备
+func (s *APIKeyService) CreateAPIKey(orgID *uint, req *CreateAPIKeyRequest, createdBy string) (*APIKeyCreateResult, error) {
+	for _, scope := range req.Scopes {
+		if !model.IsValidScope(scope) {
+			return nil, errors.New(errors.ErrInvalidParams, "无效的授权范围: "+scope)
+		}
+	}
+	for _, entry := range req.AllowedIPs {
+		if !isValidIPEntry(entry) {
+			return nil, errors.New(errors.ErrInvalidParams, "无效的IP地址: "+entry)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, errors.New(errors.ErrInvalidParams, "过期时间必须晚于当前时间")
+	}
+
+	prefix := utils.GenerateRandomString(apiKeyPrefixLength)
+	rawKey := model.APIKeyPrefix + prefix + "_" + utils.GenerateRandomString(apiKeySecretLength)
+
+	key := &model.APIKey{
+		Name:           req.Name,
+		Prefix:         prefix,
+		KeyHash:        utils.HashToken(rawKey),
+		Scopes:         strings.Join(req.Scopes, ","),
+		AllowedIPs:     strings.Join(req.AllowedIPs, ","),
+		OrganizationID: orgID,
+		ExpiresAt:      req.ExpiresAt,
+		CreatedBy:      createdBy,
+	}
+	if err := s.store.APIKeys().Create(key); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	return &APIKeyCreateResult{Key: rawKey, APIKey: key}, nil
+}
+
+// ListAPIKeys 查询访问范围内的API密钥
+func (s *APIKeyService) ListAPIKeys(tenant Tenant) ([]model.APIKey, error) {
+	keys, err := s.store.APIKeys().List(tenant)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey 撤销API密钥，撤销后立即失效
+func (s *APIKeyService) RevokeAPIKey(tenant Tenant, id uint) (*model.APIKey, error) {
+	key, err := s.store.APIKeys().FindInScope(tenant, id)
+	if err != nil {
+		return nil, errors.New(errors.ErrInvalidParams, "API密钥不存在")
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+
+	now := time.Now()
+	if err := s.store.APIKeys().Update(key, map[string]interface{}{"revoked_at": now}); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	key.RevokedAt = &now
+	return key, nil
+}
+
+// isValidIPEntry 校验IP地址或CIDR
+func isValidIPEntry(entry string) bool {
+	if strings.Contains(entry, "/") {
+		_, _, err := net.ParseCIDR(entry)
+		return err == nil
+	}
+	return net.ParseIP(entry) != nil
+}
@@ -2,11 +2,13 @@ package service
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt"
 	mdmodel "mingda_cloud_service/internal/app/model"
-	"mingda_cloud_service/internal/pkg/database"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
 	"mingda_cloud_service/internal/pkg/errors"
 	"mingda_cloud_service/internal/pkg/utils"
 	"mingda_cloud_service/internal/pkg/validator"
@@ -46,65 +48,136 @@ func (dl *DeviceLock) Unlock(deviceID uint) {
 }
 
 type AuthService struct {
-	jwtSecret string
-	aesKey    []byte
-	deviceLock *DeviceLock
+	store       repository.Store
+	jwtSecret   string
+	cipher      *utils.SecretCipher
+	deviceLock  *DeviceLock
+	lockout     *LockoutService
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	maxSessions int
 }
 
-func NewAuthService(jwtSecret, aesKey string) *AuthService {
-	return &AuthService{
-		jwtSecret:  jwtSecret,
-		aesKey:     []byte(aesKey),
-		deviceLock: NewDeviceLock(),
+const (
+	defaultAccessTokenTTL  = 2 * time.Hour
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	defaultMaxSessions     = 5
+)
+
+func NewAuthService(store repository.Store, jwtSecret string, cipher *utils.SecretCipher, authCfg config.AuthConfig) *AuthService {
+	s := &AuthService{
+		store:       store,
+		jwtSecret:   jwtSecret,
+		cipher:      cipher,
+		deviceLock:  NewDeviceLock(),
+		lockout:     NewLockoutService(store, authCfg),
+		accessTTL:   time.Duration(authCfg.AccessTokenTTL) * time.Second,
+		refreshTTL:  time.Duration(authCfg.RefreshTokenTTL) * time.Second,
+		maxSessions: authCfg.MaxActiveSessions,
+	}
+	if s.accessTTL <= 0 {
+		s.accessTTL = defaultAccessTokenTTL
+	}
+	if s.refreshTTL <= 0 {
+		s.refreshTTL = defaultRefreshTokenTTL
 	}
+	if s.maxSessions <= 0 {
+		s.maxSessions = defaultMaxSessions
+	}
+	return s
 }
 
 // RegisterDevice 注册设备
-func (s *AuthService) RegisterDevice(sn, model string) (*mdmodel.Device, error) {
+// 由服务器生成密钥时返回密钥明文，仅此一次；出厂预置的设备已持有密钥，不再返回
+func (s *AuthService) RegisterDevice(sn, model string) (*mdmodel.Device, string, error) {
 	// 验证SN码格式
 	if err := validator.ValidateDeviceSN(sn); err != nil {
-		return nil, errors.New(errors.ErrInvalidSN, err.Error())
+		return nil, "", errors.New(errors.ErrInvalidSN, err.Error())
 	}
 
-	// 检查设备是否已存在
-	var device mdmodel.Device
-	if err := database.DB.Where("sn = ?", sn).First(&device).Error; err == nil {
-		return nil, errors.New(errors.ErrDeviceDisabled, "设备已注册")
+	// 验证型号与SN中的机型代码一致，统一使用登记的型号名称保存
+	printerModel, err := checkDeviceModel(sn, model)
+	if err != nil {
+		return nil, "", err
 	}
+	model = printerModel.Name
 
-	// 在生产环境下，应该从生产管理系统获取预置的密钥
-	var secret string
-	if gin.Mode() == gin.DebugMode {
-		// 开发环境：生成随机密钥
-		secret = utils.GenerateRandomString(32)
-	} else {
-		// 生产环境：从生产管理系统获取预置密钥
-		// TODO: 实现从生产管理系统获取密钥的逻辑
-		// secret = productionSystem.GetDeviceSecret(sn)
-		// if secret == "" {
-		//     return nil, errors.New(errors.ErrDeviceNotFound, "设备未授权")
-		// }
-		secret = utils.GenerateRandomString(32) // 临时使用，实际生产环境需要替换
-	}
+	// 检查设备是否已存在
+	if _, err := s.store.Devices().FindBySN(sn); err == nil {
+		return nil, "", errors.New(errors.ErrDeviceDisabled, "设备已注册")
+	}
+
+	var device *mdmodel.Device
+	var revealSecret string
+	err = s.store.Transaction(func(store repository.Store) error {
+		devices := store.Devices()
+
+		// 查询出厂预置信息
+		var secret, claimCodeHash string
+		provision, err := devices.FindProvisionForUpdate(sn)
+		switch {
+		case err == nil:
+			if provision.Status == mdmodel.ProvisionStatusRegistered {
+				return errors.New(errors.ErrDeviceDisabled, "设备已注册")
+			}
+			if !strings.EqualFold(provision.DeviceModel, model) {
+				return errors.New(errors.ErrDeviceTypeInvalid, "设备型号与出厂信息不符")
+			}
+			secret = provision.Secret // 预置密钥已加密保存
+			claimCodeHash = provision.ClaimCodeHash
+		case err != repository.ErrNotFound:
+			return errors.NewWithError(errors.ErrDatabase, err)
+		case gin.Mode() == gin.DebugMode:
+			// 开发环境：未预置的设备生成随机密钥
+			revealSecret = utils.GenerateRandomString(32)
+			encrypted, err := s.cipher.Encrypt(revealSecret)
+			if err != nil {
+				return errors.NewWithError(errors.ErrEncrypt, err)
+			}
+			secret = encrypted
+		default:
+			// 生产环境：只允许出厂预置的设备注册
+			return errors.New(errors.ErrDeviceNotFound, "设备未授权")
+		}
 
-	// 创建设备记录
-	device = mdmodel.Device{
-		SN:          sn,
-		DeviceModel: model,
-		Secret:      secret,
-		Status:      0, // 初始状态：未激活
-		LastOnline:  time.Now(), // 设置初始在线时间
-	}
+		// 创建设备记录
+		device = &mdmodel.Device{
+			SN:            sn,
+			DeviceModel:   model,
+			Secret:        secret,
+			ClaimCodeHash: claimCodeHash,
+			Status:        0,          // 初始状态：未激活
+			LastOnline:    time.Now(), // 设置初始在线时间
+		}
+		if err := devices.Create(device); err != nil {
+			return fmt.Errorf("create device error: %v", err)
+		}
 
-	if err := database.DB.Create(&device).Error; err != nil {
-		return nil, fmt.Errorf("create device error: %v", err)
+		// 标记出厂预置记录已注册
+		if provision != nil {
+			if err := devices.UpdateProvision(provision, map[string]interface{}{
+				"status":        mdmodel.ProvisionStatusRegistered,
+				"registered_at": time.Now(),
+			}); err != nil {
+				return errors.NewWithError(errors.ErrDatabase, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", txError(err)
 	}
 
-	return &device, nil
+	return device, revealSecret, nil
 }
 
 // AuthenticateDevice 设备认证（使用分布式锁）
-func (s *AuthService) AuthenticateDevice(sn, sign string, timestamp int64) (*mdmodel.Device, error) {
+// 同一SN或IP认证失败次数过多时临时锁定
+func (s *AuthService) AuthenticateDevice(sn, sign string, timestamp int64, meta RequestMeta) (*mdmodel.Device, error) {
+	if remaining := s.lockout.RetryAfter(sn, meta.ClientIP); remaining > 0 {
+		return nil, lockedError(remaining)
+	}
+
 	ctx := context.Background()
 	lockKey := fmt.Sprintf("device_lock:%s", sn)
 	
@@ -114,213 +187,413 @@ func (s *AuthService) AuthenticateDevice(sn, sign string, timestamp int64) (*mdm
 	}
 	defer redis.Unlock(ctx, lockKey)
 
-	// 开启事务
-	tx := database.DB.Begin()
+	var device *mdmodel.Device
+	var lockedID uint
 	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+		if lockedID != 0 {
+			s.deviceLock.Unlock(lockedID)
 		}
 	}()
 
-	// 获取设备信息（加锁）
-	var device mdmodel.Device
-	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("sn = ?", sn).First(&device).Error; err != nil {
-		tx.Rollback()
-		return nil, errors.New(errors.ErrDeviceNotFound, "设备未注册")
-	}
+	err := s.store.Transaction(func(store repository.Store) error {
+		devices := store.Devices()
 
-	// 获取设备锁
-	if !s.deviceLock.Lock(device.ID) {
-		tx.Rollback()
-		return nil, errors.New(errors.ErrTooManyReq, "设备正忙")
-	}
-	defer s.deviceLock.Unlock(device.ID)
+		// 获取设备信息（加锁）
+		d, err := devices.FindBySNForUpdate(sn)
+		if err != nil {
+			// 未注册的SN只按IP统计，防止枚举SN
+			s.lockout.RecordFailure("", meta.ClientIP, "设备未注册")
+			return errors.New(errors.ErrDeviceNotFound, "设备未注册")
+		}
 
-	// 检查时间戳
-	if time.Now().Unix()-timestamp > 300 { // 5分钟内有效
-		tx.Rollback()
-		return nil, errors.New(errors.ErrTokenExpired, "请求已过期")
-	}
+		// 获取设备锁
+		if !s.deviceLock.Lock(d.ID) {
+			return errors.New(errors.ErrTooManyReq, "设备正忙")
+		}
+		lockedID = d.ID
 
-	// 验证签名
-	if !utils.ValidateSign(sn, device.Secret, timestamp, sign) {
-		tx.Rollback()
-		return nil, errors.New(errors.ErrInvalidSign, "签名验证失败")
-	}
+		// 检查时间戳
+		if time.Now().Unix()-timestamp > 300 { // 5分钟内有效
+			s.lockout.RecordFailure(sn, meta.ClientIP, "请求已过期")
+			return errors.New(errors.ErrTokenExpired, "请求已过期")
+		}
 
-	// 更新设备状态
-	if device.Status == 0 {
-		if err := tx.Model(&device).Update("status", 1).Error; err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("activate device error: %v", err)
+		// 验证签名，密钥轮换宽限期内旧密钥同样有效
+		matched, err := s.cipher.Match(d.SecretCandidates(time.Now()), func(secret string) bool {
+			return utils.ValidateSign(sn, secret, timestamp, sign)
+		})
+		if err != nil {
+			return errors.NewWithError(errors.ErrDecrypt, err)
+		}
+		if matched < 0 {
+			s.lockout.RecordFailure(sn, meta.ClientIP, "签名验证失败")
+			return errors.New(errors.ErrInvalidSign, "签名验证失败")
 		}
-		device.Status = 1
-	}
 
-	// 更新最后在线时间
-	now := time.Now()
-	if err := tx.Model(&device).Update("last_online", now).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("update last_online error: %v", err)
-	}
-	device.LastOnline = now
+		// 设备已使用新密钥认证，停用轮换前的旧密钥
+		if matched == 0 && d.PrevSecret != "" {
+			if err := devices.Update(d, map[string]interface{}{
+				"prev_secret":           "",
+				"prev_secret_expire_at": nil,
+			}); err != nil {
+				return errors.NewWithError(errors.ErrDatabase, err)
+			}
+			d.PrevSecret = ""
+			d.PrevSecretExpireAt = nil
+		}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("commit transaction error: %v", err)
+		// 明文或旧版本密钥加密的密钥，使用当前密钥重新加密
+		if s.cipher.NeedsReencrypt(d.Secret) {
+			secret, err := s.cipher.Decrypt(d.Secret)
+			if err != nil {
+				return errors.NewWithError(errors.ErrDecrypt, err)
+			}
+			encrypted, err := s.cipher.Encrypt(secret)
+			if err != nil {
+				return errors.NewWithError(errors.ErrEncrypt, err)
+			}
+			if err := devices.Update(d, map[string]interface{}{"secret": encrypted}); err != nil {
+				return errors.NewWithError(errors.ErrDatabase, err)
+			}
+			d.Secret = encrypted
+		}
+
+		// 停用、退役或返厂维修的设备不允许认证
+		if err := s.checkDeviceUsable(d); err != nil {
+			return err
+		}
+
+		// 首次认证激活设备
+		if d.Status == mdmodel.DeviceStatusProvisioned {
+			if _, err := transitionDevice(devices, d, mdmodel.DeviceStatusActive, "设备首次认证", mdmodel.OperatorSystem); err != nil {
+				return fmt.Errorf("activate device error: %v", err)
+			}
+		}
+
+		// 更新最后在线时间
+		now := time.Now()
+		if err := devices.Update(d, map[string]interface{}{"last_online": now}); err != nil {
+			return fmt.Errorf("update last_online error: %v", err)
+		}
+		d.LastOnline = now
+
+		device = d
+		return nil
+	})
+	if err != nil {
+		return nil, txError(err)
 	}
 
-	return &device, nil
+	s.lockout.ClearFailures(sn)
+	return device, nil
+}
+
+// LockoutRetryAfter 返回SN或IP的剩余锁定秒数，未锁定时返回0
+func (s *AuthService) LockoutRetryAfter(sn, ip string) int64 {
+	return retryAfterSeconds(s.lockout.RetryAfter(sn, ip))
 }
 
-// GenerateToken 生成访问令牌
-func (s *AuthService) GenerateToken(device *mdmodel.Device) (string, error) {
-	// 生成JWT token
-	token, err := utils.GenerateToken(device, s.jwtSecret, 24*time.Hour) // token有效期24小时
+// TokenPair 访问令牌与刷新令牌
+type TokenPair struct {
+	AccessToken      string `json:"token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`         // 访问令牌有效期(秒)
+	RefreshExpiresIn int64  `json:"refresh_expires_in"` // 刷新令牌有效期(秒)
+}
+
+// GenerateToken 生成访问令牌和刷新令牌，每次认证开启一个新的令牌族(会话)
+// 设备的有效会话超过上限时撤销最早签发的会话
+func (s *AuthService) GenerateToken(device *mdmodel.Device, meta RequestMeta) (*TokenPair, error) {
+	var pair *TokenPair
+	err := s.store.Transaction(func(store repository.Store) error {
+		var err error
+		pair, err = s.issueTokenPair(store.Tokens(), device, utils.GenerateRandomString(32), meta.ClientIP)
+		if err != nil {
+			return err
+		}
+
+		return enforceSessionLimit(store.Tokens(), device.ID, s.maxSessions)
+	})
 	if err != nil {
-		return "", err
+		return nil, txError(err)
 	}
 
-	// 保存token记录
-	deviceToken := &mdmodel.DeviceToken{
-		DeviceID: device.ID,
-		Token:    token,
-		ExpireAt: time.Now().Add(24 * time.Hour),
+	return pair, nil
+}
+
+// issueTokenPair 在指定令牌族下签发一对令牌并保存摘要记录
+func (s *AuthService) issueTokenPair(tokens repository.TokenRepository, device *mdmodel.Device, familyID, clientIP string) (*TokenPair, error) {
+	accessToken, err := utils.GenerateToken(device, s.jwtSecret, mdmodel.TokenTypeAccess, familyID, s.accessTTL)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := database.DB.Create(deviceToken).Error; err != nil {
-		return "", err
+	refreshToken, err := utils.GenerateToken(device, s.jwtSecret, mdmodel.TokenTypeRefresh, familyID, s.refreshTTL)
+	if err != nil {
+		return nil, err
 	}
 
-	return token, nil
+	// 保存token记录，只保存摘要
+	now := time.Now()
+	records := []mdmodel.DeviceToken{
+		{
+			DeviceID:  device.ID,
+			TokenType: mdmodel.TokenTypeAccess,
+			TokenHash: utils.HashToken(accessToken),
+			FamilyID:  familyID,
+			ExpireAt:  now.Add(s.accessTTL),
+			ClientIP:  clientIP,
+		},
+		{
+			DeviceID:  device.ID,
+			TokenType: mdmodel.TokenTypeRefresh,
+			TokenHash: utils.HashToken(refreshToken),
+			FamilyID:  familyID,
+			ExpireAt:  now.Add(s.refreshTTL),
+			ClientIP:  clientIP,
+		},
+	}
+
+	if err := tokens.Create(records); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(s.accessTTL.Seconds()),
+		RefreshExpiresIn: int64(s.refreshTTL.Seconds()),
+	}, nil
 }
 
 // ValidateToken 验证访问令牌
 func (s *AuthService) ValidateToken(tokenString string) (*mdmodel.Device, error) {
 	// 解析token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.jwtSecret), nil
-	})
-
+	claims, err := utils.ParseToken(tokenString, s.jwtSecret)
 	if err != nil {
 		return nil, errors.New(errors.ErrUnauthorized, "无效的访问令牌")
 	}
 
-	// 验证claims
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		deviceID := uint(claims["device_id"].(float64))
-		
-		// 获取设备信息
-		var device mdmodel.Device
-		if err := database.DB.First(&device, deviceID).Error; err != nil {
-			return nil, errors.New(errors.ErrDeviceNotFound, "设备不存在")
-		}
+	// 刷新令牌不能用于访问业务接口
+	if claims.IsRefresh() {
+		return nil, errors.New(errors.ErrInvalidToken, "无效的访问令牌")
+	}
 
-		// 检查设备状态
-		if err := s.checkDeviceStatus(&device); err != nil {
-			return nil, err
-		}
+	// 获取设备信息
+	device, err := s.store.Devices().FindByID(claims.DeviceID)
+	if err != nil {
+		return nil, errors.New(errors.ErrDeviceNotFound, "设备不存在")
+	}
+
+	// 检查设备状态
+	if err := s.checkDeviceStatus(device); err != nil {
+		return nil, err
+	}
 
-		return &device, nil
+	// 检查令牌是否已撤销
+	if s.isTokenRevoked(device, claims, tokenString) {
+		return nil, errors.New(errors.ErrInvalidToken, "token has been revoked")
 	}
 
-	return nil, errors.New(errors.ErrUnauthorized, "无效的访问令牌")
+	return device, nil
 }
 
 // checkDeviceStatus 检查设备状态
 func (s *AuthService) checkDeviceStatus(device *mdmodel.Device) error {
-	if device.Status != 1 {
+	if device.Status == mdmodel.DeviceStatusProvisioned {
 		return errors.New(errors.ErrUnauthorized, "device is not activated")
 	}
-	return nil
+	return s.checkDeviceUsable(device)
+}
+
+// checkDeviceUsable 检查设备是否处于可认证的生命周期状态
+func (s *AuthService) checkDeviceUsable(device *mdmodel.Device) error {
+	switch device.Status {
+	case mdmodel.DeviceStatusProvisioned, mdmodel.DeviceStatusActive:
+		return nil
+	case mdmodel.DeviceStatusSuspended:
+		return errors.New(errors.ErrDeviceDisabled, "设备已停用")
+	case mdmodel.DeviceStatusDecommissioned:
+		return errors.New(errors.ErrDeviceDisabled, "设备已退役")
+	case mdmodel.DeviceStatusRMA:
+		return errors.New(errors.ErrDeviceDisabled, "设备返厂维修中")
+	default:
+		return errors.New(errors.ErrDeviceDisabled, "设备不可用")
+	}
 }
 
-// RefreshToken 刷新访问令牌
-func (s *AuthService) RefreshToken(oldToken string) (string, error) {
-	// 解析旧token
-	claims, err := utils.ParseToken(oldToken, s.jwtSecret)
+// RefreshToken 使用刷新令牌换取新的令牌对
+// 刷新令牌只能使用一次，已使用的刷新令牌再次出现时视为泄露，撤销整个令牌族
+func (s *AuthService) RefreshToken(refreshToken string, meta RequestMeta) (*TokenPair, error) {
+	// 解析刷新令牌
+	claims, err := utils.ParseToken(refreshToken, s.jwtSecret)
 	if err != nil {
-		return "", errors.New(errors.ErrUnauthorized, "invalid token")
+		return nil, errors.New(errors.ErrUnauthorized, "invalid token")
+	}
+
+	// 只接受刷新令牌
+	if !claims.IsRefresh() {
+		return nil, errors.New(errors.ErrInvalidToken, "invalid token type, refresh token required")
 	}
 
 	// 获取设备锁
 	if !s.deviceLock.Lock(claims.DeviceID) {
-		return "", errors.New(errors.ErrTooManyReq, "设备正忙")
+		return nil, errors.New(errors.ErrTooManyReq, "设备正忙")
 	}
 	defer s.deviceLock.Unlock(claims.DeviceID)
 
-	// 开启事务
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+	// 重复使用时需要提交撤销令牌族的结果，再返回错误
+	var pair *TokenPair
+	var reused bool
+	err = s.store.Transaction(func(store repository.Store) error {
+		tokens := store.Tokens()
+
+		// 查找刷新令牌记录（加锁）
+		stored, err := tokens.FindByHashForUpdate(utils.HashToken(refreshToken), mdmodel.TokenTypeRefresh)
+		if err != nil {
+			return errors.New(errors.ErrUnauthorized, "token has been revoked")
 		}
-	}()
 
-	// 检查token是否在黑名单中
-	if s.isTokenBlacklisted(oldToken) {
-		tx.Rollback()
-		return "", errors.New(errors.ErrUnauthorized, "token has been revoked")
+		if stored.DeviceID != claims.DeviceID || stored.FamilyID != claims.FamilyID {
+			return errors.New(errors.ErrUnauthorized, "invalid token")
+		}
+
+		// 重复使用检测：撤销整个令牌族
+		if stored.Revoked {
+			reused = true
+			if err := tokens.RevokeFamilies(stored.DeviceID, []string{stored.FamilyID}); err != nil {
+				return errors.NewWithError(errors.ErrDatabase, err)
+			}
+			return nil
+		}
+
+		// 获取设备信息
+		device, err := store.Devices().FindByID(claims.DeviceID)
+		if err != nil {
+			return errors.New(errors.ErrDeviceNotFound, "device not found")
+		}
+
+		// 检查设备状态
+		if err := s.checkDeviceStatus(device); err != nil {
+			return err
+		}
+
+		// 旧刷新令牌作废
+		if err := tokens.Revoke(stored); err != nil {
+			return errors.NewWithError(errors.ErrDatabase, err)
+		}
+
+		// 在同一令牌族下签发新令牌
+		pair, err = s.issueTokenPair(tokens, device, stored.FamilyID, meta.ClientIP)
+		return err
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+	if reused {
+		return nil, errors.New(errors.ErrUnauthorized, "token has been revoked")
 	}
 
-	// 获取设备信息
-	var device mdmodel.Device
-	if err := tx.First(&device, claims.DeviceID).Error; err != nil {
-		tx.Rollback()
-		return "", errors.New(errors.ErrDeviceNotFound, "device not found")
+	return pair, nil
+}
+
+// TokenSubject 解析令牌所属设备，用于审计记录，令牌无效时返回空值
+func (s *AuthService) TokenSubject(token string) (string, uint) {
+	claims, err := utils.ParseToken(token, s.jwtSecret)
+	if err != nil {
+		return "", 0
 	}
+	return claims.DeviceSN, claims.DeviceID
+}
 
-	// 检查设备状态
-	if err := s.checkDeviceStatus(&device); err != nil {
-		tx.Rollback()
-		return "", err
+// Logout 设备登出，当前访问令牌加入黑名单并撤销所在令牌族
+func (s *AuthService) Logout(claims *utils.Claims, accessToken string) error {
+	if err := addToBlacklist(accessToken, claims.ExpiresAt); err != nil {
+		return errors.NewWithError(errors.ErrRedis, err)
 	}
 
-	// 生成新token
-	newToken, err := utils.GenerateToken(&device, s.jwtSecret, 24*time.Hour)
-	if err != nil {
-		tx.Rollback()
-		return "", err
+	if claims.FamilyID == "" {
+		return nil
 	}
 
-	// 将旧token加入黑名单
-	if err := s.addToBlacklist(oldToken, claims.ExpiresAt); err != nil {
-		tx.Rollback()
-		return "", err
+	if err := s.store.Tokens().RevokeFamilies(claims.DeviceID, []string{claims.FamilyID}); err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
 	}
 
-	// 保存新token记录
-	deviceToken := &mdmodel.DeviceToken{
-		DeviceID: device.ID,
-		Token:    newToken,
-		ExpireAt: time.Now().Add(24 * time.Hour),
+	return nil
+}
+
+// RevokeDeviceTokens 撤销设备的全部令牌
+// 只需写入设备的令牌生效时间，之前签发的访问令牌由认证中间件统一拒绝
+func (s *AuthService) RevokeDeviceTokens(sn string) error {
+	device, err := s.store.Devices().FindBySN(sn)
+	if err != nil {
+		return errors.New(errors.ErrDeviceNotFound, "设备不存在")
 	}
 
-	if err := tx.Create(deviceToken).Error; err != nil {
-		tx.Rollback()
-		return "", err
+	return revokeDeviceTokens(s.store, device)
+}
+
+// revokeDeviceTokens 写入令牌生效时间并标记全部令牌记录为已撤销
+func revokeDeviceTokens(store repository.Store, device *mdmodel.Device) error {
+	now := time.Now()
+	if err := store.Devices().Update(device, map[string]interface{}{"tokens_valid_after": now}); err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
 	}
+	device.TokensValidAfter = &now
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		return "", fmt.Errorf("commit transaction error: %v", err)
+	if err := store.Tokens().RevokeAll(device.ID); err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
 	}
 
-	return newToken, nil
+	return nil
+}
+
+// isTokenRevoked 检查令牌是否已被注销或被设备级撤销
+func (s *AuthService) isTokenRevoked(device *mdmodel.Device, claims *utils.Claims, token string) bool {
+	if repository.TokenRevokedByDevice(s.store.Tokens(), device, claims.IssuedAt, utils.HashToken(token)) {
+		return true
+	}
+	return s.isTokenBlacklisted(token)
+}
+
+// checkSessionToken 检查长期连接的设备仍处于启用状态，且建立连接时使用的令牌未被注销或撤销
+// 检查与认证中间件一致，供长连接和MQTT主题权限回调在连接建立后重复检查，Redis不可用时不检查黑名单
+func checkSessionToken(store repository.Store, sn string, issuedAt int64, tokenHash string) error {
+	device, err := store.Devices().FindBySN(sn)
+	if err != nil {
+		return errors.New(errors.ErrDeviceNotFound, "设备不存在")
+	}
+	if device.Status != mdmodel.DeviceStatusActive {
+		return errors.New(errors.ErrDeviceDisabled, "设备已禁用")
+	}
+	if repository.TokenRevokedByDevice(store.Tokens(), device, issuedAt, tokenHash) {
+		return errors.New(errors.ErrInvalidToken, "访问令牌已失效")
+	}
+	blacklisted, err := redis.Exists(context.Background(), constants.RedisTokenBlacklistPrefix+tokenHash)
+	if err == nil && blacklisted {
+		return errors.New(errors.ErrInvalidToken, "访问令牌已失效")
+	}
+	return nil
 }
 
 // isTokenBlacklisted 检查token是否在黑名单中
 func (s *AuthService) isTokenBlacklisted(token string) bool {
-	exists, err := redis.Exists(context.Background(), fmt.Sprintf("token_blacklist:%s", token))
+	exists, err := redis.Exists(context.Background(), constants.RedisTokenBlacklistPrefix+utils.HashToken(token))
 	return err == nil && exists
 }
 
-// addToBlacklist 将token加入黑名单
-func (s *AuthService) addToBlacklist(token string, expireAt int64) error {
-	ctx := context.Background()
-	duration := time.Until(time.Unix(expireAt, 0))
-	return redis.Set(ctx, fmt.Sprintf("token_blacklist:%s", token), true, duration)
-} 
\ No newline at end of file
+// addToBlacklist 将token加入黑名单，保留到令牌过期为止
+func addToBlacklist(token string, expireAt int64) error {
+	return blacklistTokenHash(utils.HashToken(token), time.Unix(expireAt, 0))
+}
+
+// blacklistTokenHash 按令牌摘要加入黑名单，用于只保存了摘要的令牌
+func blacklistTokenHash(hash string, expireAt time.Time) error {
+	duration := time.Until(expireAt)
+	if duration <= 0 {
+		// 已过期的令牌无需加入黑名单
+		return nil
+	}
+	return redis.Set(context.Background(), constants.RedisTokenBlacklistPrefix+hash, true, duration)
+}
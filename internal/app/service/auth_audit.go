@@ -0,0 +1,87 @@
+package service
+
+import (
+	"time"
+
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/errors"
+)
+
+// 认证成功时记录的响应码，与统一响应的成功码一致
+const authSuccessCode = 200
+
+// AuthAuditService 认证审计服务
+type AuthAuditService struct {
+	store repository.Store
+}
+
+// NewAuthAuditService 创建认证审计服务实例
+func NewAuthAuditService(store repository.Store) *AuthAuditService {
+	return &AuthAuditService{store: store}
+}
+
+// AuthAuditEntry 一次认证活动
+type AuthAuditEntry struct {
+	Event    string
+	DeviceSN string
+	DeviceID uint
+	Meta     RequestMeta
+	Start    time.Time // 开始处理的时间，用于计算耗时
+	Err      error     // 处理结果，为空表示成功
+}
+
+// AuthAuditQuery 认证审计查询条件
+type AuthAuditQuery struct {
+	PageQuery
+	SN        string     `form:"sn"`                                               // 设备SN
+	Event     string     `form:"event"`                                            // 事件类型
+	Result    string     `form:"result" binding:"omitempty,oneof=success failure"` // 结果
+	StartTime *time.Time `form:"start_time"`                                       // 开始时间(RFC3339)
+	EndTime   *time.Time `form:"end_time"`                                         // 结束时间(RFC3339)
+}
+
+// Record 记录一次认证活动，写入失败不影响认证流程
+func (s *AuthAuditService) Record(entry *AuthAuditEntry) {
+	audit := &model.AuthAudit{
+		Event:      entry.Event,
+		DeviceSN:   entry.DeviceSN,
+		DeviceID:   entry.DeviceID,
+		ClientIP:   entry.Meta.ClientIP,
+		UserAgent:  entry.Meta.UserAgent,
+		Result:     model.AuthResultSuccess,
+		ResultCode: authSuccessCode,
+		LatencyMs:  time.Since(entry.Start).Milliseconds(),
+	}
+	if entry.Err != nil {
+		audit.Result = model.AuthResultFailure
+		audit.ResultCode = int(errors.ErrUnknown)
+		if e, ok := entry.Err.(*errors.Error); ok {
+			audit.ResultCode = int(e.Code)
+		}
+		audit.Detail = entry.Err.Error()
+	}
+	recordAuthAudit(s.store, audit)
+}
+
+// ListAuthAudits 分页查询访问范围内的认证审计记录，按时间倒序
+func (s *AuthAuditService) ListAuthAudits(tenant Tenant, query *AuthAuditQuery) (*PageResult, error) {
+	query.normalize()
+
+	audits, total, err := s.store.AuthAudits().List(tenant.WithDevice(query.SN), repository.AuthAuditFilter{
+		Event:     query.Event,
+		Result:    query.Result,
+		StartTime: query.StartTime,
+		EndTime:   query.EndTime,
+	}, query.page())
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	return &PageResult{
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Items:    audits,
+	}, nil
+}
@@ -1,21 +1,30 @@
 package service
 
 import (
-	"context"
+	"crypto/sha256"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 	"mingda_cloud_service/internal/app/model"
-	"mingda_cloud_service/internal/pkg/database"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/migrations"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/logger"
 	"mingda_cloud_service/internal/pkg/redis"
 	"mingda_cloud_service/internal/pkg/utils"
-	"mingda_cloud_service/internal/pkg/config"
 )
 
 func TestAuthService_RefreshToken(t *testing.T) {
 	// 初始化测试环境
-	setupTestEnv(t)
+	store := setupTestEnv(t)
 
 	// 创建测试用例
 	tests := []struct {
@@ -34,12 +43,12 @@ func TestAuthService_RefreshToken(t *testing.T) {
 					Status:      1, // 正常状态
 					LastOnline:  time.Now(),
 				}
-				database.DB.Create(device)
+				store.Devices().Create(device)
 
 				// 为设备生成token
-				authService := NewAuthService("test_secret", "test_key")
-				token, _ := authService.GenerateToken(device)
-				return token, device
+				authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{})
+				pair, _ := authService.GenerateToken(device, testMeta)
+				return pair.RefreshToken, device
 			},
 			wantErr: false,
 		},
@@ -52,27 +61,66 @@ func TestAuthService_RefreshToken(t *testing.T) {
 			errMsg:  "invalid token",
 		},
 		{
-			name: "设备已禁用",
+			name: "设备未激活",
 			setupFunc: func() (string, *model.Device) {
-				// 创建已禁用的测试设备
+				// 创建已注册未激活的测试设备
 				device := &model.Device{
 					SN:          "M1A2401A0100002",
 					DeviceModel: "MD-400D",
-					Status:      0, // 禁用状态
+					Status:      0, // 未激活状态
 					LastOnline:  time.Now(),
 				}
-				database.DB.Create(device)
+				store.Devices().Create(device)
 
 				// 为设备生成token
-				authService := NewAuthService("test_secret", "test_key")
-				token, _ := authService.GenerateToken(device)
-				return token, device
+				authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{})
+				pair, _ := authService.GenerateToken(device, testMeta)
+				return pair.RefreshToken, device
+			},
+			wantErr: true,
+			errMsg:  "device is not activated",
+		},
+		{
+			name: "设备已停用",
+			setupFunc: func() (string, *model.Device) {
+				// 创建测试设备，签发令牌后停用
+				device := &model.Device{
+					SN:          "M1A2401A0100005",
+					DeviceModel: "MD-400D",
+					Status:      1,
+					LastOnline:  time.Now(),
+				}
+				store.Devices().Create(device)
+
+				authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{})
+				pair, _ := authService.GenerateToken(device, testMeta)
+				store.Devices().Update(device, map[string]interface{}{"status": model.DeviceStatusSuspended})
+				return pair.RefreshToken, device
+			},
+			wantErr: true,
+			errMsg:  "设备已停用",
+		},
+		{
+			name: "使用访问令牌刷新",
+			setupFunc: func() (string, *model.Device) {
+				// 创建测试设备
+				device := &model.Device{
+					SN:          "M1A2401A0100004",
+					DeviceModel: "MD-400D",
+					Status:      1,
+					LastOnline:  time.Now(),
+				}
+				store.Devices().Create(device)
+
+				authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{})
+				pair, _ := authService.GenerateToken(device, testMeta)
+				return pair.AccessToken, device
 			},
 			wantErr: true,
-			errMsg:  "device is disabled",
+			errMsg:  "refresh token required",
 		},
 		{
-			name: "token已在黑名单中",
+			name: "刷新令牌被重复使用",
 			setupFunc: func() (string, *model.Device) {
 				// 创建测试设备
 				device := &model.Device{
@@ -81,16 +129,14 @@ func TestAuthService_RefreshToken(t *testing.T) {
 					Status:      1,
 					LastOnline:  time.Now(),
 				}
-				database.DB.Create(device)
+				store.Devices().Create(device)
 
-				// 为设备生成token
-				authService := NewAuthService("test_secret", "test_key")
-				token, _ := authService.GenerateToken(device)
-				
-				// 将token加入黑名单
-				authService.addToBlacklist(token, time.Now().Add(time.Hour).Unix())
-				
-				return token, device
+				// 为设备生成token并完成一次轮换
+				authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{})
+				pair, _ := authService.GenerateToken(device, testMeta)
+				authService.RefreshToken(pair.RefreshToken, testMeta)
+
+				return pair.RefreshToken, device
 			},
 			wantErr: true,
 			errMsg:  "token has been revoked",
@@ -100,27 +146,32 @@ func TestAuthService_RefreshToken(t *testing.T) {
 	// 运行测试用例
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			authService := NewAuthService("test_secret", "test_key")
+			authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{})
 			oldToken, _ := tt.setupFunc()
 
 			// 执行刷新
-			newToken, err := authService.RefreshToken(oldToken)
+			pair, err := authService.RefreshToken(oldToken, testMeta)
 
 			// 验证结果
 			if tt.wantErr {
 				assert.Error(t, err)
 				assert.Contains(t, err.Error(), tt.errMsg)
-				assert.Empty(t, newToken)
+				assert.Nil(t, pair)
 			} else {
 				assert.NoError(t, err)
-				assert.NotEmpty(t, newToken)
-				assert.NotEqual(t, oldToken, newToken)
+				assert.NotEmpty(t, pair.RefreshToken)
+				assert.NotEqual(t, oldToken, pair.RefreshToken)
+
+				// 旧刷新令牌只能使用一次
+				_, err = authService.RefreshToken(oldToken, testMeta)
+				assert.Error(t, err)
 
-				// 验证旧token是否已加入黑名单
-				assert.True(t, authService.isTokenBlacklisted(oldToken))
+				// 重复使用后整个令牌族被撤销，新刷新令牌也不可用
+				_, err = authService.RefreshToken(pair.RefreshToken, testMeta)
+				assert.Error(t, err)
 
-				// 验证新token是否可用
-				claims, err := authService.ValidateToken(newToken)
+				// 验证新访问令牌是否可用
+				claims, err := authService.ValidateToken(pair.AccessToken)
 				assert.NoError(t, err)
 				assert.NotNil(t, claims)
 			}
@@ -130,7 +181,7 @@ func TestAuthService_RefreshToken(t *testing.T) {
 
 func TestAuthService_TokenFlow(t *testing.T) {
 	// 初始化测试环境
-	setupTestEnv(t)
+	store := setupTestEnv(t)
 
 	// 创建测试设备
 	device := &model.Device{
@@ -140,29 +191,34 @@ func TestAuthService_TokenFlow(t *testing.T) {
 		Status:      1,
 		LastOnline:  time.Now(),
 	}
-	database.DB.Create(device)
+	store.Devices().Create(device)
 
 	t.Run("完整token流程测试", func(t *testing.T) {
-		authService := NewAuthService("test_jwt_secret", "test_aes_key")
+		authService := NewAuthService(store, "test_jwt_secret", newTestCipher(t), config.AuthConfig{})
 
 		// 1. 设备认证
 		timestamp := time.Now().Unix()
 		sign := utils.GenerateSign(device.SN, device.Secret, timestamp)
-		authedDevice, err := authService.AuthenticateDevice(device.SN, sign, timestamp)
+		authedDevice, err := authService.AuthenticateDevice(device.SN, sign, timestamp, testMeta)
 		assert.NoError(t, err)
 		assert.NotNil(t, authedDevice)
 		assert.Equal(t, device.SN, authedDevice.SN)
+		// 明文存储的旧密钥在认证成功后被加密
+		assert.True(t, strings.HasPrefix(authedDevice.Secret, "v1:"))
 
 		// 2. 生成token
-		token, err := authService.GenerateToken(authedDevice)
+		pair, err := authService.GenerateToken(authedDevice, testMeta)
 		assert.NoError(t, err)
-		assert.NotEmpty(t, token)
+		assert.NotEmpty(t, pair.AccessToken)
+		assert.NotEmpty(t, pair.RefreshToken)
+		token := pair.AccessToken
 
 		// 3. 验证token
 		claims, err := utils.ParseToken(token, "test_jwt_secret")
 		assert.NoError(t, err)
 		assert.NotNil(t, claims)
 		assert.Equal(t, device.SN, claims.DeviceSN)
+		assert.False(t, claims.IsRefresh())
 
 		// 4. 使用token访问受保护的资源
 		validatedDevice, err := authService.ValidateToken(token)
@@ -171,27 +227,28 @@ func TestAuthService_TokenFlow(t *testing.T) {
 		assert.Equal(t, device.ID, validatedDevice.ID)
 
 		// 5. 检查设备token记录
-		var deviceToken model.DeviceToken
-		err = database.DB.Where("device_id = ?", device.ID).First(&deviceToken).Error
+		deviceTokens, err := store.Tokens().ListActive(device.ID, model.TokenTypeAccess)
 		assert.NoError(t, err)
-		assert.Equal(t, token, deviceToken.Token)
-		assert.True(t, deviceToken.ExpireAt.After(time.Now()))
+		if assert.Len(t, deviceTokens, 1) {
+			assert.Equal(t, utils.HashToken(token), deviceTokens[0].TokenHash)
+			assert.True(t, deviceTokens[0].ExpireAt.After(time.Now()))
+		}
 	})
 
 	t.Run("异常场景测试", func(t *testing.T) {
-		authService := NewAuthService("test_jwt_secret", "test_aes_key")
+		authService := NewAuthService(store, "test_jwt_secret", newTestCipher(t), config.AuthConfig{})
 
 		// 1. 使用错误的签名
 		timestamp := time.Now().Unix()
 		wrongSign := "wrong_sign"
-		_, err := authService.AuthenticateDevice(device.SN, wrongSign, timestamp)
+		_, err := authService.AuthenticateDevice(device.SN, wrongSign, timestamp, testMeta)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "签名验证失败")
 
 		// 2. 使用过期的时间戳
 		expiredTimestamp := time.Now().Add(-10 * time.Minute).Unix()
 		sign := utils.GenerateSign(device.SN, device.Secret, expiredTimestamp)
-		_, err = authService.AuthenticateDevice(device.SN, sign, expiredTimestamp)
+		_, err = authService.AuthenticateDevice(device.SN, sign, expiredTimestamp, testMeta)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "请求已过期")
 
@@ -203,15 +260,140 @@ func TestAuthService_TokenFlow(t *testing.T) {
 
 		// 4. 设备被禁用后使用token
 		// 先获取有效token
-		validToken, _ := authService.GenerateToken(device)
-		// 禁用设备
-		database.DB.Model(device).Update("status", 0)
-		_, err = authService.ValidateToken(validToken)
+		validPair, _ := authService.GenerateToken(device, testMeta)
+		// 停用设备
+		store.Devices().Update(device, map[string]interface{}{"status": model.DeviceStatusSuspended})
+		_, err = authService.ValidateToken(validPair.AccessToken)
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "设备不可用")
+		assert.Contains(t, err.Error(), "设备已停用")
 	})
 }
 
+func TestAuthService_SessionLimit(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	device := &model.Device{
+		SN:          "M1A2401A0100005",
+		DeviceModel: "MD-400D",
+		Status:      1,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+
+	authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{MaxActiveSessions: 2})
+	first, err := authService.GenerateToken(device, testMeta)
+	assert.NoError(t, err)
+	_, err = authService.GenerateToken(device, testMeta)
+	assert.NoError(t, err)
+	_, err = authService.GenerateToken(device, testMeta)
+	assert.NoError(t, err)
+
+	// 超出上限时最早的会话被撤销，访问令牌加入黑名单
+	sessions, err := NewSessionService(store).ListSessions(device.SN)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	_, err = authService.ValidateToken(first.AccessToken)
+	assert.Error(t, err)
+	_, err = authService.RefreshToken(first.RefreshToken, testMeta)
+	assert.Error(t, err)
+}
+
+func TestAuthService_RevokeDeviceTokens(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	device := &model.Device{
+		SN:          "M1A2401A0100006",
+		DeviceModel: "MD-400D",
+		Status:      model.DeviceStatusActive,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+
+	authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{})
+
+	// 签发后立即撤销，同一秒内签发的令牌也失效
+	revoked, err := authService.GenerateToken(device, testMeta)
+	assert.NoError(t, err)
+	assert.NoError(t, authService.RevokeDeviceTokens(device.SN))
+	_, err = authService.ValidateToken(revoked.AccessToken)
+	assert.Error(t, err)
+
+	// 撤销后重新签发的令牌不受影响
+	current, err := authService.GenerateToken(device, testMeta)
+	assert.NoError(t, err)
+	_, err = authService.ValidateToken(current.AccessToken)
+	assert.NoError(t, err)
+
+	// 撤销时间与签发时间在同一秒时按令牌记录判断先后
+	claims, err := utils.ParseToken(current.AccessToken, "test_secret")
+	assert.NoError(t, err)
+	store.Devices().Update(device, map[string]interface{}{"tokens_valid_after": time.Unix(claims.IssuedAt, 0)})
+	_, err = authService.ValidateToken(current.AccessToken)
+	assert.NoError(t, err)
+	_, err = authService.ValidateToken(revoked.AccessToken)
+	assert.Error(t, err)
+}
+
+func TestAuthService_SecretRotationGrace(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	cipher := newTestCipher(t)
+	encrypted, err := cipher.Encrypt("old_secret")
+	assert.NoError(t, err)
+	device := &model.Device{
+		SN:          "M1A2401A0100007",
+		DeviceModel: "MD-400D",
+		Secret:      encrypted,
+		Status:      model.DeviceStatusActive,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+
+	authService := NewAuthService(store, "test_secret", cipher, config.AuthConfig{})
+	secretService := NewSecretService(store, cipher, config.AuthConfig{SecretGracePeriod: 3600})
+	authenticate := func(secret string) error {
+		timestamp := time.Now().Unix()
+		_, err := authService.AuthenticateDevice(device.SN, utils.GenerateSign(device.SN, secret, timestamp), timestamp, testMeta)
+		return err
+	}
+	// rotate 轮换密钥并用设备持有的旧密钥解出新密钥
+	rotate := func(confirmed string) string {
+		rotation, err := secretService.RotateSecret(device.ID)
+		assert.NoError(t, err)
+		deliveryKey := sha256.Sum256([]byte(confirmed))
+		secret, err := utils.AESDecrypt(deliveryKey[:], rotation.EncryptedSecret)
+		assert.NoError(t, err)
+		return secret
+	}
+	reload := func() *model.Device {
+		d, err := store.Devices().FindBySN(device.SN)
+		assert.NoError(t, err)
+		return d
+	}
+
+	// 宽限期内新旧密钥均可认证
+	newSecret := rotate("old_secret")
+	assert.NoError(t, authenticate("old_secret"))
+	assert.NotEmpty(t, reload().PrevSecret)
+
+	// 使用新密钥认证成功后旧密钥立即停用
+	assert.NoError(t, authenticate(newSecret))
+	current := reload()
+	assert.Empty(t, current.PrevSecret)
+	assert.Nil(t, current.PrevSecretExpireAt)
+	assert.Error(t, authenticate("old_secret"))
+
+	// 宽限期结束后旧密钥不再可用
+	latest := rotate(newSecret)
+	store.Devices().Update(reload(), map[string]interface{}{"prev_secret_expire_at": time.Now().Add(-time.Second)})
+	assert.Error(t, authenticate(newSecret))
+	assert.NoError(t, authenticate(latest))
+}
+
 // 添加辅助函数用于生成签名
 func TestAuthService_GenerateSign(t *testing.T) {
 	sn := "M1A2401A0100001"
@@ -230,27 +412,38 @@ func TestAuthService_GenerateSign(t *testing.T) {
 	assert.NotEqual(t, sign, sign3)
 }
 
-// setupTestEnv 初始化测试环境
-func setupTestEnv(t *testing.T) {
-	// 初始化测试数据库连接
-	err := database.Init(database.Config{
-		Driver:   "sqlite3",
-		Database: ":memory:", // 使用内存数据库进行测试
+// setupTestEnv 初始化测试环境，使用SQLite内存数据库和内存Redis，不依赖外部服务
+func setupTestEnv(t *testing.T) repository.Store {
+	// 每个测试使用独立的内存数据库，共享缓存使事务内外的连接访问同一个库
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: gormlogger.Discard,
 	})
 	assert.NoError(t, err)
-
-	// 初始化测试Redis连接
-	err = redis.Init(config.RedisConfig{
-		Host:     "localhost",
-		Port:     6379,
-		DB:       1, // 使用单独的数据库进行测试
-		PoolSize: 10,
+	assert.NoError(t, migrations.AutoMigrate(db))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
 	})
-	assert.NoError(t, err)
 
-	// 清理测试数据
-	database.DB.Exec("DELETE FROM md_devices")
-	database.DB.Exec("DELETE FROM md_device_tokens")
-	ctx := context.Background()
-	redis.Client.FlushDB(ctx)
-} 
\ No newline at end of file
+	// 初始化内存Redis，测试结束后自动关闭
+	mr := miniredis.RunT(t)
+	redis.Client = goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+
+	if logger.Log == nil {
+		logger.Log = zap.NewNop()
+	}
+
+	// 机型缓存绑定当前测试的数据库
+	store := repository.NewStore(db)
+	PrinterModelRegistry(store)
+	return store
+}
+
+var testMeta = RequestMeta{ClientIP: "127.0.0.1", UserAgent: "go-test"}
+
+func newTestCipher(t *testing.T) *utils.SecretCipher {
+	cipher, err := utils.NewSecretCipher(1, map[int]string{1: "test_aes_key"})
+	assert.NoError(t, err)
+	return cipher
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/errors"
+)
+
+// 分页默认值
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// PageQuery 分页参数
+type PageQuery struct {
+	Page     int `form:"page"`      // 页码，从1开始
+	PageSize int `form:"page_size"` // 每页条数
+}
+
+// normalize 规范化分页参数
+func (q *PageQuery) normalize() {
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = defaultPageSize
+	}
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+}
+
+// page 转换为仓储分页范围
+func (q *PageQuery) page() repository.Page {
+	return repository.Page{Offset: (q.Page - 1) * q.PageSize, Limit: q.PageSize}
+}
+
+// PageResult 分页结果
+type PageResult struct {
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+	Items    interface{} `json:"items"`
+}
+
+// DeviceQuery 设备查询条件
+type DeviceQuery struct {
+	PageQuery
+	SN             string `form:"sn"`              // SN前缀
+	Model          string `form:"model"`           // 设备型号
+	Status         *int   `form:"status"`          // 生命周期状态
+	OrganizationID *uint  `form:"organization_id"` // 所属组织，仅平台运维人员可用
+}
+
+// DeviceAdminService 运维设备查询服务
+type DeviceAdminService struct {
+	store repository.Store
+}
+
+// NewDeviceAdminService 创建运维设备查询服务实例
+func NewDeviceAdminService(store repository.Store) *DeviceAdminService {
+	return &DeviceAdminService{store: store}
+}
+
+// ListDevices 分页查询访问范围内的设备
+func (s *DeviceAdminService) ListDevices(tenant Tenant, query *DeviceQuery) (*PageResult, error) {
+	query.normalize()
+
+	if tenant.IsPlatform() && query.OrganizationID != nil {
+		tenant = OrganizationTenant(query.OrganizationID)
+	}
+	devices, total, err := s.store.Devices().List(tenant, repository.DeviceFilter{
+		SNPrefix:    query.SN,
+		DeviceModel: query.Model,
+		Status:      query.Status,
+	}, query.page())
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	return &PageResult{
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Items:    devices,
+	}, nil
+}
+
+// GetDevice 查询访问范围内的设备详情
+func (s *DeviceAdminService) GetDevice(tenant Tenant, sn string) (*model.Device, error) {
+	device, err := s.store.Devices().FindInScope(tenant, sn)
+	if err != nil {
+		return nil, errors.New(errors.ErrDeviceNotFound, "设备不存在")
+	}
+	return device, nil
+}
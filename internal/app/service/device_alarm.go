@@ -3,16 +3,18 @@ package service
 import (
 	"time"
 	"mingda_cloud_service/internal/app/model"
-	"mingda_cloud_service/internal/pkg/database"
+	"mingda_cloud_service/internal/app/repository"
 	"mingda_cloud_service/internal/pkg/errors"
 )
 
 // DeviceAlarmService 设备告警服务
-type DeviceAlarmService struct{}
+type DeviceAlarmService struct {
+	store repository.Store
+}
 
 // NewDeviceAlarmService 创建设备告警服务实例
-func NewDeviceAlarmService() *DeviceAlarmService {
-	return &DeviceAlarmService{}
+func NewDeviceAlarmService(store repository.Store) *DeviceAlarmService {
+	return &DeviceAlarmService{store: store}
 }
 
 // DeviceAlarmRequest 设备告警上报请求
@@ -43,7 +45,7 @@ func (s *DeviceAlarmService) ReportDeviceAlarm(deviceSN string, req *DeviceAlarm
 		Status:     model.AlarmStatusPending,
 	}
 
-	if err := database.DB.Create(alarm).Error; err != nil {
+	if err := s.store.Alarms().Create(alarm); err != nil {
 		return errors.NewWithError(errors.ErrDatabase, err)
 	}
 
@@ -55,50 +57,76 @@ type ResolveAlarmRequest struct {
 	ResolveDesc string `json:"resolve_desc" binding:"required"` // 处理说明
 }
 
-// ResolveAlarm 处理告警
-func (s *DeviceAlarmService) ResolveAlarm(alarmID int64, req *ResolveAlarmRequest) error {
+// 非运维人员处理告警时记录的处理人
+const (
+	AlarmResolverDevice       = "device"  // 设备自行解除告警
+	AlarmResolverAPIKeyPrefix = "apikey:" // 第三方系统处理告警，后接密钥前缀
+)
+
+// ResolveAlarm 处理告警，只能处理访问范围内的告警
+func (s *DeviceAlarmService) ResolveAlarm(alarmID int64, tenant Tenant, resolver string, req *ResolveAlarmRequest) error {
 	now := time.Now()
 	
 	// 更新告警状态
-	if err := database.DB.Model(&model.DeviceAlarm{}).
-		Where("id = ? AND status = ?", alarmID, model.AlarmStatusPending).
-		Updates(map[string]interface{}{
-			"status":       model.AlarmStatusResolved,
-			"resolve_time": now,
-			"resolve_desc": req.ResolveDesc,
-			"update_time":  now,
-		}).Error; err != nil {
+	if err := s.store.Alarms().UpdatePending(tenant, alarmID, map[string]interface{}{
+		"status":       model.AlarmStatusResolved,
+		"resolve_time": now,
+		"resolve_desc": req.ResolveDesc,
+		"resolve_by":   resolver,
+		"update_time":  now,
+	}); err != nil {
 		return errors.NewWithError(errors.ErrDatabase, err)
 	}
 
 	return nil
 }
 
-// IgnoreAlarm 忽略告警
-func (s *DeviceAlarmService) IgnoreAlarm(alarmID int64) error {
+// IgnoreAlarm 忽略告警，只能处理访问范围内的告警
+func (s *DeviceAlarmService) IgnoreAlarm(alarmID int64, tenant Tenant, resolver string) error {
 	// 更新告警状态为已忽略
-	if err := database.DB.Model(&model.DeviceAlarm{}).
-		Where("id = ? AND status = ?", alarmID, model.AlarmStatusPending).
-		Updates(map[string]interface{}{
-			"status":      model.AlarmStatusIgnored,
-			"update_time": time.Now(),
-		}).Error; err != nil {
+	if err := s.store.Alarms().UpdatePending(tenant, alarmID, map[string]interface{}{
+		"status":      model.AlarmStatusIgnored,
+		"resolve_by":  resolver,
+		"update_time": time.Now(),
+	}); err != nil {
 		return errors.NewWithError(errors.ErrDatabase, err)
 	}
 
 	return nil
 }
 
-// GetDeviceAlarms 获取设备告警列表
-func (s *DeviceAlarmService) GetDeviceAlarms(deviceSN string, status *int) ([]model.DeviceAlarm, error) {
-	var alarms []model.DeviceAlarm
-	query := database.DB.Where("device_sn = ?", deviceSN)
-	
-	if status != nil {
-		query = query.Where("status = ?", *status)
+// AlarmQuery 告警查询条件
+type AlarmQuery struct {
+	PageQuery
+	DeviceSN   string `form:"device_sn"`   // 设备SN
+	Status     *int   `form:"status"`      // 告警状态
+	AlarmLevel *int   `form:"alarm_level"` // 告警级别
+}
+
+// ListAlarms 运维分页查询访问范围内设备的告警
+func (s *DeviceAlarmService) ListAlarms(tenant Tenant, query *AlarmQuery) (*PageResult, error) {
+	query.normalize()
+
+	alarms, total, err := s.store.Alarms().List(tenant.WithDevice(query.DeviceSN), repository.AlarmFilter{
+		Status:     query.Status,
+		AlarmLevel: query.AlarmLevel,
+	}, query.page())
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
 	}
-	
-	if err := query.Order("create_time DESC").Find(&alarms).Error; err != nil {
+
+	return &PageResult{
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Items:    alarms,
+	}, nil
+}
+
+// GetDeviceAlarms 获取设备告警列表
+func (s *DeviceAlarmService) GetDeviceAlarms(tenant Tenant, status *int) ([]model.DeviceAlarm, error) {
+	alarms, err := s.store.Alarms().ListAll(tenant, status)
+	if err != nil {
 		return nil, errors.NewWithError(errors.ErrDatabase, err)
 	}
 	
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/redis"
+)
+
+const (
+	maxCommandPayloadSize = 4096 // 指令参数和执行结果序列化后的大小上限(字节)
+	commandPollBatchSize  = 20   // 单次拉取的指令数上限
+)
+
+// DeviceCommandService 设备指令服务
+type DeviceCommandService struct {
+	store          repository.Store
+	defaultTTL     time.Duration
+	maxTTL         time.Duration
+	pollTimeout    time.Duration
+	redeliverAfter time.Duration
+}
+
+// NewDeviceCommandService 创建设备指令服务实例
+func NewDeviceCommandService(store repository.Store, cfg config.CommandConfig) *DeviceCommandService {
+	return &DeviceCommandService{
+		store:          store,
+		defaultTTL:     time.Duration(cfg.DefaultTTL) * time.Second,
+		maxTTL:         time.Duration(cfg.MaxTTL) * time.Second,
+		pollTimeout:    time.Duration(cfg.PollTimeout) * time.Second,
+		redeliverAfter: time.Duration(cfg.RedeliverAfter) * time.Second,
+	}
+}
+
+// IssueCommandRequest 下发指令请求
+type IssueCommandRequest struct {
+	CommandType string                 `json:"command_type" binding:"required,oneof=pause_print resume_print cancel_print reboot capture_snapshot upload_logs"`
+	Params      map[string]interface{} `json:"params"`
+	TTL         int                    `json:"ttl" binding:"min=0"` // 有效期(秒)，为0时使用默认有效期
+}
+
+// CommandAckRequest 设备确认指令或上报执行结果
+type CommandAckRequest struct {
+	Status       string                 `json:"status" binding:"required,oneof=acked succeeded failed"`
+	Result       map[string]interface{} `json:"result"`
+	ErrorCode    string                 `json:"error_code" binding:"max=32"`
+	ErrorMessage string                 `json:"error_message" binding:"max=255"`
+}
+
+// CommandQuery 指令查询条件
+type CommandQuery struct {
+	PageQuery
+	Status string `form:"status"`
+}
+
+// IssueCommand 向设备下发指令，设备通过长轮询拉取
+func (s *DeviceCommandService) IssueCommand(sn string, req *IssueCommandRequest, operator string) (*model.DeviceCommand, error) {
+	device, err := s.store.Devices().FindBySN(sn)
+	if err != nil {
+		return nil, errors.New(errors.ErrDeviceNotFound, "设备不存在")
+	}
+	if device.Status != model.DeviceStatusActive {
+		return nil, errors.New(errors.ErrDeviceDisabled, "设备未激活或已停用")
+	}
+
+	ttl := s.defaultTTL
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+	if ttl > s.maxTTL {
+		return nil, errors.New(errors.ErrInvalidParams, fmt.Sprintf("有效期不能超过%d秒", int(s.maxTTL.Seconds())))
+	}
+
+	params, err := encodeCommandPayload(req.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	command := &model.DeviceCommand{
+		DeviceSN:    sn,
+		CommandType: req.CommandType,
+		Params:      params,
+		Status:      model.CommandStatusPending,
+		ExpireAt:    time.Now().Add(ttl),
+		CreatedBy:   operator,
+	}
+	if err := s.store.DeviceCommands().Create(command); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	notifyDeviceCommand(sn)
+	return command, nil
+}
+
+// ListCommands 分页查询设备指令，按下发时间倒序
+func (s *DeviceCommandService) ListCommands(sn string, query *CommandQuery) (*PageResult, error) {
+	query.normalize()
+
+	commands, total, err := s.store.DeviceCommands().List(sn, query.Status, query.page())
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	return &PageResult{
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Items:    commands,
+	}, nil
+}
+
+// GetCommand 查询设备指令详情
+func (s *DeviceCommandService) GetCommand(sn string, id uint) (*model.DeviceCommand, error) {
+	command, err := s.store.DeviceCommands().FindDeviceCommand(sn, id)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, errors.New(errors.ErrInvalidParams, "指令不存在")
+		}
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return command, nil
+}
+
+// PollCommands 设备拉取待执行的指令，没有指令时最多等待wait，期间有新指令立即返回
+func (s *DeviceCommandService) PollCommands(ctx context.Context, sn string, wait time.Duration) ([]model.DeviceCommand, error) {
+	if wait > s.pollTimeout {
+		wait = s.pollTimeout
+	}
+
+	// 先注册再查询，避免查询后、等待前下发的指令错过通知
+	notify := deviceCommandWaiters.add(sn)
+	defer deviceCommandWaiters.remove(sn, notify)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		commands, err := s.deliver(sn)
+		if err != nil || len(commands) > 0 {
+			return commands, err
+		}
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return commands, nil
+		case <-ctx.Done():
+			return commands, nil
+		}
+	}
+}
+
+// deliver 将待拉取和超时未确认的指令标记为已下发，返回本次下发的指令
+// 按原状态和下发次数条件更新，同一设备的多个长轮询请求不会重复下发
+func (s *DeviceCommandService) deliver(sn string) ([]model.DeviceCommand, error) {
+	now := time.Now()
+
+	candidates, err := s.store.DeviceCommands().ListDeliverable(sn, now, now.Add(-s.redeliverAfter), commandPollBatchSize)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	commands := make([]model.DeviceCommand, 0, len(candidates))
+	for _, command := range candidates {
+		delivered, err := s.store.DeviceCommands().Deliver(&command, map[string]interface{}{
+			"status":        model.CommandStatusDelivered,
+			"delivered_at":  now,
+			"deliver_count": command.DeliverCount + 1,
+		})
+		if err != nil {
+			return nil, errors.NewWithError(errors.ErrDatabase, err)
+		}
+		if !delivered {
+			continue
+		}
+		command.Status = model.CommandStatusDelivered
+		command.DeliveredAt = &now
+		command.DeliverCount++
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+// AckCommand 设备确认收到指令或上报执行结果，重复上报相同状态直接返回成功
+func (s *DeviceCommandService) AckCommand(sn string, id uint, req *CommandAckRequest) error {
+	command, err := s.GetCommand(sn, id)
+	if err != nil {
+		return err
+	}
+	if command.Status == req.Status {
+		return nil
+	}
+	if command.Finished() {
+		return errors.New(errors.ErrInvalidParams, "指令已结束")
+	}
+	if time.Now().After(command.ExpireAt) {
+		return errors.New(errors.ErrInvalidParams, "指令已过期")
+	}
+
+	now := time.Now()
+	from := []string{model.CommandStatusPending, model.CommandStatusDelivered}
+	updates := map[string]interface{}{"status": req.Status}
+	if req.Status == model.CommandStatusAcked {
+		updates["acked_at"] = now
+	} else {
+		result, err := encodeCommandPayload(req.Result)
+		if err != nil {
+			return err
+		}
+		from = model.CommandActiveStatuses
+		updates["result"] = result
+		updates["error_code"] = req.ErrorCode
+		updates["error_message"] = req.ErrorMessage
+		updates["finished_at"] = now
+		if command.AckedAt == nil {
+			updates["acked_at"] = now
+		}
+	}
+
+	updated, err := s.store.DeviceCommands().Transition(command.ID, from, updates)
+	if err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if !updated {
+		return errors.New(errors.ErrInvalidParams, "指令状态已变更")
+	}
+	return nil
+}
+
+// ExpireCommands 将超过有效期仍未执行完成的指令置为过期，返回处理的条数
+func (s *DeviceCommandService) ExpireCommands() (int64, error) {
+	now := time.Now()
+	expired, err := s.store.DeviceCommands().UpdateExpired(now, map[string]interface{}{
+		"status":      model.CommandStatusExpired,
+		"finished_at": now,
+	})
+	if err != nil {
+		return 0, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return expired, nil
+}
+
+// encodeCommandPayload 序列化指令参数或执行结果，为空时返回nil
+func encodeCommandPayload(payload map[string]interface{}) (json.RawMessage, error) {
+	if len(payload) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.New(errors.ErrInvalidParams, "无效的参数格式")
+	}
+	if len(data) > maxCommandPayloadSize {
+		return nil, errors.New(errors.ErrInvalidParams, "参数内容过大")
+	}
+	return data, nil
+}
+
+// commandWaiterRegistry 本实例中等待指令的长轮询请求
+type commandWaiterRegistry struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+var deviceCommandWaiters = &commandWaiterRegistry{waiters: map[string]map[chan struct{}]struct{}{}}
+
+// add 注册等待中的请求
+func (r *commandWaiterRegistry) add(sn string) chan struct{} {
+	ch := make(chan struct{}, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.waiters[sn] == nil {
+		r.waiters[sn] = map[chan struct{}]struct{}{}
+	}
+	r.waiters[sn][ch] = struct{}{}
+	return ch
+}
+
+// remove 注销等待中的请求
+func (r *commandWaiterRegistry) remove(sn string, ch chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.waiters[sn], ch)
+	if len(r.waiters[sn]) == 0 {
+		delete(r.waiters, sn)
+	}
+}
+
+// notify 唤醒设备的全部等待请求
+func (r *commandWaiterRegistry) notify(sn string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for ch := range r.waiters[sn] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notifyDeviceCommand 唤醒本实例的长轮询请求并通知其他实例
+func notifyDeviceCommand(sn string) {
+	deviceCommandWaiters.notify(sn)
+	if err := redis.Client.Publish(context.Background(), constants.RedisDeviceCommandChannel, sn).Err(); err != nil {
+		logger.Log.Error("publish device command notify failed", zap.String("device_sn", sn), zap.Error(err))
+	}
+}
+
+// DeviceCommandNotifyService 订阅指令下发通知，唤醒本实例中等待该设备指令的长轮询请求
+type DeviceCommandNotifyService struct {
+	pubsub *goredis.PubSub
+}
+
+// NewDeviceCommandNotifyService 创建指令下发通知订阅服务实例并启动订阅
+func NewDeviceCommandNotifyService() *DeviceCommandNotifyService {
+	service := &DeviceCommandNotifyService{
+		pubsub: redis.Client.Subscribe(context.Background(), constants.RedisDeviceCommandChannel),
+	}
+
+	// 启动订阅
+	go service.startNotify()
+
+	return service
+}
+
+// startNotify 处理指令下发通知，订阅关闭后退出
+func (s *DeviceCommandNotifyService) startNotify() {
+	for msg := range s.pubsub.Channel() {
+		deviceCommandWaiters.notify(msg.Payload)
+	}
+}
+
+// Stop 停止服务
+func (s *DeviceCommandNotifyService) Stop() {
+	s.pubsub.Close()
+}
+
+// DeviceCommandSweepService 定时将过期指令置为过期状态
+type DeviceCommandSweepService struct {
+	commandService *DeviceCommandService
+	sweepTicker    *time.Ticker
+	stopChan       chan struct{}
+}
+
+// NewDeviceCommandSweepService 创建过期指令清理服务实例并启动定时检查
+func NewDeviceCommandSweepService(store repository.Store, cfg config.CommandConfig) *DeviceCommandSweepService {
+	service := &DeviceCommandSweepService{
+		commandService: NewDeviceCommandService(store, cfg),
+		sweepTicker:    time.NewTicker(time.Duration(cfg.SweepInterval) * time.Second),
+		stopChan:       make(chan struct{}),
+	}
+
+	// 启动定时检查任务
+	go service.startSweep()
+
+	return service
+}
+
+// startSweep 启动定时检查任务
+func (s *DeviceCommandSweepService) startSweep() {
+	for {
+		select {
+		case <-s.sweepTicker.C:
+			if expired, err := s.commandService.ExpireCommands(); err != nil {
+				logger.Log.Error("expire device commands failed", zap.Error(err))
+			} else if expired > 0 {
+				logger.Log.Info("expired device commands", zap.Int64("expired", expired))
+			}
+		case <-s.stopChan:
+			s.sweepTicker.Stop()
+			return
+		}
+	}
+}
+
+// Stop 停止服务
+func (s *DeviceCommandSweepService) Stop() {
+	close(s.stopChan)
+}
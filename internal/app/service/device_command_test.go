@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/config"
+)
+
+func TestDeviceCommandService_Lifecycle(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	device := &model.Device{
+		SN:          "M4D2401A0100013",
+		DeviceModel: "MD-400D",
+		Status:      model.DeviceStatusActive,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+
+	commandService := NewDeviceCommandService(store, config.CommandConfig{DefaultTTL: 300, MaxTTL: 3600, PollTimeout: 5, RedeliverAfter: 60})
+
+	// 有效期超过上限
+	_, err := commandService.IssueCommand(device.SN, &IssueCommandRequest{CommandType: model.CommandReboot, TTL: 7200}, "admin")
+	assert.Error(t, err)
+
+	command, err := commandService.IssueCommand(device.SN, &IssueCommandRequest{
+		CommandType: model.CommandCancelPrint,
+		Params:      map[string]interface{}{"task_id": "T001"},
+	}, "admin")
+	assert.NoError(t, err)
+	assert.Equal(t, model.CommandStatusPending, command.Status)
+
+	// 拉取后标记为已下发，未到重新下发时间不再返回
+	commands, err := commandService.PollCommands(context.Background(), device.SN, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, commands, 1) {
+		assert.Equal(t, command.ID, commands[0].ID)
+		assert.Equal(t, model.CommandStatusDelivered, commands[0].Status)
+		assert.JSONEq(t, `{"task_id":"T001"}`, string(commands[0].Params))
+	}
+	commands, err = commandService.PollCommands(context.Background(), device.SN, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, commands)
+
+	// 设备确认和上报结果，重复上报相同状态不报错
+	assert.NoError(t, commandService.AckCommand(device.SN, command.ID, &CommandAckRequest{Status: model.CommandStatusAcked}))
+	assert.NoError(t, commandService.AckCommand(device.SN, command.ID, &CommandAckRequest{Status: model.CommandStatusAcked}))
+	assert.Error(t, commandService.AckCommand("M4D2401A0100099", command.ID, &CommandAckRequest{Status: model.CommandStatusSucceeded}))
+	assert.NoError(t, commandService.AckCommand(device.SN, command.ID, &CommandAckRequest{
+		Status: model.CommandStatusSucceeded,
+		Result: map[string]interface{}{"cancelled": true},
+	}))
+	assert.Error(t, commandService.AckCommand(device.SN, command.ID, &CommandAckRequest{Status: model.CommandStatusFailed}))
+
+	command, err = commandService.GetCommand(device.SN, command.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.CommandStatusSucceeded, command.Status)
+	assert.NotNil(t, command.AckedAt)
+	assert.NotNil(t, command.FinishedAt)
+
+	// 长轮询等待期间下发的指令立即返回
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		commandService.IssueCommand(device.SN, &IssueCommandRequest{CommandType: model.CommandCaptureSnapshot}, "admin")
+	}()
+	start := time.Now()
+	commands, err = commandService.PollCommands(context.Background(), device.SN, 5*time.Second)
+	assert.NoError(t, err)
+	assert.Len(t, commands, 1)
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	// 设备未确认时超过重新下发时间后再次下发
+	assert.NoError(t, store.DeviceCommands().Update(&commands[0], map[string]interface{}{"delivered_at": time.Now().Add(-2 * time.Minute)}))
+	commands, err = commandService.PollCommands(context.Background(), device.SN, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, commands, 1) {
+		assert.Equal(t, 2, commands[0].DeliverCount)
+	}
+
+	// 过期指令置为过期状态，不再下发和接受结果
+	assert.NoError(t, store.DeviceCommands().Update(&commands[0], map[string]interface{}{"expire_at": time.Now().Add(-time.Second)}))
+	expired, err := commandService.ExpireCommands()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), expired)
+	assert.Error(t, commandService.AckCommand(device.SN, commands[0].ID, &CommandAckRequest{Status: model.CommandStatusSucceeded}))
+
+	result, err := commandService.ListCommands(device.SN, &CommandQuery{Status: model.CommandStatusExpired})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.Total)
+
+	// 停用的设备不能下发指令
+	assert.NoError(t, store.Devices().Update(device, map[string]interface{}{"status": model.DeviceStatusSuspended}))
+	_, err = commandService.IssueCommand(device.SN, &IssueCommandRequest{CommandType: model.CommandReboot}, "admin")
+	assert.Error(t, err)
+}
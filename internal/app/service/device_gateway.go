@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	goredis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/redis"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// 长连接消息类型
+const (
+	GatewayMsgWelcome    = "welcome"     // 连接建立后下发心跳参数
+	GatewayMsgHeartbeat  = "heartbeat"   // 设备心跳
+	GatewayMsgStatus     = "status"      // 设备状态上报，内容同POST /device/status
+	GatewayMsgPrint      = "print"       // 打印任务状态上报，内容同POST /device/print/status
+	GatewayMsgAlarm      = "alarm"       // 设备告警上报，内容同POST /device/alarm
+	GatewayMsgCommandAck = "command_ack" // 指令确认或执行结果
+	GatewayMsgCommand    = "command"     // 服务端推送的指令
+	GatewayMsgReply      = "reply"       // 服务端对设备消息的应答
+)
+
+// 连接关闭原因
+const (
+	GatewayCloseReplaced         = "replaced"          // 设备建立了新连接
+	GatewayCloseTokenExpired     = "token_expired"     // 访问令牌过期，设备需刷新令牌后重连
+	GatewayCloseHeartbeatTimeout = "heartbeat_timeout" // 超过心跳超时时间未收到设备消息
+	GatewayCloseRevoked          = "revoked"           // 设备已停用或访问令牌已撤销
+)
+
+const (
+	gatewayOnlineRefresh = time.Minute // 长连接在线状态写入数据库的最小间隔
+)
+
+// presenceRefreshScript 在线记录仍属于当前连接时延长有效期
+var presenceRefreshScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// presenceRemoveScript 在线记录仍属于当前连接时删除
+var presenceRemoveScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// GatewayMessage 长连接消息
+type GatewayMessage struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`      // 设备消息ID，应答中原样返回
+	Data    json.RawMessage `json:"data,omitempty"`    // 消息内容
+	Code    int             `json:"code,omitempty"`    // 应答错误码，为空表示成功
+	Message string          `json:"message,omitempty"` // 应答错误信息
+}
+
+// GatewayCommandAck 长连接中的指令确认消息
+type GatewayCommandAck struct {
+	CommandID uint `json:"command_id" binding:"required"`
+	CommandAckRequest
+}
+
+// DevicePresence 设备长连接所在节点
+type DevicePresence struct {
+	Online      bool       `json:"online"`
+	NodeID      string     `json:"node_id,omitempty"`
+	ConnID      string     `json:"conn_id,omitempty"`
+	ConnectedAt *time.Time `json:"connected_at,omitempty"`
+}
+
+// GatewaySession 设备长连接会话
+type GatewaySession struct {
+	DeviceSN string
+	ConnID   string
+	Commands chan struct{} // 有新指令下发时收到通知
+	Kicked   chan struct{} // 设备被停用需要断开连接时收到通知
+
+	presence   string // 写入Redis的在线记录，被新连接覆盖后不再属于本会话
+	issuedAt   int64  // 建立连接时使用的访问令牌签发时间
+	tokenHash  string // 建立连接时使用的访问令牌摘要
+	lastTouch  time.Time
+	lastOnline time.Time
+
+	done      chan struct{}
+	closeOnce sync.Once
+	reason    string
+}
+
+// Done 会话关闭时关闭的通道
+func (s *GatewaySession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close 关闭会话，可重复调用，以第一次的原因为准
+func (s *GatewaySession) Close(reason string) {
+	s.closeOnce.Do(func() {
+		s.reason = reason
+		close(s.done)
+	})
+}
+
+// CloseReason 会话关闭原因，需在Done关闭后读取
+func (s *GatewaySession) CloseReason() string {
+	return s.reason
+}
+
+// DeviceGatewayService 设备长连接网关服务，在一条WebSocket连接上处理设备上报和指令推送
+// 设备所在节点记录在Redis，多实例部署时指令下发通知广播到各实例，由持有连接的实例推送
+type DeviceGatewayService struct {
+	store            repository.Store
+	nodeID           string
+	heartbeatTimeout time.Duration
+	reporter         *deviceReporter
+
+	mu       sync.Mutex
+	sessions map[string]*GatewaySession
+}
+
+// NewDeviceGatewayService 创建设备长连接网关服务实例
+func NewDeviceGatewayService(store repository.Store, cfg config.GatewayConfig, commandCfg config.CommandConfig) *DeviceGatewayService {
+	return &DeviceGatewayService{
+		store:            store,
+		nodeID:           cfg.NodeID,
+		heartbeatTimeout: time.Duration(cfg.HeartbeatTimeout) * time.Second,
+		reporter:         newDeviceReporter(store, commandCfg),
+		sessions:         map[string]*GatewaySession{},
+	}
+}
+
+// Connect 设备建立长连接，记录所在节点并标记在线，同一设备在本实例的旧连接会被关闭
+// claims和token为建立连接时使用的访问令牌，刷新在线记录时据此检查令牌是否已被撤销
+func (s *DeviceGatewayService) Connect(sn string, claims *utils.Claims, token string) (*GatewaySession, error) {
+	now := time.Now()
+	session := &GatewaySession{
+		DeviceSN:   sn,
+		ConnID:     utils.GenerateRandomString(16),
+		issuedAt:   claims.IssuedAt,
+		tokenHash:  utils.HashToken(token),
+		lastTouch:  now,
+		lastOnline: now,
+		done:       make(chan struct{}),
+	}
+	session.presence = strings.Join([]string{s.nodeID, session.ConnID, strconv.FormatInt(now.Unix(), 10)}, "|")
+
+	// 直接覆盖，其他实例上的旧连接在下次心跳时发现记录已不属于自己后断开
+	if err := redis.Client.Set(context.Background(), constants.RedisDevicePresencePrefix+sn, session.presence, s.heartbeatTimeout).Err(); err != nil {
+		return nil, errors.NewWithError(errors.ErrRedis, err)
+	}
+	if err := s.store.DeviceStatus().MarkOnline(sn, now); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	session.Commands = deviceCommandWaiters.add(sn)
+	session.Kicked = gatewayKickWaiters.add(sn)
+
+	s.mu.Lock()
+	old := s.sessions[sn]
+	s.sessions[sn] = session
+	s.mu.Unlock()
+	if old != nil {
+		old.Close(GatewayCloseReplaced)
+	}
+
+	return session, nil
+}
+
+// Touch 收到设备消息后刷新在线记录，在线记录已被新连接覆盖或令牌已失效时关闭会话并返回错误
+// 按心跳超时时间的1/3刷新Redis并重新检查令牌，按分钟刷新数据库，避免每条消息都写入
+func (s *DeviceGatewayService) Touch(session *GatewaySession) error {
+	now := time.Now()
+	if now.Sub(session.lastTouch) >= s.heartbeatTimeout/3 {
+		if err := checkSessionToken(s.store, session.DeviceSN, session.issuedAt, session.tokenHash); err != nil {
+			session.Close(GatewayCloseRevoked)
+			return err
+		}
+		owned, err := presenceRefreshScript.Run(context.Background(), redis.Client,
+			[]string{constants.RedisDevicePresencePrefix + session.DeviceSN},
+			session.presence, s.heartbeatTimeout.Milliseconds()).Int()
+		if err != nil {
+			return errors.NewWithError(errors.ErrRedis, err)
+		}
+		if owned == 0 {
+			session.Close(GatewayCloseReplaced)
+			return errors.New(errors.ErrUnauthorized, "设备已建立新连接")
+		}
+		session.lastTouch = now
+	}
+
+	if now.Sub(session.lastOnline) >= gatewayOnlineRefresh {
+		if err := s.store.DeviceStatus().MarkOnline(session.DeviceSN, now); err != nil {
+			return errors.NewWithError(errors.ErrDatabase, err)
+		}
+		session.lastOnline = now
+	}
+	return nil
+}
+
+// Disconnect 连接断开，在线记录仍属于本连接时删除并标记设备离线
+func (s *DeviceGatewayService) Disconnect(session *GatewaySession) {
+	session.Close("closed")
+	deviceCommandWaiters.remove(session.DeviceSN, session.Commands)
+	gatewayKickWaiters.remove(session.DeviceSN, session.Kicked)
+
+	s.mu.Lock()
+	if s.sessions[session.DeviceSN] == session {
+		delete(s.sessions, session.DeviceSN)
+	}
+	s.mu.Unlock()
+
+	removed, err := presenceRemoveScript.Run(context.Background(), redis.Client,
+		[]string{constants.RedisDevicePresencePrefix + session.DeviceSN}, session.presence).Int()
+	if err != nil {
+		logger.Log.Error("remove device presence failed", zap.String("device_sn", session.DeviceSN), zap.Error(err))
+		return
+	}
+	if removed == 0 {
+		return
+	}
+	if err := s.store.DeviceStatus().MarkDeviceOffline(session.DeviceSN, time.Now()); err != nil {
+		logger.Log.Error("mark device offline failed", zap.String("device_sn", session.DeviceSN), zap.Error(err))
+	}
+}
+
+// HandleMessage 处理设备消息，返回应答
+func (s *DeviceGatewayService) HandleMessage(session *GatewaySession, msg *GatewayMessage) *GatewayMessage {
+	if msg.Type == GatewayMsgHeartbeat {
+		return GatewayReply(msg.ID, nil)
+	}
+	return GatewayReply(msg.ID, s.reporter.report(session.DeviceSN, msg.Type, msg.Data))
+}
+
+// PendingCommands 获取需要推送给设备的指令并标记为已下发
+func (s *DeviceGatewayService) PendingCommands(session *GatewaySession) ([]model.DeviceCommand, error) {
+	return s.reporter.commandService.deliver(session.DeviceSN)
+}
+
+// GetPresence 查询设备长连接所在节点
+func (s *DeviceGatewayService) GetPresence(sn string) (*DevicePresence, error) {
+	value, err := redis.Client.Get(context.Background(), constants.RedisDevicePresencePrefix+sn).Result()
+	if err == goredis.Nil {
+		return &DevicePresence{}, nil
+	}
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrRedis, err)
+	}
+
+	parts := strings.Split(value, "|")
+	if len(parts) != 3 {
+		return &DevicePresence{}, nil
+	}
+	presence := &DevicePresence{Online: true, NodeID: parts[0], ConnID: parts[1]}
+	if ts, err := strconv.ParseInt(parts[2], 10, 64); err == nil {
+		connectedAt := time.Unix(ts, 0)
+		presence.ConnectedAt = &connectedAt
+	}
+	return presence, nil
+}
+
+// gatewayKickWaiters 本实例长连接会话的断开通知
+var gatewayKickWaiters = &commandWaiterRegistry{waiters: map[string]map[chan struct{}]struct{}{}}
+
+// notifyDeviceKick 通知本实例和其他实例断开设备的长连接
+func notifyDeviceKick(sn string) {
+	gatewayKickWaiters.notify(sn)
+	if err := redis.Client.Publish(context.Background(), constants.RedisDeviceKickChannel, sn).Err(); err != nil {
+		logger.Log.Error("publish device kick notify failed", zap.String("device_sn", sn), zap.Error(err))
+	}
+}
+
+// DeviceKickNotifyService 订阅设备停用通知，断开本实例中该设备的长连接
+type DeviceKickNotifyService struct {
+	pubsub *goredis.PubSub
+}
+
+// NewDeviceKickNotifyService 创建设备停用通知订阅服务实例并启动订阅
+func NewDeviceKickNotifyService() *DeviceKickNotifyService {
+	service := &DeviceKickNotifyService{
+		pubsub: redis.Client.Subscribe(context.Background(), constants.RedisDeviceKickChannel),
+	}
+
+	// 启动订阅
+	go service.startNotify()
+
+	return service
+}
+
+// startNotify 处理设备停用通知，订阅关闭后退出
+func (s *DeviceKickNotifyService) startNotify() {
+	for msg := range s.pubsub.Channel() {
+		gatewayKickWaiters.notify(msg.Payload)
+	}
+}
+
+// Stop 停止服务
+func (s *DeviceKickNotifyService) Stop() {
+	s.pubsub.Close()
+}
+
+// deviceReporter 按消息类型将设备上报交给对应服务处理，长连接和MQTT接入共用
+type deviceReporter struct {
+	statusService  *DeviceStatusService
+	printService   *PrintTaskService
+	alarmService   *DeviceAlarmService
+	commandService *DeviceCommandService
+}
+
+// newDeviceReporter 创建设备上报处理
+func newDeviceReporter(store repository.Store, commandCfg config.CommandConfig) *deviceReporter {
+	return &deviceReporter{
+		// 只用于处理上报，离线检测任务由HTTP上报接口的服务实例负责
+		statusService:  &DeviceStatusService{store: store},
+		printService:   NewPrintTaskService(store),
+		alarmService:   NewDeviceAlarmService(store),
+		commandService: NewDeviceCommandService(store, commandCfg),
+	}
+}
+
+// report 处理设备上报，消息内容与对应HTTP接口的请求体一致
+func (r *deviceReporter) report(sn, msgType string, data json.RawMessage) error {
+	switch msgType {
+	case GatewayMsgStatus:
+		var req DeviceStatusRequest
+		if err := decodeGatewayData(data, &req); err != nil {
+			return err
+		}
+		return r.statusService.ReportDeviceStatus(sn, &req)
+	case GatewayMsgPrint:
+		var req PrintTaskRequest
+		if err := decodeGatewayData(data, &req); err != nil {
+			return err
+		}
+		return r.printService.ReportPrintStatus(sn, &req)
+	case GatewayMsgAlarm:
+		var req DeviceAlarmRequest
+		if err := decodeGatewayData(data, &req); err != nil {
+			return err
+		}
+		return r.alarmService.ReportDeviceAlarm(sn, &req)
+	case GatewayMsgCommandAck:
+		var req GatewayCommandAck
+		if err := decodeGatewayData(data, &req); err != nil {
+			return err
+		}
+		return r.commandService.AckCommand(sn, req.CommandID, &req.CommandAckRequest)
+	default:
+		return errors.New(errors.ErrInvalidParams, "不支持的消息类型: "+msgType)
+	}
+}
+
+// GatewayReply 生成应答消息
+func GatewayReply(id string, err error) *GatewayMessage {
+	reply := &GatewayMessage{Type: GatewayMsgReply, ID: id}
+	if err != nil {
+		reply.Code = int(errors.ErrUnknown)
+		reply.Message = err.Error()
+		if e, ok := err.(*errors.Error); ok {
+			reply.Code = int(e.Code)
+		}
+	}
+	return reply
+}
+
+// decodeGatewayData 解码消息内容并按binding标签校验，与HTTP接口的校验规则一致
+func decodeGatewayData(data json.RawMessage, obj interface{}) error {
+	if len(data) == 0 {
+		return errors.New(errors.ErrInvalidParams, "消息内容不能为空")
+	}
+	if err := json.Unmarshal(data, obj); err != nil {
+		return errors.New(errors.ErrInvalidParams, "参数绑定错误")
+	}
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		return errors.New(errors.ErrInvalidParams, fmt.Sprintf("参数验证错误: %v", err))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+func TestDeviceGatewayService_Session(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	device := &model.Device{
+		SN:          "M4D2401A0100013",
+		DeviceModel: "MD-400D",
+		Status:      model.DeviceStatusActive,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+	authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{})
+	pair, err := authService.GenerateToken(device, testMeta)
+	assert.NoError(t, err)
+	claims, err := utils.ParseToken(pair.AccessToken, "test_secret")
+	assert.NoError(t, err)
+
+	commandCfg := config.CommandConfig{DefaultTTL: 300, MaxTTL: 3600, PollTimeout: 5, RedeliverAfter: 60}
+	nodeA := NewDeviceGatewayService(store, config.GatewayConfig{NodeID: "node-a", HeartbeatTimeout: 90}, commandCfg)
+	nodeB := NewDeviceGatewayService(store, config.GatewayConfig{NodeID: "node-b", HeartbeatTimeout: 90}, commandCfg)
+
+	isOnline := func() bool {
+		online, err := store.DeviceStatus().FindOnline(device.SN)
+		assert.NoError(t, err)
+		return online != nil && online.IsOnline
+	}
+
+	// 建立连接后记录所在节点并标记在线
+	session, err := nodeA.Connect(device.SN, claims, pair.AccessToken)
+	assert.NoError(t, err)
+	assert.True(t, isOnline())
+	presence, err := nodeA.GetPresence(device.SN)
+	assert.NoError(t, err)
+	assert.True(t, presence.Online)
+	assert.Equal(t, "node-a", presence.NodeID)
+	assert.Equal(t, session.ConnID, presence.ConnID)
+
+	// 通过长连接上报状态
+	data, _ := json.Marshal(DeviceStatusRequest{
+		StorageTotal: 100, StorageUsed: 40, StorageFree: 60,
+		CPUUsage: 12.5, CPUTemperature: 45,
+		MemoryTotal: 1024, MemoryUsed: 512, MemoryFree: 512,
+	})
+	reply := nodeA.HandleMessage(session, &GatewayMessage{Type: GatewayMsgStatus, ID: "m1", Data: data})
+	assert.Equal(t, GatewayMsgReply, reply.Type)
+	assert.Equal(t, "m1", reply.ID)
+	assert.Zero(t, reply.Code)
+	statusCount, err := store.DeviceStatus().CountStatus(device.SN)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), statusCount)
+
+	// 校验规则与HTTP接口一致
+	reply = nodeA.HandleMessage(session, &GatewayMessage{Type: GatewayMsgStatus, ID: "m2", Data: json.RawMessage(`{"cpu_usage":1}`)})
+	assert.Equal(t, int(errors.ErrInvalidParams), reply.Code)
+	reply = nodeA.HandleMessage(session, &GatewayMessage{Type: "unknown", ID: "m3"})
+	assert.Equal(t, int(errors.ErrInvalidParams), reply.Code)
+
+	// 下发的指令通知到持有连接的会话，推送后通过长连接确认
+	commandService := NewDeviceCommandService(store, commandCfg)
+	command, err := commandService.IssueCommand(device.SN, &IssueCommandRequest{CommandType: model.CommandReboot}, "admin")
+	assert.NoError(t, err)
+	select {
+	case <-session.Commands:
+	case <-time.After(time.Second):
+		t.Fatal("command notify not received")
+	}
+	commands, err := nodeA.PendingCommands(session)
+	assert.NoError(t, err)
+	assert.Len(t, commands, 1)
+
+	data, _ = json.Marshal(GatewayCommandAck{CommandID: command.ID, CommandAckRequest: CommandAckRequest{Status: model.CommandStatusSucceeded}})
+	reply = nodeA.HandleMessage(session, &GatewayMessage{Type: GatewayMsgCommandAck, ID: "m4", Data: data})
+	assert.Zero(t, reply.Code, reply.Message)
+	command, _ = commandService.GetCommand(device.SN, command.ID)
+	assert.Equal(t, model.CommandStatusSucceeded, command.Status)
+
+	// 设备在其他节点重新连接，旧连接刷新在线记录时发现已被替换
+	newSession, err := nodeB.Connect(device.SN, claims, pair.AccessToken)
+	assert.NoError(t, err)
+	session.lastTouch = time.Now().Add(-time.Minute)
+	assert.Error(t, nodeA.Touch(session))
+	select {
+	case <-session.Done():
+		assert.Equal(t, GatewayCloseReplaced, session.CloseReason())
+	default:
+		t.Fatal("replaced session not closed")
+	}
+
+	// 旧连接断开不影响新连接的在线状态
+	nodeA.Disconnect(session)
+	assert.True(t, isOnline())
+	presence, _ = nodeA.GetPresence(device.SN)
+	assert.Equal(t, "node-b", presence.NodeID)
+
+	// 同一节点上的新连接直接关闭旧连接
+	latest, err := nodeB.Connect(device.SN, claims, pair.AccessToken)
+	assert.NoError(t, err)
+	select {
+	case <-newSession.Done():
+	default:
+		t.Fatal("previous session on the same node not closed")
+	}
+	nodeB.Disconnect(newSession)
+	assert.True(t, isOnline())
+
+	// 当前连接断开后删除在线记录并标记离线
+	nodeB.Disconnect(latest)
+	assert.False(t, isOnline())
+	presence, _ = nodeB.GetPresence(device.SN)
+	assert.False(t, presence.Online)
+
+	// 令牌注销后，下次刷新在线记录时以令牌失效关闭连接
+	session, err = nodeA.Connect(device.SN, claims, pair.AccessToken)
+	assert.NoError(t, err)
+	assert.NoError(t, authService.Logout(claims, pair.AccessToken))
+	session.lastTouch = time.Now().Add(-time.Minute)
+	assert.Error(t, nodeA.Touch(session))
+	select {
+	case <-session.Done():
+		assert.Equal(t, GatewayCloseRevoked, session.CloseReason())
+	default:
+		t.Fatal("revoked session not closed")
+	}
+	nodeA.Disconnect(session)
+
+	// 设备令牌被整体撤销后同样关闭
+	pair, err = authService.GenerateToken(device, testMeta)
+	assert.NoError(t, err)
+	claims, err = utils.ParseToken(pair.AccessToken, "test_secret")
+	assert.NoError(t, err)
+	session, err = nodeA.Connect(device.SN, claims, pair.AccessToken)
+	assert.NoError(t, err)
+	assert.NoError(t, authService.RevokeDeviceTokens(device.SN))
+	session.lastTouch = time.Now().Add(-time.Minute)
+	assert.Error(t, nodeA.Touch(session))
+	assert.Equal(t, GatewayCloseRevoked, session.CloseReason())
+	nodeA.Disconnect(session)
+}
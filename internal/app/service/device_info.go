@@ -2,18 +2,26 @@ package service
 
 import (
 	"time"
+	"go.uber.org/zap"
 	"mingda_cloud_service/internal/app/model"
-	"mingda_cloud_service/internal/pkg/database"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/constants"
 	"mingda_cloud_service/internal/pkg/errors"
-	"gorm.io/gorm"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/rabbitmq"
 )
 
+// publishDeviceEvent 发布设备事件到RabbitMQ，测试中可替换
+var publishDeviceEvent = rabbitmq.PublishJSON
+
 // DeviceInfoService 设备信息服务
-type DeviceInfoService struct{}
+type DeviceInfoService struct {
+	store repository.Store
+}
 
 // NewDeviceInfoService 创建设备信息服务实例
-func NewDeviceInfoService() *DeviceInfoService {
-	return &DeviceInfoService{}
+func NewDeviceInfoService(store repository.Store) *DeviceInfoService {
+	return &DeviceInfoService{store: store}
 }
 
 // DeviceInfoRequest 设备信息上报请求
@@ -38,15 +46,8 @@ type DeviceInfoRequest struct {
 }
 
 // ReportDeviceInfo 上报设备信息
+// 设备首次上报的版本作为基线记录，不发布变更事件
 func (s *DeviceInfoService) ReportDeviceInfo(req *DeviceInfoRequest) error {
-	// 开启事务
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
 	// 1. 更新设备基础信息
 	deviceInfo := &model.DeviceInfo{
 		DeviceSN:        req.DeviceInfo.DeviceSN,
@@ -55,15 +56,6 @@ func (s *DeviceInfoService) ReportDeviceInfo(req *DeviceInfoRequest) error {
 		UpdateTime:      time.Now(),
 	}
 
-	// 使用 Upsert 操作
-	if err := tx.Where("device_sn = ?", deviceInfo.DeviceSN).
-		Assign(deviceInfo).
-		FirstOrCreate(deviceInfo).Error; err != nil {
-		tx.Rollback()
-		return errors.NewWithError(errors.ErrDatabase, err)
-	}
-
-	// 2. 检查并更新软件版本信息
 	softwareVersions := &model.SoftwareVersions{
 		DeviceSN:            req.DeviceInfo.DeviceSN,
 		KlipperVersion:      req.SoftwareVersions.Klipper,
@@ -77,55 +69,163 @@ func (s *DeviceInfoService) ReportDeviceInfo(req *DeviceInfoRequest) error {
 		ReportTime:         time.Now(),
 	}
 
-	// 查询是否存在记录
-	var existingVersions model.SoftwareVersions
-	err := tx.Where("device_sn = ?", softwareVersions.DeviceSN).First(&existingVersions).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
+	var changes []model.SoftwareVersionChange
+	baseline := false
+	err := s.store.Transaction(func(store repository.Store) error {
+		infos := store.DeviceInfo()
+		if err := infos.SaveInfo(deviceInfo); err != nil {
+			return err
+		}
+
+		// 2. 检查并更新软件版本信息，记录各组件的版本变更
+		existing, err := infos.FindVersions(softwareVersions.DeviceSN)
+		switch {
+		case err == repository.ErrNotFound:
 			// 不存在记录，直接插入
-			if err := tx.Create(softwareVersions).Error; err != nil {
-				tx.Rollback()
-				return errors.NewWithError(errors.ErrDatabase, err)
+			if err := infos.CreateVersions(softwareVersions); err != nil {
+				return err
 			}
-		} else {
-			// 其他数据库错误
-			tx.Rollback()
-			return errors.NewWithError(errors.ErrDatabase, err)
-		}
-	} else {
-		// 存在记录，检查版本是否有变化
-		if existingVersions.KlipperVersion != softwareVersions.KlipperVersion ||
-			existingVersions.KlipperScreenVersion != softwareVersions.KlipperScreenVersion ||
-			existingVersions.MoonrakerVersion != softwareVersions.MoonrakerVersion ||
-			existingVersions.MainsailVersion != softwareVersions.MainsailVersion ||
-			existingVersions.CrowsnestVersion != softwareVersions.CrowsnestVersion ||
-			existingVersions.MainboardFirmware != softwareVersions.MainboardFirmware ||
-			existingVersions.PrintheadFirmware != softwareVersions.PrintheadFirmware ||
-			existingVersions.LevelingFirmware != softwareVersions.LevelingFirmware {
-			// 版本有变化，更新记录
-			if err := tx.Model(&model.SoftwareVersions{}).
-				Where("device_sn = ?", softwareVersions.DeviceSN).
-				Updates(map[string]interface{}{
-					"klipper_version":       softwareVersions.KlipperVersion,
+			baseline = true
+			changes = diffSoftwareVersions(nil, softwareVersions)
+		case err != nil:
+			return err
+		default:
+			changes = diffSoftwareVersions(existing, softwareVersions)
+			if len(changes) > 0 {
+				// 版本有变化，更新记录
+				if err := infos.UpdateVersions(softwareVersions.DeviceSN, map[string]interface{}{
+					"klipper_version":        softwareVersions.KlipperVersion,
 					"klipper_screen_version": softwareVersions.KlipperScreenVersion,
-					"moonraker_version":     softwareVersions.MoonrakerVersion,
-					"mainsail_version":      softwareVersions.MainsailVersion,
-					"crowsnest_version":     softwareVersions.CrowsnestVersion,
-					"mainboard_firmware":    softwareVersions.MainboardFirmware,
-					"printhead_firmware":    softwareVersions.PrintheadFirmware,
-					"leveling_firmware":     softwareVersions.LevelingFirmware,
-					"report_time":          softwareVersions.ReportTime,
-				}).Error; err != nil {
-				tx.Rollback()
-				return errors.NewWithError(errors.ErrDatabase, err)
+					"moonraker_version":      softwareVersions.MoonrakerVersion,
+					"mainsail_version":       softwareVersions.MainsailVersion,
+					"crowsnest_version":      softwareVersions.CrowsnestVersion,
+					"mainboard_firmware":     softwareVersions.MainboardFirmware,
+					"printhead_firmware":     softwareVersions.PrintheadFirmware,
+					"leveling_firmware":      softwareVersions.LevelingFirmware,
+					"report_time":            softwareVersions.ReportTime,
+				}); err != nil {
+					return err
+				}
 			}
 		}
-	}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
+		// 3. 保存版本变更记录
+		if len(changes) > 0 {
+			if err := infos.CreateVersionChanges(changes); err != nil {
+				return err
+			}
+		}
+
+		// 4. 上报的版本与升级目标版本一致时确认升级成功
+		return confirmOTAUpdates(store.OTA(), softwareVersions)
+	})
+	if err != nil {
 		return errors.NewWithError(errors.ErrDatabase, err)
 	}
 
+	// 事务提交后再发布变更事件，避免下游收到未落库的变更；首次上报只是基线，不是变更
+	if !baseline {
+		publishVersionChanges(changes)
+	}
+
 	return nil
+}
+
+// VersionChangeEvent 软件版本变更事件，发布到RabbitMQ供下游服务消费
+type VersionChangeEvent struct {
+	DeviceSN   string    `json:"device_sn"`
+	Component  string    `json:"component"`
+	OldVersion string    `json:"old_version"`
+	NewVersion string    `json:"new_version"`
+	ChangeTime time.Time `json:"change_time"`
+}
+
+// VersionTimelineQuery 版本变更时间线查询条件
+type VersionTimelineQuery struct {
+	PageQuery
+	Component string     `form:"component"`  // 组件名称
+	StartTime *time.Time `form:"start_time"` // 开始时间(RFC3339)
+	EndTime   *time.Time `form:"end_time"`   // 结束时间(RFC3339)
+}
+
+// VersionTimeline 设备软件版本时间线
+type VersionTimeline struct {
+	DeviceSN string                   `json:"device_sn"`
+	Current  []model.ComponentVersion `json:"current"` // 当前各组件版本，设备未上报时为空
+	Changes  *PageResult              `json:"changes"` // 版本变更记录，按变更时间倒序
+}
+
+// GetVersionTimeline 查询设备当前软件版本和版本变更记录
+func (s *DeviceInfoService) GetVersionTimeline(sn string, query *VersionTimelineQuery) (*VersionTimeline, error) {
+	query.normalize()
+
+	timeline := &VersionTimeline{DeviceSN: sn, Current: []model.ComponentVersion{}}
+
+	current, err := s.store.DeviceInfo().FindVersions(sn)
+	if err == nil {
+		timeline.Current = current.Components()
+	} else if err != repository.ErrNotFound {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	changes, total, err := s.store.DeviceInfo().ListVersionChanges(sn, repository.VersionChangeFilter{
+		Component: query.Component,
+		StartTime: query.StartTime,
+		EndTime:   query.EndTime,
+	}, query.page())
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	timeline.Changes = &PageResult{
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Items:    changes,
+	}
+	return timeline, nil
+}
+
+// diffSoftwareVersions 比较前后两次上报的组件版本，old为空时视为设备首次上报，返回各组件的初始版本
+func diffSoftwareVersions(old, current *model.SoftwareVersions) []model.SoftwareVersionChange {
+	previous := map[string]string{}
+	if old != nil {
+		for _, c := range old.Components() {
+			previous[c.Component] = c.Version
+		}
+	}
+
+	var changes []model.SoftwareVersionChange
+	for _, c := range current.Components() {
+		if previous[c.Component] == c.Version {
+			continue
+		}
+		changes = append(changes, model.SoftwareVersionChange{
+			DeviceSN:   current.DeviceSN,
+			Component:  c.Component,
+			OldVersion: previous[c.Component],
+			NewVersion: c.Version,
+			ChangeTime: current.ReportTime,
+		})
+	}
+	return changes
+}
+
+// publishVersionChanges 发布版本变更事件，发布失败只记录日志，不影响上报结果
+func publishVersionChanges(changes []model.SoftwareVersionChange) {
+	for _, change := range changes {
+		event := VersionChangeEvent{
+			DeviceSN:   change.DeviceSN,
+			Component:  change.Component,
+			OldVersion: change.OldVersion,
+			NewVersion: change.NewVersion,
+			ChangeTime: change.ChangeTime,
+		}
+		if err := publishDeviceEvent(constants.MQExchangeDeviceEvents, constants.MQRoutingVersionChanged, event); err != nil {
+			logger.Log.Warn("publish version change event failed",
+				zap.String("device_sn", change.DeviceSN),
+				zap.String("component", change.Component),
+				zap.Error(err))
+		}
+	}
 } 
\ No newline at end of file
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/rabbitmq"
+)
+
+func TestDeviceInfoService_VersionChanges(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	// 记录发布的版本变更事件
+	var published []VersionChangeEvent
+	publishDeviceEvent = func(exchange, routingKey string, message interface{}) error {
+		published = append(published, message.(VersionChangeEvent))
+		return nil
+	}
+	t.Cleanup(func() { publishDeviceEvent = rabbitmq.PublishJSON })
+
+	infoService := NewDeviceInfoService(store)
+	report := func(klipper, mainboard string) *DeviceInfoRequest {
+		req := &DeviceInfoRequest{}
+		req.DeviceInfo.DeviceSN = "M4D2401A0100007"
+		req.DeviceInfo.DeviceModel = "MD-400D"
+		req.SoftwareVersions.Klipper = klipper
+		req.SoftwareVersions.KlipperScreen = "0.3.1"
+		req.SoftwareVersions.Firmware.Mainboard = mainboard
+		req.SoftwareVersions.Firmware.Printhead = "1.0.0"
+		return req
+	}
+
+	// 首次上报记录已上报组件的初始版本，作为基线不发布变更事件
+	assert.NoError(t, infoService.ReportDeviceInfo(report("0.11.0", "1.2.0")))
+	timeline, err := infoService.GetVersionTimeline("M4D2401A0100007", &VersionTimelineQuery{})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, timeline.Changes.Total)
+	assert.Empty(t, published)
+
+	// 版本未变化不产生记录，变化的组件发布一条变更事件
+	assert.NoError(t, infoService.ReportDeviceInfo(report("0.11.0", "1.2.0")))
+	assert.Empty(t, published)
+	assert.NoError(t, infoService.ReportDeviceInfo(report("0.12.0", "1.2.0")))
+	if assert.Len(t, published, 1) {
+		assert.Equal(t, model.ComponentKlipper, published[0].Component)
+		assert.Equal(t, "0.11.0", published[0].OldVersion)
+		assert.Equal(t, "0.12.0", published[0].NewVersion)
+	}
+
+	timeline, err = infoService.GetVersionTimeline("M4D2401A0100007", &VersionTimelineQuery{Component: model.ComponentKlipper})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, timeline.Changes.Total)
+	changes := timeline.Changes.Items.([]model.SoftwareVersionChange)
+	assert.Equal(t, "0.11.0", changes[0].OldVersion)
+	assert.Equal(t, "0.12.0", changes[0].NewVersion)
+	assert.Equal(t, "", changes[1].OldVersion)
+	assert.Contains(t, timeline.Current, model.ComponentVersion{Component: model.ComponentKlipper, Version: "0.12.0"})
+}
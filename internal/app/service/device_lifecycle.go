@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/errors"
+)
+
+// deviceTransitions 允许的设备状态变更，已退役为终态
+var deviceTransitions = map[int][]int{
+	model.DeviceStatusProvisioned: {model.DeviceStatusActive, model.DeviceStatusSuspended, model.DeviceStatusDecommissioned},
+	model.DeviceStatusActive:      {model.DeviceStatusSuspended, model.DeviceStatusDecommissioned, model.DeviceStatusRMA},
+	model.DeviceStatusSuspended:   {model.DeviceStatusActive, model.DeviceStatusDecommissioned, model.DeviceStatusRMA},
+	model.DeviceStatusRMA:         {model.DeviceStatusActive, model.DeviceStatusProvisioned, model.DeviceStatusDecommissioned},
+}
+
+// CanTransition 判断设备状态能否从from变更为to
+func CanTransition(from, to int) bool {
+	for _, status := range deviceTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// DeviceLifecycleService 设备生命周期服务
+type DeviceLifecycleService struct {
+	store repository.Store
+}
+
+// NewDeviceLifecycleService 创建设备生命周期服务实例
+func NewDeviceLifecycleService(store repository.Store) *DeviceLifecycleService {
+	return &DeviceLifecycleService{store: store}
+}
+
+// ChangeState 变更设备状态并记录变更历史
+// 停用、退役和返厂时立即撤销设备的全部令牌，并断开设备的长连接和MQTT连接
+func (s *DeviceLifecycleService) ChangeState(sn string, to int, reason, operator string) (*model.DeviceStateHistory, error) {
+	var history *model.DeviceStateHistory
+	err := s.store.Transaction(func(store repository.Store) error {
+		device, err := store.Devices().FindBySNForUpdate(sn)
+		if err != nil {
+			return errors.New(errors.ErrDeviceNotFound, "设备不存在")
+		}
+
+		history, err = transitionDevice(store.Devices(), device, to, reason, operator)
+		if err != nil {
+			return err
+		}
+
+		if to != model.DeviceStatusActive && to != model.DeviceStatusProvisioned {
+			return revokeDeviceTokens(store, device)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+
+	if to != model.DeviceStatusActive {
+		disconnectDevice(sn)
+	}
+
+	return history, nil
+}
+
+// GetStateHistory 查询设备状态变更历史，按时间倒序
+func (s *DeviceLifecycleService) GetStateHistory(sn string) ([]model.DeviceStateHistory, error) {
+	histories, err := s.store.Devices().ListStateHistory(sn)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return histories, nil
+}
+
+// disconnectDevice 断开设备已建立的连接，长连接由持有连接的实例关闭
+// 外部Broker上的连接无法直接断开，删除连接记录后主题权限回调拒绝该设备
+func disconnectDevice(sn string) {
+	notifyDeviceKick(sn)
+	removeMQTTSession(sn)
+}
+
+// transitionDevice 在事务中校验并变更设备状态，写入变更历史
+func transitionDevice(devices repository.DeviceRepository, device *model.Device, to int, reason, operator string) (*model.DeviceStateHistory, error) {
+	if !CanTransition(device.Status, to) {
+		return nil, errors.New(errors.ErrInvalidParams, fmt.Sprintf("设备状态不能从%s变更为%s",
+			model.DeviceStatusName(device.Status), model.DeviceStatusName(to)))
+	}
+
+	// Update会把新状态写回device，先记下变更前的状态
+	from := device.Status
+	if err := devices.Update(device, map[string]interface{}{"status": to}); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	history := &model.DeviceStateHistory{
+		DeviceID:   device.ID,
+		DeviceSN:   device.SN,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+		Operator:   operator,
+	}
+	if err := devices.CreateStateHistory(history); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	device.Status = to
+	return history, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+func TestCanTransition(t *testing.T) {
+	const (
+		provisioned    = model.DeviceStatusProvisioned
+		active         = model.DeviceStatusActive
+		suspended      = model.DeviceStatusSuspended
+		decommissioned = model.DeviceStatusDecommissioned
+		rma            = model.DeviceStatusRMA
+	)
+	statuses := []int{provisioned, active, suspended, decommissioned, rma}
+
+	// 允许的状态变更，未列出的组合均不允许
+	allowed := map[[2]int]bool{
+		{provisioned, active}:         true,
+		{provisioned, suspended}:      true,
+		{provisioned, decommissioned}: true,
+		{active, suspended}:           true,
+		{active, decommissioned}:      true,
+		{active, rma}:                 true,
+		{suspended, active}:           true,
+		{suspended, decommissioned}:   true,
+		{suspended, rma}:              true,
+		{rma, active}:                 true,
+		{rma, provisioned}:            true,
+		{rma, decommissioned}:         true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			name := fmt.Sprintf("%s->%s", model.DeviceStatusName(from), model.DeviceStatusName(to))
+			t.Run(name, func(t *testing.T) {
+				assert.Equal(t, allowed[[2]int{from, to}], CanTransition(from, to))
+			})
+		}
+	}
+
+	// 未知状态不能变更
+	assert.False(t, CanTransition(99, active))
+	assert.False(t, CanTransition(active, 99))
+}
+
+func TestDeviceLifecycleService_ChangeState(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	device := &model.Device{
+		SN:          "M1A2401A0100001",
+		DeviceModel: "MD-400D",
+		Status:      model.DeviceStatusActive,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+	lifecycle := NewDeviceLifecycleService(store)
+
+	// 合法变更写入历史并撤销令牌
+	authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{})
+	pair, err := authService.GenerateToken(device, testMeta)
+	assert.NoError(t, err)
+	gateway := NewDeviceGatewayService(store, config.GatewayConfig{NodeID: "node-a", HeartbeatTimeout: 90}, config.CommandConfig{})
+	claims, err := utils.ParseToken(pair.AccessToken, "test_secret")
+	assert.NoError(t, err)
+	session, err := gateway.Connect(device.SN, claims, pair.AccessToken)
+	assert.NoError(t, err)
+	defer gateway.Disconnect(session)
+
+	history, err := lifecycle.ChangeState(device.SN, model.DeviceStatusDecommissioned, "报废", "admin")
+	assert.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusActive, history.FromStatus)
+	assert.Equal(t, model.DeviceStatusDecommissioned, history.ToStatus)
+	_, err = authService.ValidateToken(pair.AccessToken)
+	assert.Error(t, err)
+
+	// 已建立的长连接收到断开通知
+	select {
+	case <-session.Kicked:
+	case <-time.After(time.Second):
+		t.Fatal("gateway session not kicked")
+	}
+
+	// 非法变更返回错误，不修改状态也不写入历史
+	_, err = lifecycle.ChangeState(device.SN, model.DeviceStatusActive, "重新启用", "admin")
+	assert.Error(t, err)
+
+	current, err := store.Devices().FindBySN(device.SN)
+	assert.NoError(t, err)
+	assert.Equal(t, model.DeviceStatusDecommissioned, current.Status)
+
+	histories, err := lifecycle.GetStateHistory(device.SN)
+	assert.NoError(t, err)
+	assert.Len(t, histories, 1)
+
+	// 设备不存在
+	_, err = lifecycle.ChangeState("M1A2401A0199999", model.DeviceStatusSuspended, "", "admin")
+	assert.Error(t, err)
+}
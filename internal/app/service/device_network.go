@@ -0,0 +1,211 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/errors"
+)
+
+const (
+	defaultNetworkHistoryRange = 24 * time.Hour
+	maxNetworkHistoryRange     = 7 * 24 * time.Hour
+	maxNetworkHistoryPoints    = 5000
+)
+
+// DeviceNetworkService 设备网络信息服务
+type DeviceNetworkService struct {
+	store repository.Store
+}
+
+// NewDeviceNetworkService 创建设备网络信息服务实例
+func NewDeviceNetworkService(store repository.Store) *DeviceNetworkService {
+	return &DeviceNetworkService{store: store}
+}
+
+// DeviceNetworkRequest 设备网络信息上报请求
+type DeviceNetworkRequest struct {
+	DeviceSN       string `json:"device_sn"` // 设备SN，以token中的值为准
+	IPAddress      string `json:"ip_address" binding:"required,ip"`
+	MACAddress     string `json:"mac_address" binding:"required,mac"`
+	NetworkType    string `json:"network_type" binding:"omitempty,oneof=wifi ethernet"`
+	SignalStrength *int   `json:"signal_strength"` // 信号强度(dBm)，wifi时必填
+}
+
+// NetworkHistoryQuery 网络信息历史查询条件，默认查询最近24小时，最长7天
+type NetworkHistoryQuery struct {
+	StartTime *time.Time `form:"start_time"` // 开始时间(RFC3339)
+	EndTime   *time.Time `form:"end_time"`   // 结束时间(RFC3339)
+}
+
+// NetworkSample 网络信息采样点
+type NetworkSample struct {
+	ReportTime     time.Time `json:"report_time"`
+	NetworkType    string    `json:"network_type"`
+	IPAddress      string    `json:"ip_address"`
+	SignalStrength *int      `json:"signal_strength"`
+}
+
+// SignalStats 信号强度统计，只统计wifi上报
+type SignalStats struct {
+	Count int      `json:"count"`
+	Min   *int     `json:"min"`
+	Max   *int     `json:"max"`
+	Avg   *float64 `json:"avg"`
+}
+
+// NetworkHistory 设备网络信息历史
+type NetworkHistory struct {
+	DeviceSN   string          `json:"device_sn"`
+	IP         string          `json:"ip"`  // 设备当前IP
+	MAC        string          `json:"mac"` // 设备当前MAC
+	StartTime  time.Time       `json:"start_time"`
+	EndTime    time.Time       `json:"end_time"`
+	Samples    []NetworkSample `json:"samples"`
+	Signal     SignalStats     `json:"signal"`
+	Truncated  bool            `json:"truncated"`   // 采样点超过上限被截断
+	IPChanges  int             `json:"ip_changes"`  // 时间范围内IP变化次数
+	TypeSwitch int             `json:"type_switch"` // 时间范围内网络类型切换次数
+}
+
+// ReportDeviceNetwork 上报设备网络信息，保存历史记录并更新设备的最新IP和MAC
+func (s *DeviceNetworkService) ReportDeviceNetwork(tokenDeviceSN string, req *DeviceNetworkRequest) error {
+	// 使用token中的设备SN
+	req.DeviceSN = tokenDeviceSN
+	req.MACAddress = strings.ToUpper(strings.ReplaceAll(req.MACAddress, "-", ":"))
+
+	switch req.NetworkType {
+	case model.NetworkTypeWifi:
+		if req.SignalStrength == nil {
+			return errors.New(errors.ErrInvalidParams, "wifi网络必须上报信号强度")
+		}
+	case model.NetworkTypeEthernet:
+		// 有线网络没有信号强度
+		req.SignalStrength = nil
+	}
+
+	now := time.Now()
+	err := s.store.Transaction(func(store repository.Store) error {
+		device, err := store.Devices().FindBySN(req.DeviceSN)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				return errors.New(errors.ErrDeviceNotFound, "设备不存在")
+			}
+			return err
+		}
+
+		network := &model.DeviceNetwork{
+			DeviceSN:       req.DeviceSN,
+			IPAddress:      req.IPAddress,
+			MACAddress:     req.MACAddress,
+			NetworkType:    req.NetworkType,
+			SignalStrength: req.SignalStrength,
+			ReportTime:     now,
+		}
+		if err := store.DeviceNetwork().CreateNetwork(network); err != nil {
+			return err
+		}
+
+		if device.IP != req.IPAddress || device.MAC != req.MACAddress {
+			if err := store.Devices().Update(device, map[string]interface{}{
+				"ip":  req.IPAddress,
+				"mac": req.MACAddress,
+			}); err != nil {
+				return err
+			}
+		}
+
+		return store.DeviceStatus().MarkOnline(req.DeviceSN, now)
+	})
+	if err != nil {
+		return txError(err)
+	}
+
+	return nil
+}
+
+// GetNetworkHistory 查询设备在时间范围内的网络信息和信号强度变化
+func (s *DeviceNetworkService) GetNetworkHistory(sn string, query *NetworkHistoryQuery) (*NetworkHistory, error) {
+	end := time.Now()
+	if query.EndTime != nil {
+		end = *query.EndTime
+	}
+	start := end.Add(-defaultNetworkHistoryRange)
+	if query.StartTime != nil {
+		start = *query.StartTime
+	}
+	if !start.Before(end) {
+		return nil, errors.New(errors.ErrInvalidParams, "开始时间必须早于结束时间")
+	}
+	if end.Sub(start) > maxNetworkHistoryRange {
+		return nil, errors.New(errors.ErrInvalidParams, "查询时间范围不能超过7天")
+	}
+
+	device, err := s.store.Devices().FindBySN(sn)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, errors.New(errors.ErrDeviceNotFound, "设备不存在")
+		}
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	// 多查一条用于判断是否截断
+	records, err := s.store.DeviceNetwork().ListNetwork(sn, start, end, maxNetworkHistoryPoints+1)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	history := &NetworkHistory{
+		DeviceSN:  device.SN,
+		IP:        device.IP,
+		MAC:       device.MAC,
+		StartTime: start,
+		EndTime:   end,
+		Samples:   make([]NetworkSample, 0, len(records)),
+	}
+	if len(records) > maxNetworkHistoryPoints {
+		records = records[:maxNetworkHistoryPoints]
+		history.Truncated = true
+	}
+
+	var sum int
+	for i, record := range records {
+		history.Samples = append(history.Samples, NetworkSample{
+			ReportTime:     record.ReportTime,
+			NetworkType:    record.NetworkType,
+			IPAddress:      record.IPAddress,
+			SignalStrength: record.SignalStrength,
+		})
+
+		if i > 0 {
+			prev := records[i-1]
+			if prev.IPAddress != record.IPAddress {
+				history.IPChanges++
+			}
+			if prev.NetworkType != record.NetworkType {
+				history.TypeSwitch++
+			}
+		}
+
+		if record.NetworkType != model.NetworkTypeWifi || record.SignalStrength == nil {
+			continue
+		}
+		v := *record.SignalStrength
+		if history.Signal.Min == nil || v < *history.Signal.Min {
+			history.Signal.Min = &v
+		}
+		if history.Signal.Max == nil || v > *history.Signal.Max {
+			history.Signal.Max = &v
+		}
+		sum += v
+		history.Signal.Count++
+	}
+	if history.Signal.Count > 0 {
+		avg := float64(sum) / float64(history.Signal.Count)
+		history.Signal.Avg = &avg
+	}
+
+	return history, nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+)
+
+func TestDeviceNetworkService_ReportAndHistory(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	device := &model.Device{
+		SN:          "M4D2401A0100006",
+		DeviceModel: "MD-400D",
+		Status:      1,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+
+	networkService := NewDeviceNetworkService(store)
+	signal := func(v int) *int { return &v }
+
+	// wifi上报必须带信号强度
+	err := networkService.ReportDeviceNetwork(device.SN, &DeviceNetworkRequest{
+		IPAddress:   "192.168.1.20",
+		MACAddress:  "aa:bb:cc:dd:ee:ff",
+		NetworkType: model.NetworkTypeWifi,
+	})
+	assert.Error(t, err)
+
+	reports := []DeviceNetworkRequest{
+		{IPAddress: "192.168.1.20", MACAddress: "aa-bb-cc-dd-ee-ff", NetworkType: model.NetworkTypeWifi, SignalStrength: signal(-50)},
+		{IPAddress: "192.168.1.21", MACAddress: "aa-bb-cc-dd-ee-ff", NetworkType: model.NetworkTypeWifi, SignalStrength: signal(-80)},
+		{IPAddress: "192.168.1.30", MACAddress: "aa-bb-cc-dd-ee-ff", NetworkType: model.NetworkTypeEthernet, SignalStrength: signal(-10)},
+	}
+	for i := range reports {
+		assert.NoError(t, networkService.ReportDeviceNetwork(device.SN, &reports[i]))
+	}
+
+	// 设备记录保存最新的IP和MAC
+	updated, err := store.Devices().FindBySN(device.SN)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.30", updated.IP)
+	assert.Equal(t, "AA:BB:CC:DD:EE:FF", updated.MAC)
+
+	history, err := networkService.GetNetworkHistory(device.SN, &NetworkHistoryQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, history.Samples, 3)
+	assert.Nil(t, history.Samples[2].SignalStrength)
+	assert.Equal(t, 2, history.Signal.Count)
+	assert.Equal(t, -80, *history.Signal.Min)
+	assert.Equal(t, -50, *history.Signal.Max)
+	assert.Equal(t, -65.0, *history.Signal.Avg)
+	assert.Equal(t, 2, history.IPChanges)
+	assert.Equal(t, 1, history.TypeSwitch)
+
+	// 时间范围超过上限
+	start := time.Now().Add(-8 * 24 * time.Hour)
+	_, err = networkService.GetNetworkHistory(device.SN, &NetworkHistoryQuery{StartTime: &start})
+	assert.Error(t, err)
+}
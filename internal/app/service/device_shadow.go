@@ -0,0 +1,417 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"go.uber.org/zap"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/rabbitmq"
+)
+
+const (
+	shadowUpdateRetries   = 3     // 并发修改冲突时的重试次数
+	maxShadowStateSize    = 8192  // 期望配置和上报配置序列化后的大小上限(字节)
+	shadowBatchSize       = 200   // 批量修改期望配置时每批处理的设备数
+	maxShadowBatchDevices = 10000 // 批量修改期望配置的设备数上限
+)
+
+// shadowSettings 云端可下发的配置项及取值校验
+var shadowSettings = map[string]func(value interface{}) error{
+	model.ShadowKeyInfoReportInterval:     intSetting(60, 86400),
+	model.ShadowKeyStatusReportInterval:   intSetting(5, 3600),
+	model.ShadowKeyCameraSnapshotInterval: intSetting(0, 3600),
+	model.ShadowKeyAIDetectionEnabled: func(value interface{}) error {
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("必须为布尔值")
+		}
+		return nil
+	},
+	model.ShadowKeyTimezone: func(value interface{}) error {
+		name, ok := value.(string)
+		if !ok || name == "" {
+			return fmt.Errorf("必须为时区名称")
+		}
+		if _, err := time.LoadLocation(name); err != nil {
+			return fmt.Errorf("无效的时区: %s", name)
+		}
+		return nil
+	},
+}
+
+// intSetting 整数配置项校验
+func intSetting(min, max int) func(value interface{}) error {
+	return func(value interface{}) error {
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Errorf("必须为整数")
+		}
+		if n < float64(min) || n > float64(max) {
+			return fmt.Errorf("取值范围为%d-%d", min, max)
+		}
+		return nil
+	}
+}
+
+// DeviceShadowService 设备影子服务
+type DeviceShadowService struct {
+	store repository.Store
+}
+
+// NewDeviceShadowService 创建设备影子服务实例
+func NewDeviceShadowService(store repository.Store) *DeviceShadowService {
+	return &DeviceShadowService{store: store}
+}
+
+// ShadowReportRequest 设备上报当前配置，值为null表示删除该配置项
+type ShadowReportRequest struct {
+	State map[string]interface{} `json:"state" binding:"required"`
+}
+
+// ShadowDesiredRequest 修改单台设备的期望配置，值为null表示删除该配置项
+type ShadowDesiredRequest struct {
+	State   map[string]interface{} `json:"state" binding:"required"`
+	Version *int64                 `json:"version"` // 可选，期望配置当前版本，与服务端不一致时拒绝修改
+}
+
+// ShadowBatchDesiredRequest 按条件批量修改期望配置，至少指定一个筛选条件
+type ShadowBatchDesiredRequest struct {
+	SNs            []string               `json:"sns" binding:"max=1000"`
+	Model          string                 `json:"model"`
+	OrganizationID *uint                  `json:"organization_id"` // 仅平台运维人员可用
+	State          map[string]interface{} `json:"state" binding:"required"`
+}
+
+// ShadowDelta 设备需要应用的配置差异
+type ShadowDelta struct {
+	Version int64                  `json:"version"` // 当前期望配置版本，设备下次查询时带上
+	State   map[string]interface{} `json:"state"`   // 期望值与上报值不一致的配置项
+}
+
+// ShadowDocument 设备影子文档
+type ShadowDocument struct {
+	DeviceSN        string                 `json:"device_sn"`
+	Desired         map[string]interface{} `json:"desired"`
+	DesiredVersion  int64                  `json:"desired_version"`
+	DesiredTime     *time.Time             `json:"desired_time"`
+	Reported        map[string]interface{} `json:"reported"`
+	ReportedVersion int64                  `json:"reported_version"`
+	ReportedTime    *time.Time             `json:"reported_time"`
+	Delta           map[string]interface{} `json:"delta"` // 期望值与上报值不一致的配置项
+}
+
+// ShadowDeltaEvent 期望配置变更事件，发布到RabbitMQ供推送通道通知设备
+type ShadowDeltaEvent struct {
+	DeviceSN string                 `json:"device_sn"`
+	Version  int64                  `json:"version"`
+	State    map[string]interface{} `json:"state"`
+}
+
+// shadowState 解码后的设备影子
+type shadowState struct {
+	record   *model.DeviceShadow
+	desired  map[string]interface{}
+	meta     map[string]int64
+	reported map[string]interface{}
+}
+
+// GetShadow 查询设备影子文档
+func (s *DeviceShadowService) GetShadow(sn string) (*ShadowDocument, error) {
+	state, err := loadShadow(s.store.DeviceShadows(), sn)
+	if err != nil {
+		return nil, err
+	}
+	return state.document(), nil
+}
+
+// GetDelta 查询设备自指定期望配置版本以来需要应用的配置差异，version为0时返回全部差异
+func (s *DeviceShadowService) GetDelta(sn string, version int64) (*ShadowDelta, error) {
+	state, err := loadShadow(s.store.DeviceShadows(), sn)
+	if err != nil {
+		return nil, err
+	}
+	return state.delta(version), nil
+}
+
+// ReportState 设备上报当前配置，返回仍需应用的全部配置差异
+func (s *DeviceShadowService) ReportState(sn string, req *ShadowReportRequest) (*ShadowDelta, error) {
+	state, _, err := updateShadow(s.store.DeviceShadows(), sn, func(state *shadowState) (map[string]interface{}, error) {
+		changed := mergeState(state.reported, req.State)
+		if len(changed) == 0 {
+			return nil, nil
+		}
+		now := time.Now()
+		state.record.ReportedVersion++
+		state.record.ReportedTime = &now
+		return changed, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state.delta(0), nil
+}
+
+// UpdateDesired 修改单台设备的期望配置
+func (s *DeviceShadowService) UpdateDesired(sn string, req *ShadowDesiredRequest) (*ShadowDocument, error) {
+	if err := validateDesired(req.State); err != nil {
+		return nil, err
+	}
+
+	state, _, err := s.updateDesired(sn, req.State, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	return state.document(), nil
+}
+
+// UpdateDesiredBatch 按条件批量修改访问范围内设备的期望配置，返回期望配置发生变化的设备数
+func (s *DeviceShadowService) UpdateDesiredBatch(tenant Tenant, req *ShadowBatchDesiredRequest) (int64, error) {
+	if len(req.SNs) == 0 && req.Model == "" && req.OrganizationID == nil {
+		return 0, errors.New(errors.ErrInvalidParams, "请指定设备SN、型号或组织")
+	}
+	if err := validateDesired(req.State); err != nil {
+		return 0, err
+	}
+
+	if tenant.IsPlatform() && req.OrganizationID != nil {
+		tenant = OrganizationTenant(req.OrganizationID)
+	}
+	filter := repository.DeviceFilter{SNs: req.SNs, DeviceModel: req.Model}
+	total, err := s.store.Devices().Count(tenant, filter)
+	if err != nil {
+		return 0, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if total > maxShadowBatchDevices {
+		return 0, errors.New(errors.ErrInvalidParams, fmt.Sprintf("单次最多修改%d台设备，请缩小范围", maxShadowBatchDevices))
+	}
+
+	var affected int64
+	err = s.store.Devices().EachBatchInScope(tenant, filter, shadowBatchSize, func(devices []model.Device) error {
+		for _, device := range devices {
+			_, changed, err := s.updateDesired(device.SN, req.State, nil)
+			if err != nil {
+				return err
+			}
+			if changed {
+				affected++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return affected, err
+	}
+
+	return affected, nil
+}
+
+// updateDesired 合并期望配置，有变化时版本号加1并发布差异事件
+func (s *DeviceShadowService) updateDesired(sn string, patch map[string]interface{}, expectVersion *int64) (*shadowState, bool, error) {
+	state, changed, err := updateShadow(s.store.DeviceShadows(), sn, func(state *shadowState) (map[string]interface{}, error) {
+		if expectVersion != nil && *expectVersion != state.record.DesiredVersion {
+			return nil, errors.New(errors.ErrVersionNotMatch, "期望配置已被修改，请刷新后重试")
+		}
+		changed := mergeState(state.desired, patch)
+		if len(changed) == 0 {
+			return nil, nil
+		}
+		now := time.Now()
+		state.record.DesiredVersion++
+		state.record.DesiredTime = &now
+		for key := range changed {
+			if _, ok := state.desired[key]; ok {
+				state.meta[key] = state.record.DesiredVersion
+			} else {
+				delete(state.meta, key)
+			}
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 只推送本次变更且与上报值不一致的配置项
+	if changed {
+		publishShadowDelta(sn, state.delta(state.record.DesiredVersion-1))
+	}
+	return state, changed, nil
+}
+
+// validateDesired 校验期望配置项和取值
+func validateDesired(patch map[string]interface{}) error {
+	if len(patch) == 0 {
+		return errors.New(errors.ErrInvalidParams, "配置项不能为空")
+	}
+	for key, value := range patch {
+		validate, ok := shadowSettings[key]
+		if !ok {
+			return errors.New(errors.ErrInvalidParams, "不支持的配置项: "+key)
+		}
+		if value == nil {
+			continue
+		}
+		if err := validate(value); err != nil {
+			return errors.New(errors.ErrInvalidParams, fmt.Sprintf("配置项%s%s", key, err.Error()))
+		}
+	}
+	return nil
+}
+
+// mergeState 将patch合并到state，值为null时删除，返回实际发生变化的配置项
+func mergeState(state, patch map[string]interface{}) map[string]interface{} {
+	changed := map[string]interface{}{}
+	for key, value := range patch {
+		current, exists := state[key]
+		if value == nil {
+			if exists {
+				delete(state, key)
+				changed[key] = nil
+			}
+			continue
+		}
+		if exists && reflect.DeepEqual(current, value) {
+			continue
+		}
+		state[key] = value
+		changed[key] = value
+	}
+	return changed
+}
+
+// updateShadow 读取设备影子并按版本号条件更新，并发修改冲突时重新读取后重试
+// apply返回nil表示没有变化，不写入数据库
+func updateShadow(shadows repository.DeviceShadowRepository, sn string, apply func(state *shadowState) (map[string]interface{}, error)) (*shadowState, bool, error) {
+	for i := 0; i < shadowUpdateRetries; i++ {
+		state, err := loadShadow(shadows, sn)
+		if err != nil {
+			return nil, false, err
+		}
+		if state.record.ID == 0 {
+			// 首次使用时创建空影子，并发创建时忽略唯一索引冲突
+			if err := shadows.CreateIfAbsent(&model.DeviceShadow{DeviceSN: sn, Desired: "{}", DesiredMeta: "{}", Reported: "{}"}); err != nil {
+				return nil, false, errors.NewWithError(errors.ErrDatabase, err)
+			}
+			if state, err = loadShadow(shadows, sn); err != nil {
+				return nil, false, err
+			}
+		}
+
+		desiredVersion, reportedVersion := state.record.DesiredVersion, state.record.ReportedVersion
+		changed, err := apply(state)
+		if err != nil {
+			return nil, false, err
+		}
+		if changed == nil {
+			return state, false, nil
+		}
+
+		desired, _ := json.Marshal(state.desired)
+		meta, _ := json.Marshal(state.meta)
+		reported, _ := json.Marshal(state.reported)
+		if len(desired) > maxShadowStateSize || len(reported) > maxShadowStateSize {
+			return nil, false, errors.New(errors.ErrInvalidParams, "配置内容过大")
+		}
+
+		updated, err := shadows.UpdateVersioned(state.record.ID, desiredVersion, reportedVersion, map[string]interface{}{
+			"desired":          string(desired),
+			"desired_meta":     string(meta),
+			"desired_version":  state.record.DesiredVersion,
+			"desired_time":     state.record.DesiredTime,
+			"reported":         string(reported),
+			"reported_version": state.record.ReportedVersion,
+			"reported_time":    state.record.ReportedTime,
+		})
+		if err != nil {
+			return nil, false, errors.NewWithError(errors.ErrDatabase, err)
+		}
+		if updated {
+			return state, true, nil
+		}
+	}
+	return nil, false, errors.New(errors.ErrServiceBusy, "设备影子修改冲突，请稍后重试")
+}
+
+// loadShadow 读取并解码设备影子，不存在时返回空影子(ID为0)
+func loadShadow(shadows repository.DeviceShadowRepository, sn string) (*shadowState, error) {
+	record, err := shadows.Find(sn)
+	if err != nil {
+		if err != repository.ErrNotFound {
+			return nil, errors.NewWithError(errors.ErrDatabase, err)
+		}
+		record = &model.DeviceShadow{DeviceSN: sn}
+	}
+
+	state := &shadowState{
+		record:   record,
+		desired:  map[string]interface{}{},
+		meta:     map[string]int64{},
+		reported: map[string]interface{}{},
+	}
+	for _, field := range []struct {
+		raw    string
+		target interface{}
+	}{
+		{record.Desired, &state.desired},
+		{record.DesiredMeta, &state.meta},
+		{record.Reported, &state.reported},
+	} {
+		if field.raw == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(field.raw), field.target); err != nil {
+			return nil, errors.NewWithError(errors.ErrSystem, err)
+		}
+	}
+	return state, nil
+}
+
+// delta 计算自指定版本以来变更过、且与上报值不一致的期望配置项
+func (st *shadowState) delta(since int64) *ShadowDelta {
+	delta := &ShadowDelta{Version: st.record.DesiredVersion, State: map[string]interface{}{}}
+	for key, value := range st.desired {
+		if st.meta[key] <= since {
+			continue
+		}
+		if reported, ok := st.reported[key]; ok && reflect.DeepEqual(reported, value) {
+			continue
+		}
+		delta.State[key] = value
+	}
+	return delta
+}
+
+// document 转换为设备影子文档
+func (st *shadowState) document() *ShadowDocument {
+	return &ShadowDocument{
+		DeviceSN:        st.record.DeviceSN,
+		Desired:         st.desired,
+		DesiredVersion:  st.record.DesiredVersion,
+		DesiredTime:     st.record.DesiredTime,
+		Reported:        st.reported,
+		ReportedVersion: st.record.ReportedVersion,
+		ReportedTime:    st.record.ReportedTime,
+		Delta:           st.delta(0).State,
+	}
+}
+
+// publishShadowDelta 发布期望配置变更事件，发布失败只记录日志，设备仍可通过查询接口获取差异
+func publishShadowDelta(sn string, delta *ShadowDelta) {
+	if len(delta.State) == 0 {
+		return
+	}
+	event := ShadowDeltaEvent{DeviceSN: sn, Version: delta.Version, State: delta.State}
+	if err := rabbitmq.PublishJSON(constants.MQExchangeDeviceEvents, constants.MQRoutingShadowDelta, event); err != nil {
+		logger.Log.Warn("publish shadow delta event failed",
+			zap.String("device_sn", sn),
+			zap.Int64("version", delta.Version),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/errors"
+)
+
+func TestDeviceShadowService_DesiredAndReported(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	device := &model.Device{
+		SN:          "M4D2401A0100013",
+		DeviceModel: "MD-400D",
+		Status:      1,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+
+	shadowService := NewDeviceShadowService(store)
+
+	// 不支持的配置项和超出范围的取值
+	_, err := shadowService.UpdateDesired(device.SN, &ShadowDesiredRequest{State: map[string]interface{}{"unknown": 1.0}})
+	assert.Error(t, err)
+	_, err = shadowService.UpdateDesired(device.SN, &ShadowDesiredRequest{State: map[string]interface{}{model.ShadowKeyStatusReportInterval: 1.0}})
+	assert.Error(t, err)
+	_, err = shadowService.UpdateDesired(device.SN, &ShadowDesiredRequest{State: map[string]interface{}{model.ShadowKeyTimezone: "Mars/Olympus"}})
+	assert.Error(t, err)
+
+	doc, err := shadowService.UpdateDesired(device.SN, &ShadowDesiredRequest{State: map[string]interface{}{
+		model.ShadowKeyStatusReportInterval: 30.0,
+		model.ShadowKeyTimezone:             "Asia/Shanghai",
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), doc.DesiredVersion)
+	assert.Len(t, doc.Delta, 2)
+
+	// 设备应用后上报，差异清空
+	delta, err := shadowService.GetDelta(device.SN, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), delta.Version)
+	assert.Len(t, delta.State, 2)
+
+	delta, err = shadowService.ReportState(device.SN, &ShadowReportRequest{State: map[string]interface{}{
+		model.ShadowKeyStatusReportInterval: 30.0,
+		model.ShadowKeyTimezone:             "Asia/Shanghai",
+		"firmware_channel":                  "stable",
+	}})
+	assert.NoError(t, err)
+	assert.Empty(t, delta.State)
+
+	// 只返回指定版本之后变更的配置项
+	_, err = shadowService.UpdateDesired(device.SN, &ShadowDesiredRequest{State: map[string]interface{}{model.ShadowKeyAIDetectionEnabled: true}})
+	assert.NoError(t, err)
+	_, err = shadowService.UpdateDesired(device.SN, &ShadowDesiredRequest{State: map[string]interface{}{model.ShadowKeyStatusReportInterval: 60.0}})
+	assert.NoError(t, err)
+
+	delta, err = shadowService.GetDelta(device.SN, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), delta.Version)
+	assert.Equal(t, map[string]interface{}{model.ShadowKeyStatusReportInterval: 60.0}, delta.State)
+
+	delta, err = shadowService.GetDelta(device.SN, 0)
+	assert.NoError(t, err)
+	assert.Len(t, delta.State, 2)
+
+	// 期望配置版本不一致时拒绝修改
+	stale := int64(1)
+	_, err = shadowService.UpdateDesired(device.SN, &ShadowDesiredRequest{State: map[string]interface{}{model.ShadowKeyTimezone: "UTC"}, Version: &stale})
+	if assert.Error(t, err) {
+		assert.Equal(t, errors.ErrVersionNotMatch, err.(*errors.Error).Code)
+	}
+
+	// 值为null时删除配置项
+	current := int64(3)
+	doc, err = shadowService.UpdateDesired(device.SN, &ShadowDesiredRequest{State: map[string]interface{}{model.ShadowKeyAIDetectionEnabled: nil}, Version: &current})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), doc.DesiredVersion)
+	assert.NotContains(t, doc.Desired, model.ShadowKeyAIDetectionEnabled)
+	assert.Equal(t, "stable", doc.Reported["firmware_channel"])
+	assert.Equal(t, map[string]interface{}{model.ShadowKeyStatusReportInterval: 60.0}, doc.Delta)
+
+	// 相同的值不增加版本号
+	doc, err = shadowService.UpdateDesired(device.SN, &ShadowDesiredRequest{State: map[string]interface{}{model.ShadowKeyStatusReportInterval: 60.0}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), doc.DesiredVersion)
+}
+
+func TestDeviceShadowService_UpdateDesiredBatch(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	orgID := uint(7)
+	for _, d := range []model.Device{
+		{SN: "M4D2401A0100001", DeviceModel: "MD-400D", OrganizationID: &orgID},
+		{SN: "M4D2401A0100002", DeviceModel: "MD-400D"},
+		{SN: "M6D2401A0100003", DeviceModel: "MD-600D", OrganizationID: &orgID},
+	} {
+		device := d
+		device.Status = 1
+		device.LastOnline = time.Now()
+		store.Devices().Create(&device)
+	}
+
+	shadowService := NewDeviceShadowService(store)
+	state := map[string]interface{}{model.ShadowKeyCameraSnapshotInterval: 10.0}
+
+	// 必须指定筛选条件
+	_, err := shadowService.UpdateDesiredBatch(OrganizationTenant(nil), &ShadowBatchDesiredRequest{State: state})
+	assert.Error(t, err)
+
+	affected, err := shadowService.UpdateDesiredBatch(OrganizationTenant(nil), &ShadowBatchDesiredRequest{Model: "MD-400D", State: state})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), affected)
+
+	// 组织运维人员只能修改本组织的设备
+	affected, err = shadowService.UpdateDesiredBatch(OrganizationTenant(&orgID), &ShadowBatchDesiredRequest{
+		SNs:   []string{"M4D2401A0100002", "M6D2401A0100003"},
+		State: state,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	doc, err := shadowService.GetShadow("M4D2401A0100002")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), doc.DesiredVersion)
+	doc, err = shadowService.GetShadow("M6D2401A0100003")
+	assert.NoError(t, err)
+	assert.Equal(t, 10.0, doc.Desired[model.ShadowKeyCameraSnapshotInterval])
+}
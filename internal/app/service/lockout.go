@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/redis"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+const (
+	defaultLockoutWindow      = 15 * time.Minute
+	defaultSNMaxFailures      = 5
+	defaultIPMaxFailures      = 30
+	defaultLockoutDuration    = time.Minute
+	defaultLockoutMaxDuration = time.Hour
+
+	// 锁定次数保留时长，超过后锁定时长从头计算
+	lockoutStrikeTTL = 24 * time.Hour
+)
+
+// RequestMeta 请求来源信息
+type RequestMeta struct {
+	ClientIP  string
+	UserAgent string
+}
+
+// Lockout 锁定信息
+type Lockout struct {
+	Scope       string    `json:"scope"`        // 锁定维度：sn/ip
+	Value       string    `json:"value"`        // 设备SN或客户端IP
+	LockedUntil time.Time `json:"locked_until"` // 解锁时间
+	RetryAfter  int64     `json:"retry_after"`  // 剩余锁定时长(秒)
+}
+
+// LockoutService 认证失败锁定服务
+// 按SN和客户端IP分别在滑动窗口内统计认证失败次数，超过阈值后临时锁定，
+// 重复锁定时锁定时长逐次翻倍
+type LockoutService struct {
+	store    repository.Store
+	window   time.Duration
+	snMax    int
+	ipMax    int
+	lockBase time.Duration
+	lockMax  time.Duration
+}
+
+// NewLockoutService 创建认证失败锁定服务实例
+func NewLockoutService(store repository.Store, cfg config.AuthConfig) *LockoutService {
+	s := &LockoutService{
+		store:    store,
+		window:   time.Duration(cfg.LockoutWindow) * time.Second,
+		snMax:    cfg.SNMaxFailures,
+		ipMax:    cfg.IPMaxFailures,
+		lockBase: time.Duration(cfg.LockoutDuration) * time.Second,
+		lockMax:  time.Duration(cfg.LockoutMaxDuration) * time.Second,
+	}
+	if s.window <= 0 {
+		s.window = defaultLockoutWindow
+	}
+	if s.snMax <= 0 {
+		s.snMax = defaultSNMaxFailures
+	}
+	if s.ipMax <= 0 {
+		s.ipMax = defaultIPMaxFailures
+	}
+	if s.lockBase <= 0 {
+		s.lockBase = defaultLockoutDuration
+	}
+	if s.lockMax < s.lockBase {
+		s.lockMax = defaultLockoutMaxDuration
+		if s.lockMax < s.lockBase {
+			s.lockMax = s.lockBase
+		}
+	}
+	return s
+}
+
+// RetryAfter 返回SN或IP的剩余锁定时长，未锁定时返回0
+// Redis不可用时不阻断认证
+func (s *LockoutService) RetryAfter(sn, ip string) time.Duration {
+	ctx := context.Background()
+	var remaining time.Duration
+	for _, target := range lockoutTargets(sn, ip) {
+		ttl, err := redis.Client.PTTL(ctx, lockoutKey(constants.RedisAuthLockPrefix, target.scope, target.value)).Result()
+		if err == nil && ttl > remaining {
+			remaining = ttl
+		}
+	}
+	return remaining
+}
+
+// RecordFailure 记录一次认证失败，达到阈值时锁定对应的SN或IP
+// sn为空时只统计IP，用于未注册SN的探测
+func (s *LockoutService) RecordFailure(sn, ip, reason string) {
+	ctx := context.Background()
+	for _, target := range lockoutTargets(sn, ip) {
+		count, err := s.addFailure(ctx, target.scope, target.value)
+		if err != nil {
+			continue
+		}
+
+		limit := s.snMax
+		if target.scope == model.LockoutScopeIP {
+			limit = s.ipMax
+		}
+		if count >= int64(limit) {
+			s.lock(ctx, target.scope, target.value, sn, ip, count, reason)
+		}
+	}
+}
+
+// ClearFailures 认证成功后清除SN的失败记录
+func (s *LockoutService) ClearFailures(sn string) {
+	redis.Del(context.Background(), lockoutKey(constants.RedisAuthFailPrefix, model.LockoutScopeSN, sn))
+}
+
+// ListLockouts 查询当前全部锁定
+func (s *LockoutService) ListLockouts() ([]Lockout, error) {
+	ctx := context.Background()
+	lockouts := make([]Lockout, 0)
+
+	iter := redis.Client.Scan(ctx, 0, constants.RedisAuthLockPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		parts := strings.SplitN(strings.TrimPrefix(key, constants.RedisAuthLockPrefix), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		ttl, err := redis.Client.PTTL(ctx, key).Result()
+		if err != nil || ttl <= 0 {
+			continue
+		}
+		lockouts = append(lockouts, Lockout{
+			Scope:       parts[0],
+			Value:       parts[1],
+			LockedUntil: time.Now().Add(ttl),
+			RetryAfter:  retryAfterSeconds(ttl),
+		})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, errors.NewWithError(errors.ErrRedis, err)
+	}
+
+	sort.Slice(lockouts, func(i, j int) bool {
+		return lockouts[i].LockedUntil.Before(lockouts[j].LockedUntil)
+	})
+	return lockouts, nil
+}
+
+// ClearLockout 解除锁定，同时清除失败记录和锁定次数
+func (s *LockoutService) ClearLockout(scope, value, operator string) error {
+	if scope != model.LockoutScopeSN && scope != model.LockoutScopeIP {
+		return errors.New(errors.ErrInvalidParams, "无效的锁定维度")
+	}
+	if value == "" {
+		return errors.New(errors.ErrInvalidParams, "锁定对象不能为空")
+	}
+
+	ctx := context.Background()
+	if err := redis.Del(ctx,
+		lockoutKey(constants.RedisAuthLockPrefix, scope, value),
+		lockoutKey(constants.RedisAuthFailPrefix, scope, value),
+		lockoutKey(constants.RedisAuthStrikePrefix, scope, value),
+	); err != nil {
+		return errors.NewWithError(errors.ErrRedis, err)
+	}
+
+	audit := &model.AuthAudit{
+		Event:      model.AuthEventLockoutCleared,
+		Scope:      scope,
+		Result:     model.AuthResultSuccess,
+		ResultCode: authSuccessCode,
+		Detail:     fmt.Sprintf("运维人员%s解除锁定", operator),
+	}
+	if scope == model.LockoutScopeSN {
+		audit.DeviceSN = value
+	} else {
+		audit.ClientIP = value
+	}
+	recordAuthAudit(s.store, audit)
+	return nil
+}
+
+// addFailure 在滑动窗口中记录一次失败，返回窗口内的失败次数
+func (s *LockoutService) addFailure(ctx context.Context, scope, value string) (int64, error) {
+	key := lockoutKey(constants.RedisAuthFailPrefix, scope, value)
+	now := time.Now()
+
+	var card *goredis.IntCmd
+	_, err := redis.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-s.window).UnixMilli(), 10))
+		pipe.ZAdd(ctx, key, &goredis.Z{
+			Score:  float64(now.UnixMilli()),
+			Member: fmt.Sprintf("%d-%s", now.UnixNano(), utils.GenerateRandomString(6)),
+		})
+		card = pipe.ZCard(ctx, key)
+		pipe.Expire(ctx, key, s.window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return card.Val(), nil
+}
+
+// lock 锁定SN或IP，锁定时长按24小时内的锁定次数翻倍
+func (s *LockoutService) lock(ctx context.Context, scope, value, sn, ip string, failures int64, reason string) {
+	strikeKey := lockoutKey(constants.RedisAuthStrikePrefix, scope, value)
+	strikes, err := redis.Client.Incr(ctx, strikeKey).Result()
+	if err != nil {
+		return
+	}
+	redis.Client.Expire(ctx, strikeKey, lockoutStrikeTTL)
+
+	duration := s.lockBase
+	for i := int64(1); i < strikes && duration < s.lockMax; i++ {
+		duration *= 2
+	}
+	if duration > s.lockMax {
+		duration = s.lockMax
+	}
+
+	until := time.Now().Add(duration)
+	if err := redis.Set(ctx, lockoutKey(constants.RedisAuthLockPrefix, scope, value), until.Unix(), duration); err != nil {
+		return
+	}
+	// 重新开始统计，解锁后再次失败达到阈值才会再次锁定
+	redis.Del(ctx, lockoutKey(constants.RedisAuthFailPrefix, scope, value))
+
+	recordAuthAudit(s.store, &model.AuthAudit{
+		Event:      model.AuthEventLockout,
+		Scope:      scope,
+		DeviceSN:   sn,
+		ClientIP:   ip,
+		Result:     model.AuthResultFailure,
+		ResultCode: int(errors.ErrTooManyReq),
+		Detail: fmt.Sprintf("%s: 窗口内认证失败%d次，第%d次锁定，锁定%d秒",
+			reason, failures, strikes, retryAfterSeconds(duration)),
+	})
+}
+
+// recordAuthAudit 写入认证审计记录，写入失败不影响认证流程
+func recordAuthAudit(store repository.Store, audit *model.AuthAudit) {
+	store.AuthAudits().Create(audit)
+}
+
+// lockedError 锁定期间返回的错误，附带重试等待时间
+func lockedError(remaining time.Duration) error {
+	return errors.New(errors.ErrTooManyReq, fmt.Sprintf("认证失败次数过多，请%d秒后重试", retryAfterSeconds(remaining)))
+}
+
+func retryAfterSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+type lockoutTarget struct {
+	scope string
+	value string
+}
+
+func lockoutTargets(sn, ip string) []lockoutTarget {
+	targets := make([]lockoutTarget, 0, 2)
+	if sn != "" {
+		targets = append(targets, lockoutTarget{scope: model.LockoutScopeSN, value: sn})
+	}
+	if ip != "" {
+		targets = append(targets, lockoutTarget{scope: model.LockoutScopeIP, value: ip})
+	}
+	return targets
+}
+
+func lockoutKey(prefix, scope, value string) string {
+	return prefix + scope + ":" + value
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/redis"
+)
+
+func TestLockoutService(t *testing.T) {
+	// 初始化测试环境，单独持有内存Redis以便推进过期时间
+	store := setupTestEnv(t)
+	mr := miniredis.RunT(t)
+	redis.Client = goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+
+	lockout := NewLockoutService(store, config.AuthConfig{
+		LockoutWindow:      60,
+		SNMaxFailures:      3,
+		IPMaxFailures:      5,
+		LockoutDuration:    10,
+		LockoutMaxDuration: 35,
+	})
+	sn := "M1A2401A0100001"
+
+	assertLocked := func(want time.Duration) {
+		t.Helper()
+		remaining := lockout.RetryAfter(sn, "")
+		assert.True(t, remaining > want-time.Second && remaining <= want, "remaining %v, want %v", remaining, want)
+	}
+	fail := func(times int) {
+		for i := 0; i < times; i++ {
+			lockout.RecordFailure(sn, "", "签名验证失败")
+		}
+	}
+
+	// 未达到阈值不锁定，达到阈值后锁定首次时长
+	fail(2)
+	assert.Zero(t, lockout.RetryAfter(sn, ""))
+	fail(1)
+	assertLocked(10 * time.Second)
+
+	// 锁定到期后自动解锁，再次达到阈值时锁定时长翻倍，直到上限
+	mr.FastForward(11 * time.Second)
+	assert.Zero(t, lockout.RetryAfter(sn, ""))
+	fail(3)
+	assertLocked(20 * time.Second)
+
+	mr.FastForward(21 * time.Second)
+	fail(3)
+	assertLocked(35 * time.Second)
+
+	lockouts, err := lockout.ListLockouts()
+	assert.NoError(t, err)
+	if assert.Len(t, lockouts, 1) {
+		assert.Equal(t, model.LockoutScopeSN, lockouts[0].Scope)
+		assert.Equal(t, sn, lockouts[0].Value)
+		assert.Equal(t, int64(35), lockouts[0].RetryAfter)
+	}
+
+	// 运维解除锁定后同时清除锁定次数，下次锁定从首次时长开始
+	assert.Error(t, lockout.ClearLockout("device", sn, "admin"))
+	assert.NoError(t, lockout.ClearLockout(model.LockoutScopeSN, sn, "admin"))
+	assert.Zero(t, lockout.RetryAfter(sn, ""))
+	fail(3)
+	assertLocked(10 * time.Second)
+	assert.NoError(t, lockout.ClearLockout(model.LockoutScopeSN, sn, "admin"))
+
+	// 超出滑动窗口的失败不再计数
+	fail(2)
+	mr.FastForward(61 * time.Second)
+	fail(1)
+	assert.Zero(t, lockout.RetryAfter(sn, ""))
+
+	// 认证成功后清除失败记录
+	fail(1)
+	lockout.ClearFailures(sn)
+	fail(2)
+	assert.Zero(t, lockout.RetryAfter(sn, ""))
+
+	// IP按单独的阈值统计，未注册SN的探测只计入IP
+	for i := 0; i < 4; i++ {
+		lockout.RecordFailure("", "10.0.0.1", "设备不存在")
+	}
+	assert.Zero(t, lockout.RetryAfter("", "10.0.0.1"))
+	lockout.RecordFailure("", "10.0.0.1", "设备不存在")
+	assert.True(t, lockout.RetryAfter("M1A2401A0100002", "10.0.0.1") > 0)
+	assert.Zero(t, lockout.RetryAfter("M1A2401A0100002", "10.0.0.2"))
+
+	// 每次锁定和解除锁定都写入审计
+	countAudits := func(event string) int64 {
+		_, total, err := store.AuthAudits().List(repository.Tenant{}, repository.AuthAuditFilter{Event: event}, repository.Page{Limit: 1})
+		assert.NoError(t, err)
+		return total
+	}
+	assert.Equal(t, int64(5), countAudits(model.AuthEventLockout))
+	assert.Equal(t, int64(2), countAudits(model.AuthEventLockoutCleared))
+}
@@ -0,0 +1,419 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	goredis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/redis"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// MQTT主题类型，设备主题为{prefix}/{sn}/{type}
+const (
+	MQTTTopicOnline  = "online"  // 设备上下线，内容为online/offline，建议设为遗嘱消息
+	MQTTTopicCommand = "command" // 服务端推送的指令
+	MQTTTopicReply   = "reply"   // 设备上报处理失败时的应答
+)
+
+// 设备可发布的主题类型，status/print/alarm/command_ack的内容与长连接消息一致
+var mqttUplinkTopics = []string{MQTTTopicOnline, GatewayMsgStatus, GatewayMsgPrint, GatewayMsgAlarm, GatewayMsgCommandAck}
+
+// 设备可订阅的主题类型
+var mqttDownlinkTopics = []string{MQTTTopicCommand, MQTTTopicReply}
+
+// Broker认证接口返回结果
+const (
+	MQTTResultAllow = "allow"
+	MQTTResultDeny  = "deny"
+)
+
+const (
+	mqttPublishTimeout    = 10 * time.Second // 单条消息发布超时
+	mqttDisconnectQuiesce = 250              // 断开连接前等待未完成消息的时间(毫秒)
+)
+
+// mqttPublisher 向Broker发布消息
+type mqttPublisher interface {
+	Publish(topic string, payload []byte) error
+}
+
+// pahoPublisher 基于paho客户端的消息发布
+type pahoPublisher struct {
+	client mqtt.Client
+	qos    byte
+}
+
+func (p *pahoPublisher) Publish(topic string, payload []byte) error {
+	token := p.client.Publish(topic, p.qos, false, payload)
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		return fmt.Errorf("publish %s timeout", topic)
+	}
+	return token.Error()
+}
+
+// MQTTBridgeService MQTT接入服务，连接外部Broker订阅设备上报并推送指令
+// 设备上报复用长连接的处理逻辑，设备认证和主题权限由Broker回调认证接口完成
+type MQTTBridgeService struct {
+	store       repository.Store
+	prefix      string
+	presenceTTL time.Duration
+	reporter    *deviceReporter
+	publisher   mqttPublisher
+
+	client mqtt.Client
+	pubsub *goredis.PubSub
+}
+
+// NewMQTTBridgeService 创建MQTT接入服务实例，连接Broker并订阅指令下发通知
+// 连接失败时在后台重试，不阻塞服务启动
+func NewMQTTBridgeService(store repository.Store, cfg config.MQTTConfig, commandCfg config.CommandConfig) *MQTTBridgeService {
+	service := newMQTTBridge(store, cfg, commandCfg)
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		// 消息处理中会发布应答和指令，按顺序处理时等待发布完成会阻塞客户端
+		SetOrderMatters(false).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			service.subscribe(client, cfg)
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Log.Warn("mqtt connection lost", zap.String("broker", cfg.Broker), zap.Error(err))
+		})
+	service.client = mqtt.NewClient(opts)
+	service.publisher = &pahoPublisher{client: service.client, qos: cfg.QoS}
+	service.client.Connect()
+
+	service.pubsub = redis.Client.Subscribe(context.Background(), constants.RedisDeviceCommandChannel)
+	go service.startNotify()
+
+	return service
+}
+
+// newMQTTBridge 创建不连接Broker的MQTT接入服务
+func newMQTTBridge(store repository.Store, cfg config.MQTTConfig, commandCfg config.CommandConfig) *MQTTBridgeService {
+	return &MQTTBridgeService{
+		store:       store,
+		prefix:      cfg.TopicPrefix,
+		presenceTTL: time.Duration(cfg.PresenceTTL) * time.Second,
+		reporter:    newDeviceReporter(store, commandCfg),
+	}
+}
+
+// subscribe 订阅设备上报主题，每次连接成功后重新订阅
+// 配置了共享订阅分组时多个实例分摊消息，每条消息只由一个实例处理
+func (s *MQTTBridgeService) subscribe(client mqtt.Client, cfg config.MQTTConfig) {
+	filters := make(map[string]byte, len(mqttUplinkTopics))
+	for _, topicType := range mqttUplinkTopics {
+		filter := s.topic("+", topicType)
+		if cfg.SharedGroup != "" {
+			filter = "$share/" + cfg.SharedGroup + "/" + filter
+		}
+		filters[filter] = cfg.QoS
+	}
+
+	token := client.SubscribeMultiple(filters, func(_ mqtt.Client, msg mqtt.Message) {
+		s.HandleMessage(msg.Topic(), msg.Payload())
+	})
+	if token.Wait(); token.Error() != nil {
+		logger.Log.Error("mqtt subscribe failed", zap.String("broker", cfg.Broker), zap.Error(token.Error()))
+		return
+	}
+	logger.Log.Info("mqtt bridge connected", zap.String("broker", cfg.Broker))
+}
+
+// HandleMessage 处理设备发布的消息，处理失败时向设备的应答主题发布错误信息
+func (s *MQTTBridgeService) HandleMessage(topic string, payload []byte) {
+	sn, topicType, ok := s.parseTopic(topic)
+	if !ok {
+		logger.Log.Warn("ignore mqtt message", zap.String("topic", topic))
+		return
+	}
+
+	// 主题权限由Broker校验，这里再确认设备可用，避免Broker未配置认证时接收伪造的上报
+	device, err := s.store.Devices().FindBySN(sn)
+	if err != nil || device.Status != model.DeviceStatusActive {
+		logger.Log.Warn("ignore mqtt message from unavailable device", zap.String("topic", topic))
+		return
+	}
+
+	if topicType == MQTTTopicOnline {
+		s.handleOnline(sn, payload)
+		return
+	}
+
+	s.refreshPresence(sn)
+	if err := s.reporter.report(sn, topicType, payload); err != nil {
+		s.publishJSON(sn, MQTTTopicReply, GatewayReply(topicType, err))
+		return
+	}
+
+	// 状态按固定间隔上报，借此重新推送超时未确认的指令
+	if topicType == GatewayMsgStatus {
+		s.PushCommands(sn)
+	}
+}
+
+// handleOnline 处理设备上下线消息，上线时推送待下发的指令
+func (s *MQTTBridgeService) handleOnline(sn string, payload []byte) {
+	now := time.Now()
+	switch parseMQTTOnline(payload) {
+	case "online":
+		s.refreshPresence(sn)
+		if err := s.store.DeviceStatus().MarkOnline(sn, now); err != nil {
+			logger.Log.Error("mark device online failed", zap.String("device_sn", sn), zap.Error(err))
+		}
+		s.PushCommands(sn)
+	case "offline":
+		if err := redis.Client.Del(context.Background(), constants.RedisMQTTPresencePrefix+sn).Err(); err != nil {
+			logger.Log.Error("remove mqtt presence failed", zap.String("device_sn", sn), zap.Error(err))
+		}
+		if err := s.store.DeviceStatus().MarkDeviceOffline(sn, now); err != nil {
+			logger.Log.Error("mark device offline failed", zap.String("device_sn", sn), zap.Error(err))
+		}
+	default:
+		logger.Log.Warn("invalid mqtt online payload", zap.String("device_sn", sn), zap.ByteString("payload", payload))
+	}
+}
+
+// PushCommands 设备通过MQTT在线时推送待下发的指令
+// 指令下发状态按条件更新，多个实例同时收到通知时只有一个实例推送
+func (s *MQTTBridgeService) PushCommands(sn string) {
+	online, err := redis.Exists(context.Background(), constants.RedisMQTTPresencePrefix+sn)
+	if err != nil || !online {
+		return
+	}
+
+	commands, err := s.reporter.commandService.deliver(sn)
+	if err != nil {
+		logger.Log.Error("load pending commands failed", zap.String("device_sn", sn), zap.Error(err))
+		return
+	}
+	// 发布失败的指令保持已下发状态，超过重新下发间隔后再次推送
+	for i := range commands {
+		s.publishJSON(sn, MQTTTopicCommand, &commands[i])
+	}
+}
+
+// refreshPresence 记录设备通过MQTT在线，超过有效期未收到消息时失效
+func (s *MQTTBridgeService) refreshPresence(sn string) {
+	if err := redis.Client.Set(context.Background(), constants.RedisMQTTPresencePrefix+sn, 1, s.presenceTTL).Err(); err != nil {
+		logger.Log.Error("refresh mqtt presence failed", zap.String("device_sn", sn), zap.Error(err))
+	}
+}
+
+// publishJSON 向设备主题发布JSON消息
+func (s *MQTTBridgeService) publishJSON(sn, topicType string, v interface{}) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		logger.Log.Error("encode mqtt message failed", zap.String("device_sn", sn), zap.Error(err))
+		return
+	}
+	if err := s.publisher.Publish(s.topic(sn, topicType), payload); err != nil {
+		logger.Log.Error("publish mqtt message failed", zap.String("device_sn", sn), zap.String("type", topicType), zap.Error(err))
+	}
+}
+
+// topic 生成设备主题
+func (s *MQTTBridgeService) topic(sn, topicType string) string {
+	return s.prefix + "/" + sn + "/" + topicType
+}
+
+// parseTopic 从设备主题中解析设备SN和主题类型
+func (s *MQTTBridgeService) parseTopic(topic string) (sn, topicType string, ok bool) {
+	return parseMQTTTopic(s.prefix, topic)
+}
+
+// startNotify 收到指令下发通知后向MQTT在线的设备推送，订阅关闭后退出
+func (s *MQTTBridgeService) startNotify() {
+	for msg := range s.pubsub.Channel() {
+		s.PushCommands(msg.Payload)
+	}
+}
+
+// Stop 停止服务
+func (s *MQTTBridgeService) Stop() {
+	s.pubsub.Close()
+	s.client.Disconnect(mqttDisconnectQuiesce)
+}
+
+// MQTTAuthRequest Broker认证回调请求
+type MQTTAuthRequest struct {
+	Username string `json:"username" binding:"required"` // 设备SN
+	Password string `json:"password" binding:"required"` // 设备访问令牌
+}
+
+// MQTTACLRequest Broker主题权限回调请求
+type MQTTACLRequest struct {
+	Username string `json:"username" binding:"required"`
+	Topic    string `json:"topic" binding:"required"`
+	Action   string `json:"action" binding:"required,oneof=publish subscribe"`
+}
+
+// MQTTAuthResult Broker回调结果
+type MQTTAuthResult struct {
+	Result      string `json:"result"`
+	IsSuperuser bool   `json:"is_superuser,omitempty"`
+	ExpireAt    int64  `json:"expire_at,omitempty"` // 访问令牌过期时间，Broker到期后断开设备连接
+}
+
+// MQTTAuthService Broker认证回调服务，设备以SN为用户名、访问令牌为密码连接Broker
+// 连接时使用的令牌记录在Redis，主题权限回调据此重新确认设备和令牌仍然有效
+type MQTTAuthService struct {
+	store       repository.Store
+	authService *AuthService
+	jwtSecret   string
+	prefix      string
+	username    string
+	password    string
+}
+
+// NewMQTTAuthService 创建Broker认证回调服务实例
+func NewMQTTAuthService(store repository.Store, jwtSecret string, cipher *utils.SecretCipher, authCfg config.AuthConfig, cfg config.MQTTConfig) *MQTTAuthService {
+	return &MQTTAuthService{
+		store:       store,
+		authService: NewAuthService(store, jwtSecret, cipher, authCfg),
+		jwtSecret:   jwtSecret,
+		prefix:      cfg.TopicPrefix,
+		username:    cfg.Username,
+		password:    cfg.Password,
+	}
+}
+
+// Authenticate 校验连接Broker的账号，服务端账号为超级用户
+func (s *MQTTAuthService) Authenticate(req *MQTTAuthRequest) *MQTTAuthResult {
+	if s.isBridge(req.Username) {
+		if subtle.ConstantTimeCompare([]byte(req.Password), []byte(s.password)) == 1 {
+			return &MQTTAuthResult{Result: MQTTResultAllow, IsSuperuser: true}
+		}
+		return &MQTTAuthResult{Result: MQTTResultDeny}
+	}
+
+	device, err := s.authService.ValidateToken(req.Password)
+	if err != nil || device.SN != req.Username || device.Status != model.DeviceStatusActive {
+		return &MQTTAuthResult{Result: MQTTResultDeny}
+	}
+
+	claims, err := utils.ParseToken(req.Password, s.jwtSecret)
+	if err != nil {
+		return &MQTTAuthResult{Result: MQTTResultDeny}
+	}
+	if err := saveMQTTSession(device.SN, claims, req.Password); err != nil {
+		logger.Log.Error("save mqtt session failed", zap.String("device_sn", device.SN), zap.Error(err))
+		return &MQTTAuthResult{Result: MQTTResultDeny}
+	}
+	return &MQTTAuthResult{Result: MQTTResultAllow, ExpireAt: claims.ExpiresAt}
+}
+
+// Authorize 校验主题权限，设备只能发布和订阅自己的主题
+func (s *MQTTAuthService) Authorize(req *MQTTACLRequest) *MQTTAuthResult {
+	if s.isBridge(req.Username) {
+		return &MQTTAuthResult{Result: MQTTResultAllow}
+	}
+
+	sn, topicType, ok := parseMQTTTopic(s.prefix, req.Topic)
+	if !ok || sn != req.Username || !s.sessionUsable(sn) {
+		return &MQTTAuthResult{Result: MQTTResultDeny}
+	}
+
+	allowed := mqttUplinkTopics
+	if req.Action == "subscribe" {
+		allowed = mqttDownlinkTopics
+	}
+	for _, t := range allowed {
+		if t == topicType {
+			return &MQTTAuthResult{Result: MQTTResultAllow}
+		}
+	}
+	return &MQTTAuthResult{Result: MQTTResultDeny}
+}
+
+// sessionUsable 每次回调重新确认设备处于启用状态，且连接时使用的令牌未被注销或撤销
+func (s *MQTTAuthService) sessionUsable(sn string) bool {
+	issuedAt, tokenHash, ok := loadMQTTSession(sn)
+	if !ok {
+		return false
+	}
+	return checkSessionToken(s.store, sn, issuedAt, tokenHash) == nil
+}
+
+// isBridge 是否为服务端连接Broker的账号
+func (s *MQTTAuthService) isBridge(username string) bool {
+	return s.username != "" && username == s.username
+}
+
+// saveMQTTSession 记录设备连接Broker使用的令牌，保留到令牌过期为止
+func saveMQTTSession(sn string, claims *utils.Claims, token string) error {
+	value := fmt.Sprintf("%d|%s", claims.IssuedAt, utils.HashToken(token))
+	return redis.Client.Set(context.Background(), constants.RedisMQTTSessionPrefix+sn, value,
+		time.Until(time.Unix(claims.ExpiresAt, 0))).Err()
+}
+
+// loadMQTTSession 读取设备连接Broker使用的令牌签发时间和摘要，没有记录时视为未连接
+func loadMQTTSession(sn string) (issuedAt int64, tokenHash string, ok bool) {
+	value, err := redis.Client.Get(context.Background(), constants.RedisMQTTSessionPrefix+sn).Result()
+	if err != nil {
+		return 0, "", false
+	}
+	parts := strings.SplitN(value, "|", 2)
+	if len(parts) != 2 {
+		return 0, "", false
+	}
+	issuedAt, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return issuedAt, parts[1], true
+}
+
+// removeMQTTSession 删除设备的MQTT连接记录，之后的主题权限回调拒绝该设备
+func removeMQTTSession(sn string) {
+	if err := redis.Client.Del(context.Background(), constants.RedisMQTTSessionPrefix+sn, constants.RedisMQTTPresencePrefix+sn).Err(); err != nil {
+		logger.Log.Error("remove mqtt session failed", zap.String("device_sn", sn), zap.Error(err))
+	}
+}
+
+// parseMQTTTopic 从{prefix}/{sn}/{type}格式的主题中解析设备SN和主题类型，包含通配符时视为无效
+func parseMQTTTopic(prefix, topic string) (sn, topicType string, ok bool) {
+	if !strings.HasPrefix(topic, prefix+"/") || strings.ContainsAny(topic, "+#") {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(topic, prefix+"/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// parseMQTTOnline 解析上下线消息，兼容Moonraker的{"server": "online"}格式
+func parseMQTTOnline(payload []byte) string {
+	text := strings.TrimSpace(string(payload))
+	if strings.HasPrefix(text, "{") {
+		var status struct {
+			Server string `json:"server"`
+		}
+		if err := json.Unmarshal(payload, &status); err != nil {
+			return ""
+		}
+		text = status.Server
+	}
+	return strings.ToLower(text)
+}
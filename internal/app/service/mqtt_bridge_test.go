@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// recordPublisher 记录发布的消息，代替Broker
+type recordPublisher struct {
+	topics   []string
+	payloads [][]byte
+}
+
+func (p *recordPublisher) Publish(topic string, payload []byte) error {
+	p.topics = append(p.topics, topic)
+	p.payloads = append(p.payloads, payload)
+	return nil
+}
+
+func TestMQTTBridgeService_HandleMessage(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	device := &model.Device{
+		SN:          "M4D2401A0100013",
+		DeviceModel: "MD-400D",
+		Status:      model.DeviceStatusActive,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+
+	commandCfg := config.CommandConfig{DefaultTTL: 300, MaxTTL: 3600, PollTimeout: 5, RedeliverAfter: 60}
+	bridge := newMQTTBridge(store, config.MQTTConfig{TopicPrefix: "mingda", PresenceTTL: 180}, commandCfg)
+	publisher := &recordPublisher{}
+	bridge.publisher = publisher
+
+	isOnline := func() bool {
+		online, err := store.DeviceStatus().FindOnline(device.SN)
+		assert.NoError(t, err)
+		return online != nil && online.IsOnline
+	}
+
+	// 设备未通过MQTT上线时不推送指令
+	commandService := NewDeviceCommandService(store, commandCfg)
+	command, err := commandService.IssueCommand(device.SN, &IssueCommandRequest{CommandType: model.CommandPausePrint}, "admin")
+	assert.NoError(t, err)
+	bridge.PushCommands(device.SN)
+	assert.Empty(t, publisher.topics)
+
+	// 上线后标记在线并推送待下发的指令，兼容Moonraker的上下线消息格式
+	bridge.HandleMessage("mingda/"+device.SN+"/online", []byte(`{"server": "online"}`))
+	assert.True(t, isOnline())
+	if assert.Len(t, publisher.topics, 1) {
+		assert.Equal(t, "mingda/"+device.SN+"/command", publisher.topics[0])
+		var pushed model.DeviceCommand
+		assert.NoError(t, json.Unmarshal(publisher.payloads[0], &pushed))
+		assert.Equal(t, command.ID, pushed.ID)
+		assert.Equal(t, model.CommandStatusDelivered, pushed.Status)
+	}
+
+	// 状态上报与HTTP接口的请求体一致
+	data, _ := json.Marshal(DeviceStatusRequest{
+		StorageTotal: 100, StorageUsed: 40, StorageFree: 60,
+		CPUUsage: 12.5, CPUTemperature: 45,
+		MemoryTotal: 1024, MemoryUsed: 512, MemoryFree: 512,
+	})
+	bridge.HandleMessage("mingda/"+device.SN+"/status", data)
+	statusCount, err := store.DeviceStatus().CountStatus(device.SN)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), statusCount)
+	assert.Len(t, publisher.topics, 1)
+
+	// 校验失败时向应答主题发布错误信息
+	bridge.HandleMessage("mingda/"+device.SN+"/status", []byte(`{"cpu_usage":1}`))
+	if assert.Len(t, publisher.topics, 2) {
+		assert.Equal(t, "mingda/"+device.SN+"/reply", publisher.topics[1])
+		var reply GatewayMessage
+		assert.NoError(t, json.Unmarshal(publisher.payloads[1], &reply))
+		assert.Equal(t, GatewayMsgStatus, reply.ID)
+		assert.Equal(t, int(errors.ErrInvalidParams), reply.Code)
+	}
+
+	// 确认指令
+	data, _ = json.Marshal(GatewayCommandAck{CommandID: command.ID, CommandAckRequest: CommandAckRequest{Status: model.CommandStatusAcked}})
+	bridge.HandleMessage("mingda/"+device.SN+"/command_ack", data)
+	command, _ = commandService.GetCommand(device.SN, command.ID)
+	assert.Equal(t, model.CommandStatusAcked, command.Status)
+
+	// 未激活设备和格式错误的主题直接忽略
+	store.Devices().Create(&model.Device{SN: "M4D2401A0100014", DeviceModel: "MD-400D", Status: model.DeviceStatusSuspended, LastOnline: time.Now()})
+	bridge.HandleMessage("mingda/M4D2401A0100014/status", data)
+	bridge.HandleMessage("mingda/"+device.SN, data)
+	assert.Len(t, publisher.topics, 2)
+
+	// 遗嘱消息标记离线，之后的指令不再推送
+	bridge.HandleMessage("mingda/"+device.SN+"/online", []byte("offline"))
+	assert.False(t, isOnline())
+	_, err = commandService.IssueCommand(device.SN, &IssueCommandRequest{CommandType: model.CommandResumePrint}, "admin")
+	assert.NoError(t, err)
+	bridge.PushCommands(device.SN)
+	assert.Len(t, publisher.topics, 2)
+}
+
+func TestMQTTAuthService(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	device := &model.Device{
+		SN:          "M4D2401A0100013",
+		DeviceModel: "MD-400D",
+		Status:      model.DeviceStatusActive,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+
+	authService := NewAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{})
+	pair, err := authService.GenerateToken(device, testMeta)
+	assert.NoError(t, err)
+
+	mqttAuth := NewMQTTAuthService(store, "test_secret", newTestCipher(t), config.AuthConfig{}, config.MQTTConfig{
+		TopicPrefix: "mingda",
+		Username:    "mingda_cloud",
+		Password:    "bridge_password",
+	})
+
+	// 设备以SN和访问令牌连接，返回令牌过期时间
+	result := mqttAuth.Authenticate(&MQTTAuthRequest{Username: device.SN, Password: pair.AccessToken})
+	assert.Equal(t, MQTTResultAllow, result.Result)
+	assert.False(t, result.IsSuperuser)
+	assert.Greater(t, result.ExpireAt, time.Now().Unix())
+
+	// 令牌与SN不匹配、刷新令牌和无效令牌均拒绝
+	assert.Equal(t, MQTTResultDeny, mqttAuth.Authenticate(&MQTTAuthRequest{Username: "M4D2401A0100099", Password: pair.AccessToken}).Result)
+	assert.Equal(t, MQTTResultDeny, mqttAuth.Authenticate(&MQTTAuthRequest{Username: device.SN, Password: pair.RefreshToken}).Result)
+	assert.Equal(t, MQTTResultDeny, mqttAuth.Authenticate(&MQTTAuthRequest{Username: device.SN, Password: "invalid"}).Result)
+
+	// 服务端账号为超级用户
+	result = mqttAuth.Authenticate(&MQTTAuthRequest{Username: "mingda_cloud", Password: "bridge_password"})
+	assert.Equal(t, MQTTResultAllow, result.Result)
+	assert.True(t, result.IsSuperuser)
+	assert.Equal(t, MQTTResultDeny, mqttAuth.Authenticate(&MQTTAuthRequest{Username: "mingda_cloud", Password: "wrong"}).Result)
+
+	// 设备只能发布上报主题、订阅下发主题，且只能访问自己的主题
+	tests := []struct {
+		username string
+		topic    string
+		action   string
+		want     string
+	}{
+		{device.SN, "mingda/" + device.SN + "/status", "publish", MQTTResultAllow},
+		{device.SN, "mingda/" + device.SN + "/command_ack", "publish", MQTTResultAllow},
+		{device.SN, "mingda/" + device.SN + "/command", "subscribe", MQTTResultAllow},
+		{device.SN, "mingda/" + device.SN + "/command", "publish", MQTTResultDeny},
+		{device.SN, "mingda/" + device.SN + "/status", "subscribe", MQTTResultDeny},
+		{device.SN, "mingda/M4D2401A0100099/status", "publish", MQTTResultDeny},
+		{device.SN, "mingda/+/command", "subscribe", MQTTResultDeny},
+		{device.SN, "mingda/#", "subscribe", MQTTResultDeny},
+		{"mingda_cloud", "$share/mingda_cloud/mingda/+/status", "subscribe", MQTTResultAllow},
+	}
+	for _, tt := range tests {
+		result := mqttAuth.Authorize(&MQTTACLRequest{Username: tt.username, Topic: tt.topic, Action: tt.action})
+		assert.Equal(t, tt.want, result.Result, tt.topic+" "+tt.action)
+	}
+
+	// 设备停用后，已建立的连接在下次主题权限回调时被拒绝
+	acl := &MQTTACLRequest{Username: device.SN, Topic: "mingda/" + device.SN + "/status", Action: "publish"}
+	_, err = NewDeviceLifecycleService(store).ChangeState(device.SN, model.DeviceStatusSuspended, "欠费", "admin")
+	assert.NoError(t, err)
+	assert.Equal(t, MQTTResultDeny, mqttAuth.Authorize(acl).Result)
+
+	// 恢复启用后仍需使用新令牌重新连接
+	_, err = NewDeviceLifecycleService(store).ChangeState(device.SN, model.DeviceStatusActive, "恢复", "admin")
+	assert.NoError(t, err)
+	assert.Equal(t, MQTTResultDeny, mqttAuth.Authorize(acl).Result)
+	assert.Equal(t, MQTTResultDeny, mqttAuth.Authenticate(&MQTTAuthRequest{Username: device.SN, Password: pair.AccessToken}).Result)
+	pair, err = authService.GenerateToken(device, testMeta)
+	assert.NoError(t, err)
+	assert.Equal(t, MQTTResultAllow, mqttAuth.Authenticate(&MQTTAuthRequest{Username: device.SN, Password: pair.AccessToken}).Result)
+	assert.Equal(t, MQTTResultAllow, mqttAuth.Authorize(acl).Result)
+
+	// 连接使用的令牌注销后同样拒绝
+	claims, err := utils.ParseToken(pair.AccessToken, "test_secret")
+	assert.NoError(t, err)
+	assert.NoError(t, authService.Logout(claims, pair.AccessToken))
+	assert.Equal(t, MQTTResultDeny, mqttAuth.Authorize(acl).Result)
+}
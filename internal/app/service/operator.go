@@ -0,0 +1,225 @@
+package service
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// 运维令牌默认有效期
+const defaultOperatorTokenTTL = 8 * time.Hour
+
+// 用户名不存在时参与比较的密码摘要，使登录耗时与用户名是否存在无关
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("mingda-dummy-password"), bcrypt.DefaultCost)
+
+// OperatorService 运维账号服务
+type OperatorService struct {
+	store     repository.Store
+	jwtSecret string
+	tokenTTL  time.Duration
+	lockout   *LockoutService
+}
+
+// NewOperatorService 创建运维账号服务实例
+func NewOperatorService(store repository.Store, cfg config.OperatorConfig, authCfg config.AuthConfig) *OperatorService {
+	s := &OperatorService{
+		store:     store,
+		jwtSecret: cfg.JWTSecret,
+		tokenTTL:  time.Duration(cfg.TokenTTL) * time.Second,
+		lockout:   NewLockoutService(store, authCfg),
+	}
+	if s.tokenTTL <= 0 {
+		s.tokenTTL = defaultOperatorTokenTTL
+	}
+	return s
+}
+
+// CreateOperatorRequest 创建运维账号请求
+type CreateOperatorRequest struct {
+	Username       string `json:"username" binding:"required,min=3,max=64"`
+	Password       string `json:"password" binding:"required,min=8,max=72"`
+	DisplayName    string `json:"display_name" binding:"max=64"`
+	Role           string `json:"role" binding:"required"`
+	OrganizationID *uint  `json:"organization_id"` // 所属组织，为空表示平台运维人员
+}
+
+// UpdateOperatorRequest 更新运维账号请求，未提供的字段保持不变
+type UpdateOperatorRequest struct {
+	Password    *string `json:"password" binding:"omitempty,min=8,max=72"`
+	DisplayName *string `json:"display_name" binding:"omitempty,max=64"`
+	Role        *string `json:"role"`
+	Status      *int    `json:"status" binding:"omitempty,oneof=0 1"`
+}
+
+// OperatorLoginResult 运维登录结果
+type OperatorLoginResult struct {
+	Token     string          `json:"token"`
+	ExpiresIn int64           `json:"expires_in"` // 令牌有效期(秒)
+	Operator  *model.Operator `json:"operator"`
+}
+
+// Login 运维人员登录
+// 登录失败按客户端IP计入认证失败次数，与设备认证共用锁定策略
+func (s *OperatorService) Login(username, password string, meta RequestMeta) (*OperatorLoginResult, error) {
+	if s.jwtSecret == "" {
+		return nil, errors.New(errors.ErrUnauthorized, "运维接口未启用")
+	}
+	if remaining := s.lockout.RetryAfter("", meta.ClientIP); remaining > 0 {
+		return nil, lockedError(remaining)
+	}
+
+	hash := dummyPasswordHash
+	operator, err := s.store.Operators().FindByUsername(username)
+	if err == nil {
+		hash = []byte(operator.PasswordHash)
+	} else if err != repository.ErrNotFound {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || err != nil {
+		s.lockout.RecordFailure("", meta.ClientIP, "运维登录失败")
+		return nil, errors.New(errors.ErrUnauthorized, "用户名或密码错误")
+	}
+	if operator.Status != model.OperatorStatusEnabled {
+		return nil, errors.New(errors.ErrUnauthorized, "运维账号已禁用")
+	}
+
+	token, err := utils.GenerateOperatorToken(operator, s.jwtSecret, s.tokenTTL)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrSystem, err)
+	}
+
+	now := time.Now()
+	if err := s.store.Operators().Update(operator, map[string]interface{}{"last_login_at": now}); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	operator.LastLoginAt = &now
+
+	return &OperatorLoginResult{
+		Token:     token,
+		ExpiresIn: int64(s.tokenTTL.Seconds()),
+		Operator:  operator,
+	}, nil
+}
+
+// Logout 运维人员登出，当前令牌加入黑名单
+func (s *OperatorService) Logout(claims *utils.OperatorClaims, token string) error {
+	if err := addToBlacklist(token, claims.ExpiresAt); err != nil {
+		return errors.NewWithError(errors.ErrRedis, err)
+	}
+	return nil
+}
+
+// CreateOperator 创建运维账号
+func (s *OperatorService) CreateOperator(req *CreateOperatorRequest) (*model.Operator, error) {
+	if !model.IsValidRole(req.Role) {
+		return nil, errors.New(errors.ErrInvalidParams, "无效的角色")
+	}
+	if req.OrganizationID != nil {
+		if err := checkOrganizationEnabled(s.store.Organizations(), *req.OrganizationID); err != nil {
+			return nil, err
+		}
+	}
+
+	exists, err := s.store.Operators().ExistsByUsername(req.Username)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if exists {
+		return nil, errors.New(errors.ErrDatabaseDup, "用户名已存在")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrSystem, err)
+	}
+
+	operator := &model.Operator{
+		Username:       req.Username,
+		PasswordHash:   string(hash),
+		DisplayName:    req.DisplayName,
+		Role:           req.Role,
+		OrganizationID: req.OrganizationID,
+		Status:         model.OperatorStatusEnabled,
+	}
+	if err := s.store.Operators().Create(operator); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	return operator, nil
+}
+
+// ListOperators 查询全部运维账号
+func (s *OperatorService) ListOperators() ([]model.Operator, error) {
+	operators, err := s.store.Operators().List()
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return operators, nil
+}
+
+// UpdateOperator 更新运维账号
+// 修改密码、角色或状态后，该账号之前签发的令牌全部失效；系统至少保留一个启用的平台管理员
+func (s *OperatorService) UpdateOperator(id uint, req *UpdateOperatorRequest) (*model.Operator, error) {
+	if req.Role != nil && !model.IsValidRole(*req.Role) {
+		return nil, errors.New(errors.ErrInvalidParams, "无效的角色")
+	}
+
+	var operator *model.Operator
+	err := s.store.Transaction(func(store repository.Store) error {
+		var err error
+		operator, err = store.Operators().FindByIDForUpdate(id)
+		if err != nil {
+			return errors.New(errors.ErrInvalidParams, "运维账号不存在")
+		}
+
+		updates := map[string]interface{}{}
+		if req.DisplayName != nil {
+			updates["display_name"] = *req.DisplayName
+		}
+		if req.Password != nil {
+			hash, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return errors.NewWithError(errors.ErrSystem, err)
+			}
+			updates["password_hash"] = string(hash)
+		}
+		if req.Role != nil && *req.Role != operator.Role {
+			updates["role"] = *req.Role
+		}
+		if req.Status != nil && *req.Status != operator.Status {
+			updates["status"] = *req.Status
+		}
+
+		// 降级或禁用平台管理员时确认仍有其他启用的平台管理员
+		demoted := updates["role"] != nil || updates["status"] != nil
+		isPlatformAdmin := operator.Role == model.RoleAdmin && operator.OrganizationID == nil
+		if isPlatformAdmin && operator.Status == model.OperatorStatusEnabled && demoted {
+			admins, err := store.Operators().CountPlatformAdmins(operator.ID)
+			if err != nil {
+				return err
+			}
+			if admins == 0 {
+				return errors.New(errors.ErrInvalidParams, "至少需要保留一个启用的平台管理员")
+			}
+		}
+
+		if updates["password_hash"] != nil || demoted {
+			updates["tokens_valid_after"] = time.Now()
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return store.Operators().Update(operator, updates)
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+
+	return operator, nil
+}
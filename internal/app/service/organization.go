@@ -0,0 +1,273 @@
+package service
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// 认领码长度(十六进制字符)
+const claimCodeLength = 12
+
+// OrganizationService 组织与设备归属服务
+type OrganizationService struct {
+	store   repository.Store
+	lockout *LockoutService
+}
+
+// NewOrganizationService 创建组织服务实例
+func NewOrganizationService(store repository.Store, authCfg config.AuthConfig) *OrganizationService {
+	return &OrganizationService{
+		store:   store,
+		lockout: NewLockoutService(store, authCfg),
+	}
+}
+
+// CreateOrganizationRequest 创建组织请求
+type CreateOrganizationRequest struct {
+	Name   string `json:"name" binding:"required,max=64"`
+	Remark string `json:"remark" binding:"max=255"`
+}
+
+// ClaimDeviceRequest 认领设备请求
+type ClaimDeviceRequest struct {
+	SN        string `json:"sn" binding:"required"`
+	ClaimCode string `json:"claim_code" binding:"required"`
+}
+
+// TransferDeviceRequest 转移设备请求
+type TransferDeviceRequest struct {
+	OrganizationID uint `json:"organization_id" binding:"required"`
+}
+
+// ClaimCodeResult 新生成的认领码，只返回一次
+type ClaimCodeResult struct {
+	SN        string `json:"sn"`
+	ClaimCode string `json:"claim_code"`
+}
+
+// CreateOrganization 创建组织
+func (s *OrganizationService) CreateOrganization(req *CreateOrganizationRequest) (*model.Organization, error) {
+	exists, err := s.store.Organizations().ExistsByName(req.Name)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if exists {
+		return nil, errors.New(errors.ErrDatabaseDup, "组织名称已存在")
+	}
+
+	org := &model.Organization{
+		Name:   req.Name,
+		Remark: req.Remark,
+		Status: model.OrganizationStatusEnabled,
+	}
+	if err := s.store.Organizations().Create(org); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return org, nil
+}
+
+// ListOrganizations 查询全部组织
+func (s *OrganizationService) ListOrganizations() ([]model.Organization, error) {
+	orgs, err := s.store.Organizations().List()
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return orgs, nil
+}
+
+// ClaimDevice 组织使用认领码绑定设备，认领码使用后立即失效
+// 认领码错误按客户端IP计入认证失败次数，防止穷举
+func (s *OrganizationService) ClaimDevice(orgID *uint, req *ClaimDeviceRequest, operator string, meta RequestMeta) (*model.Device, error) {
+	if orgID == nil {
+		return nil, errors.New(errors.ErrInvalidParams, "平台运维人员请使用设备转移")
+	}
+	if remaining := s.lockout.RetryAfter("", meta.ClientIP); remaining > 0 {
+		return nil, lockedError(remaining)
+	}
+	if err := checkOrganizationEnabled(s.store.Organizations(), *orgID); err != nil {
+		return nil, err
+	}
+
+	// 设备不存在、已被绑定或认领码错误返回相同的错误，避免泄露设备信息
+	codeHash := hashClaimCode(req.ClaimCode)
+	var device *model.Device
+	codeMismatch := false
+	err := s.store.Transaction(func(store repository.Store) error {
+		var err error
+		device, err = store.Devices().FindBySNForUpdate(req.SN)
+		if err != nil && err != repository.ErrNotFound {
+			return err
+		}
+		if err != nil || device.OrganizationID != nil || device.ClaimCodeHash == "" ||
+			subtle.ConstantTimeCompare([]byte(device.ClaimCodeHash), []byte(codeHash)) != 1 {
+			codeMismatch = true
+			return errors.New(errors.ErrInvalidParams, "设备SN或认领码错误")
+		}
+		if device.Status == model.DeviceStatusDecommissioned {
+			return errors.New(errors.ErrDeviceDisabled, "设备已退役")
+		}
+
+		return changeDeviceOwner(store.Devices(), device, orgID, model.OwnershipActionClaim, operator)
+	})
+	if codeMismatch {
+		s.lockout.RecordFailure("", meta.ClientIP, "设备认领码错误")
+	}
+	if err != nil {
+		return nil, txError(err)
+	}
+	return device, nil
+}
+
+// TransferDevice 将设备转移到其他组织，仅限平台运维人员
+// 组织运维人员不能直接把设备转入其他组织，需先解绑，再由接收方使用认领码认领
+func (s *OrganizationService) TransferDevice(tenant Tenant, sn string, toOrgID uint, operator string) (*model.Device, error) {
+	if !tenant.IsPlatform() {
+		return nil, errors.New(errors.ErrUnauthorized, "仅限平台运维人员转移设备，请解绑后由接收方认领")
+	}
+	if err := checkOrganizationEnabled(s.store.Organizations(), toOrgID); err != nil {
+		return nil, err
+	}
+
+	var device *model.Device
+	err := s.store.Transaction(func(store repository.Store) error {
+		var err error
+		device, err = store.Devices().FindInScopeForUpdate(tenant, sn)
+		if err != nil {
+			return errors.New(errors.ErrDeviceNotFound, "设备不存在")
+		}
+		if device.OrganizationID != nil && *device.OrganizationID == toOrgID {
+			return errors.New(errors.ErrInvalidParams, "设备已属于该组织")
+		}
+
+		return changeDeviceOwner(store.Devices(), device, &toOrgID, model.OwnershipActionTransfer, operator)
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+	return device, nil
+}
+
+// UnbindDevice 解除设备与组织的绑定，并生成新的认领码供下一位所有者使用
+func (s *OrganizationService) UnbindDevice(tenant Tenant, sn, operator string) (*ClaimCodeResult, error) {
+	var device *model.Device
+	var code string
+	err := s.store.Transaction(func(store repository.Store) error {
+		var err error
+		device, err = store.Devices().FindInScopeForUpdate(tenant, sn)
+		if err != nil {
+			return errors.New(errors.ErrDeviceNotFound, "设备不存在")
+		}
+		if device.OrganizationID == nil {
+			return errors.New(errors.ErrInvalidParams, "设备未绑定组织")
+		}
+
+		if err := changeDeviceOwner(store.Devices(), device, nil, model.OwnershipActionUnbind, operator); err != nil {
+			return err
+		}
+		code, err = issueClaimCode(store.Devices(), device)
+		return err
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+	return &ClaimCodeResult{SN: device.SN, ClaimCode: code}, nil
+}
+
+// IssueClaimCode 为未绑定的设备重新生成认领码，原认领码失效
+func (s *OrganizationService) IssueClaimCode(sn string) (*ClaimCodeResult, error) {
+	device, err := s.store.Devices().FindBySN(sn)
+	if err != nil {
+		return nil, errors.New(errors.ErrDeviceNotFound, "设备不存在")
+	}
+	if device.OrganizationID != nil {
+		return nil, errors.New(errors.ErrInvalidParams, "设备已绑定组织，请先解绑")
+	}
+
+	code, err := issueClaimCode(s.store.Devices(), device)
+	if err != nil {
+		return nil, err
+	}
+	return &ClaimCodeResult{SN: device.SN, ClaimCode: code}, nil
+}
+
+// GetOwnershipHistory 查询设备归属变更历史，按时间倒序
+func (s *OrganizationService) GetOwnershipHistory(sn string) ([]model.DeviceOwnershipHistory, error) {
+	histories, err := s.store.Devices().ListOwnershipHistory(sn)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return histories, nil
+}
+
+// hashClaimCode 计算认领码摘要，忽略大小写和首尾空白
+func hashClaimCode(code string) string {
+	return utils.HashToken(strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// changeDeviceOwner 在事务中变更设备归属并记录变更历史，绑定后清除认领码
+func changeDeviceOwner(devices repository.DeviceRepository, device *model.Device, toOrgID *uint, action, operator string) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"organization_id": toOrgID,
+		"claim_code_hash": "",
+		"claimed_at":      nil,
+	}
+	if toOrgID != nil {
+		updates["claimed_at"] = now
+	}
+	// Updates会把新归属写回device，先记下变更前的组织
+	fromOrgID := device.OrganizationID
+	if err := devices.Update(device, updates); err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	history := &model.DeviceOwnershipHistory{
+		DeviceID:  device.ID,
+		DeviceSN:  device.SN,
+		Action:    action,
+		FromOrgID: fromOrgID,
+		ToOrgID:   toOrgID,
+		Operator:  operator,
+	}
+	if err := devices.CreateOwnershipHistory(history); err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	device.OrganizationID = toOrgID
+	device.ClaimCodeHash = ""
+	device.ClaimedAt = nil
+	if toOrgID != nil {
+		device.ClaimedAt = &now
+	}
+	return nil
+}
+
+// issueClaimCode 为设备生成新的认领码并保存摘要
+func issueClaimCode(devices repository.DeviceRepository, device *model.Device) (string, error) {
+	code := strings.ToUpper(utils.GenerateRandomString(claimCodeLength))
+	hash := hashClaimCode(code)
+	if err := devices.Update(device, map[string]interface{}{"claim_code_hash": hash}); err != nil {
+		return "", errors.NewWithError(errors.ErrDatabase, err)
+	}
+	device.ClaimCodeHash = hash
+	return code, nil
+}
+
+// checkOrganizationEnabled 校验组织存在且已启用
+func checkOrganizationEnabled(orgs repository.OrganizationRepository, orgID uint) error {
+	org, err := orgs.FindByID(orgID)
+	if err != nil {
+		return errors.New(errors.ErrInvalidParams, "组织不存在")
+	}
+	if org.Status != model.OrganizationStatusEnabled {
+		return errors.New(errors.ErrInvalidParams, "组织已禁用")
+	}
+	return nil
+}
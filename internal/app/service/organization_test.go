@@ -0,0 +1,111 @@
+package service
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	orgA, orgB := uint(1), uint(2)
+	for _, device := range []*model.Device{
+		{SN: "M1A2401A0100001", DeviceModel: "MD-400D", Status: model.DeviceStatusActive, OrganizationID: &orgA, LastOnline: time.Now()},
+		{SN: "M1A2401A0100002", DeviceModel: "MD-400D", Status: model.DeviceStatusActive, OrganizationID: &orgB, LastOnline: time.Now()},
+		{SN: "M1A2401A0100003", DeviceModel: "MD-400D", Status: model.DeviceStatusActive, LastOnline: time.Now()},
+	} {
+		assert.NoError(t, store.Devices().Create(device))
+		assert.NoError(t, store.Alarms().Create(&model.DeviceAlarm{DeviceSN: device.SN, AlarmType: model.AlarmTypeStorage}))
+	}
+
+	deviceSNs := func(tenant Tenant) []string {
+		devices, _, err := store.Devices().List(tenant, repository.DeviceFilter{}, repository.Page{Limit: 10})
+		assert.NoError(t, err)
+		sns := make([]string, 0, len(devices))
+		for _, device := range devices {
+			sns = append(sns, device.SN)
+		}
+		sort.Strings(sns)
+		return sns
+	}
+	alarmSNs := func(tenant Tenant) []string {
+		alarms, err := store.Alarms().ListAll(tenant, nil)
+		assert.NoError(t, err)
+		sns := make([]string, 0, len(alarms))
+		for _, alarm := range alarms {
+			sns = append(sns, alarm.DeviceSN)
+		}
+		sort.Strings(sns)
+		return sns
+	}
+
+	// 平台范围可以访问全部数据
+	assert.Len(t, deviceSNs(OrganizationTenant(nil)), 3)
+	assert.Len(t, alarmSNs(OrganizationTenant(nil)), 3)
+
+	// 组织只能访问本组织设备及其数据
+	assert.Equal(t, []string{"M1A2401A0100001"}, deviceSNs(OrganizationTenant(&orgA)))
+	assert.Equal(t, []string{"M1A2401A0100001"}, alarmSNs(OrganizationTenant(&orgA)))
+	assert.Equal(t, []string{"M1A2401A0100002"}, alarmSNs(OrganizationTenant(&orgB)))
+
+	// 在组织范围内指定其他组织的设备时查不到数据
+	assert.Empty(t, deviceSNs(OrganizationTenant(&orgA).WithDevice("M1A2401A0100002")))
+	assert.Empty(t, alarmSNs(OrganizationTenant(&orgA).WithDevice("M1A2401A0100003")))
+
+	// 设备只能访问自己的数据
+	assert.Equal(t, []string{"M1A2401A0100003"}, alarmSNs(DeviceTenant("M1A2401A0100003")))
+}
+
+func TestOrganizationService_TransferDevice(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	orgService := NewOrganizationService(store, config.AuthConfig{})
+	orgA, err := orgService.CreateOrganization(&CreateOrganizationRequest{Name: "经销商A"})
+	assert.NoError(t, err)
+	orgB, err := orgService.CreateOrganization(&CreateOrganizationRequest{Name: "经销商B"})
+	assert.NoError(t, err)
+
+	device := &model.Device{SN: "M1A2401A0100001", DeviceModel: "MD-400D", Status: model.DeviceStatusActive, OrganizationID: &orgA.ID, LastOnline: time.Now()}
+	assert.NoError(t, store.Devices().Create(device))
+
+	// 组织运维人员不能直接把设备转入其他组织
+	_, err = orgService.TransferDevice(OrganizationTenant(&orgA.ID), device.SN, orgB.ID, "org_admin")
+	assert.Error(t, err)
+
+	// 平台运维人员可以转移设备，并记录转移前的归属
+	transferred, err := orgService.TransferDevice(OrganizationTenant(nil), device.SN, orgB.ID, "admin")
+	assert.NoError(t, err)
+	assert.Equal(t, orgB.ID, *transferred.OrganizationID)
+
+	histories, err := orgService.GetOwnershipHistory(device.SN)
+	assert.NoError(t, err)
+	if assert.Len(t, histories, 1) {
+		assert.Equal(t, model.OwnershipActionTransfer, histories[0].Action)
+		assert.Equal(t, orgA.ID, *histories[0].FromOrgID)
+		assert.Equal(t, orgB.ID, *histories[0].ToOrgID)
+	}
+
+	// 组织之间通过解绑和认领码交接设备
+	_, err = orgService.UnbindDevice(OrganizationTenant(&orgA.ID), device.SN, "org_admin")
+	assert.Error(t, err)
+	code, err := orgService.UnbindDevice(OrganizationTenant(&orgB.ID), device.SN, "org_admin")
+	assert.NoError(t, err)
+
+	_, err = orgService.ClaimDevice(&orgA.ID, &ClaimDeviceRequest{SN: device.SN, ClaimCode: "WRONG"}, "org_admin", testMeta)
+	assert.Error(t, err)
+	claimed, err := orgService.ClaimDevice(&orgA.ID, &ClaimDeviceRequest{SN: device.SN, ClaimCode: code.ClaimCode}, "org_admin", testMeta)
+	assert.NoError(t, err)
+	assert.Equal(t, orgA.ID, *claimed.OrganizationID)
+
+	// 认领码使用后失效
+	_, err = orgService.ClaimDevice(&orgB.ID, &ClaimDeviceRequest{SN: device.SN, ClaimCode: code.ClaimCode}, "org_admin", testMeta)
+	assert.Error(t, err)
+}
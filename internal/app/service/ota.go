@@ -0,0 +1,524 @@
+package service
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/storage"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// OTAService 固件和软件升级服务
+type OTAService struct {
+	store      repository.Store
+	storage    storage.ObjectStorage
+	signingKey *rsa.PrivateKey
+	signKeyID  string
+	urlExpiry  time.Duration
+	maxSize    int64
+}
+
+// NewOTAService 创建升级服务实例，storage或signingKey为空时不能上传和下发升级包
+func NewOTAService(store repository.Store, objectStorage storage.ObjectStorage, signingKey *rsa.PrivateKey, cfg config.OTAConfig) *OTAService {
+	return &OTAService{
+		store:      store,
+		storage:    objectStorage,
+		signingKey: signingKey,
+		signKeyID:  cfg.SigningKeyID,
+		urlExpiry:  time.Duration(cfg.URLExpiry) * time.Second,
+		maxSize:    cfg.MaxPackageSize << 20,
+	}
+}
+
+// UploadOTAPackageRequest 上传升级包请求，随文件以表单提交
+type UploadOTAPackageRequest struct {
+	Component    string `form:"component" binding:"required"`
+	Version      string `form:"version" binding:"required,max=32"`
+	TargetModels string `form:"target_models" binding:"required,max=255"` // 适用型号名称，多个用逗号分隔
+	MinVersion   string `form:"min_version" binding:"max=32"`
+	MaxVersion   string `form:"max_version" binding:"max=32"`
+	SHA256       string `form:"sha256"` // 可选，构建系统给出的校验和，与上传文件不一致时拒绝
+	ReleaseNotes string `form:"release_notes"`
+}
+
+// UpdateOTAPackageRequest 修改升级包请求，字段为空表示不修改
+type UpdateOTAPackageRequest struct {
+	TargetModels *string `json:"target_models" binding:"omitempty,max=255"`
+	MinVersion   *string `json:"min_version" binding:"omitempty,max=32"`
+	MaxVersion   *string `json:"max_version" binding:"omitempty,max=32"`
+	ReleaseNotes *string `json:"release_notes"`
+	Status       *int    `json:"status" binding:"omitempty,oneof=0 1"`
+}
+
+// OTAPackageQuery 升级包查询条件
+type OTAPackageQuery struct {
+	PageQuery
+	Component string `form:"component"`
+	Status    *int   `form:"status"`
+}
+
+// OTAProgressRequest 设备上报升级进度，安装完成上报success后需重启并上报版本确认
+type OTAProgressRequest struct {
+	UpdateID     uint   `json:"update_id" binding:"required"`
+	Status       string `json:"status" binding:"required,oneof=downloading installing success failed"`
+	Progress     int    `json:"progress" binding:"min=0,max=100"`
+	ErrorCode    string `json:"error_code" binding:"max=32"`
+	ErrorMessage string `json:"error_message" binding:"max=255"`
+}
+
+// OTAUpdateInfo 下发给设备的升级信息
+type OTAUpdateInfo struct {
+	UpdateID     uint      `json:"update_id"`
+	Component    string    `json:"component"`
+	FromVersion  string    `json:"from_version"`
+	Version      string    `json:"version"`
+	FileSize     int64     `json:"file_size"`
+	SHA256       string    `json:"sha256"`
+	Signature    string    `json:"signature"` // 对SHA-256摘要的RSA PKCS#1 v1.5签名(Base64)
+	SignKeyID    string    `json:"sign_key_id"`
+	DownloadURL  string    `json:"download_url"`
+	URLExpiresAt time.Time `json:"url_expires_at"`
+	ReleaseNotes string    `json:"release_notes"`
+}
+
+// OTACheckResult 检查升级结果，每个组件最多一个升级
+type OTACheckResult struct {
+	Updates []OTAUpdateInfo `json:"updates"`
+}
+
+// UploadPackage 上传升级包到对象存储，计算校验和并签名，上传后为停用状态，确认无误后再发布
+func (s *OTAService) UploadPackage(req *UploadOTAPackageRequest, file io.Reader, fileName string, size int64, operator string) (*model.OTAPackage, error) {
+	if err := s.checkEnabled(); err != nil {
+		return nil, err
+	}
+	if _, ok := (&model.SoftwareVersions{}).VersionOf(req.Component); !ok {
+		return nil, errors.New(errors.ErrInvalidParams, "不支持的组件: "+req.Component)
+	}
+	if size <= 0 || size > s.maxSize {
+		return nil, errors.New(errors.ErrInvalidParams, fmt.Sprintf("升级包大小必须在1字节到%dMB之间", s.maxSize>>20))
+	}
+	if err := checkVersionRange(req.MinVersion, req.MaxVersion); err != nil {
+		return nil, err
+	}
+	targets, err := normalizeTargetModels(s.store.PrinterModels(), req.TargetModels)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := s.store.OTA().PackageExists(req.Component, req.Version)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if exists {
+		return nil, errors.New(errors.ErrDatabaseDup, "该组件的版本已存在")
+	}
+
+	// 上传的同时计算校验和
+	fileName = filepath.Base(fileName)
+	objectKey := fmt.Sprintf("ota/%s/%s/%s", req.Component, req.Version, fileName)
+	hasher := sha256.New()
+	ctx := context.Background()
+	if err := s.storage.PutObject(ctx, objectKey, io.TeeReader(file, hasher), size, "application/octet-stream"); err != nil {
+		return nil, errors.NewWithError(errors.ErrSystem, err)
+	}
+
+	digest := hasher.Sum(nil)
+	checksum := hex.EncodeToString(digest)
+	if req.SHA256 != "" && !strings.EqualFold(req.SHA256, checksum) {
+		s.storage.RemoveObject(ctx, objectKey)
+		return nil, errors.New(errors.ErrInvalidParams, "升级包校验和不一致")
+	}
+
+	signature, err := utils.RSASignSHA256(s.signingKey, digest)
+	if err != nil {
+		s.storage.RemoveObject(ctx, objectKey)
+		return nil, errors.NewWithError(errors.ErrEncrypt, err)
+	}
+
+	pkg := &model.OTAPackage{
+		Component:    req.Component,
+		Version:      req.Version,
+		TargetModels: targets,
+		MinVersion:   req.MinVersion,
+		MaxVersion:   req.MaxVersion,
+		FileName:     fileName,
+		ObjectKey:    objectKey,
+		FileSize:     size,
+		SHA256:       checksum,
+		Signature:    base64.StdEncoding.EncodeToString(signature),
+		SignKeyID:    s.signKeyID,
+		ReleaseNotes: req.ReleaseNotes,
+		Status:       model.OTAPackageStatusDisabled,
+		CreatedBy:    operator,
+	}
+	if err := s.store.OTA().CreatePackage(pkg); err != nil {
+		s.storage.RemoveObject(ctx, objectKey)
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	return pkg, nil
+}
+
+// ListPackages 分页查询升级包
+func (s *OTAService) ListPackages(query *OTAPackageQuery) (*PageResult, error) {
+	query.normalize()
+
+	packages, total, err := s.store.OTA().ListPackages(repository.OTAPackageFilter{
+		Component: query.Component,
+		Status:    query.Status,
+	}, query.page())
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	return &PageResult{
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Items:    packages,
+	}, nil
+}
+
+// GetPackage 查询升级包
+func (s *OTAService) GetPackage(id uint) (*model.OTAPackage, error) {
+	pkg, err := s.store.OTA().FindPackage(id)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, errors.New(errors.ErrInvalidParams, "升级包不存在")
+		}
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return pkg, nil
+}
+
+// UpdatePackage 修改升级包的适用范围、说明或发布状态，文件和校验和不可修改
+func (s *OTAService) UpdatePackage(id uint, req *UpdateOTAPackageRequest) (*model.OTAPackage, error) {
+	pkg, err := s.GetPackage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.TargetModels != nil {
+		targets, err := normalizeTargetModels(s.store.PrinterModels(), *req.TargetModels)
+		if err != nil {
+			return nil, err
+		}
+		updates["target_models"] = targets
+	}
+	minVersion, maxVersion := pkg.MinVersion, pkg.MaxVersion
+	if req.MinVersion != nil {
+		minVersion = *req.MinVersion
+		updates["min_version"] = minVersion
+	}
+	if req.MaxVersion != nil {
+		maxVersion = *req.MaxVersion
+		updates["max_version"] = maxVersion
+	}
+	if err := checkVersionRange(minVersion, maxVersion); err != nil {
+		return nil, err
+	}
+	if req.ReleaseNotes != nil {
+		updates["release_notes"] = *req.ReleaseNotes
+	}
+	if req.Status != nil {
+		// 灰度中的升级包由升级活动完成后转为全量发布
+		if *req.Status == model.OTAPackageStatusEnabled {
+			if err := checkNoOpenCampaign(s.store.OTACampaigns(), pkg.ID, 0); err != nil {
+				return nil, err
+			}
+		}
+		updates["status"] = *req.Status
+	}
+
+	if len(updates) > 0 {
+		if err := s.store.OTA().UpdatePackage(pkg, updates); err != nil {
+			return nil, errors.NewWithError(errors.ErrDatabase, err)
+		}
+	}
+
+	return s.GetPackage(id)
+}
+
+// CheckUpdate 根据设备型号和最近上报的软件版本查找可用升级，component为空时检查全部组件
+func (s *OTAService) CheckUpdate(sn, component string) (*OTACheckResult, error) {
+	result := &OTACheckResult{Updates: []OTAUpdateInfo{}}
+
+	device, err := s.store.Devices().FindBySN(sn)
+	if err != nil {
+		return nil, errors.New(errors.ErrDeviceNotFound, "设备不存在")
+	}
+
+	// 未上报过版本信息的设备无法判断是否需要升级
+	versions, err := s.store.DeviceInfo().FindVersions(sn)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return result, nil
+		}
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	packages, err := s.store.OTA().ListEnabledPackages(component)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	// 灰度中的升级包只下发给当前阶段覆盖的设备
+	campaignPackages, campaigns, err := rolloutPackages(s.store, device, versions, component)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	packages = append(packages, campaignPackages...)
+	if len(packages) == 0 {
+		return result, nil
+	}
+
+	var printerModel *model.PrinterModel
+	if len(sn) >= 3 {
+		if m, ok := printerModels.get(sn[0:3]); ok {
+			printerModel = &m
+		}
+	}
+
+	for _, pkg := range selectOTAPackages(packages, device.DeviceModel, versions, printerModel) {
+		info, err := s.dispatch(sn, versions, pkg, campaigns[pkg.ID])
+		if err != nil {
+			return nil, err
+		}
+		result.Updates = append(result.Updates, *info)
+	}
+
+	return result, nil
+}
+
+// dispatch 创建或复用设备对该升级包未结束的升级记录，并生成下载地址，campaign为空表示直接发布的升级包
+func (s *OTAService) dispatch(sn string, versions *model.SoftwareVersions, pkg *model.OTAPackage, campaign *model.OTACampaign) (*OTAUpdateInfo, error) {
+	if err := s.checkEnabled(); err != nil {
+		return nil, err
+	}
+
+	update, err := s.store.OTA().FindActiveUpdate(sn, pkg.ID)
+	if err == repository.ErrNotFound {
+		current, _ := versions.VersionOf(pkg.Component)
+		update = &model.OTAUpdate{
+			DeviceSN:    sn,
+			PackageID:   pkg.ID,
+			Component:   pkg.Component,
+			FromVersion: current,
+			ToVersion:   pkg.Version,
+			Status:      model.OTAUpdatePending,
+		}
+		if campaign != nil {
+			update.CampaignID = &campaign.ID
+			update.CampaignStage = campaign.CurrentStage
+		}
+		err = s.store.OTA().CreateUpdate(update)
+	}
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	url, err := s.storage.PresignedGetURL(context.Background(), pkg.ObjectKey, s.urlExpiry)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrSystem, err)
+	}
+
+	return &OTAUpdateInfo{
+		UpdateID:     update.ID,
+		Component:    pkg.Component,
+		FromVersion:  update.FromVersion,
+		Version:      pkg.Version,
+		FileSize:     pkg.FileSize,
+		SHA256:       pkg.SHA256,
+		Signature:    pkg.Signature,
+		SignKeyID:    pkg.SignKeyID,
+		DownloadURL:  url,
+		URLExpiresAt: time.Now().Add(s.urlExpiry),
+		ReleaseNotes: pkg.ReleaseNotes,
+	}, nil
+}
+
+// ReportProgress 记录设备上报的升级进度
+func (s *OTAService) ReportProgress(sn string, req *OTAProgressRequest) error {
+	update, err := s.store.OTA().FindDeviceUpdate(sn, req.UpdateID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return errors.New(errors.ErrInvalidParams, "升级记录不存在")
+		}
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if update.Finished() {
+		return errors.New(errors.ErrInvalidParams, "升级已结束")
+	}
+
+	updates := map[string]interface{}{
+		"progress": req.Progress,
+	}
+	switch req.Status {
+	case "success":
+		// 安装完成，等待设备重启后上报的版本确认
+		updates["status"] = model.OTAUpdateInstalled
+		updates["progress"] = 100
+	case model.OTAUpdateFailed:
+		now := time.Now()
+		updates["status"] = model.OTAUpdateFailed
+		updates["error_code"] = req.ErrorCode
+		updates["error_message"] = req.ErrorMessage
+		updates["finished_at"] = &now
+	default:
+		updates["status"] = req.Status
+	}
+
+	if err := s.store.OTA().ModifyUpdate(update, updates); err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return nil
+}
+
+// ListDeviceUpdates 查询设备最近的升级记录
+func (s *OTAService) ListDeviceUpdates(sn string) ([]model.OTAUpdate, error) {
+	updates, err := s.store.OTA().ListDeviceUpdates(sn, 100)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return updates, nil
+}
+
+// PublicKeyPEM 升级包验签公钥
+func (s *OTAService) PublicKeyPEM() (string, string, error) {
+	if s.signingKey == nil {
+		return "", "", errors.New(errors.ErrSystem, "未配置升级包签名密钥")
+	}
+	publicKey, err := utils.EncodePublicKeyPEM(&s.signingKey.PublicKey)
+	if err != nil {
+		return "", "", errors.NewWithError(errors.ErrEncrypt, err)
+	}
+	return s.signKeyID, publicKey, nil
+}
+
+// checkEnabled 检查对象存储和签名密钥是否已配置
+func (s *OTAService) checkEnabled() error {
+	if s.storage == nil {
+		return errors.New(errors.ErrSystem, "未配置对象存储")
+	}
+	if s.signingKey == nil {
+		return errors.New(errors.ErrSystem, "未配置升级包签名密钥")
+	}
+	return nil
+}
+
+// selectOTAPackages 为每个组件选出适用于设备的最高版本升级包
+// 升级包需适用于设备型号、高于当前版本且当前版本在允许范围内；主板固件还需在机型支持的固件范围内
+func selectOTAPackages(packages []model.OTAPackage, deviceModel string, versions *model.SoftwareVersions, printerModel *model.PrinterModel) []*model.OTAPackage {
+	best := map[string]*model.OTAPackage{}
+	var order []string
+	for i := range packages {
+		pkg := &packages[i]
+		current, ok := versions.VersionOf(pkg.Component)
+		if !ok || !pkg.SupportsModel(deviceModel) {
+			continue
+		}
+		if current != "" && utils.CompareVersion(pkg.Version, current) <= 0 {
+			continue
+		}
+		if pkg.MinVersion != "" && (current == "" || utils.CompareVersion(current, pkg.MinVersion) < 0) {
+			continue
+		}
+		if pkg.MaxVersion != "" && (current == "" || utils.CompareVersion(current, pkg.MaxVersion) > 0) {
+			continue
+		}
+		if pkg.Component == model.ComponentMainboardFirmware && printerModel != nil {
+			if printerModel.MinFirmware != "" && utils.CompareVersion(pkg.Version, printerModel.MinFirmware) < 0 {
+				continue
+			}
+			if printerModel.MaxFirmware != "" && utils.CompareVersion(pkg.Version, printerModel.MaxFirmware) > 0 {
+				continue
+			}
+		}
+
+		prev, exists := best[pkg.Component]
+		if !exists {
+			order = append(order, pkg.Component)
+		}
+		if !exists || utils.CompareVersion(pkg.Version, prev.Version) > 0 {
+			best[pkg.Component] = pkg
+		}
+	}
+
+	selected := make([]*model.OTAPackage, 0, len(order))
+	for _, component := range order {
+		selected = append(selected, best[component])
+	}
+	return selected
+}
+
+// confirmOTAUpdates 设备上报的版本与升级目标版本一致时确认升级成功，需在上报版本的事务中调用
+func confirmOTAUpdates(ota repository.OTARepository, versions *model.SoftwareVersions) error {
+	updates, err := ota.ListActiveUpdates(versions.DeviceSN)
+	if err != nil {
+		return err
+	}
+
+	for i := range updates {
+		current, _ := versions.VersionOf(updates[i].Component)
+		if current != updates[i].ToVersion {
+			continue
+		}
+		if err := ota.ModifyUpdate(&updates[i], map[string]interface{}{
+			"status":      model.OTAUpdateSuccess,
+			"progress":    100,
+			"finished_at": versions.ReportTime,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkVersionRange 校验版本范围
+func checkVersionRange(minVersion, maxVersion string) error {
+	if minVersion != "" && maxVersion != "" && utils.CompareVersion(minVersion, maxVersion) > 0 {
+		return errors.New(errors.ErrInvalidParams, "最低版本不能高于最高版本")
+	}
+	return nil
+}
+
+// normalizeTargetModels 校验适用型号均已登记，返回按登记名称规范化后的型号列表
+func normalizeTargetModels(models repository.PrinterModelRepository, raw string) (string, error) {
+	list, err := models.List()
+	if err != nil {
+		return "", errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	pkg := model.OTAPackage{TargetModels: raw}
+	var names []string
+	for _, target := range pkg.Targets() {
+		var matched string
+		for _, m := range list {
+			if m.MatchesName(target) {
+				matched = m.Name
+				break
+			}
+		}
+		if matched == "" {
+			return "", errors.New(errors.ErrDeviceTypeInvalid, "未登记的型号: "+target)
+		}
+		names = append(names, matched)
+	}
+	if len(names) == 0 {
+		return "", errors.New(errors.ErrInvalidParams, "适用型号不能为空")
+	}
+	return strings.Join(names, ","), nil
+}
@@ -0,0 +1,503 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/logger"
+)
+
+// 升级活动默认参数
+const (
+	defaultCampaignStageDuration    = 24 * 60 // 分钟
+	defaultCampaignFailureThreshold = 5.0
+	defaultCampaignAlarmThreshold   = 10.0
+	defaultCampaignMinSamples       = 20
+)
+
+// OTACampaignService 灰度升级活动服务
+type OTACampaignService struct {
+	store repository.Store
+}
+
+// NewOTACampaignService 创建灰度升级活动服务实例
+func NewOTACampaignService(store repository.Store) *OTACampaignService {
+	return &OTACampaignService{store: store}
+}
+
+// CreateOTACampaignRequest 创建升级活动请求，阈值和观察时间为空时使用默认值
+type CreateOTACampaignRequest struct {
+	Name             string  `json:"name" binding:"required,max=64"`
+	PackageID        uint    `json:"package_id" binding:"required"`
+	TargetModel      string  `json:"target_model" binding:"max=32"`
+	FromVersion      string  `json:"from_version" binding:"max=32"`
+	Stages           []int   `json:"stages" binding:"required,min=1,max=10,dive,min=1,max=100"` // 各阶段覆盖比例，递增且最后一个阶段为100
+	StageDuration    int     `json:"stage_duration" binding:"min=0"`                            // 每阶段观察时间(分钟)
+	FailureThreshold float64 `json:"failure_threshold" binding:"min=0,max=100"`
+	AlarmThreshold   float64 `json:"alarm_threshold" binding:"min=0,max=100"`
+	MinSamples       int     `json:"min_samples" binding:"min=0"`
+}
+
+// OTACampaignQuery 升级活动查询条件
+type OTACampaignQuery struct {
+	PageQuery
+	Status    string `form:"status"`
+	PackageID uint   `form:"package_id"`
+}
+
+// OTAStageMetrics 升级活动单个阶段的升级情况
+type OTAStageMetrics struct {
+	Stage        int     `json:"stage"`         // 阶段序号，从0开始
+	Percent      int     `json:"percent"`       // 覆盖比例
+	Dispatched   int64   `json:"dispatched"`    // 已下发设备数
+	InProgress   int64   `json:"in_progress"`   // 升级中(未确认结果)
+	Success      int64   `json:"success"`       // 升级成功
+	Failed       int64   `json:"failed"`        // 升级失败
+	AlarmDevices int64   `json:"alarm_devices"` // 升级成功后产生告警的设备数
+	FailureRate  float64 `json:"failure_rate"`  // 失败率(%) = 失败 / (成功 + 失败)
+	AlarmRate    float64 `json:"alarm_rate"`    // 告警率(%) = 告警设备 / 成功
+}
+
+// OTACampaignDetail 升级活动详情
+type OTACampaignDetail struct {
+	Campaign *model.OTACampaign `json:"campaign"`
+	Stages   []OTAStageMetrics  `json:"stages"`
+	Total    OTAStageMetrics    `json:"total"` // 全部阶段合计，用于判断是否自动暂停
+}
+
+// CreateCampaign 创建升级活动，创建后为草稿状态
+func (s *OTACampaignService) CreateCampaign(req *CreateOTACampaignRequest, operator string) (*model.OTACampaign, error) {
+	for i, percent := range req.Stages {
+		if i > 0 && percent <= req.Stages[i-1] {
+			return nil, errors.New(errors.ErrInvalidParams, "各阶段覆盖比例必须递增")
+		}
+	}
+	if req.Stages[len(req.Stages)-1] != 100 {
+		return nil, errors.New(errors.ErrInvalidParams, "最后一个阶段必须覆盖全部设备")
+	}
+
+	pkg, err := s.store.OTA().FindPackage(req.PackageID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, errors.New(errors.ErrInvalidParams, "升级包不存在")
+		}
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if pkg.Status == model.OTAPackageStatusEnabled {
+		return nil, errors.New(errors.ErrInvalidParams, "升级包已全量发布")
+	}
+	if req.TargetModel != "" {
+		if !pkg.SupportsModel(req.TargetModel) {
+			return nil, errors.New(errors.ErrInvalidParams, "升级包不适用于该型号")
+		}
+	}
+	if err := checkNoOpenCampaign(s.store.OTACampaigns(), pkg.ID, 0); err != nil {
+		return nil, err
+	}
+
+	stages := make([]string, len(req.Stages))
+	for i, percent := range req.Stages {
+		stages[i] = strconv.Itoa(percent)
+	}
+
+	campaign := &model.OTACampaign{
+		Name:             req.Name,
+		PackageID:        pkg.ID,
+		TargetModel:      req.TargetModel,
+		FromVersion:      req.FromVersion,
+		Stages:           strings.Join(stages, ","),
+		StageDuration:    req.StageDuration,
+		FailureThreshold: req.FailureThreshold,
+		AlarmThreshold:   req.AlarmThreshold,
+		MinSamples:       req.MinSamples,
+		Status:           model.OTACampaignDraft,
+		CreatedBy:        operator,
+	}
+	if campaign.StageDuration == 0 {
+		campaign.StageDuration = defaultCampaignStageDuration
+	}
+	if campaign.FailureThreshold == 0 {
+		campaign.FailureThreshold = defaultCampaignFailureThreshold
+	}
+	if campaign.AlarmThreshold == 0 {
+		campaign.AlarmThreshold = defaultCampaignAlarmThreshold
+	}
+	if campaign.MinSamples == 0 {
+		campaign.MinSamples = defaultCampaignMinSamples
+	}
+
+	if err := s.store.OTACampaigns().Create(campaign); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return campaign, nil
+}
+
+// ListCampaigns 分页查询升级活动
+func (s *OTACampaignService) ListCampaigns(query *OTACampaignQuery) (*PageResult, error) {
+	query.normalize()
+
+	filter := repository.OTACampaignFilter{Status: query.Status, PackageID: query.PackageID}
+	campaigns, total, err := s.store.OTACampaigns().List(filter, query.page())
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	return &PageResult{
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Items:    campaigns,
+	}, nil
+}
+
+// GetCampaign 查询升级活动及各阶段升级情况
+func (s *OTACampaignService) GetCampaign(id uint) (*OTACampaignDetail, error) {
+	campaign, err := s.findCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+
+	stages, total, err := campaignMetrics(s.store.OTACampaigns(), campaign, nil)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	return &OTACampaignDetail{Campaign: campaign, Stages: stages, Total: total}, nil
+}
+
+// StartCampaign 开始升级活动，从第一阶段开始下发
+func (s *OTACampaignService) StartCampaign(id uint) (*model.OTACampaign, error) {
+	campaign, err := s.findCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNoOpenCampaign(s.store.OTACampaigns(), campaign.PackageID, campaign.ID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return s.transition(campaign, []string{model.OTACampaignDraft}, map[string]interface{}{
+		"status":           model.OTACampaignRunning,
+		"current_stage":    0,
+		"stage_started_at": now,
+		"started_at":       now,
+		"metrics_since":    now,
+	})
+}
+
+// PauseCampaign 暂停升级活动，暂停期间不再向新设备下发
+func (s *OTACampaignService) PauseCampaign(id uint, operator string) (*model.OTACampaign, error) {
+	campaign, err := s.findCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.transition(campaign, []string{model.OTACampaignRunning}, map[string]interface{}{
+		"status":       model.OTACampaignPaused,
+		"pause_reason": fmt.Sprintf("%s手动暂停", operator),
+	})
+}
+
+// ResumeCampaign 恢复升级活动，当前阶段重新开始计算观察时间
+func (s *OTACampaignService) ResumeCampaign(id uint) (*model.OTACampaign, error) {
+	campaign, err := s.findCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return s.transition(campaign, []string{model.OTACampaignPaused}, map[string]interface{}{
+		"status":           model.OTACampaignRunning,
+		"pause_reason":     "",
+		"stage_started_at": now,
+		"metrics_since":    now,
+	})
+}
+
+// AbortCampaign 终止升级活动，尚未开始下载的升级记录标记为失败
+func (s *OTACampaignService) AbortCampaign(id uint, operator string) (*model.OTACampaign, error) {
+	campaign, err := s.findCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	campaign, err = s.transition(campaign, model.OTACampaignOpenStatuses, map[string]interface{}{
+		"status":       model.OTACampaignAborted,
+		"pause_reason": fmt.Sprintf("%s终止", operator),
+		"finished_at":  now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.OTACampaigns().UpdatePendingUpdates(campaign.ID, map[string]interface{}{
+		"status":        model.OTAUpdateFailed,
+		"error_code":    "campaign_aborted",
+		"error_message": "升级活动已终止",
+		"finished_at":   now,
+	}); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	return campaign, nil
+}
+
+// Evaluate 检查进行中的升级活动：失败率或告警率超过阈值时自动暂停，当前阶段观察时间结束后进入下一阶段
+// 只统计最近一次开始或恢复后下发的升级，恢复后不会因暂停前的数据再次暂停
+func (s *OTACampaignService) Evaluate(campaign *model.OTACampaign, now time.Time) error {
+	_, total, err := campaignMetrics(s.store.OTACampaigns(), campaign, campaign.MetricsSince)
+	if err != nil {
+		return err
+	}
+
+	var reason string
+	if finished := total.Success + total.Failed; finished >= int64(campaign.MinSamples) && total.FailureRate > campaign.FailureThreshold {
+		reason = fmt.Sprintf("升级失败率%.1f%%超过阈值%.1f%%", total.FailureRate, campaign.FailureThreshold)
+	} else if total.Success >= int64(campaign.MinSamples) && total.AlarmRate > campaign.AlarmThreshold {
+		reason = fmt.Sprintf("升级后告警率%.1f%%超过阈值%.1f%%", total.AlarmRate, campaign.AlarmThreshold)
+	}
+	if reason != "" {
+		if _, err := s.transition(campaign, []string{model.OTACampaignRunning}, map[string]interface{}{
+			"status":       model.OTACampaignPaused,
+			"pause_reason": reason,
+		}); err != nil {
+			return err
+		}
+		logger.Log.Warn("ota campaign paused", zap.Uint("campaign_id", campaign.ID), zap.String("reason", reason))
+		return nil
+	}
+
+	if campaign.StageStartedAt == nil || now.Sub(*campaign.StageStartedAt) < time.Duration(campaign.StageDuration)*time.Minute {
+		return nil
+	}
+
+	// 条件更新，多个实例同时检查时只推进一次
+	return s.store.Transaction(func(store repository.Store) error {
+		updates := map[string]interface{}{
+			"current_stage":    campaign.CurrentStage + 1,
+			"stage_started_at": now,
+		}
+		if campaign.IsLastStage() {
+			updates = map[string]interface{}{
+				"status":      model.OTACampaignCompleted,
+				"finished_at": now,
+			}
+		}
+
+		advanced, err := store.OTACampaigns().AdvanceStage(campaign.ID, campaign.CurrentStage, updates)
+		if err != nil || !advanced || !campaign.IsLastStage() {
+			return err
+		}
+
+		// 最后阶段完成后转为全量发布
+		pkg := &model.OTAPackage{}
+		pkg.ID = campaign.PackageID
+		return store.OTA().UpdatePackage(pkg, map[string]interface{}{"status": model.OTAPackageStatusEnabled})
+	})
+}
+
+// findCampaign 查询升级活动
+func (s *OTACampaignService) findCampaign(id uint) (*model.OTACampaign, error) {
+	campaign, err := s.store.OTACampaigns().Find(id)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			return nil, errors.New(errors.ErrInvalidParams, "升级活动不存在")
+		}
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return campaign, nil
+}
+
+// transition 按当前状态条件更新升级活动，状态已被其他请求变更时返回错误
+func (s *OTACampaignService) transition(campaign *model.OTACampaign, from []string, updates map[string]interface{}) (*model.OTACampaign, error) {
+	updated, err := s.store.OTACampaigns().Transition(campaign.ID, from, updates)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if !updated {
+		return nil, errors.New(errors.ErrInvalidParams, "升级活动当前状态不允许该操作")
+	}
+	return s.findCampaign(campaign.ID)
+}
+
+// checkNoOpenCampaign 同一升级包同时只能有一个未结束的升级活动
+func checkNoOpenCampaign(campaigns repository.OTACampaignRepository, packageID, exceptID uint) error {
+	open, err := campaigns.HasOpen(packageID, exceptID)
+	if err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if open {
+		return errors.New(errors.ErrInvalidParams, "该升级包已有未结束的升级活动")
+	}
+	return nil
+}
+
+// campaignMetrics 按阶段统计升级活动的升级情况，since不为空时只统计该时间之后下发的升级
+func campaignMetrics(campaigns repository.OTACampaignRepository, campaign *model.OTACampaign, since *time.Time) ([]OTAStageMetrics, OTAStageMetrics, error) {
+	rows, err := campaigns.CountUpdates(campaign.ID, since)
+	if err != nil {
+		return nil, OTAStageMetrics{}, err
+	}
+
+	// 升级成功后产生警告及以上级别告警的设备
+	alarms, err := campaigns.CountAlarmDevices(campaign.ID, since, model.AlarmLevelWarning)
+	if err != nil {
+		return nil, OTAStageMetrics{}, err
+	}
+
+	percents := campaign.StagePercents()
+	stages := make([]OTAStageMetrics, len(percents))
+	for i, percent := range percents {
+		stages[i] = OTAStageMetrics{Stage: i, Percent: percent}
+	}
+	total := OTAStageMetrics{Stage: campaign.CurrentStage, Percent: campaign.CurrentPercent()}
+
+	for _, row := range rows {
+		if row.CampaignStage < 0 || row.CampaignStage >= len(stages) {
+			continue
+		}
+		for _, m := range []*OTAStageMetrics{&stages[row.CampaignStage], &total} {
+			m.Dispatched += row.Count
+			switch row.Status {
+			case model.OTAUpdateSuccess:
+				m.Success += row.Count
+			case model.OTAUpdateFailed:
+				m.Failed += row.Count
+			default:
+				m.InProgress += row.Count
+			}
+		}
+	}
+	for _, alarm := range alarms {
+		if alarm.CampaignStage < 0 || alarm.CampaignStage >= len(stages) {
+			continue
+		}
+		stages[alarm.CampaignStage].AlarmDevices += alarm.Count
+		total.AlarmDevices += alarm.Count
+	}
+
+	for i := range stages {
+		stages[i].computeRates()
+	}
+	total.computeRates()
+	return stages, total, nil
+}
+
+// computeRates 计算失败率和告警率
+func (m *OTAStageMetrics) computeRates() {
+	if finished := m.Success + m.Failed; finished > 0 {
+		m.FailureRate = float64(m.Failed) * 100 / float64(finished)
+	}
+	if m.Success > 0 {
+		m.AlarmRate = float64(m.AlarmDevices) * 100 / float64(m.Success)
+	}
+}
+
+// rolloutBucket 设备在升级活动中的分桶(0-99)，同一活动中结果固定，不同活动使用不同的设备批次
+func rolloutBucket(campaignID uint, sn string) int {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatUint(uint64(campaignID), 10) + ":" + sn))
+	return int(h.Sum32() % 100)
+}
+
+// rolloutPackages 查询设备所在批次已开放的灰度升级包，同时返回升级包对应的升级活动
+func rolloutPackages(store repository.Store, device *model.Device, versions *model.SoftwareVersions, component string) ([]model.OTAPackage, map[uint]*model.OTACampaign, error) {
+	campaigns, err := store.OTACampaigns().ListRunning()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byPackage := map[uint]*model.OTACampaign{}
+	var packageIDs []uint
+	for i := range campaigns {
+		c := &campaigns[i]
+		if c.TargetModel != "" && !strings.EqualFold(c.TargetModel, strings.TrimSpace(device.DeviceModel)) {
+			continue
+		}
+		if rolloutBucket(c.ID, device.SN) >= c.CurrentPercent() {
+			continue
+		}
+		byPackage[c.PackageID] = c
+		packageIDs = append(packageIDs, c.PackageID)
+	}
+	if len(packageIDs) == 0 {
+		return nil, byPackage, nil
+	}
+	packages, err := store.OTA().ListPackagesByID(packageIDs, component)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 限定了当前版本的活动只对该版本的设备开放
+	eligible := packages[:0]
+	for _, pkg := range packages {
+		c := byPackage[pkg.ID]
+		if current, _ := versions.VersionOf(pkg.Component); c.FromVersion != "" && current != c.FromVersion {
+			continue
+		}
+		eligible = append(eligible, pkg)
+	}
+	return eligible, byPackage, nil
+}
+
+// OTACampaignMonitorService 定时检查进行中的升级活动
+type OTACampaignMonitorService struct {
+	campaignService *OTACampaignService
+	checkTicker     *time.Ticker
+	stopChan        chan struct{}
+}
+
+// NewOTACampaignMonitorService 创建并启动升级活动检查任务
+func NewOTACampaignMonitorService(store repository.Store, interval time.Duration) *OTACampaignMonitorService {
+	service := &OTACampaignMonitorService{
+		campaignService: NewOTACampaignService(store),
+		checkTicker:     time.NewTicker(interval),
+		stopChan:        make(chan struct{}),
+	}
+
+	go service.startCheck()
+
+	return service
+}
+
+// startCheck 启动定时检查任务
+func (s *OTACampaignMonitorService) startCheck() {
+	for {
+		select {
+		case <-s.checkTicker.C:
+			s.CheckCampaigns()
+		case <-s.stopChan:
+			s.checkTicker.Stop()
+			return
+		}
+	}
+}
+
+// CheckCampaigns 检查全部进行中的升级活动，单个活动出错不影响其他活动
+func (s *OTACampaignMonitorService) CheckCampaigns() {
+	campaigns, err := s.campaignService.store.OTACampaigns().ListRunning()
+	if err != nil {
+		logger.Log.Error("load ota campaigns failed", zap.Error(err))
+		return
+	}
+
+	now := time.Now()
+	for i := range campaigns {
+		if err := s.campaignService.Evaluate(&campaigns[i], now); err != nil {
+			logger.Log.Error("evaluate ota campaign failed", zap.Uint("campaign_id", campaigns[i].ID), zap.Error(err))
+		}
+	}
+}
+
+// Stop 停止服务
+func (s *OTACampaignMonitorService) Stop() {
+	close(s.stopChan)
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/config"
+)
+
+func TestRolloutBucket(t *testing.T) {
+	sn := "M4D2401A0100013"
+	assert.Equal(t, rolloutBucket(1, sn), rolloutBucket(1, sn))
+
+	// 不同活动使用不同的设备批次
+	differs := false
+	for id := uint(2); id < 20; id++ {
+		if rolloutBucket(id, sn) != rolloutBucket(1, sn) {
+			differs = true
+			break
+		}
+	}
+	assert.True(t, differs)
+}
+
+func TestOTACampaignService_Rollout(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	infoService := NewDeviceInfoService(store)
+	var devices []*model.Device
+	for i := 0; i < 40; i++ {
+		device := &model.Device{
+			SN:          fmt.Sprintf("M4D2401A01%05d", i),
+			DeviceModel: "MD-400D",
+			Status:      1,
+			LastOnline:  time.Now(),
+		}
+		store.Devices().Create(device)
+		devices = append(devices, device)
+
+		req := &DeviceInfoRequest{}
+		req.DeviceInfo.DeviceSN = device.SN
+		req.DeviceInfo.DeviceModel = device.DeviceModel
+		req.SoftwareVersions.Klipper = "0.11.0"
+		assert.NoError(t, infoService.ReportDeviceInfo(req))
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otaService := NewOTAService(store, &memoryStorage{objects: map[string][]byte{}}, key, config.OTAConfig{SigningKeyID: "ota-1", URLExpiry: 600, MaxPackageSize: 1})
+	content := []byte("klipper package")
+	pkg, err := otaService.UploadPackage(&UploadOTAPackageRequest{
+		Component:    model.ComponentKlipper,
+		Version:      "0.12.0",
+		TargetModels: "MD-400D",
+	}, bytes.NewReader(content), "klipper.tar.gz", int64(len(content)), "admin")
+	assert.NoError(t, err)
+
+	campaignService := NewOTACampaignService(store)
+
+	// 最后一个阶段必须覆盖全部设备
+	_, err = campaignService.CreateCampaign(&CreateOTACampaignRequest{Name: "klipper", PackageID: pkg.ID, Stages: []int{10, 50}}, "admin")
+	assert.Error(t, err)
+
+	campaign, err := campaignService.CreateCampaign(&CreateOTACampaignRequest{
+		Name:             "klipper 0.12.0",
+		PackageID:        pkg.ID,
+		Stages:           []int{50, 100},
+		FailureThreshold: 20,
+		MinSamples:       3,
+	}, "admin")
+	assert.NoError(t, err)
+	assert.Equal(t, model.OTACampaignDraft, campaign.Status)
+
+	// 活动未结束时不能直接全量发布
+	enabled := model.OTAPackageStatusEnabled
+	_, err = otaService.UpdatePackage(pkg.ID, &UpdateOTAPackageRequest{Status: &enabled})
+	assert.Error(t, err)
+
+	campaign, err = campaignService.StartCampaign(campaign.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.OTACampaignRunning, campaign.Status)
+
+	// 只有第一阶段批次内的设备收到升级
+	var dispatched []OTAUpdateInfo
+	var dispatchedSN []string
+	for _, device := range devices {
+		result, err := otaService.CheckUpdate(device.SN, "")
+		assert.NoError(t, err)
+		if rolloutBucket(campaign.ID, device.SN) < 50 {
+			if assert.Len(t, result.Updates, 1) {
+				dispatched = append(dispatched, result.Updates[0])
+				dispatchedSN = append(dispatchedSN, device.SN)
+			}
+		} else {
+			assert.Empty(t, result.Updates)
+		}
+	}
+	if !assert.GreaterOrEqual(t, len(dispatched), 3) {
+		return
+	}
+
+	// 失败率超过阈值后自动暂停，暂停期间不再下发
+	for i, update := range dispatched[:3] {
+		assert.NoError(t, otaService.ReportProgress(dispatchedSN[i], &OTAProgressRequest{UpdateID: update.UpdateID, Status: model.OTAUpdateFailed, ErrorCode: "E01"}))
+	}
+	assert.NoError(t, campaignService.Evaluate(campaign, time.Now()))
+	detail, err := campaignService.GetCampaign(campaign.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.OTACampaignPaused, detail.Campaign.Status)
+	assert.NotEmpty(t, detail.Campaign.PauseReason)
+	assert.Equal(t, int64(3), detail.Total.Failed)
+
+	if len(dispatched) > 3 {
+		result, err := otaService.CheckUpdate(dispatchedSN[len(dispatchedSN)-1], "")
+		assert.NoError(t, err)
+		assert.Empty(t, result.Updates)
+	}
+
+	// 恢复后只统计恢复后的升级结果，不会立即再次暂停
+	campaign, err = campaignService.ResumeCampaign(campaign.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, campaignService.Evaluate(campaign, time.Now()))
+	campaign, err = campaignService.findCampaign(campaign.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.OTACampaignRunning, campaign.Status)
+
+	// 观察时间结束后进入下一阶段，最后阶段结束后全量发布
+	later := time.Now().Add(time.Duration(campaign.StageDuration+1) * time.Minute)
+	assert.NoError(t, campaignService.Evaluate(campaign, later))
+	campaign, err = campaignService.findCampaign(campaign.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, campaign.CurrentStage)
+	assert.Equal(t, 100, campaign.CurrentPercent())
+
+	for _, device := range devices {
+		if rolloutBucket(campaign.ID, device.SN) >= 50 {
+			result, err := otaService.CheckUpdate(device.SN, "")
+			assert.NoError(t, err)
+			assert.Len(t, result.Updates, 1)
+			break
+		}
+	}
+
+	assert.NoError(t, campaignService.Evaluate(campaign, later.Add(time.Duration(campaign.StageDuration+1)*time.Minute)))
+	campaign, err = campaignService.findCampaign(campaign.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.OTACampaignCompleted, campaign.Status)
+	assert.NotNil(t, campaign.FinishedAt)
+
+	pkg, err = otaService.GetPackage(pkg.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.OTAPackageStatusEnabled, pkg.Status)
+}
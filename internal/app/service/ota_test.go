@@ -0,0 +1,146 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/config"
+)
+
+// memoryStorage 测试用内存对象存储
+type memoryStorage struct {
+	objects map[string][]byte
+}
+
+func (s *memoryStorage) PutObject(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memoryStorage) PresignedGetURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "https://storage.example.com/" + key, nil
+}
+
+func (s *memoryStorage) RemoveObject(ctx context.Context, key string) error {
+	delete(s.objects, key)
+	return nil
+}
+
+func TestOTAService_UpdateFlow(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	device := &model.Device{
+		SN:          "M4D2401A0100013",
+		DeviceModel: "MD-400D",
+		Status:      1,
+		LastOnline:  time.Now(),
+	}
+	store.Devices().Create(device)
+
+	infoService := NewDeviceInfoService(store)
+	report := func(klipper string) {
+		req := &DeviceInfoRequest{}
+		req.DeviceInfo.DeviceSN = device.SN
+		req.DeviceInfo.DeviceModel = device.DeviceModel
+		req.SoftwareVersions.Klipper = klipper
+		req.SoftwareVersions.KlipperScreen = "0.3.1"
+		req.SoftwareVersions.Firmware.Mainboard = "1.2.0"
+		req.SoftwareVersions.Firmware.Printhead = "1.0.0"
+		assert.NoError(t, infoService.ReportDeviceInfo(req))
+	}
+	report("0.11.0")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	objects := &memoryStorage{objects: map[string][]byte{}}
+	otaService := NewOTAService(store, objects, key, config.OTAConfig{SigningKeyID: "ota-1", URLExpiry: 600, MaxPackageSize: 1})
+
+	content := []byte("klipper package")
+	sum := sha256.Sum256(content)
+	upload := func(version, targets, minVersion string) (*model.OTAPackage, error) {
+		return otaService.UploadPackage(&UploadOTAPackageRequest{
+			Component:    model.ComponentKlipper,
+			Version:      version,
+			TargetModels: targets,
+			MinVersion:   minVersion,
+			SHA256:       hex.EncodeToString(sum[:]),
+		}, bytes.NewReader(content), "klipper.tar.gz", int64(len(content)), "admin")
+	}
+
+	// 未登记的型号不能作为适用型号
+	_, err = upload("0.12.0", "MD-9000", "")
+	assert.Error(t, err)
+
+	pkg, err := upload("0.12.0", "md-400d", "0.10.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "MD-400D", pkg.TargetModels)
+	assert.Equal(t, content, objects.objects[pkg.ObjectKey])
+	signature, _ := base64.StdEncoding.DecodeString(pkg.Signature)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], signature))
+
+	// 不满足当前版本范围的升级包不下发
+	tooNew, err := upload("0.13.0", "MD-400D", "0.12.0")
+	assert.NoError(t, err)
+
+	// 升级包发布前不下发
+	result, err := otaService.CheckUpdate(device.SN, "")
+	assert.NoError(t, err)
+	assert.Empty(t, result.Updates)
+
+	enabled := model.OTAPackageStatusEnabled
+	_, err = otaService.UpdatePackage(pkg.ID, &UpdateOTAPackageRequest{Status: &enabled})
+	assert.NoError(t, err)
+	_, err = otaService.UpdatePackage(tooNew.ID, &UpdateOTAPackageRequest{Status: &enabled})
+	assert.NoError(t, err)
+
+	result, err = otaService.CheckUpdate(device.SN, "")
+	assert.NoError(t, err)
+	if assert.Len(t, result.Updates, 1) {
+		assert.Equal(t, "0.12.0", result.Updates[0].Version)
+		assert.Equal(t, "0.11.0", result.Updates[0].FromVersion)
+	}
+	updateID := result.Updates[0].UpdateID
+
+	// 重复检查复用未结束的升级记录
+	result, err = otaService.CheckUpdate(device.SN, model.ComponentKlipper)
+	assert.NoError(t, err)
+	assert.Equal(t, updateID, result.Updates[0].UpdateID)
+
+	assert.NoError(t, otaService.ReportProgress(device.SN, &OTAProgressRequest{UpdateID: updateID, Status: model.OTAUpdateDownloading, Progress: 40}))
+	assert.NoError(t, otaService.ReportProgress(device.SN, &OTAProgressRequest{UpdateID: updateID, Status: "success"}))
+	assert.Error(t, otaService.ReportProgress("M4D2401A0100099", &OTAProgressRequest{UpdateID: updateID, Status: "success"}))
+
+	updates, err := otaService.ListDeviceUpdates(device.SN)
+	assert.NoError(t, err)
+	assert.Equal(t, model.OTAUpdateInstalled, updates[0].Status)
+
+	// 设备重启后上报目标版本，确认升级成功
+	report("0.12.0")
+	updates, err = otaService.ListDeviceUpdates(device.SN)
+	assert.NoError(t, err)
+	assert.Equal(t, model.OTAUpdateSuccess, updates[0].Status)
+	assert.NotNil(t, updates[0].FinishedAt)
+
+	// 升级后满足新升级包的版本范围
+	result, err = otaService.CheckUpdate(device.SN, "")
+	assert.NoError(t, err)
+	if assert.Len(t, result.Updates, 1) {
+		assert.Equal(t, "0.13.0", result.Updates[0].Version)
+	}
+}
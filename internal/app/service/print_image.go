@@ -9,28 +9,28 @@ import (
     "time"
     
     "mingda_cloud_service/internal/app/model"
+    "mingda_cloud_service/internal/app/repository"
     "mingda_cloud_service/internal/pkg/ai"
     "mingda_cloud_service/internal/pkg/config"
     "mingda_cloud_service/internal/pkg/errors"
-    "gorm.io/gorm"
 )
 
 // PrintImageService 打印图片服务
 type PrintImageService struct {
-    db       *gorm.DB
+    store    repository.Store
     config   *config.Config
     aiClient *ai.Client
 }
 
 // NewPrintImageService 创建打印图片服务
-func NewPrintImageService(db *gorm.DB, cfg *config.Config) *PrintImageService {
+func NewPrintImageService(store repository.Store, cfg *config.Config) *PrintImageService {
     aiClient := ai.NewClient(
         cfg.AI.BaseURL,
         fmt.Sprintf("%s/api/v1/ai/callback", cfg.Server.BaseURL),
     )
     
     return &PrintImageService{
-        db:       db,
+        store:    store,
         config:   cfg,
         aiClient: aiClient,
     }
@@ -86,17 +86,6 @@ func (s *PrintImageService) UploadPrintImage(file *multipart.FileHeader, deviceS
     // 构建图片URL
     imageURL := fmt.Sprintf("%s/images/%s/%s", s.config.Server.BaseURL, time.Now().Format("20060102"), filename)
 
-    // 开启事务
-    tx := s.db.Begin()
-    if tx.Error != nil {
-        return errors.New(errors.ErrDatabase, "开启事务失败")
-    }
-    defer func() {
-        if r := recover(); r != nil {
-            tx.Rollback()
-        }
-    }()
-
     // 创建图片记录
     image := &model.PrintImage{
         TaskID:    taskID,
@@ -106,23 +95,15 @@ func (s *PrintImageService) UploadPrintImage(file *multipart.FileHeader, deviceS
         Status:    model.StatusChecking, // 设置为检测中状态
     }
 
-    if err := tx.Create(image).Error; err != nil {
-        tx.Rollback()
+    if err := s.store.PrintImages().Create(image); err != nil {
         return errors.New(errors.ErrDatabase, fmt.Sprintf("保存图片记录失败: %v", err))
     }
 
-    // 提交事务
-    if err := tx.Commit().Error; err != nil {
-        return errors.New(errors.ErrDatabase, "提交事务失败")
-    }
-
     // 触发AI检测
     go func() {
         if err := s.aiClient.RequestPredict(imageURL, taskID); err != nil {
             // 更新状态为未检测，等待重试
-            s.db.Model(&model.PrintImage{}).
-                Where("task_id = ?", taskID).
-                Update("status", model.StatusPending)
+            s.store.PrintImages().UpdateByTask(taskID, deviceSN, map[string]interface{}{"status": model.StatusPending})
         }
     }()
 
@@ -147,16 +128,10 @@ func checkDirPermissions(dir string) error {
     return nil
 }
 
-// GetPrintImages 获取打印图片列表
-func (s *PrintImageService) GetPrintImages(deviceSN string, taskID string) ([]model.PrintImage, error) {
-    var images []model.PrintImage
-    query := s.db.Where("device_sn = ?", deviceSN)
-    
-    if taskID != "" {
-        query = query.Where("task_id = ?", taskID)
-    }
-    
-    if err := query.Find(&images).Error; err != nil {
+// GetPrintImages 获取访问范围内的打印图片列表
+func (s *PrintImageService) GetPrintImages(tenant Tenant, taskID string) ([]model.PrintImage, error) {
+    images, err := s.store.PrintImages().List(tenant, taskID)
+    if err != nil {
         return nil, errors.New(errors.ErrDatabase, fmt.Sprintf("查询图片列表失败: %v", err))
     }
     
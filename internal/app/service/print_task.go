@@ -4,16 +4,18 @@ import (
 	"fmt"
 	"time"
 	"mingda_cloud_service/internal/app/model"
-	"mingda_cloud_service/internal/pkg/database"
+	"mingda_cloud_service/internal/app/repository"
 	"mingda_cloud_service/internal/pkg/errors"
 )
 
 // PrintTaskService 打印任务服务
-type PrintTaskService struct{}
+type PrintTaskService struct {
+	store repository.Store
+}
 
 // NewPrintTaskService 创建打印任务服务实例
-func NewPrintTaskService() *PrintTaskService {
-	return &PrintTaskService{}
+func NewPrintTaskService(store repository.Store) *PrintTaskService {
+	return &PrintTaskService{store: store}
 }
 
 // PrintTaskRequest 打印任务状态上报请求
@@ -38,49 +40,41 @@ func (s *PrintTaskService) ReportPrintStatus(deviceSN string, req *PrintTaskRequ
 		return errors.New(errors.ErrInvalidParams, "无效的任务状态")
 	}
 
-	// 2. 开启事务
-	tx := database.DB.Begin()
-	if tx.Error != nil {
-		return errors.New(errors.ErrDatabase, "开启事务失败")
-	}
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+	// 2. 在事务中更新任务
+	return s.store.Transaction(func(store repository.Store) error {
+		tasks := store.PrintTasks()
 
-	// 3. 查找或创建打印任务
-	var task model.PrintTask
-	result := tx.Where("task_id = ?", req.TaskID).First(&task)
-	if result.Error != nil {
-		// 如果任务不存在，创建新任务
-		task = model.PrintTask{
-			TaskID:          req.TaskID,
-			DeviceSN:        deviceSN,
-			FileName:        req.FileName,
-			StartTime:       req.StartTime,
-			Status:          req.Status,
-			Progress:        req.Progress,
-			Duration:        req.Duration,
-			FilamentUsed:    req.FilamentUsed,
-			LayersCompleted: req.LayersCompleted,
-		}
-		if err := tx.Create(&task).Error; err != nil {
-			tx.Rollback()
-			return errors.New(errors.ErrDatabase, fmt.Sprintf("创建打印任务失败: %v", err))
+		// 3. 查找或创建打印任务，只能更新本设备的任务
+		task, err := tasks.FindTask(req.TaskID, deviceSN)
+		if err != nil {
+			// 如果任务不存在，创建新任务
+			task = &model.PrintTask{
+				TaskID:          req.TaskID,
+				DeviceSN:        deviceSN,
+				FileName:        req.FileName,
+				StartTime:       req.StartTime,
+				Status:          req.Status,
+				Progress:        req.Progress,
+				Duration:        req.Duration,
+				FilamentUsed:    req.FilamentUsed,
+				LayersCompleted: req.LayersCompleted,
+			}
+			if err := tasks.CreateTask(task); err != nil {
+				return errors.New(errors.ErrDatabase, fmt.Sprintf("创建打印任务失败: %v", err))
+			}
+			return nil
 		}
-	} else {
+
 		// 4. 记录状态变更历史
 		if task.Status != req.Status {
-			history := model.PrintTaskHistory{
+			history := &model.PrintTaskHistory{
 				TaskID:         req.TaskID,
 				DeviceSN:       deviceSN,
 				PreviousStatus: task.Status,
 				CurrentStatus:  req.Status,
 				ChangeTime:     time.Now(),
 			}
-			if err := tx.Create(&history).Error; err != nil {
-				tx.Rollback()
+			if err := tasks.CreateHistory(history); err != nil {
 				return errors.New(errors.ErrDatabase, fmt.Sprintf("记录状态变更历史失败: %v", err))
 			}
 		}
@@ -88,9 +82,9 @@ func (s *PrintTaskService) ReportPrintStatus(deviceSN string, req *PrintTaskRequ
 		// 5. 更新任务状态
 		updates := map[string]interface{}{
 			"status":           req.Status,
-			"progress":        req.Progress,
-			"duration":        req.Duration,
-			"filament_used":   req.FilamentUsed,
+			"progress":         req.Progress,
+			"duration":         req.Duration,
+			"filament_used":    req.FilamentUsed,
 			"layers_completed": req.LayersCompleted,
 		}
 
@@ -106,42 +100,27 @@ func (s *PrintTaskService) ReportPrintStatus(deviceSN string, req *PrintTaskRequ
 			}
 		}
 
-		if err := tx.Model(&task).Updates(updates).Error; err != nil {
-			tx.Rollback()
+		if err := tasks.UpdateTask(task, updates); err != nil {
 			return errors.New(errors.ErrDatabase, fmt.Sprintf("更新打印任务失败: %v", err))
 		}
-	}
-
-	// 6. 提交事务
-	if err := tx.Commit().Error; err != nil {
-		return errors.New(errors.ErrDatabase, fmt.Sprintf("提交事务失败: %v", err))
-	}
-
-	return nil
+		return nil
+	})
 }
 
-// GetDevicePrintTasks 获取设备打印任务列表
-func (s *PrintTaskService) GetDevicePrintTasks(deviceSN string, status string) ([]model.PrintTask, error) {
-	var tasks []model.PrintTask
-	query := database.DB.Where("device_sn = ?", deviceSN)
-	
-	if status != "" {
-		query = query.Where("status = ?", status)
-	}
-	
-	if err := query.Order("create_time DESC").Find(&tasks).Error; err != nil {
+// GetDevicePrintTasks 获取访问范围内的打印任务列表
+func (s *PrintTaskService) GetDevicePrintTasks(tenant Tenant, status string) ([]model.PrintTask, error) {
+	tasks, err := s.store.PrintTasks().ListTasks(tenant, status)
+	if err != nil {
 		return nil, errors.New(errors.ErrDatabase, fmt.Sprintf("查询打印任务失败: %v", err))
 	}
 	
 	return tasks, nil
 }
 
-// GetTaskHistory 获取任务状态变更历史
-func (s *PrintTaskService) GetTaskHistory(taskID string) ([]model.PrintTaskHistory, error) {
-	var history []model.PrintTaskHistory
-	if err := database.DB.Where("task_id = ?", taskID).
-		Order("change_time DESC").
-		Find(&history).Error; err != nil {
+// GetTaskHistory 获取访问范围内的任务状态变更历史
+func (s *PrintTaskService) GetTaskHistory(tenant Tenant, taskID string) ([]model.PrintTaskHistory, error) {
+	history, err := s.store.PrintTasks().ListHistory(tenant, taskID)
+	if err != nil {
 		return nil, errors.New(errors.ErrDatabase, fmt.Sprintf("查询任务历史失败: %v", err))
 	}
 	return history, nil
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/redis"
+	"mingda_cloud_service/internal/pkg/utils"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// 机型缓存最长有效期，防止错过失效通知时长期使用旧数据
+const printerModelCacheTTL = 5 * time.Minute
+
+// 机型代码格式，与SN前三位一致
+var modelCodePattern = regexp.MustCompile(`^[A-Z]\d[A-Z]$`)
+
+// printerModelCache 机型内存缓存，数据变更时通过Redis通知各实例失效
+type printerModelCache struct {
+	mu       sync.RWMutex
+	store    repository.Store
+	models   map[string]model.PrinterModel // 机型代码 -> 机型
+	loadedAt time.Time
+}
+
+var printerModels = &printerModelCache{}
+
+// PrinterModelRegistry 绑定机型缓存使用的仓储并返回机型注册表，用于SN校验
+func PrinterModelRegistry(store repository.Store) validator.ModelRegistry {
+	printerModels.mu.Lock()
+	printerModels.store = store
+	printerModels.loadedAt = time.Time{}
+	printerModels.mu.Unlock()
+	return printerModels
+}
+
+// IsValidModelCode 机型代码是否已登记且启用
+func (c *printerModelCache) IsValidModelCode(code string) bool {
+	m, ok := c.get(code)
+	return ok && m.Status == model.PrinterModelStatusEnabled
+}
+
+// get 按机型代码查询，缓存过期时从数据库重新加载
+func (c *printerModelCache) get(code string) (model.PrinterModel, bool) {
+	c.mu.RLock()
+	fresh := c.models != nil && time.Since(c.loadedAt) < printerModelCacheTTL
+	m, ok := c.models[code]
+	c.mu.RUnlock()
+	if fresh {
+		return m, ok
+	}
+
+	// 加载失败时继续使用旧数据
+	if err := c.reload(); err != nil {
+		logger.Log.Error("load printer models failed", zap.Error(err))
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m, ok = c.models[code]
+	return m, ok
+}
+
+// reload 从数据库加载全部机型
+func (c *printerModelCache) reload() error {
+	c.mu.RLock()
+	store := c.store
+	c.mu.RUnlock()
+	if store == nil {
+		return fmt.Errorf("printer model registry is not initialized")
+	}
+
+	list, err := store.PrinterModels().List()
+	if err != nil {
+		return err
+	}
+
+	models := make(map[string]model.PrinterModel, len(list))
+	for _, m := range list {
+		models[m.Code] = m
+	}
+
+	c.mu.Lock()
+	c.models = models
+	c.loadedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// invalidate 标记缓存失效，下次查询时重新加载
+func (c *printerModelCache) invalidate() {
+	c.mu.Lock()
+	c.loadedAt = time.Time{}
+	c.mu.Unlock()
+}
+
+// checkDeviceModel 校验设备上报的型号与SN中的机型代码一致，返回登记的机型
+func checkDeviceModel(sn, name string) (*model.PrinterModel, error) {
+	if len(sn) < 3 {
+		return nil, errors.New(errors.ErrInvalidSN, "SN码格式不正确")
+	}
+
+	m, ok := printerModels.get(sn[0:3])
+	if !ok {
+		return nil, errors.New(errors.ErrDeviceTypeInvalid, "未登记的机型")
+	}
+	if m.Status != model.PrinterModelStatusEnabled {
+		return nil, errors.New(errors.ErrDeviceTypeInvalid, "机型已停用")
+	}
+	if !m.MatchesName(name) {
+		return nil, errors.New(errors.ErrDeviceTypeInvalid, "设备型号与SN机型代码不符")
+	}
+	return &m, nil
+}
+
+// PrinterModelService 打印机机型管理服务
+type PrinterModelService struct {
+	store repository.Store
+}
+
+// NewPrinterModelService 创建机型管理服务实例
+func NewPrinterModelService(store repository.Store) *PrinterModelService {
+	return &PrinterModelService{store: store}
+}
+
+// CreatePrinterModelRequest 创建机型请求
+type CreatePrinterModelRequest struct {
+	Code        string `json:"code" binding:"required,len=3"`
+	Name        string `json:"name" binding:"required,max=32"`
+	BuildX      int    `json:"build_x" binding:"min=0"`
+	BuildY      int    `json:"build_y" binding:"min=0"`
+	BuildZ      int    `json:"build_z" binding:"min=0"`
+	NozzleCount int    `json:"nozzle_count" binding:"required,min=1"`
+	MinFirmware string `json:"min_firmware" binding:"max=32"`
+	MaxFirmware string `json:"max_firmware" binding:"max=32"`
+	Remark      string `json:"remark" binding:"max=255"`
+}
+
+// UpdatePrinterModelRequest 更新机型请求，未提供的字段保持不变，机型代码不可修改
+type UpdatePrinterModelRequest struct {
+	Name        *string `json:"name" binding:"omitempty,max=32"`
+	BuildX      *int    `json:"build_x" binding:"omitempty,min=0"`
+	BuildY      *int    `json:"build_y" binding:"omitempty,min=0"`
+	BuildZ      *int    `json:"build_z" binding:"omitempty,min=0"`
+	NozzleCount *int    `json:"nozzle_count" binding:"omitempty,min=1"`
+	MinFirmware *string `json:"min_firmware" binding:"omitempty,max=32"`
+	MaxFirmware *string `json:"max_firmware" binding:"omitempty,max=32"`
+	Status      *int    `json:"status" binding:"omitempty,oneof=0 1"`
+	Remark      *string `json:"remark" binding:"omitempty,max=255"`
+}
+
+// CreatePrinterModel 登记新机型
+func (s *PrinterModelService) CreatePrinterModel(req *CreatePrinterModelRequest) (*model.PrinterModel, error) {
+	if !modelCodePattern.MatchString(req.Code) {
+		return nil, errors.New(errors.ErrInvalidParams, "机型代码格式不正确")
+	}
+	if err := checkFirmwareRange(req.MinFirmware, req.MaxFirmware); err != nil {
+		return nil, err
+	}
+
+	exists, err := s.store.PrinterModels().ExistsByCodeOrName(req.Code, req.Name)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if exists {
+		return nil, errors.New(errors.ErrDatabaseDup, "机型代码或名称已存在")
+	}
+
+	m := &model.PrinterModel{
+		Code:        req.Code,
+		Name:        req.Name,
+		BuildX:      req.BuildX,
+		BuildY:      req.BuildY,
+		BuildZ:      req.BuildZ,
+		NozzleCount: req.NozzleCount,
+		MinFirmware: req.MinFirmware,
+		MaxFirmware: req.MaxFirmware,
+		Status:      model.PrinterModelStatusEnabled,
+		Remark:      req.Remark,
+	}
+	if err := s.store.PrinterModels().Create(m); err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	publishPrinterModelChange()
+	return m, nil
+}
+
+// ListPrinterModels 查询全部机型
+func (s *PrinterModelService) ListPrinterModels() ([]model.PrinterModel, error) {
+	list, err := s.store.PrinterModels().List()
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return list, nil
+}
+
+// GetPrinterModel 按机型代码查询机型
+func (s *PrinterModelService) GetPrinterModel(code string) (*model.PrinterModel, error) {
+	m, err := s.store.PrinterModels().FindByCode(code)
+	if err != nil {
+		return nil, errors.New(errors.ErrDeviceTypeInvalid, "机型不存在")
+	}
+	return m, nil
+}
+
+// UpdatePrinterModel 更新机型信息
+// 已注册设备的型号使用机型名称保存，有设备时不允许修改名称
+func (s *PrinterModelService) UpdatePrinterModel(code string, req *UpdatePrinterModelRequest) (*model.PrinterModel, error) {
+	m, err := s.GetPrinterModel(code)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil && *req.Name != m.Name {
+		used, err := s.store.PrinterModels().InUse(m.Code)
+		if err != nil {
+			return nil, errors.NewWithError(errors.ErrDatabase, err)
+		}
+		if used {
+			return nil, errors.New(errors.ErrInvalidParams, "机型已有设备，不能修改名称")
+		}
+
+		exists, err := s.store.PrinterModels().ExistsByName(*req.Name, m.ID)
+		if err != nil {
+			return nil, errors.NewWithError(errors.ErrDatabase, err)
+		}
+		if exists {
+			return nil, errors.New(errors.ErrDatabaseDup, "机型名称已存在")
+		}
+		updates["name"] = *req.Name
+	}
+	if req.BuildX != nil {
+		updates["build_x"] = *req.BuildX
+	}
+	if req.BuildY != nil {
+		updates["build_y"] = *req.BuildY
+	}
+	if req.BuildZ != nil {
+		updates["build_z"] = *req.BuildZ
+	}
+	if req.NozzleCount != nil {
+		updates["nozzle_count"] = *req.NozzleCount
+	}
+	minFirmware, maxFirmware := m.MinFirmware, m.MaxFirmware
+	if req.MinFirmware != nil {
+		minFirmware = *req.MinFirmware
+		updates["min_firmware"] = minFirmware
+	}
+	if req.MaxFirmware != nil {
+		maxFirmware = *req.MaxFirmware
+		updates["max_firmware"] = maxFirmware
+	}
+	if err := checkFirmwareRange(minFirmware, maxFirmware); err != nil {
+		return nil, err
+	}
+	if req.Status != nil {
+		updates["status"] = *req.Status
+	}
+	if req.Remark != nil {
+		updates["remark"] = *req.Remark
+	}
+
+	if len(updates) > 0 {
+		if err := s.store.PrinterModels().Update(m, updates); err != nil {
+			return nil, errors.NewWithError(errors.ErrDatabase, err)
+		}
+		publishPrinterModelChange()
+	}
+
+	return s.GetPrinterModel(code)
+}
+
+// DeletePrinterModel 删除机型，已有设备或出厂预置记录的机型只能停用
+func (s *PrinterModelService) DeletePrinterModel(code string) error {
+	m, err := s.GetPrinterModel(code)
+	if err != nil {
+		return err
+	}
+
+	used, err := s.store.PrinterModels().InUse(m.Code)
+	if err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if used {
+		return errors.New(errors.ErrInvalidParams, "机型已有设备，请改为停用")
+	}
+
+	if err := s.store.PrinterModels().Delete(m); err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	publishPrinterModelChange()
+	return nil
+}
+
+// checkFirmwareRange 校验固件版本范围
+func checkFirmwareRange(minFirmware, maxFirmware string) error {
+	if minFirmware != "" && maxFirmware != "" && utils.CompareVersion(minFirmware, maxFirmware) > 0 {
+		return errors.New(errors.ErrInvalidParams, "最低固件版本不能高于最高固件版本")
+	}
+	return nil
+}
+
+// publishPrinterModelChange 失效本实例缓存并通知其他实例
+func publishPrinterModelChange() {
+	printerModels.invalidate()
+	if err := redis.Client.Publish(context.Background(), constants.RedisPrinterModelChannel, "changed").Err(); err != nil {
+		logger.Log.Error("publish printer model change failed", zap.Error(err))
+	}
+}
+
+// PrinterModelSyncService 订阅机型变更通知，收到通知后失效本实例缓存
+type PrinterModelSyncService struct {
+	pubsub *goredis.PubSub
+}
+
+// NewPrinterModelSyncService 创建机型变更订阅服务实例并启动订阅
+func NewPrinterModelSyncService() *PrinterModelSyncService {
+	service := &PrinterModelSyncService{
+		pubsub: redis.Client.Subscribe(context.Background(), constants.RedisPrinterModelChannel),
+	}
+
+	// 启动订阅
+	go service.startSync()
+
+	return service
+}
+
+// startSync 处理机型变更通知，订阅关闭后退出
+func (s *PrinterModelSyncService) startSync() {
+	for range s.pubsub.Channel() {
+		printerModels.invalidate()
+	}
+}
+
+// Stop 停止服务
+func (s *PrinterModelSyncService) Stop() {
+	s.pubsub.Close()
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/utils"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// 出厂密钥和认领码最短长度
+const (
+	minProvisionSecretLen = 16
+	minClaimCodeLen       = 8
+)
+
+// ProvisionService 出厂预置服务
+type ProvisionService struct {
+	store       repository.Store
+	manifestKey string
+	cipher      *utils.SecretCipher
+}
+
+// NewProvisionService 创建出厂预置服务实例
+func NewProvisionService(store repository.Store, manifestKey string, cipher *utils.SecretCipher) *ProvisionService {
+	return &ProvisionService{
+		store:       store,
+		manifestKey: manifestKey,
+		cipher:      cipher,
+	}
+}
+
+// ProvisionRecord 出厂预置记录
+type ProvisionRecord struct {
+	SN        string `json:"sn"`
+	Model     string `json:"model"`
+	Secret    string `json:"secret"`
+	ClaimCode string `json:"claim_code,omitempty"` // 可选，随设备印刷的认领码
+	Line      int    `json:"-"`                    // CSV中的源行号，清单导入时为0
+}
+
+// ProvisionManifest 出厂清单，signature为除signature字段外规范化JSON的HMAC-SHA256签名
+type ProvisionManifest struct {
+	BatchNo   string            `json:"batch_no"`
+	Devices   []ProvisionRecord `json:"devices"`
+	Signature string            `json:"signature"`
+}
+
+// ImportError 导入失败的记录
+type ImportError struct {
+	Line   int    `json:"line"`
+	SN     string `json:"sn"`
+	Reason string `json:"reason"`
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	BatchNo string        `json:"batch_no"`
+	Total   int           `json:"total"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Failed  []ImportError `json:"failed"`
+}
+
+// ParseCSV 解析CSV格式的出厂数据，列顺序为sn,model,secret[,claim_code]，首行可以是表头
+func (s *ProvisionService) ParseCSV(r io.Reader) ([]ProvisionRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records := make([]ProvisionRecord, 0)
+	for first := true; ; first = false {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New(errors.ErrInvalidParams, fmt.Sprintf("解析CSV失败: %v", err))
+		}
+		// 记录所在的源文件行号，表头和空行都计入
+		line, _ := reader.FieldPos(0)
+		if len(row) != 3 && len(row) != 4 {
+			return nil, errors.New(errors.ErrInvalidParams, fmt.Sprintf("解析CSV失败: 第%d行列数错误", line))
+		}
+		if first && strings.EqualFold(strings.TrimSpace(row[0]), "sn") {
+			continue
+		}
+		record := ProvisionRecord{
+			SN:     strings.TrimSpace(row[0]),
+			Model:  strings.TrimSpace(row[1]),
+			Secret: strings.TrimSpace(row[2]),
+			Line:   line,
+		}
+		if len(row) == 4 {
+			record.ClaimCode = strings.TrimSpace(row[3])
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// ParseManifest 解析并验证签名的JSON出厂清单
+func (s *ProvisionService) ParseManifest(data []byte) (*ProvisionManifest, error) {
+	if s.manifestKey == "" {
+		return nil, errors.New(errors.ErrSystem, "未配置出厂清单签名密钥")
+	}
+
+	var manifest ProvisionManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.New(errors.ErrInvalidParams, "出厂清单格式错误")
+	}
+	if manifest.Signature == "" {
+		return nil, errors.New(errors.ErrInvalidSign, "出厂清单缺少签名")
+	}
+
+	// 去掉签名字段后规范化计算签名
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.New(errors.ErrInvalidParams, "出厂清单格式错误")
+	}
+	delete(fields, "signature")
+	unsigned, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.New(errors.ErrInvalidParams, "出厂清单格式错误")
+	}
+	canonical, err := utils.CanonicalJSON(unsigned)
+	if err != nil {
+		return nil, errors.New(errors.ErrInvalidParams, "出厂清单格式错误")
+	}
+
+	if !utils.ValidateHMACSign(s.manifestKey, canonical, manifest.Signature) {
+		return nil, errors.New(errors.ErrInvalidSign, "出厂清单签名验证失败")
+	}
+
+	return &manifest, nil
+}
+
+// Import 导入出厂预置记录
+// 已注册的SN跳过，未注册的SN重复导入时以最新数据为准
+func (s *ProvisionService) Import(batchNo string, records []ProvisionRecord) (*ImportResult, error) {
+	result := &ImportResult{
+		BatchNo: batchNo,
+		Total:   len(records),
+		Failed:  make([]ImportError, 0),
+	}
+
+	for i, record := range records {
+		// CSV导入报告源文件行号，清单导入报告设备在清单中的序号
+		line := record.Line
+		if line == 0 {
+			line = i + 1
+		}
+		if reason := validateProvisionRecord(&record); reason != "" {
+			result.Failed = append(result.Failed, ImportError{Line: line, SN: record.SN, Reason: reason})
+			continue
+		}
+
+		// 密钥加密后入库
+		secret, err := s.cipher.Encrypt(record.Secret)
+		if err != nil {
+			return nil, errors.NewWithError(errors.ErrEncrypt, err)
+		}
+		var claimCodeHash string
+		if record.ClaimCode != "" {
+			claimCodeHash = hashClaimCode(record.ClaimCode)
+		}
+
+		existing, err := s.store.Devices().FindProvision(record.SN)
+		if err == nil {
+			if existing.Status == model.ProvisionStatusRegistered {
+				result.Failed = append(result.Failed, ImportError{Line: line, SN: record.SN, Reason: "设备已注册"})
+				continue
+			}
+			if err := s.store.Devices().UpdateProvision(existing, map[string]interface{}{
+				"device_model":    record.Model,
+				"secret":          secret,
+				"batch_no":        batchNo,
+				"claim_code_hash": claimCodeHash,
+			}); err != nil {
+				return nil, errors.NewWithError(errors.ErrDatabase, err)
+			}
+			result.Updated++
+			continue
+		}
+
+		provision := &model.DeviceProvision{
+			SN:            record.SN,
+			DeviceModel:   record.Model,
+			Secret:        secret,
+			BatchNo:       batchNo,
+			Status:        model.ProvisionStatusPending,
+			ClaimCodeHash: claimCodeHash,
+		}
+		if err := s.store.Devices().CreateProvision(provision); err != nil {
+			return nil, errors.NewWithError(errors.ErrDatabase, err)
+		}
+		result.Created++
+	}
+
+	return result, nil
+}
+
+// GetProvision 查询设备出厂预置信息
+func (s *ProvisionService) GetProvision(sn string) (*model.DeviceProvision, error) {
+	provision, err := s.store.Devices().FindProvision(sn)
+	if err != nil {
+		return nil, errors.New(errors.ErrDeviceNotFound, "设备未预置")
+	}
+	return provision, nil
+}
+
+// validateProvisionRecord 校验出厂记录并统一型号名称，返回失败原因
+func validateProvisionRecord(record *ProvisionRecord) string {
+	if err := validator.ValidateDeviceSN(record.SN); err != nil {
+		return err.Error()
+	}
+	if record.Model == "" {
+		return "设备型号不能为空"
+	}
+	printerModel, err := checkDeviceModel(record.SN, record.Model)
+	if err != nil {
+		return err.Error()
+	}
+	record.Model = printerModel.Name
+	if len(record.Secret) < minProvisionSecretLen {
+		return "设备密钥长度不足"
+	}
+	if record.ClaimCode != "" && len(strings.TrimSpace(record.ClaimCode)) < minClaimCodeLen {
+		return "认领码长度不足"
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/utils"
+	"mingda_cloud_service/internal/pkg/validator"
+)
+
+// signManifest 按出厂清单格式签名，签名范围不含signature字段
+func signManifest(t *testing.T, key string, manifest *ProvisionManifest) []byte {
+	unsigned, err := json.Marshal(map[string]interface{}{"batch_no": manifest.BatchNo, "devices": manifest.Devices})
+	assert.NoError(t, err)
+	canonical, err := utils.CanonicalJSON(unsigned)
+	assert.NoError(t, err)
+
+	manifest.Signature = utils.HMACSign(key, canonical)
+	data, err := json.Marshal(manifest)
+	assert.NoError(t, err)
+	return data
+}
+
+func TestProvisionService_ImportManifest(t *testing.T) {
+	// 初始化测试环境，不启动App，与运维子命令相同只设置机型注册表
+	store := setupTestEnv(t)
+	t.Cleanup(func() { validator.SetModelRegistry(nil) })
+
+	provisionService := NewProvisionService(store, "manifest_key", newTestCipher(t))
+	data := signManifest(t, "manifest_key", &ProvisionManifest{
+		BatchNo: "B20240101",
+		Devices: []ProvisionRecord{
+			{SN: "M4D2401A0100001", Model: "md-400d", Secret: "0123456789abcdef", ClaimCode: "CLAIM0001"},
+			{SN: "M4D2401A0100002", Model: "MD-400D", Secret: "short"},
+			{SN: "M9Z2401A0100003", Model: "MD-400D", Secret: "0123456789abcdef"},
+		},
+	})
+
+	manifest, err := provisionService.ParseManifest(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "B20240101", manifest.BatchNo)
+
+	// 签名错误的清单被拒绝
+	tampered := signManifest(t, "other_key", &ProvisionManifest{BatchNo: "B20240101", Devices: manifest.Devices})
+	_, err = provisionService.ParseManifest(tampered)
+	assert.Error(t, err)
+
+	// 未设置机型注册表时不接受任何SN
+	validator.SetModelRegistry(nil)
+	result, err := provisionService.Import(manifest.BatchNo, manifest.Devices)
+	assert.NoError(t, err)
+	assert.Len(t, result.Failed, 3)
+
+	validator.SetModelRegistry(PrinterModelRegistry(store))
+	result, err = provisionService.Import(manifest.BatchNo, manifest.Devices)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Total)
+	assert.Equal(t, 1, result.Created)
+	if assert.Len(t, result.Failed, 2) {
+		assert.Equal(t, "M4D2401A0100002", result.Failed[0].SN)
+		assert.Equal(t, "M9Z2401A0100003", result.Failed[1].SN)
+	}
+
+	// 型号名称统一为登记的机型名称，密钥加密保存
+	provision, err := provisionService.GetProvision("M4D2401A0100001")
+	assert.NoError(t, err)
+	assert.Equal(t, "MD-400D", provision.DeviceModel)
+	assert.Equal(t, model.ProvisionStatusPending, provision.Status)
+	assert.NotEqual(t, "0123456789abcdef", provision.Secret)
+	secret, err := newTestCipher(t).Decrypt(provision.Secret)
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", secret)
+
+	// 未注册的SN重复导入时更新
+	result, err = provisionService.Import(manifest.BatchNo, manifest.Devices[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Updated)
+}
+
+func TestProvisionService_ImportCSVLine(t *testing.T) {
+	store := setupTestEnv(t)
+	validator.SetModelRegistry(PrinterModelRegistry(store))
+	t.Cleanup(func() { validator.SetModelRegistry(nil) })
+
+	provisionService := NewProvisionService(store, "manifest_key", newTestCipher(t))
+	data := "sn,model,secret\n" +
+		"M4D2401A0100001,MD-400D,0123456789abcdef\n" +
+		"\n" +
+		"M4D2401A0100002,MD-400D,short\n"
+	records, err := provisionService.ParseCSV(strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	// 失败记录报告CSV源文件行号，表头和空行都计入
+	result, err := provisionService.Import("B20240101", records)
+	assert.NoError(t, err)
+	if assert.Len(t, result.Failed, 1) {
+		assert.Equal(t, "M4D2401A0100002", result.Failed[0].SN)
+		assert.Equal(t, 4, result.Failed[0].Line)
+	}
+}
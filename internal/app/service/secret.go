@@ -0,0 +1,199 @@
+package service
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+const (
+	// 重新加密时每批处理的记录数
+	reencryptBatchSize = 200
+	// 轮换后旧密钥的默认宽限期
+	defaultSecretGracePeriod = 7 * 24 * time.Hour
+)
+
+// SecretService 设备密钥服务，负责密钥轮换和存储加密
+type SecretService struct {
+	store       repository.Store
+	cipher      *utils.SecretCipher
+	gracePeriod time.Duration
+}
+
+// NewSecretService 创建设备密钥服务实例
+func NewSecretService(store repository.Store, cipher *utils.SecretCipher, authCfg config.AuthConfig) *SecretService {
+	s := &SecretService{
+		store:       store,
+		cipher:      cipher,
+		gracePeriod: time.Duration(authCfg.SecretGracePeriod) * time.Second,
+	}
+	if s.gracePeriod <= 0 {
+		s.gracePeriod = defaultSecretGracePeriod
+	}
+	return s
+}
+
+// SecretRotation 密钥轮换结果
+type SecretRotation struct {
+	EncryptedSecret string    `json:"encrypted_secret"` // 使用当前密钥加密的新密钥
+	Algorithm       string    `json:"algorithm"`        // 加密算法
+	GraceExpireAt   time.Time `json:"grace_expire_at"`  // 旧密钥宽限期截止时间
+}
+
+// RotateSecret 为设备生成新密钥
+// 新密钥使用AES-256-GCM加密下发，加密密钥为设备当前密钥的SHA-256摘要；
+// 宽限期内新旧密钥均可用于签名，设备使用新密钥认证成功后旧密钥立即停用
+func (s *SecretService) RotateSecret(deviceID uint) (*SecretRotation, error) {
+	var delivered string
+	var graceExpireAt time.Time
+	err := s.store.Transaction(func(store repository.Store) error {
+		device, err := store.Devices().FindByIDForUpdate(deviceID)
+		if err != nil {
+			return errors.New(errors.ErrDeviceNotFound, "设备不存在")
+		}
+
+		// 上一次轮换尚未确认时设备仍持有旧密钥，继续保留旧密钥并用它加密下发
+		now := time.Now()
+		confirmed := device.Secret
+		if candidates := device.SecretCandidates(now); len(candidates) > 1 {
+			confirmed = candidates[1]
+		}
+		confirmedSecret, err := s.cipher.Decrypt(confirmed)
+		if err != nil {
+			return errors.NewWithError(errors.ErrDecrypt, err)
+		}
+
+		newSecret := utils.GenerateRandomString(32)
+		storedSecret, err := s.cipher.Encrypt(newSecret)
+		if err != nil {
+			return errors.NewWithError(errors.ErrEncrypt, err)
+		}
+		deliveryKey := sha256.Sum256([]byte(confirmedSecret))
+		delivered, err = utils.AESEncrypt(deliveryKey[:], newSecret)
+		if err != nil {
+			return errors.NewWithError(errors.ErrEncrypt, err)
+		}
+
+		graceExpireAt = now.Add(s.gracePeriod)
+		return store.Devices().Update(device, map[string]interface{}{
+			"secret":                 storedSecret,
+			"prev_secret":            confirmed,
+			"prev_secret_expire_at":  graceExpireAt,
+			"secret_rotate_required": false,
+		})
+	})
+	if err != nil {
+		return nil, txError(err)
+	}
+
+	return &SecretRotation{
+		EncryptedSecret: delivered,
+		Algorithm:       "AES-256-GCM",
+		GraceExpireAt:   graceExpireAt,
+	}, nil
+}
+
+// RequireRotation 要求指定设备轮换密钥
+func (s *SecretService) RequireRotation(sn string) error {
+	affected, err := s.store.Devices().UpdateBySN(sn, map[string]interface{}{"secret_rotate_required": true})
+	if err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if affected == 0 {
+		return errors.New(errors.ErrDeviceNotFound, "设备不存在")
+	}
+	return nil
+}
+
+// RequireRotationByModel 要求指定型号的全部设备轮换密钥，返回受影响的设备数
+func (s *SecretService) RequireRotationByModel(deviceModel string) (int64, error) {
+	affected, err := s.store.Devices().UpdateByModel(deviceModel, map[string]interface{}{"secret_rotate_required": true})
+	if err != nil {
+		return 0, errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return affected, nil
+}
+
+// ReencryptResult 重新加密结果
+type ReencryptResult struct {
+	Devices    int `json:"devices"`    // 重新加密的设备数
+	Provisions int `json:"provisions"` // 重新加密的出厂预置记录数
+}
+
+// ReencryptSecrets 使用当前版本AES密钥重新加密所有明文或旧版本密文的设备密钥
+// 用于AES密钥轮换后，轮换完成前旧版本密钥需保留在previous_aes_keys中
+func (s *SecretService) ReencryptSecrets() (*ReencryptResult, error) {
+	result := &ReencryptResult{}
+
+	devices := s.store.Devices()
+	err := devices.EachBatch(reencryptBatchSize, func(batch []model.Device) error {
+		for i := range batch {
+			updates := map[string]interface{}{}
+			if err := s.reencrypt(updates, "secret", batch[i].Secret); err != nil {
+				return err
+			}
+			// 轮换宽限期内的旧密钥一并重新加密
+			if batch[i].PrevSecret != "" {
+				if err := s.reencrypt(updates, "prev_secret", batch[i].PrevSecret); err != nil {
+					return err
+				}
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			if err := devices.Update(&batch[i], updates); err != nil {
+				return errors.NewWithError(errors.ErrDatabase, err)
+			}
+			result.Devices++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = devices.EachProvisionBatch(reencryptBatchSize, func(batch []model.DeviceProvision) error {
+		for i := range batch {
+			updates := map[string]interface{}{}
+			if err := s.reencrypt(updates, "secret", batch[i].Secret); err != nil {
+				return err
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			if err := devices.UpdateProvision(&batch[i], updates); err != nil {
+				return errors.NewWithError(errors.ErrDatabase, err)
+			}
+			result.Provisions++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// reencrypt 密钥字段需要重新加密时，把新密文按字段名写入updates
+func (s *SecretService) reencrypt(updates map[string]interface{}, column, stored string) error {
+	if !s.cipher.NeedsReencrypt(stored) {
+		return nil
+	}
+
+	secret, err := s.cipher.Decrypt(stored)
+	if err != nil {
+		return errors.NewWithError(errors.ErrDecrypt, err)
+	}
+	encrypted, err := s.cipher.Encrypt(secret)
+	if err != nil {
+		return errors.NewWithError(errors.ErrEncrypt, err)
+	}
+	updates[column] = encrypted
+	return nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/redis"
+)
+
+const (
+	defaultTokenPurgeInterval = time.Hour
+	tokenPurgeBatchSize       = 1000
+)
+
+// Session 设备会话，即一次认证产生的令牌族
+type Session struct {
+	FamilyID string    `json:"family_id"`
+	ClientIP string    `json:"client_ip"` // 最近一次签发令牌时的客户端IP
+	IssuedAt time.Time `json:"issued_at"` // 最近一次签发令牌的时间
+	ExpireAt time.Time `json:"expire_at"` // 刷新令牌过期时间
+}
+
+// SessionService 设备会话管理服务
+type SessionService struct {
+	store repository.Store
+}
+
+// NewSessionService 创建设备会话管理服务实例
+func NewSessionService(store repository.Store) *SessionService {
+	return &SessionService{store: store}
+}
+
+// ListSessions 查询设备当前有效的会话，按签发时间倒序
+func (s *SessionService) ListSessions(sn string) ([]Session, error) {
+	device, err := s.store.Devices().FindBySN(sn)
+	if err != nil {
+		return nil, errors.New(errors.ErrDeviceNotFound, "设备不存在")
+	}
+
+	// 每个令牌族只有一个有效的刷新令牌
+	tokens, err := s.store.Tokens().ListActive(device.ID, model.TokenTypeRefresh)
+	if err != nil {
+		return nil, errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, Session{
+			FamilyID: token.FamilyID,
+			ClientIP: token.ClientIP,
+			IssuedAt: token.CreatedAt,
+			ExpireAt: token.ExpireAt,
+		})
+	}
+	return sessions, nil
+}
+
+// RevokeSession 撤销设备的指定会话，会话内未过期的访问令牌加入黑名单
+func (s *SessionService) RevokeSession(sn, familyID string) error {
+	device, err := s.store.Devices().FindBySN(sn)
+	if err != nil {
+		return errors.New(errors.ErrDeviceNotFound, "设备不存在")
+	}
+
+	count, err := s.store.Tokens().CountFamily(device.ID, familyID)
+	if err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if count == 0 {
+		return errors.New(errors.ErrInvalidParams, "会话不存在")
+	}
+
+	return revokeTokenFamilies(s.store.Tokens(), device.ID, []string{familyID})
+}
+
+// enforceSessionLimit 设备有效会话超过上限时撤销最早签发的会话
+func enforceSessionLimit(tokens repository.TokenRepository, deviceID uint, maxSessions int) error {
+	active, err := tokens.ListActive(deviceID, model.TokenTypeRefresh)
+	if err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+	if len(active) <= maxSessions {
+		return nil
+	}
+
+	families := make([]string, 0, len(active)-maxSessions)
+	for _, token := range active[maxSessions:] {
+		families = append(families, token.FamilyID)
+	}
+	return revokeTokenFamilies(tokens, deviceID, families)
+}
+
+// revokeTokenFamilies 撤销令牌族，数据库只保存令牌摘要，按摘要将未过期的访问令牌加入黑名单
+func revokeTokenFamilies(tokens repository.TokenRepository, deviceID uint, families []string) error {
+	accessTokens, err := tokens.ListActiveInFamilies(deviceID, families, model.TokenTypeAccess)
+	if err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+
+	for _, token := range accessTokens {
+		if err := blacklistTokenHash(token.TokenHash, token.ExpireAt); err != nil {
+			return errors.NewWithError(errors.ErrRedis, err)
+		}
+	}
+
+	if err := tokens.RevokeFamilies(deviceID, families); err != nil {
+		return errors.NewWithError(errors.ErrDatabase, err)
+	}
+	return nil
+}
+
+// TokenPurgeService 过期令牌清理服务，定期删除过期的令牌记录
+type TokenPurgeService struct {
+	store       repository.Store
+	purgeTicker *time.Ticker
+	stopChan    chan struct{}
+	maxTokenTTL time.Duration
+}
+
+// NewTokenPurgeService 创建过期令牌清理服务实例并启动定时清理
+func NewTokenPurgeService(store repository.Store, cfg config.AuthConfig) *TokenPurgeService {
+	interval := time.Duration(cfg.TokenPurgeInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultTokenPurgeInterval
+	}
+	maxTokenTTL := time.Duration(cfg.RefreshTokenTTL) * time.Second
+	if maxTokenTTL <= 0 {
+		maxTokenTTL = defaultRefreshTokenTTL
+	}
+
+	service := &TokenPurgeService{
+		store:       store,
+		purgeTicker: time.NewTicker(interval),
+		stopChan:    make(chan struct{}),
+		maxTokenTTL: maxTokenTTL,
+	}
+
+	// 启动定时清理任务
+	go service.startPurge()
+
+	return service
+}
+
+// startPurge 启动定时清理任务
+func (s *TokenPurgeService) startPurge() {
+	for {
+		select {
+		case <-s.purgeTicker.C:
+			if deleted, err := s.PurgeExpiredTokens(); err != nil {
+				logger.Log.Error("purge expired tokens failed", zap.Error(err))
+			} else if deleted > 0 {
+				logger.Log.Info("purged expired tokens", zap.Int64("deleted", deleted))
+			}
+			if err := s.PurgeBlacklist(); err != nil {
+				logger.Log.Error("purge token blacklist failed", zap.Error(err))
+			}
+		case <-s.stopChan:
+			s.purgeTicker.Stop()
+			return
+		}
+	}
+}
+
+// Stop 停止服务
+func (s *TokenPurgeService) Stop() {
+	close(s.stopChan)
+}
+
+// PurgeExpiredTokens 分批物理删除已过期的令牌记录，返回删除条数
+// 过期的令牌无法通过签名校验，删除后不影响刷新令牌重复使用检测
+func (s *TokenPurgeService) PurgeExpiredTokens() (int64, error) {
+	var deleted int64
+	now := time.Now()
+	for {
+		n, err := s.store.Tokens().DeleteExpired(now, tokenPurgeBatchSize)
+		deleted += n
+		if err != nil || n < tokenPurgeBatchSize {
+			return deleted, err
+		}
+	}
+}
+
+// PurgeBlacklist 清理令牌黑名单
+// 黑名单条目写入时均设置了过期时间，由Redis自动删除；
+// 没有过期时间的历史条目设置为令牌最长有效期后过期，避免永久占用内存
+func (s *TokenPurgeService) PurgeBlacklist() error {
+	ctx := context.Background()
+	iter := redis.Client.Scan(ctx, 0, constants.RedisTokenBlacklistPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		ttl, err := redis.Client.TTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		// -1表示键存在但没有过期时间
+		if ttl == -1 {
+			if err := redis.Client.Expire(ctx, key, s.maxTokenTTL).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return iter.Err()
+}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"mingda_cloud_service/internal/pkg/errors"
+)
+
+// txError 转换事务返回的错误，业务错误原样返回，其余视为数据库错误
+func txError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*errors.Error); ok {
+		return err
+	}
+	return errors.NewWithError(errors.ErrDatabase, err)
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"mingda_cloud_service/internal/app/repository"
+)
+
+// Tenant 数据访问范围，定义见repository.Tenant
+type Tenant = repository.Tenant
+
+// DeviceTenant 设备自身的访问范围
+func DeviceTenant(sn string) Tenant {
+	return Tenant{DeviceSN: sn}
+}
+
+// OrganizationTenant 运维人员的访问范围，orgID为空表示平台运维人员
+func OrganizationTenant(orgID *uint) Tenant {
+	return Tenant{OrganizationID: orgID}
+}
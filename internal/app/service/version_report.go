@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/redis"
+)
+
+// versionReportCacheTTL 版本分布统计结果缓存时间，全量聚合开销较大，统计结果允许有几分钟延迟
+const versionReportCacheTTL = 10 * time.Minute
+
+// versionReportComponents 参与统计的组件
+var versionReportComponents = []string{
+	model.ComponentKlipper,
+	model.ComponentKlipperScreen,
+	model.ComponentMoonraker,
+	model.ComponentMainsail,
+	model.ComponentCrowsnest,
+	model.ComponentMainboardFirmware,
+	model.ComponentPrintheadFirmware,
+	model.ComponentLevelingFirmware,
+}
+
+// VersionReportQuery 版本分布统计条件
+type VersionReportQuery struct {
+	Component    string     `form:"component" json:"component"`         // 组件名称，为空时统计全部组件
+	Model        string     `form:"model" json:"model"`                 // 设备型号
+	Online       *bool      `form:"online" json:"online"`               // 在线状态
+	ReportAfter  *time.Time `form:"report_after" json:"report_after"`   // 最后上报时间下限(RFC3339)
+	ReportBefore *time.Time `form:"report_before" json:"report_before"` // 最后上报时间上限(RFC3339)
+}
+
+// VersionCount 某机型某组件版本的设备数
+type VersionCount struct {
+	Component   string `json:"component"`
+	DeviceModel string `json:"device_model"`
+	Version     string `json:"version"`
+	Count       int64  `json:"count"`
+}
+
+// VersionReport 版本分布统计结果
+type VersionReport struct {
+	GeneratedAt time.Time      `json:"generated_at"` // 统计时间，结果可能来自缓存
+	Items       []VersionCount `json:"items"`        // 按组件、机型、设备数倒序排列
+}
+
+// VersionReportService 软件版本分布统计服务
+type VersionReportService struct {
+	store repository.Store
+}
+
+// NewVersionReportService 创建软件版本分布统计服务实例
+func NewVersionReportService(store repository.Store) *VersionReportService {
+	return &VersionReportService{store: store}
+}
+
+// GetVersionDistribution 按机型统计访问范围内设备各组件版本的设备数，结果按条件缓存
+func (s *VersionReportService) GetVersionDistribution(tenant Tenant, query *VersionReportQuery) (*VersionReport, error) {
+	components := versionReportComponents
+	if query.Component != "" {
+		components = nil
+		for _, component := range versionReportComponents {
+			if component == query.Component {
+				components = append(components, component)
+			}
+		}
+		if len(components) == 0 {
+			return nil, errors.New(errors.ErrInvalidParams, "不支持的组件: "+query.Component)
+		}
+	}
+
+	cacheKey := versionReportCacheKey(tenant, query)
+	if report := loadVersionReport(cacheKey); report != nil {
+		return report, nil
+	}
+
+	filter := repository.VersionDistributionFilter{
+		DeviceModel:  query.Model,
+		Online:       query.Online,
+		ReportAfter:  query.ReportAfter,
+		ReportBefore: query.ReportBefore,
+	}
+	report := &VersionReport{GeneratedAt: time.Now(), Items: []VersionCount{}}
+	for _, component := range components {
+		counts, err := s.store.DeviceInfo().CountVersions(tenant, component, filter)
+		if err != nil {
+			return nil, errors.NewWithError(errors.ErrDatabase, err)
+		}
+		for _, c := range counts {
+			report.Items = append(report.Items, VersionCount{
+				Component:   component,
+				DeviceModel: c.DeviceModel,
+				Version:     c.Version,
+				Count:       c.Count,
+			})
+		}
+	}
+
+	storeVersionReport(cacheKey, report)
+	return report, nil
+}
+
+// WriteVersionReportCSV 导出版本分布统计为CSV，带UTF-8 BOM以便Excel正确识别中文
+func WriteVersionReportCSV(w io.Writer, report *VersionReport) error {
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"组件", "机型", "版本", "设备数"}); err != nil {
+		return err
+	}
+	for _, item := range report.Items {
+		if err := writer.Write([]string{item.Component, item.DeviceModel, item.Version, strconv.FormatInt(item.Count, 10)}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// versionReportCacheKey 按访问范围和统计条件生成缓存键
+func versionReportCacheKey(tenant Tenant, query *VersionReportQuery) string {
+	raw, _ := json.Marshal(struct {
+		OrganizationID *uint               `json:"organization_id"`
+		Query          *VersionReportQuery `json:"query"`
+	}{tenant.OrganizationID, query})
+	sum := sha1.Sum(raw)
+	return constants.RedisVersionReportPrefix + hex.EncodeToString(sum[:])
+}
+
+// loadVersionReport 读取缓存的统计结果，未命中或读取失败时返回nil
+func loadVersionReport(key string) *VersionReport {
+	data, err := redis.Client.Get(context.Background(), key).Bytes()
+	if err != nil {
+		return nil
+	}
+
+	var report VersionReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil
+	}
+	return &report
+}
+
+// storeVersionReport 缓存统计结果，写入失败只记录日志
+func storeVersionReport(key string, report *VersionReport) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	if err := redis.Client.Set(context.Background(), key, data, versionReportCacheTTL).Err(); err != nil {
+		logger.Log.Warn("cache version report failed", zap.Error(err))
+	}
+}
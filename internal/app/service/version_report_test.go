@@ -0,0 +1,62 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+)
+
+func TestVersionReportService_Distribution(t *testing.T) {
+	// 初始化测试环境
+	store := setupTestEnv(t)
+
+	infoService := NewDeviceInfoService(store)
+	report := func(sn, deviceModel, klipper string) {
+		req := &DeviceInfoRequest{}
+		req.DeviceInfo.DeviceSN = sn
+		req.DeviceInfo.DeviceModel = deviceModel
+		req.SoftwareVersions.Klipper = klipper
+		req.SoftwareVersions.KlipperScreen = "0.3.1"
+		req.SoftwareVersions.Firmware.Mainboard = "1.2.0"
+		req.SoftwareVersions.Firmware.Printhead = "1.0.0"
+		assert.NoError(t, infoService.ReportDeviceInfo(req))
+	}
+	report("M4D2401A0100008", "MD-400D", "0.11.0")
+	report("M4D2401A0100009", "MD-400D", "0.12.0")
+	report("M4D2401A0100010", "MD-400D", "0.12.0")
+	report("M6D2401A0100011", "MD-600D", "0.12.0")
+	assert.NoError(t, store.DeviceStatus().MarkOnline("M4D2401A0100009", time.Now()))
+
+	reportService := NewVersionReportService(store)
+	result, err := reportService.GetVersionDistribution(Tenant{}, &VersionReportQuery{Component: model.ComponentKlipper})
+	assert.NoError(t, err)
+	assert.Equal(t, []VersionCount{
+		{Component: model.ComponentKlipper, DeviceModel: "MD-400D", Version: "0.12.0", Count: 2},
+		{Component: model.ComponentKlipper, DeviceModel: "MD-400D", Version: "0.11.0", Count: 1},
+		{Component: model.ComponentKlipper, DeviceModel: "MD-600D", Version: "0.12.0", Count: 1},
+	}, result.Items)
+
+	online := true
+	result, err = reportService.GetVersionDistribution(Tenant{}, &VersionReportQuery{Component: model.ComponentKlipper, Model: "MD-400D", Online: &online})
+	assert.NoError(t, err)
+	assert.Equal(t, []VersionCount{
+		{Component: model.ComponentKlipper, DeviceModel: "MD-400D", Version: "0.12.0", Count: 1},
+	}, result.Items)
+
+	// 相同条件命中缓存，新上报的设备暂不计入
+	report("M4D2401A0100012", "MD-400D", "0.12.0")
+	cached, err := reportService.GetVersionDistribution(Tenant{}, &VersionReportQuery{Component: model.ComponentKlipper, Model: "MD-400D", Online: &online})
+	assert.NoError(t, err)
+	assert.Equal(t, result.Items, cached.Items)
+
+	_, err = reportService.GetVersionDistribution(Tenant{}, &VersionReportQuery{Component: "unknown"})
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteVersionReportCSV(&buf, result))
+	assert.True(t, strings.HasSuffix(buf.String(), "klipper,MD-400D,0.12.0,1\n"))
+}
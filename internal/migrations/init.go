@@ -7,16 +7,73 @@ import (
 
 // AutoMigrate 自动迁移数据库表结构
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		&model.Device{},
 		&model.DeviceToken{},
 		&model.DeviceInfo{},
 		&model.SoftwareVersions{},
+		&model.SoftwareVersionChange{},
 		&model.DeviceStatus{},
 		&model.DeviceOnline{},
+		&model.DeviceNetwork{},
+		&model.DeviceShadow{},
+		&model.DeviceCommand{},
 		&model.DeviceAlarm{},
 		&model.PrintTask{},
 		&model.PrintTaskHistory{},
 		&model.PrintImage{},
-	)
+		&model.DeviceProvision{},
+		&model.AuthAudit{},
+		&model.DeviceStateHistory{},
+		&model.Operator{},
+		&model.Organization{},
+		&model.DeviceOwnershipHistory{},
+		&model.APIKey{},
+		&model.PrinterModel{},
+		&model.OTAPackage{},
+		&model.OTAUpdate{},
+		&model.OTACampaign{},
+	); err != nil {
+		return err
+	}
+
+	if err := seedPrinterModels(db); err != nil {
+		return err
+	}
+
+	return migrateLegacyDeviceTokens(db)
+}
+
+// seedPrinterModels 机型表为空时写入原先内置在SN校验中的机型，硬件参数由运维人员补充
+func seedPrinterModels(db *gorm.DB) error {
+	var count int64
+	if err := db.Unscoped().Model(&model.PrinterModel{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	models := []model.PrinterModel{
+		{Code: "M1P", Name: "MD-1000 PRO", Status: model.PrinterModelStatusEnabled},
+		{Code: "M6P", Name: "MD-600 PRO", Status: model.PrinterModelStatusEnabled},
+		{Code: "M1D", Name: "MD-1000D", Status: model.PrinterModelStatusEnabled},
+		{Code: "M4D", Name: "MD-400D", Status: model.PrinterModelStatusEnabled},
+		{Code: "M6D", Name: "MD-600D", Status: model.PrinterModelStatusEnabled},
+	}
+	return db.Create(&models).Error
+}
+
+// migrateLegacyDeviceTokens 清理旧版本明文保存的令牌记录
+// 旧记录没有摘要无法参与轮换校验，删除后对应令牌到期前仍可作为访问令牌使用
+func migrateLegacyDeviceTokens(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&model.DeviceToken{}, "token") {
+		return nil
+	}
+
+	if err := db.Unscoped().Where("token_hash = ''").Delete(&model.DeviceToken{}).Error; err != nil {
+		return err
+	}
+
+	return db.Migrator().DropColumn(&model.DeviceToken{}, "token")
 } 
\ No newline at end of file
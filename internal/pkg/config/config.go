@@ -3,25 +3,135 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	Redis    RedisConfig    `yaml:"redis"`
-	RabbitMQ RabbitMQConfig `yaml:"rabbitmq"`
-	Log      LogConfig      `yaml:"log"`
-	AI       AIConfig       `yaml:"ai"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Redis     RedisConfig     `yaml:"redis"`
+	RabbitMQ  RabbitMQConfig  `yaml:"rabbitmq"`
+	Log       LogConfig       `yaml:"log"`
+	AI        AIConfig        `yaml:"ai"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Sign      SignConfig      `yaml:"sign"`
+	Crypto    CryptoConfig    `yaml:"crypto"`
+	Provision ProvisionConfig `yaml:"provision"`
+	Operator  OperatorConfig  `yaml:"operator"`
+	Minio     MinioConfig     `yaml:"minio"`
+	OTA       OTAConfig       `yaml:"ota"`
+	Command   CommandConfig   `yaml:"command"`
+	Gateway   GatewayConfig   `yaml:"gateway"`
+	MQTT      MQTTConfig      `yaml:"mqtt"`
 }
 
 type ServerConfig struct {
-	Port      int    `yaml:"port"`
-	Mode      string `yaml:"mode"`
-	JWTSecret string `yaml:"jwt_secret"`
-	AESKey    string `yaml:"aes_key"`
-	BaseURL   string `yaml:"base_url"`
+	Port            int            `yaml:"port"`
+	Mode            string         `yaml:"mode"`
+	JWTSecret       string         `yaml:"jwt_secret"`
+	AESKey          string         `yaml:"aes_key"`
+	AESKeyVersion   int            `yaml:"aes_key_version"`   // 当前AES密钥版本，轮换时递增并将旧密钥移入PreviousAESKeys
+	PreviousAESKeys map[int]string `yaml:"previous_aes_keys"` // 旧版本AES密钥，用于解密历史数据
+	BaseURL         string         `yaml:"base_url"`
+}
+
+// AuthConfig 设备认证配置
+type AuthConfig struct {
+	AccessTokenTTL  int `yaml:"access_token_ttl"`  // 访问令牌有效期(秒)
+	RefreshTokenTTL int `yaml:"refresh_token_ttl"` // 刷新令牌有效期(秒)
+
+	LockoutWindow      int `yaml:"lockout_window"`       // 认证失败计数滑动窗口(秒)
+	SNMaxFailures      int `yaml:"sn_max_failures"`      // 窗口内单个SN允许的认证失败次数
+	IPMaxFailures      int `yaml:"ip_max_failures"`      // 窗口内单个IP允许的认证失败次数
+	LockoutDuration    int `yaml:"lockout_duration"`     // 首次锁定时长(秒)，之后每次锁定时长翻倍
+	LockoutMaxDuration int `yaml:"lockout_max_duration"` // 最长锁定时长(秒)
+
+	SecretGracePeriod int `yaml:"secret_grace_period"` // 密钥轮换后旧密钥的宽限期(秒)
+
+	MaxActiveSessions  int `yaml:"max_active_sessions"`  // 每台设备同时有效的会话(令牌族)数
+	TokenPurgeInterval int `yaml:"token_purge_interval"` // 过期令牌清理间隔(秒)
+}
+
+// SignConfig 请求签名配置
+type SignConfig struct {
+	DeviceMode string `yaml:"device_mode"` // 设备数据接口签名模式：off/optional/required
+	MaxSkew    int    `yaml:"max_skew"`    // 时间戳允许偏差(秒)
+	NonceTTL   int    `yaml:"nonce_ttl"`   // nonce保存时间(秒)，应不小于max_skew的两倍
+}
+
+// CryptoConfig 数据加密配置
+type CryptoConfig struct {
+	ActiveKeyID     string         `yaml:"active_key_id"`    // 当前下发给设备的服务器密钥ID
+	Keys            []RSAKeyConfig `yaml:"keys"`             // 服务器RSA密钥，轮换期间保留旧密钥用于解密
+	EncryptResponse bool           `yaml:"encrypt_response"` // 是否加密响应数据
+}
+
+// RSAKeyConfig 服务器RSA密钥配置
+type RSAKeyConfig struct {
+	ID             string `yaml:"id"`               // 密钥ID
+	PrivateKeyFile string `yaml:"private_key_file"` // PEM格式私钥文件路径
+}
+
+// ProvisionConfig 出厂预置配置
+type ProvisionConfig struct {
+	ManifestKey string `yaml:"manifest_key"` // 出厂清单签名密钥(HMAC-SHA256)，与生产管理系统共享
+}
+
+// OperatorConfig 运维账号配置
+type OperatorConfig struct {
+	JWTSecret string `yaml:"jwt_secret"` // 运维令牌签名密钥，必须与设备令牌密钥不同
+	TokenTTL  int    `yaml:"token_ttl"`  // 运维令牌有效期(秒)
+}
+
+// MinioConfig 对象存储配置，未配置endpoint时不启用对象存储
+type MinioConfig struct {
+	Endpoint  string `yaml:"endpoint"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	UseSSL    bool   `yaml:"use_ssl"`
+	Bucket    string `yaml:"bucket"`
+}
+
+// OTAConfig 固件升级配置
+type OTAConfig struct {
+	SigningKeyID          string `yaml:"signing_key_id"`          // 升级包签名密钥ID，设备按ID选择验签公钥
+	SigningKeyFile        string `yaml:"signing_key_file"`        // 升级包签名私钥(PEM)，应与通信加密密钥分开
+	URLExpiry             int    `yaml:"url_expiry"`              // 下载地址有效期(秒)
+	MaxPackageSize        int64  `yaml:"max_package_size"`        // 升级包大小上限(MB)
+	CampaignCheckInterval int    `yaml:"campaign_check_interval"` // 升级活动检查间隔(秒)
+}
+
+// CommandConfig 设备指令配置
+type CommandConfig struct {
+	DefaultTTL     int `yaml:"default_ttl"`     // 指令默认有效期(秒)
+	MaxTTL         int `yaml:"max_ttl"`         // 指令最长有效期(秒)
+	PollTimeout    int `yaml:"poll_timeout"`    // 长轮询最长等待时间(秒)
+	RedeliverAfter int `yaml:"redeliver_after"` // 下发后未确认时重新下发的间隔(秒)
+	SweepInterval  int `yaml:"sweep_interval"`  // 过期指令检查间隔(秒)
+}
+
+// GatewayConfig 设备长连接网关配置
+type GatewayConfig struct {
+	NodeID            string `yaml:"node_id"`            // 本实例节点ID，为空时使用主机名
+	HeartbeatInterval int    `yaml:"heartbeat_interval"` // 设备心跳间隔(秒)，连接建立后下发给设备
+	HeartbeatTimeout  int    `yaml:"heartbeat_timeout"`  // 超过该时间未收到消息时断开连接并标记离线(秒)
+	MaxMessageSize    int64  `yaml:"max_message_size"`   // 单条消息大小上限(字节)
+}
+
+// MQTTConfig MQTT接入配置，服务端作为客户端连接外部Broker
+type MQTTConfig struct {
+	Enabled     bool   `yaml:"enabled"`      // 是否启用MQTT接入
+	Broker      string `yaml:"broker"`       // Broker地址，如tcp://127.0.0.1:1883
+	ClientID    string `yaml:"client_id"`    // 服务端客户端ID，多实例部署时必须唯一，为空时使用mingda-cloud-节点ID
+	Username    string `yaml:"username"`     // 服务端连接Broker的账号，认证接口中视为超级用户
+	Password    string `yaml:"password"`     // 服务端连接Broker的密码
+	TopicPrefix string `yaml:"topic_prefix"` // 主题前缀，设备主题为{prefix}/{sn}/{type}
+	SharedGroup string `yaml:"shared_group"` // 共享订阅分组，多实例部署时每条消息只由一个实例处理，为空时不使用共享订阅
+	QoS         byte   `yaml:"qos"`          // 订阅和发布的QoS等级
+	PresenceTTL int    `yaml:"presence_ttl"` // 设备MQTT在线记录有效期(秒)，收到设备消息时刷新
+	AuthSecret  string `yaml:"auth_secret"`  // Broker调用认证接口时携带的密钥，启用MQTT接入时必须配置
 }
 
 type AIConfig struct {
@@ -75,5 +185,68 @@ func Load(file string) (*Config, error) {
 		return nil, fmt.Errorf("unmarshal config error: %v", err)
 	}
 
+	// 未配置版本号时默认为1
+	if config.Server.AESKeyVersion == 0 {
+		config.Server.AESKeyVersion = 1
+	}
+	if config.OTA.URLExpiry <= 0 {
+		config.OTA.URLExpiry = 3600
+	}
+	if config.OTA.MaxPackageSize <= 0 {
+		config.OTA.MaxPackageSize = 1024
+	}
+	if config.OTA.CampaignCheckInterval <= 0 {
+		config.OTA.CampaignCheckInterval = 60
+	}
+	if config.Command.DefaultTTL <= 0 {
+		config.Command.DefaultTTL = 300
+	}
+	if config.Command.MaxTTL <= 0 {
+		config.Command.MaxTTL = 86400
+	}
+	if config.Command.PollTimeout <= 0 {
+		config.Command.PollTimeout = 30
+	}
+	if config.Command.RedeliverAfter <= 0 {
+		config.Command.RedeliverAfter = 60
+	}
+	if config.Command.SweepInterval <= 0 {
+		config.Command.SweepInterval = 60
+	}
+	if config.Gateway.NodeID == "" {
+		config.Gateway.NodeID, _ = os.Hostname()
+	}
+	if config.Gateway.HeartbeatInterval <= 0 {
+		config.Gateway.HeartbeatInterval = 30
+	}
+	if config.Gateway.HeartbeatTimeout <= 0 {
+		config.Gateway.HeartbeatTimeout = 90
+	}
+	if config.Gateway.MaxMessageSize <= 0 {
+		config.Gateway.MaxMessageSize = 65536
+	}
+	if config.MQTT.ClientID == "" {
+		config.MQTT.ClientID = "mingda-cloud-" + config.Gateway.NodeID
+	}
+	if config.MQTT.TopicPrefix == "" {
+		config.MQTT.TopicPrefix = "mingda"
+	}
+	if config.MQTT.QoS > 2 {
+		config.MQTT.QoS = 1
+	}
+	if config.MQTT.PresenceTTL <= 0 {
+		config.MQTT.PresenceTTL = 180
+	}
+
 	return &config, nil
 }
+
+// AESKeys 返回全部版本的AES密钥
+func (c *ServerConfig) AESKeys() map[int]string {
+	keys := make(map[int]string, len(c.PreviousAESKeys)+1)
+	for version, key := range c.PreviousAESKeys {
+		keys[version] = key
+	}
+	keys[c.AESKeyVersion] = c.AESKey
+	return keys
+}
@@ -2,5 +2,41 @@ package constants
 
 // 上下文键名常量
 const (
-	ContextDeviceSN = "device_sn" // 设备SN在上下文中的键名
-) 
\ No newline at end of file
+	ContextDeviceSN    = "device_sn"    // 设备SN在上下文中的键名
+	ContextDeviceID    = "device_id"    // 设备ID在上下文中的键名
+	ContextDevice      = "device"       // 设备信息在上下文中的键名
+	ContextTokenClaims = "token_claims" // 令牌声明在上下文中的键名
+	ContextToken       = "token"        // 令牌原文在上下文中的键名
+
+	ContextOperator       = "operator"        // 运维人员信息在上下文中的键名
+	ContextOperatorClaims = "operator_claims" // 运维令牌声明在上下文中的键名
+
+	ContextAPIKey = "api_key" // API密钥信息在上下文中的键名
+)
+
+// Redis键前缀常量
+const (
+	RedisTokenBlacklistPrefix = "token_blacklist:" // 令牌黑名单，后接令牌摘要
+	RedisAuthFailPrefix       = "auth_fail:"       // 认证失败记录(有序集合)，后接维度:值
+	RedisAuthLockPrefix       = "auth_lock:"       // 认证锁定，后接维度:值，值为解锁时间戳
+	RedisAuthStrikePrefix     = "auth_strike:"     // 锁定次数，用于计算递增锁定时长
+	RedisVersionReportPrefix  = "version_report:"  // 版本分布统计缓存，后接统计条件摘要
+	RedisDevicePresencePrefix = "device_presence:" // 设备长连接所在节点，后接设备SN
+	RedisMQTTPresencePrefix   = "mqtt_presence:"   // 设备MQTT在线记录，后接设备SN
+	RedisMQTTSessionPrefix    = "mqtt_session:"    // 设备连接MQTT时使用的访问令牌，后接设备SN，值为签发时间|令牌摘要
+	RedisSignNoncePrefix      = "sign_nonce:"      // 请求签名nonce防重放，后接设备SN:nonce
+)
+
+// Redis发布订阅频道
+const (
+	RedisPrinterModelChannel  = "printer_model:changed"  // 机型变更通知，各实例收到后失效机型缓存
+	RedisDeviceCommandChannel = "device_command:created" // 设备指令下发通知，消息内容为设备SN，唤醒等待中的长轮询请求
+	RedisDeviceKickChannel    = "device:kick"            // 设备停用通知，消息内容为设备SN，持有长连接的实例断开连接
+)
+
+// RabbitMQ交换机和路由键
+const (
+	MQExchangeDeviceEvents  = "mingda.device.events"   // 设备事件交换机(topic)
+	MQRoutingVersionChanged = "device.version.changed" // 设备软件版本变更
+	MQRoutingShadowDelta    = "device.shadow.delta"    // 设备影子期望配置变更，内容为设备需要应用的差异
+)
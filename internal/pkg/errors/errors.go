@@ -49,6 +49,10 @@ const (
 	ErrRabbitMQ        ErrorCode = 3201 // RabbitMQ操作失败
 	ErrRabbitMQTimeout ErrorCode = 3202 // RabbitMQ超时
 	ErrRabbitMQConnect ErrorCode = 3203 // RabbitMQ连接失败
+
+	// 数据加解密相关 (3300-3399)
+	ErrDecrypt ErrorCode = 3301 // 数据解密失败
+	ErrEncrypt ErrorCode = 3302 // 数据加密失败
 )
 
 // Error 自定义错误
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// HeaderAPIKey 携带API密钥的请求头
+const HeaderAPIKey = "X-API-Key"
+
+// 最后使用时间的更新间隔，避免每次请求都写库
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyRequired API密钥认证中间件，用于第三方系统访问开放接口
+// 密钥通过X-API-Key请求头或"Authorization: ApiKey <key>"传递
+func APIKeyRequired(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawKey := c.GetHeader(HeaderAPIKey)
+		if rawKey == "" {
+			parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+			if len(parts) == 2 && parts[0] == "ApiKey" {
+				rawKey = parts[1]
+			}
+		}
+		if rawKey == "" {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "缺少API密钥"))
+			return
+		}
+
+		prefix, ok := parseAPIKeyPrefix(rawKey)
+		if !ok {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "无效的API密钥"))
+			return
+		}
+
+		key, err := store.APIKeys().FindByPrefix(prefix)
+		if err != nil {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "无效的API密钥"))
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(utils.HashToken(rawKey))) != 1 {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "无效的API密钥"))
+			return
+		}
+
+		now := time.Now()
+		if !key.IsUsable(now) {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "API密钥已撤销或已过期"))
+			return
+		}
+
+		clientIP := c.ClientIP()
+		if !ipAllowed(clientIP, key.AllowedIPList()) {
+			c.AbortWithStatusJSON(403, errors.New(errors.ErrUnauthorized, "来源IP不在允许范围内"))
+			return
+		}
+
+		// 记录使用情况，不更新updated_at
+		if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval || key.LastUsedIP != clientIP {
+			store.APIKeys().Touch(key, map[string]interface{}{
+				"last_used_at": now,
+				"last_used_ip": clientIP,
+			})
+		}
+
+		c.Set(constants.ContextAPIKey, *key)
+
+		c.Next()
+	}
+}
+
+// ScopeRequired API密钥授权范围校验中间件，需在APIKeyRequired之后使用
+func ScopeRequired(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get(constants.ContextAPIKey)
+		key, ok := value.(model.APIKey)
+		if !ok {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+			return
+		}
+
+		if !key.HasScope(scope) {
+			c.AbortWithStatusJSON(403, errors.New(errors.ErrUnauthorized, "API密钥未授权该操作"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// parseAPIKeyPrefix 从完整密钥中解析前缀
+func parseAPIKeyPrefix(rawKey string) (string, bool) {
+	if !strings.HasPrefix(rawKey, model.APIKeyPrefix) {
+		return "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(rawKey, model.APIKeyPrefix), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// ipAllowed 判断来源IP是否在允许列表中，列表为空时不限制
+func ipAllowed(clientIP string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
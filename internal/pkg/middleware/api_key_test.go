@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAPIKeyPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		rawKey string
+		prefix string
+		ok     bool
+	}{
+		{"正常密钥", "mdk_ab12cd34_secretpart", "ab12cd34", true},
+		{"密钥部分包含下划线", "mdk_ab12cd34_secret_part", "ab12cd34", true},
+		{"缺少固定前缀", "ab12cd34_secretpart", "", false},
+		{"固定前缀大小写不符", "MDK_ab12cd34_secretpart", "", false},
+		{"只有固定前缀", "mdk_", "", false},
+		{"缺少密钥部分", "mdk_ab12cd34", "", false},
+		{"密钥部分为空", "mdk_ab12cd34_", "", false},
+		{"前缀为空", "mdk__secretpart", "", false},
+		{"空字符串", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, ok := parseAPIKeyPrefix(tt.rawKey)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.prefix, prefix)
+		})
+	}
+}
+
+func TestIPAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientIP string
+		allowed  []string
+		want     bool
+	}{
+		{"未配置允许列表", "203.0.113.7", nil, true},
+		{"单个IP匹配", "203.0.113.7", []string{"203.0.113.7"}, true},
+		{"单个IP不匹配", "203.0.113.8", []string{"203.0.113.7"}, false},
+		{"CIDR网段内", "10.1.2.3", []string{"10.1.0.0/16"}, true},
+		{"CIDR网段边界", "10.1.255.255", []string{"10.1.0.0/16"}, true},
+		{"CIDR网段外", "10.2.0.1", []string{"10.1.0.0/16"}, false},
+		{"多个条目任一匹配", "192.168.1.20", []string{"203.0.113.7", "192.168.1.0/24"}, true},
+		{"无效CIDR条目被跳过", "10.1.2.3", []string{"10.1.0.0/33", "10.1.2.3"}, true},
+		{"无效条目不匹配", "10.1.2.3", []string{"not-an-ip", "10.1.0.0/33"}, false},
+		{"IPv6网段", "2001:db8::1", []string{"2001:db8::/32"}, true},
+		{"IPv4不匹配IPv6网段", "10.1.2.3", []string{"2001:db8::/32"}, false},
+		{"来源IP无法解析", "unknown", []string{"10.1.0.0/16"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ipAllowed(tt.clientIP, tt.allowed))
+		})
+	}
+}
@@ -1,72 +1,105 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"mingda_cloud_service/internal/app/model"
-	"mingda_cloud_service/internal/pkg/database"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/constants"
 	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/logger"
+	"mingda_cloud_service/internal/pkg/redis"
 	"mingda_cloud_service/internal/pkg/utils"
 )
 
-// AuthRequired 认证中间件
-func AuthRequired() gin.HandlerFunc {
+// HeaderSecretRotateRequired 提示设备需要轮换密钥的响应头
+const HeaderSecretRotateRequired = "X-Secret-Rotate-Required"
+
+// lastOnlineInterval 最后在线时间的最小更新间隔
+const lastOnlineInterval = time.Minute
+
+// AuthRequired 认证中间件，拒绝访问时记录认证审计
+func AuthRequired(jwtSecret string, store repository.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		start := time.Now()
+
 		auth := c.GetHeader("Authorization")
 		if auth == "" {
-			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "缺少认证头"))
+			rejectAuth(c, store, start, nil, errors.New(errors.ErrInvalidToken, "缺少认证头"))
 			return
 		}
 
 		parts := strings.SplitN(auth, " ", 2)
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "认证格式错误"))
+			rejectAuth(c, store, start, nil, errors.New(errors.ErrInvalidToken, "认证格式错误"))
 			return
 		}
 
 		// 验证token
-		claims, err := validateToken(parts[1])
+		claims, err := validateToken(parts[1], jwtSecret)
 		if err != nil {
 			if err.Error() == "token has expired" {
-				c.AbortWithStatusJSON(401, errors.New(errors.ErrTokenExpired, "访问令牌已过期"))
+				rejectAuth(c, store, start, nil, errors.New(errors.ErrTokenExpired, "访问令牌已过期"))
 			} else {
-				c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, err.Error()))
+				rejectAuth(c, store, start, nil, errors.New(errors.ErrInvalidToken, err.Error()))
 			}
 			return
 		}
 
+		// 检查令牌是否已注销
+		if isTokenBlacklisted(c.Request.Context(), parts[1]) {
+			rejectAuth(c, store, start, claims, errors.New(errors.ErrInvalidToken, "访问令牌已失效"))
+			return
+		}
+
 		// 验证设备状态
-		var device model.Device
-		if err := database.DB.First(&device, claims.DeviceID).Error; err != nil {
-			c.AbortWithStatusJSON(401, errors.New(errors.ErrDeviceNotFound, "设备不存在"))
+		device, err := store.Devices().FindByID(claims.DeviceID)
+		if err != nil {
+			rejectAuth(c, store, start, claims, errors.New(errors.ErrDeviceNotFound, "设备不存在"))
 			return
 		}
 
 		// 检查设备状态
-		if device.Status != 1 { // 假设1表示正常状态
-			c.AbortWithStatusJSON(401, errors.New(errors.ErrDeviceDisabled, "设备已禁用"))
+		if device.Status != model.DeviceStatusActive {
+			rejectAuth(c, store, start, claims, errors.New(errors.ErrDeviceDisabled, "设备已禁用"))
+			return
+		}
+
+		// 设备令牌被整体撤销后，之前签发的令牌全部失效
+		if repository.TokenRevokedByDevice(store.Tokens(), device, claims.IssuedAt, utils.HashToken(parts[1])) {
+			rejectAuth(c, store, start, claims, errors.New(errors.ErrInvalidToken, "访问令牌已失效"))
 			return
 		}
 
-		// 更新最后在线时间
-		database.DB.Model(&device).Update("last_online", time.Now())
+		// 更新最后在线时间，间隔不足时跳过以免每个请求都写库
+		if time.Since(device.LastOnline) > lastOnlineInterval {
+			if err := store.Devices().Update(device, map[string]interface{}{"last_online": time.Now()}); err != nil {
+				logger.Log.Warn("update device last online failed", zap.String("device_sn", device.SN), zap.Error(err))
+			}
+		}
+
+		// 运维要求轮换密钥时通过响应头提示设备
+		if device.SecretRotateRequired {
+			c.Header(HeaderSecretRotateRequired, "1")
+		}
 
 		// 将设备信息存储到上下文
-		c.Set("device_id", claims.DeviceID)
-		c.Set("device_sn", claims.DeviceSN)
-		c.Set("device", device)
+		c.Set(constants.ContextDeviceID, claims.DeviceID)
+		c.Set(constants.ContextDeviceSN, claims.DeviceSN)
+		c.Set(constants.ContextDevice, *device)
+		c.Set(constants.ContextTokenClaims, claims)
+		c.Set(constants.ContextToken, parts[1])
 
 		c.Next()
 	}
 }
 
-func validateToken(tokenString string) (*utils.Claims, error) {
-	// 从配置获取JWT密钥
-	jwtSecret := "mingda3D250113PrintingCloudService2024" // 建议从配置中获取
-
+func validateToken(tokenString, jwtSecret string) (*utils.Claims, error) {
 	// 解析token
 	claims, err := utils.ParseToken(tokenString, jwtSecret)
 	if err != nil {
@@ -78,5 +111,36 @@ func validateToken(tokenString string) (*utils.Claims, error) {
 		return nil, fmt.Errorf("token has expired")
 	}
 
+	// 刷新令牌只能用于换取新令牌
+	if claims.IsRefresh() {
+		return nil, fmt.Errorf("refresh token cannot be used for access")
+	}
+
 	return claims, nil
 }
+
+// rejectAuth 拒绝访问并记录认证审计，审计写入失败不影响响应
+func rejectAuth(c *gin.Context, store repository.Store, start time.Time, claims *utils.Claims, err *errors.Error) {
+	audit := &model.AuthAudit{
+		Event:      model.AuthEventRejected,
+		ClientIP:   c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Result:     model.AuthResultFailure,
+		ResultCode: int(err.Code),
+		LatencyMs:  time.Since(start).Milliseconds(),
+		Detail:     err.Message,
+	}
+	if claims != nil {
+		audit.DeviceSN = claims.DeviceSN
+		audit.DeviceID = claims.DeviceID
+	}
+	store.AuthAudits().Create(audit)
+
+	c.AbortWithStatusJSON(401, err)
+}
+
+// isTokenBlacklisted 检查令牌是否在黑名单中，Redis不可用时放行
+func isTokenBlacklisted(ctx context.Context, token string) bool {
+	exists, err := redis.Exists(ctx, constants.RedisTokenBlacklistPrefix+utils.HashToken(token))
+	return err == nil && exists
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// EncryptedEnvelope 加密请求数据包
+// key为使用服务器RSA公钥加密的随机AES-256密钥，data为AES-256-GCM密文
+type EncryptedEnvelope struct {
+	KeyID string `json:"kid,omitempty"` // 服务器密钥ID，为空时使用当前密钥
+	Key   string `json:"key"`
+	Data  string `json:"data"`
+	IV    string `json:"iv"`
+	Tag   string `json:"tag"`
+}
+
+// EncryptedResponse 加密响应数据包，使用请求中的AES密钥加密
+type EncryptedResponse struct {
+	Data string `json:"data"`
+	IV   string `json:"iv"`
+	Tag  string `json:"tag"`
+}
+
+// isEnvelope 判断是否为加密数据包
+func (e *EncryptedEnvelope) isEnvelope() bool {
+	return e.Key != "" && e.Data != "" && e.IV != "" && e.Tag != ""
+}
+
+// DecryptEnvelope 加密数据包解密中间件
+// 识别到加密数据包时解密并替换请求体，未加密的请求原样放行，便于按固件版本逐步启用
+func DecryptEnvelope(ring *utils.RSAKeyRing, encryptResponse bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.Contains(c.ContentType(), "json") || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(400, errors.New(errors.ErrInvalidParams, "读取请求体失败"))
+			return
+		}
+
+		var envelope EncryptedEnvelope
+		if err := json.Unmarshal(body, &envelope); err != nil || !envelope.isEnvelope() {
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			c.Next()
+			return
+		}
+
+		if !ring.Enabled() {
+			c.AbortWithStatusJSON(400, errors.New(errors.ErrDecrypt, "服务器未启用数据加密"))
+			return
+		}
+
+		aesKey, plaintext, err := openEnvelope(ring, &envelope)
+		if err != nil {
+			c.AbortWithStatusJSON(400, errors.New(errors.ErrDecrypt, "数据解密失败"))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(plaintext))
+		c.Request.ContentLength = int64(len(plaintext))
+		c.Request.Header.Set("Content-Length", strconv.Itoa(len(plaintext)))
+
+		if !encryptResponse {
+			c.Next()
+			return
+		}
+
+		// 缓存响应内容，处理完成后使用同一AES密钥加密
+		writer := &envelopeWriter{ResponseWriter: c.Writer, buf: &bytes.Buffer{}}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		iv, ciphertext, tag, err := utils.AESGCMEncrypt(aesKey, writer.buf.Bytes())
+		if err != nil {
+			c.JSON(500, errors.New(errors.ErrEncrypt, "数据加密失败"))
+			return
+		}
+
+		c.JSON(writer.Status(), EncryptedResponse{
+			Data: base64.StdEncoding.EncodeToString(ciphertext),
+			IV:   base64.StdEncoding.EncodeToString(iv),
+			Tag:  base64.StdEncoding.EncodeToString(tag),
+		})
+	}
+}
+
+// openEnvelope 解密数据包，返回AES密钥和明文
+func openEnvelope(ring *utils.RSAKeyRing, envelope *EncryptedEnvelope) ([]byte, []byte, error) {
+	key, ok := ring.Key(envelope.KeyID)
+	if !ok {
+		return nil, nil, errors.New(errors.ErrDecrypt, "未知的密钥ID")
+	}
+
+	fields := make([][]byte, 4)
+	for i, value := range []string{envelope.Key, envelope.Data, envelope.IV, envelope.Tag} {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		fields[i] = decoded
+	}
+
+	aesKey, err := utils.RSADecrypt(key, fields[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(aesKey) != 32 {
+		return nil, nil, errors.New(errors.ErrDecrypt, "AES密钥长度错误")
+	}
+
+	plaintext, err := utils.AESGCMDecrypt(aesKey, fields[2], fields[1], fields[3])
+	if err != nil {
+		return nil, nil, err
+	}
+	return aesKey, plaintext, nil
+}
+
+// envelopeWriter 缓存响应内容的ResponseWriter
+type envelopeWriter struct {
+	gin.ResponseWriter
+	buf *bytes.Buffer
+}
+
+func (w *envelopeWriter) Write(data []byte) (int, error) {
+	return w.buf.Write(data)
+}
+
+func (w *envelopeWriter) WriteString(s string) (int, error) {
+	return w.buf.WriteString(s)
+}
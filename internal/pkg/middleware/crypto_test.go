@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// newTestKeyRing 生成密钥k1、k2并以active为当前密钥加载密钥环
+func newTestKeyRing(t *testing.T, active string) (*utils.RSAKeyRing, map[string]*rsa.PublicKey) {
+	cfg := config.CryptoConfig{ActiveKeyID: active}
+	publicKeys := map[string]*rsa.PublicKey{}
+	for _, id := range []string{"k1", "k2"} {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+		path := filepath.Join(t.TempDir(), id+".pem")
+		assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+		cfg.Keys = append(cfg.Keys, config.RSAKeyConfig{ID: id, PrivateKeyFile: path})
+		publicKeys[id] = &key.PublicKey
+	}
+
+	ring, err := utils.LoadRSAKeyRing(cfg)
+	assert.NoError(t, err)
+	return ring, publicKeys
+}
+
+// sealEnvelope 按设备端流程加密请求体：随机AES密钥加密数据，RSA公钥加密AES密钥
+func sealEnvelope(t *testing.T, pub *rsa.PublicKey, kid string, aesKey, plaintext []byte) *EncryptedEnvelope {
+	encryptedKey, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, aesKey, nil)
+	assert.NoError(t, err)
+
+	// AES密钥长度错误时仍用32字节密钥加密数据，只验证密钥长度校验
+	dataKey := aesKey
+	if len(dataKey) != 32 {
+		dataKey = make([]byte, 32)
+	}
+	iv, ciphertext, tag, err := utils.AESGCMEncrypt(dataKey, plaintext)
+	assert.NoError(t, err)
+
+	return &EncryptedEnvelope{
+		KeyID: kid,
+		Key:   base64.StdEncoding.EncodeToString(encryptedKey),
+		Data:  base64.StdEncoding.EncodeToString(ciphertext),
+		IV:    base64.StdEncoding.EncodeToString(iv),
+		Tag:   base64.StdEncoding.EncodeToString(tag),
+	}
+}
+
+func TestDecryptEnvelope(t *testing.T) {
+	ring, publicKeys := newTestKeyRing(t, "k2")
+
+	// 处理器原样返回收到的请求体
+	newRouter := func(ring *utils.RSAKeyRing, encryptResponse bool) *gin.Engine {
+		router := gin.New()
+		router.POST("/device/info", DecryptEnvelope(ring, encryptResponse), func(c *gin.Context) {
+			body, _ := io.ReadAll(c.Request.Body)
+			c.Data(http.StatusOK, "application/json", body)
+		})
+		return router
+	}
+	send := func(router *gin.Engine, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/device/info", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	aesKey := make([]byte, 32)
+	rand.Read(aesKey)
+	plaintext := []byte(`{"device_sn":"M1A2401A0100001"}`)
+
+	t.Run("解密请求并加密响应", func(t *testing.T) {
+		w := send(newRouter(ring, true), sealEnvelope(t, publicKeys["k2"], "k2", aesKey, plaintext))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp EncryptedResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		iv, _ := base64.StdEncoding.DecodeString(resp.IV)
+		data, _ := base64.StdEncoding.DecodeString(resp.Data)
+		tag, _ := base64.StdEncoding.DecodeString(resp.Tag)
+		decrypted, err := utils.AESGCMDecrypt(aesKey, iv, data, tag)
+		assert.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	})
+
+	t.Run("不加密响应", func(t *testing.T) {
+		w := send(newRouter(ring, false), sealEnvelope(t, publicKeys["k2"], "k2", aesKey, plaintext))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, plaintext, w.Body.Bytes())
+	})
+
+	t.Run("未指定密钥ID时使用当前密钥", func(t *testing.T) {
+		w := send(newRouter(ring, false), sealEnvelope(t, publicKeys["k2"], "", aesKey, plaintext))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, plaintext, w.Body.Bytes())
+	})
+
+	t.Run("轮换后旧密钥仍可解密", func(t *testing.T) {
+		w := send(newRouter(ring, false), sealEnvelope(t, publicKeys["k1"], "k1", aesKey, plaintext))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, plaintext, w.Body.Bytes())
+	})
+
+	t.Run("未加密请求原样放行", func(t *testing.T) {
+		w := send(newRouter(ring, true), map[string]string{"device_sn": "M1A2401A0100001"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, string(plaintext), w.Body.String())
+	})
+
+	failures := []struct {
+		name     string
+		envelope func() *EncryptedEnvelope
+	}{
+		{"未知的密钥ID", func() *EncryptedEnvelope {
+			return sealEnvelope(t, publicKeys["k2"], "k9", aesKey, plaintext)
+		}},
+		{"密钥ID与加密公钥不一致", func() *EncryptedEnvelope {
+			return sealEnvelope(t, publicKeys["k1"], "k2", aesKey, plaintext)
+		}},
+		{"认证标签被篡改", func() *EncryptedEnvelope {
+			envelope := sealEnvelope(t, publicKeys["k2"], "k2", aesKey, plaintext)
+			tag, _ := base64.StdEncoding.DecodeString(envelope.Tag)
+			tag[len(tag)-1] ^= 0x01
+			envelope.Tag = base64.StdEncoding.EncodeToString(tag)
+			return envelope
+		}},
+		{"密文被篡改", func() *EncryptedEnvelope {
+			envelope := sealEnvelope(t, publicKeys["k2"], "k2", aesKey, plaintext)
+			data, _ := base64.StdEncoding.DecodeString(envelope.Data)
+			data[0] ^= 0x01
+			envelope.Data = base64.StdEncoding.EncodeToString(data)
+			return envelope
+		}},
+		{"AES密钥长度错误", func() *EncryptedEnvelope {
+			return sealEnvelope(t, publicKeys["k2"], "k2", aesKey[:16], plaintext)
+		}},
+		{"字段不是base64", func() *EncryptedEnvelope {
+			envelope := sealEnvelope(t, publicKeys["k2"], "k2", aesKey, plaintext)
+			envelope.IV = "!!"
+			return envelope
+		}},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(newRouter(ring, true), tt.envelope())
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+
+	t.Run("服务器未启用加密", func(t *testing.T) {
+		emptyRing, err := utils.LoadRSAKeyRing(config.CryptoConfig{})
+		assert.NoError(t, err)
+		w := send(newRouter(emptyRing, true), sealEnvelope(t, publicKeys["k2"], "k2", aesKey, plaintext))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/app/repository"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// OperatorRequired 运维人员认证中间件，校验运维令牌并加载运维账号
+func OperatorRequired(operatorSecret string, store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if operatorSecret == "" {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrUnauthorized, "运维接口未启用"))
+			return
+		}
+
+		auth := c.GetHeader("Authorization")
+		parts := strings.SplitN(auth, " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "认证格式错误"))
+			return
+		}
+
+		claims, err := utils.ParseOperatorToken(parts[1], operatorSecret)
+		if err != nil {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "无效的运维令牌"))
+			return
+		}
+
+		// 检查令牌是否已注销
+		if isTokenBlacklisted(c.Request.Context(), parts[1]) {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "运维令牌已失效"))
+			return
+		}
+
+		operator, err := store.Operators().FindByID(claims.OperatorID)
+		if err != nil {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrUnauthorized, "运维账号不存在"))
+			return
+		}
+		if operator.Status != model.OperatorStatusEnabled {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrUnauthorized, "运维账号已禁用"))
+			return
+		}
+		// 修改密码或角色后，之前签发的令牌全部失效
+		if operator.TokensValidAfter != nil && claims.IssuedAt < operator.TokensValidAfter.Unix() {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidToken, "运维令牌已失效"))
+			return
+		}
+
+		c.Set(constants.ContextOperator, *operator)
+		c.Set(constants.ContextOperatorClaims, claims)
+		c.Set(constants.ContextToken, parts[1])
+
+		c.Next()
+	}
+}
+
+// PermissionRequired 运维权限校验中间件，需在OperatorRequired之后使用
+func PermissionRequired(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get(constants.ContextOperator)
+		operator, ok := value.(model.Operator)
+		if !ok {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+			return
+		}
+
+		if !model.HasPermission(operator.Role, permission) {
+			c.AbortWithStatusJSON(403, errors.New(errors.ErrUnauthorized, "权限不足"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// PlatformRequired 平台运维人员校验中间件，组织运维人员不能访问，需在OperatorRequired之后使用
+func PlatformRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get(constants.ContextOperator)
+		operator, ok := value.(model.Operator)
+		if !ok {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+			return
+		}
+
+		if operator.OrganizationID != nil {
+			c.AbortWithStatusJSON(403, errors.New(errors.ErrUnauthorized, "仅限平台运维人员"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// DeviceAccessRequired 设备归属校验中间件，组织运维人员只能访问本组织的设备，
+// 需在OperatorRequired之后用于包含:sn参数的路由
+func DeviceAccessRequired(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get(constants.ContextOperator)
+		operator, ok := value.(model.Operator)
+		if !ok {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+			return
+		}
+
+		if operator.OrganizationID != nil {
+			tenant := repository.Tenant{OrganizationID: operator.OrganizationID}
+			_, err := store.Devices().FindInScope(tenant, c.Param("sn"))
+			// 不区分设备不存在和无权访问，避免泄露其他组织的设备
+			if err == repository.ErrNotFound {
+				c.AbortWithStatusJSON(404, errors.New(errors.ErrDeviceNotFound, "设备不存在"))
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(500, errors.NewWithError(errors.ErrDatabase, err))
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
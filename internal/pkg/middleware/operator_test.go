@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/constants"
+)
+
+// serveAsOperator 以指定运维账号经过guard访问测试路由，返回状态码
+func serveAsOperator(operator *model.Operator, guard gin.HandlerFunc) int {
+	router := gin.New()
+	router.GET("/admin/test", func(c *gin.Context) {
+		if operator != nil {
+			c.Set(constants.ContextOperator, *operator)
+		}
+	}, guard, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/test", nil))
+	return w.Code
+}
+
+func TestPermissionRequired(t *testing.T) {
+	permissions := []string{
+		model.PermDeviceRead, model.PermDeviceWrite,
+		model.PermAlarmRead, model.PermAlarmWrite,
+		model.PermAuthRead, model.PermAuthWrite,
+		model.PermProvisionRead, model.PermProvisionWrite,
+		model.PermOperatorManage, model.PermOrgManage,
+		model.PermAPIKeyManage, model.PermModelManage, model.PermOTAManage,
+	}
+
+	// 每个角色拥有的权限，管理员拥有全部权限
+	granted := map[string]map[string]bool{
+		model.RoleSupport: {
+			model.PermDeviceRead: true, model.PermDeviceWrite: true,
+			model.PermAlarmRead: true, model.PermAlarmWrite: true,
+			model.PermAuthRead: true, model.PermAuthWrite: true,
+			model.PermProvisionRead: true,
+		},
+		model.RoleViewer: {
+			model.PermDeviceRead: true, model.PermAlarmRead: true,
+			model.PermAuthRead: true, model.PermProvisionRead: true,
+		},
+		"unknown": {},
+	}
+
+	for _, role := range []string{model.RoleAdmin, model.RoleSupport, model.RoleViewer, "unknown"} {
+		for _, permission := range permissions {
+			want := role == model.RoleAdmin || granted[role][permission]
+			t.Run(role+"/"+permission, func(t *testing.T) {
+				assert.Equal(t, want, model.HasPermission(role, permission))
+
+				code := serveAsOperator(&model.Operator{Role: role}, PermissionRequired(permission))
+				if want {
+					assert.Equal(t, http.StatusOK, code)
+				} else {
+					assert.Equal(t, http.StatusForbidden, code)
+				}
+			})
+		}
+	}
+
+	assert.True(t, model.IsValidRole(model.RoleViewer))
+	assert.False(t, model.IsValidRole("unknown"))
+
+	// 未经过运维认证
+	assert.Equal(t, http.StatusUnauthorized, serveAsOperator(nil, PermissionRequired(model.PermDeviceRead)))
+}
+
+func TestPlatformRequired(t *testing.T) {
+	orgID := uint(1)
+
+	// 平台运维人员不属于任何组织
+	assert.Equal(t, http.StatusOK, serveAsOperator(&model.Operator{Role: model.RoleAdmin}, PlatformRequired()))
+
+	// 组织管理员拥有全部权限，但不能访问平台接口
+	orgAdmin := &model.Operator{Role: model.RoleAdmin, OrganizationID: &orgID}
+	assert.Equal(t, http.StatusOK, serveAsOperator(orgAdmin, PermissionRequired(model.PermOrgManage)))
+	assert.Equal(t, http.StatusForbidden, serveAsOperator(orgAdmin, PlatformRequired()))
+
+	assert.Equal(t, http.StatusUnauthorized, serveAsOperator(nil, PlatformRequired()))
+}
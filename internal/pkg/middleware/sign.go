@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/errors"
+	"mingda_cloud_service/internal/pkg/redis"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+// 签名模式
+const (
+	SignModeOff      = "off"      // 不校验签名
+	SignModeOptional = "optional" // 仅校验携带签名头的请求，便于按固件版本逐步启用
+	SignModeRequired = "required" // 所有请求必须携带签名
+)
+
+// 签名请求头
+const (
+	HeaderTimestamp = "X-Timestamp" // 请求时间戳(毫秒)
+	HeaderNonce     = "X-Nonce"     // 请求随机串
+	HeaderSign      = "X-Sign"      // 请求签名
+)
+
+// SignOptions 签名校验选项
+type SignOptions struct {
+	Mode     string              // 签名模式
+	MaxSkew  time.Duration       // 时间戳允许偏差
+	NonceTTL time.Duration       // nonce保存时间
+	Cipher   *utils.SecretCipher // 设备密钥解密器
+}
+
+// SignRequired 请求签名校验中间件，需在AuthRequired之后使用
+// 签名算法: HMAC-SHA256(timestamp + nonce + deviceSN + canonicalBody, DEVICE_SECRET)
+// JSON请求体按键名排序规范化，其他非空请求体取SHA-256十六进制摘要，空请求体为空串
+func SignRequired(opts SignOptions) gin.HandlerFunc {
+	if opts.MaxSkew <= 0 {
+		opts.MaxSkew = 5 * time.Minute
+	}
+	if opts.NonceTTL < 2*opts.MaxSkew {
+		opts.NonceTTL = 2 * opts.MaxSkew
+	}
+
+	return func(c *gin.Context) {
+		if opts.Mode == "" || opts.Mode == SignModeOff {
+			c.Next()
+			return
+		}
+
+		timestamp := c.GetHeader(HeaderTimestamp)
+		nonce := c.GetHeader(HeaderNonce)
+		sign := c.GetHeader(HeaderSign)
+
+		// 可选模式下未携带签名的请求直接放行
+		if opts.Mode == SignModeOptional && timestamp == "" && nonce == "" && sign == "" {
+			c.Next()
+			return
+		}
+
+		if timestamp == "" || nonce == "" || sign == "" {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidSign, "缺少签名参数"))
+			return
+		}
+		if len(nonce) > 64 {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidSign, "无效的nonce"))
+			return
+		}
+
+		// 检查时间戳
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidSign, "无效的时间戳"))
+			return
+		}
+		skew := time.Since(time.UnixMilli(ts))
+		if skew > opts.MaxSkew || skew < -opts.MaxSkew {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidSign, "请求已过期"))
+			return
+		}
+
+		value, exists := c.Get(constants.ContextDevice)
+		device, ok := value.(model.Device)
+		if !exists || !ok {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrUnauthorized, "未授权的访问"))
+			return
+		}
+
+		// 读取请求体并放回，供后续处理器绑定
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(400, errors.New(errors.ErrInvalidParams, "读取请求体失败"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		canonical, err := canonicalBody(c.ContentType(), body)
+		if err != nil {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidSign, "请求体格式错误"))
+			return
+		}
+
+		// 验证签名，密钥轮换宽限期内旧密钥同样有效
+		matched, err := opts.Cipher.Match(device.SecretCandidates(time.Now()), func(secret string) bool {
+			return utils.ValidateRequestSign(secret, timestamp, nonce, device.SN, canonical, sign)
+		})
+		if err != nil {
+			c.AbortWithStatusJSON(500, errors.NewWithError(errors.ErrDecrypt, err))
+			return
+		}
+		if matched < 0 {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidSign, "签名验证失败"))
+			return
+		}
+
+		// 签名通过后再记录nonce，防止伪造请求占用nonce
+		stored, err := redis.Client.SetNX(c.Request.Context(), constants.RedisSignNoncePrefix+device.SN+":"+nonce, 1, opts.NonceTTL).Result()
+		if err != nil {
+			c.AbortWithStatusJSON(503, errors.New(errors.ErrServiceBusy, "服务繁忙"))
+			return
+		}
+		if !stored {
+			c.AbortWithStatusJSON(401, errors.New(errors.ErrInvalidSign, "重复的请求"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// canonicalBody 计算参与签名的请求体
+func canonicalBody(contentType string, body []byte) (string, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return "", nil
+	}
+
+	if strings.Contains(contentType, "json") {
+		return utils.CanonicalJSON(body)
+	}
+
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/app/model"
+	"mingda_cloud_service/internal/pkg/constants"
+	"mingda_cloud_service/internal/pkg/redis"
+	"mingda_cloud_service/internal/pkg/utils"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// setupTestRedis 使用内存Redis，测试结束后自动关闭
+func setupTestRedis(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	redis.Client = goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	return mr
+}
+
+// signedRequest 测试请求，字段为空时不设置对应的签名头
+type signedRequest struct {
+	timestamp string
+	nonce     string
+	sign      string
+	body      string
+}
+
+func TestSignRequired(t *testing.T) {
+	setupTestRedis(t)
+
+	cipher, err := utils.NewSecretCipher(1, map[int]string{1: "test_aes_key"})
+	assert.NoError(t, err)
+	encrypted, err := cipher.Encrypt("device_secret")
+	assert.NoError(t, err)
+	device := model.Device{SN: "M1A2401A0100001", Secret: encrypted, Status: model.DeviceStatusActive}
+
+	newRouter := func(mode string) *gin.Engine {
+		router := gin.New()
+		router.POST("/device/status", func(c *gin.Context) {
+			c.Set(constants.ContextDevice, device)
+		}, SignRequired(SignOptions{Mode: mode, MaxSkew: time.Minute, Cipher: cipher}), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		return router
+	}
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	body := `{"cpu_usage":1.5,"storage":{"used":1,"total":2}}`
+	canonical, _ := utils.CanonicalJSON([]byte(body))
+	validSign := utils.GenerateRequestSign("device_secret", now, "nonce-ok", device.SN, canonical)
+
+	send := func(router *gin.Engine, req *signedRequest) int {
+		httpReq := httptest.NewRequest(http.MethodPost, "/device/status", strings.NewReader(req.body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		if req.timestamp != "" {
+			httpReq.Header.Set(HeaderTimestamp, req.timestamp)
+		}
+		if req.nonce != "" {
+			httpReq.Header.Set(HeaderNonce, req.nonce)
+		}
+		if req.sign != "" {
+			httpReq.Header.Set(HeaderSign, req.sign)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httpReq)
+		return w.Code
+	}
+	signWith := func(timestamp, nonce, reqBody string) *signedRequest {
+		canonical, _ := utils.CanonicalJSON([]byte(reqBody))
+		return &signedRequest{
+			timestamp: timestamp,
+			nonce:     nonce,
+			sign:      utils.GenerateRequestSign("device_secret", timestamp, nonce, device.SN, canonical),
+			body:      reqBody,
+		}
+	}
+	skewed := func(d time.Duration) string {
+		return strconv.FormatInt(time.Now().Add(d).UnixMilli(), 10)
+	}
+
+	tests := []struct {
+		name string
+		mode string
+		req  *signedRequest
+		want int
+	}{
+		{"关闭模式不校验", SignModeOff, &signedRequest{body: body}, http.StatusOK},
+		{"关闭模式忽略错误签名", SignModeOff, &signedRequest{timestamp: now, nonce: "n", sign: "bad", body: body}, http.StatusOK},
+		{"可选模式放行未签名请求", SignModeOptional, &signedRequest{body: body}, http.StatusOK},
+		{"可选模式校验携带的签名", SignModeOptional, &signedRequest{timestamp: now, nonce: "n-opt", sign: "bad", body: body}, http.StatusUnauthorized},
+		{"可选模式签名正确", SignModeOptional, signWith(now, "nonce-optional", body), http.StatusOK},
+		{"必须模式拒绝未签名请求", SignModeRequired, &signedRequest{body: body}, http.StatusUnauthorized},
+		{"必须模式缺少部分签名头", SignModeRequired, &signedRequest{timestamp: now, sign: validSign, body: body}, http.StatusUnauthorized},
+		{"签名正确", SignModeRequired, &signedRequest{timestamp: now, nonce: "nonce-ok", sign: validSign, body: body}, http.StatusOK},
+		{"键顺序不同的等价请求体", SignModeRequired, &signedRequest{timestamp: now, nonce: "nonce-reorder", body: `{"storage":{"total":2,"used":1},"cpu_usage":1.5}`,
+			sign: utils.GenerateRequestSign("device_secret", now, "nonce-reorder", device.SN, canonical)}, http.StatusOK},
+		{"错误的签名", SignModeRequired, &signedRequest{timestamp: now, nonce: "nonce-bad", sign: validSign, body: body}, http.StatusUnauthorized},
+		{"请求体被篡改", SignModeRequired, &signedRequest{timestamp: now, nonce: "nonce-ok2", body: `{"cpu_usage":99}`,
+			sign: utils.GenerateRequestSign("device_secret", now, "nonce-ok2", device.SN, canonical)}, http.StatusUnauthorized},
+		{"使用其他密钥签名", SignModeRequired, &signedRequest{timestamp: now, nonce: "nonce-key", body: body,
+			sign: utils.GenerateRequestSign("other_secret", now, "nonce-key", device.SN, canonical)}, http.StatusUnauthorized},
+		{"时间戳超前超过允许偏差", SignModeRequired, signWith(skewed(2*time.Minute), "nonce-future", body), http.StatusUnauthorized},
+		{"时间戳落后超过允许偏差", SignModeRequired, signWith(skewed(-2*time.Minute), "nonce-past", body), http.StatusUnauthorized},
+		{"时间戳在允许偏差内", SignModeRequired, signWith(skewed(-30*time.Second), "nonce-skew", body), http.StatusOK},
+		{"时间戳格式错误", SignModeRequired, signWith("abc", "nonce-ts", body), http.StatusUnauthorized},
+		{"nonce过长", SignModeRequired, signWith(now, strings.Repeat("n", 65), body), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, send(newRouter(tt.mode), tt.req))
+		})
+	}
+
+	t.Run("nonce重放", func(t *testing.T) {
+		router := newRouter(SignModeRequired)
+		req := signWith(now, "nonce-replay", body)
+		assert.Equal(t, http.StatusOK, send(router, req))
+		assert.Equal(t, http.StatusUnauthorized, send(router, req))
+
+		// 签名错误的请求不占用nonce
+		bad := signWith(now, "nonce-reserved", body)
+		good := *bad
+		bad.sign = "bad"
+		assert.Equal(t, http.StatusUnauthorized, send(router, bad))
+		assert.Equal(t, http.StatusOK, send(router, &good))
+	})
+
+	t.Run("Redis不可用", func(t *testing.T) {
+		mr := setupTestRedis(t)
+		mr.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, send(newRouter(SignModeRequired), signWith(now, "nonce-redis", body)))
+	})
+}
@@ -1,15 +1,22 @@
 package rabbitmq
 
 import (
+	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 	"mingda_cloud_service/internal/pkg/config"
+	"mingda_cloud_service/internal/pkg/constants"
 )
 
 var Conn *amqp.Connection
 var Channel *amqp.Channel
 
+// publishMu Channel不支持并发发布，发布消息时串行化
+var publishMu sync.Mutex
+
 // Init 初始化RabbitMQ连接
 func Init(cfg config.RabbitMQConfig) error {
 	var err error
@@ -33,9 +40,44 @@ func Init(cfg config.RabbitMQConfig) error {
 		return fmt.Errorf("create channel failed: %v", err)
 	}
 
+	// 声明设备事件交换机，下游服务按路由键绑定队列
+	if err := Channel.ExchangeDeclare(
+		constants.MQExchangeDeviceEvents,
+		amqp.ExchangeTopic,
+		true,  // durable
+		false, // auto-deleted
+		false, // internal
+		false, // no-wait
+		nil,   // arguments
+	); err != nil {
+		return fmt.Errorf("declare exchange failed: %v", err)
+	}
+
 	return nil
 }
 
+// PublishJSON 将消息序列化为JSON后持久化发布到指定交换机
+func PublishJSON(exchange, routingKey string, message interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("marshal message failed: %v", err)
+	}
+
+	publishMu.Lock()
+	defer publishMu.Unlock()
+
+	if Channel == nil {
+		return fmt.Errorf("rabbitmq not connected")
+	}
+
+	return Channel.Publish(exchange, routingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    time.Now(),
+		Body:         body,
+	})
+}
+
 // Close 关闭连接
 func Close() {
 	if Channel != nil {
@@ -68,4 +110,4 @@ func IsConnected() bool {
 	)
 
 	return err == nil
-} 
\ No newline at end of file
+}
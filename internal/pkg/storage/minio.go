@@ -1,14 +1,77 @@
 package storage
 
 import (
-    "mingda_cloud_service/internal/pkg/config"
-    "github.com/minio/minio-go/v7"
-    "github.com/minio/minio-go/v7/pkg/credentials"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"mingda_cloud_service/internal/pkg/config"
 )
 
+// ObjectStorage 对象存储
+type ObjectStorage interface {
+	// PutObject 上传对象，size未知时传-1
+	PutObject(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error
+	// PresignedGetURL 生成限时有效的下载地址
+	PresignedGetURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	RemoveObject(ctx context.Context, key string) error
+}
+
 func NewMinioClient(cfg *config.MinioConfig) (*minio.Client, error) {
-    return minio.New(cfg.Endpoint, &minio.Options{
-        Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
-        Secure: cfg.UseSSL,
-    })
+	return minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+	})
+}
+
+// MinioStorage 基于MinIO(S3兼容)的对象存储
+type MinioStorage struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewMinioStorage 创建MinIO对象存储，存储桶不存在时自动创建
+func NewMinioStorage(cfg *config.MinioConfig) (*MinioStorage, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("minio bucket not configured")
+	}
+
+	client, err := NewMinioClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create minio client failed: %v", err)
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check bucket failed: %v", err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{}); err != nil {
+			return nil, fmt.Errorf("create bucket failed: %v", err)
+		}
+	}
+
+	return &MinioStorage{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *MinioStorage) PutObject(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, reader, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *MinioStorage) PresignedGetURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, url.Values{})
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *MinioStorage) RemoveObject(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
 }
@@ -10,20 +10,31 @@ import (
 
 // Claims 自定义JWT声明
 type Claims struct {
-	DeviceID uint   `json:"device_id"`
-	DeviceSN string `json:"device_sn"`
+	DeviceID  uint   `json:"device_id"`
+	DeviceSN  string `json:"device_sn"`
+	TokenType string `json:"type,omitempty"` // 令牌类型：access/refresh，旧令牌为空视为access
+	FamilyID  string `json:"fid,omitempty"`  // 令牌族ID
 	jwt.StandardClaims
 }
 
+// IsRefresh 是否为刷新令牌
+func (c *Claims) IsRefresh() bool {
+	return c.TokenType == model.TokenTypeRefresh
+}
+
 // GenerateToken 生成JWT token
-func GenerateToken(device *model.Device, secret string, expireDuration time.Duration) (string, error) {
+func GenerateToken(device *model.Device, secret, tokenType, familyID string, expireDuration time.Duration) (string, error) {
 	// 设置claims
+	now := time.Now()
 	claims := Claims{
-		DeviceID: device.ID,
-		DeviceSN: device.SN,
+		DeviceID:  device.ID,
+		DeviceSN:  device.SN,
+		TokenType: tokenType,
+		FamilyID:  familyID,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(expireDuration).Unix(),
-			IssuedAt:  time.Now().Unix(),
+			Id:        GenerateRandomString(16), // 保证同一秒内签发的令牌也互不相同
+			ExpiresAt: now.Add(expireDuration).Unix(),
+			IssuedAt:  now.Unix(),
 			Issuer:    "mingda-cloud",
 		},
 	}
@@ -46,9 +57,10 @@ func ParseToken(tokenString string, secret string) (*Claims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	// 运维令牌不能作为设备令牌使用
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.Audience != OperatorAudience {
 		return claims, nil
 	}
 
 	return nil, fmt.Errorf("invalid token")
-} 
\ No newline at end of file
+}
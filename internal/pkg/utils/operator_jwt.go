@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"mingda_cloud_service/internal/app/model"
+)
+
+// OperatorAudience 运维令牌的受众，设备令牌解析时拒绝该受众
+const OperatorAudience = "operator"
+
+// OperatorClaims 运维人员JWT声明，与设备令牌的Claims相互独立
+type OperatorClaims struct {
+	OperatorID uint   `json:"operator_id"`
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	jwt.StandardClaims
+}
+
+// GenerateOperatorToken 生成运维令牌
+func GenerateOperatorToken(operator *model.Operator, secret string, expireDuration time.Duration) (string, error) {
+	now := time.Now()
+	claims := OperatorClaims{
+		OperatorID: operator.ID,
+		Username:   operator.Username,
+		Role:       operator.Role,
+		StandardClaims: jwt.StandardClaims{
+			Id:        GenerateRandomString(16),
+			Audience:  OperatorAudience,
+			ExpiresAt: now.Add(expireDuration).Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    "mingda-cloud",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// ParseOperatorToken 解析运维令牌
+func ParseOperatorToken(tokenString, secret string) (*OperatorClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &OperatorClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*OperatorClaims)
+	if !ok || !token.Valid || !claims.VerifyAudience(OperatorAudience, true) || claims.OperatorID == 0 {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+
+	"mingda_cloud_service/internal/pkg/config"
+)
+
+// RSAKeyRing 服务器RSA密钥环，按密钥ID管理多把密钥以支持轮换
+type RSAKeyRing struct {
+	activeID string
+	keys     map[string]*rsa.PrivateKey
+}
+
+// LoadRSAKeyRing 从配置加载密钥环，未配置密钥时返回空密钥环
+func LoadRSAKeyRing(cfg config.CryptoConfig) (*RSAKeyRing, error) {
+	ring := &RSAKeyRing{
+		activeID: cfg.ActiveKeyID,
+		keys:     make(map[string]*rsa.PrivateKey),
+	}
+
+	for _, keyCfg := range cfg.Keys {
+		key, err := LoadRSAPrivateKey(keyCfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load rsa key %s error: %v", keyCfg.ID, err)
+		}
+		ring.keys[keyCfg.ID] = key
+	}
+
+	if len(ring.keys) > 0 {
+		if _, ok := ring.keys[ring.activeID]; !ok {
+			return nil, fmt.Errorf("active rsa key %q not configured", ring.activeID)
+		}
+	}
+
+	return ring, nil
+}
+
+// Enabled 是否配置了密钥
+func (r *RSAKeyRing) Enabled() bool {
+	return r != nil && len(r.keys) > 0
+}
+
+// ActiveID 当前密钥ID
+func (r *RSAKeyRing) ActiveID() string {
+	return r.activeID
+}
+
+// Key 根据密钥ID获取私钥，ID为空时返回当前密钥
+func (r *RSAKeyRing) Key(id string) (*rsa.PrivateKey, bool) {
+	if id == "" {
+		id = r.activeID
+	}
+	key, ok := r.keys[id]
+	return key, ok
+}
+
+// PublicKeyPEM 导出指定密钥的公钥(PKIX PEM格式)
+func (r *RSAKeyRing) PublicKeyPEM(id string) (string, error) {
+	key, ok := r.Key(id)
+	if !ok {
+		return "", fmt.Errorf("rsa key %q not found", id)
+	}
+	return EncodePublicKeyPEM(&key.PublicKey)
+}
+
+// EncodePublicKeyPEM 将公钥编码为PKIX PEM格式
+func EncodePublicKeyPEM(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// LoadRSAPrivateKey 读取PEM格式RSA私钥，支持PKCS#1和PKCS#8
+func LoadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid pem data")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not a rsa private key")
+	}
+	return key, nil
+}
+
+// RSADecrypt 使用RSA-OAEP(SHA-1)解密，与Node.js crypto.publicEncrypt默认填充一致
+func RSADecrypt(key *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	return rsa.DecryptOAEP(sha1.New(), rand.Reader, key, ciphertext, nil)
+}
+
+// RSASignSHA256 对SHA-256摘要做RSA PKCS#1 v1.5签名，与openssl dgst -sha256 -sign结果一致
+func RSASignSHA256(key *rsa.PrivateKey, digest []byte) ([]byte, error) {
+	return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+}
+
+// AESGCMDecrypt 使用AES-GCM解密，认证标签单独传入
+func AESGCMDecrypt(key, iv, ciphertext, tag []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, len(ciphertext)+len(tag))
+	sealed = append(sealed, ciphertext...)
+	sealed = append(sealed, tag...)
+	return gcm.Open(nil, iv, sealed, nil)
+}
+
+// AESGCMEncrypt 使用AES-GCM加密，返回随机IV、密文和认证标签
+func AESGCMEncrypt(key, plaintext []byte) (iv, ciphertext, tag []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	iv = make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, nil, nil, err
+	}
+
+	sealed := gcm.Seal(nil, iv, plaintext, nil)
+	tagStart := len(sealed) - gcm.Overhead()
+	return iv, sealed[:tagStart], sealed[tagStart:], nil
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mingda_cloud_service/internal/pkg/config"
+)
+
+// writeTestRSAKey 生成RSA私钥并写入临时PEM文件，pkcs8为false时使用PKCS#1格式
+func writeTestRSAKey(t *testing.T, name string, pkcs8 bool) (string, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if pkcs8 {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		assert.NoError(t, err)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	path := filepath.Join(t.TempDir(), name+".pem")
+	assert.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	return path, key
+}
+
+func TestRSAKeyRing(t *testing.T) {
+	oldFile, oldKey := writeTestRSAKey(t, "k1", false)
+	newFile, newKey := writeTestRSAKey(t, "k2", true)
+
+	// 未配置密钥时为空密钥环
+	ring, err := LoadRSAKeyRing(config.CryptoConfig{})
+	assert.NoError(t, err)
+	assert.False(t, ring.Enabled())
+
+	// 当前密钥必须已配置
+	_, err = LoadRSAKeyRing(config.CryptoConfig{ActiveKeyID: "k3", Keys: []config.RSAKeyConfig{{ID: "k1", PrivateKeyFile: oldFile}}})
+	assert.Error(t, err)
+	_, err = LoadRSAKeyRing(config.CryptoConfig{ActiveKeyID: "k1", Keys: []config.RSAKeyConfig{{ID: "k1", PrivateKeyFile: filepath.Join(t.TempDir(), "missing.pem")}}})
+	assert.Error(t, err)
+
+	// 轮换后旧密钥仍可按ID取得，ID为空时使用当前密钥
+	ring, err = LoadRSAKeyRing(config.CryptoConfig{ActiveKeyID: "k2", Keys: []config.RSAKeyConfig{
+		{ID: "k1", PrivateKeyFile: oldFile},
+		{ID: "k2", PrivateKeyFile: newFile},
+	}})
+	assert.NoError(t, err)
+	assert.True(t, ring.Enabled())
+	assert.Equal(t, "k2", ring.ActiveID())
+
+	key, ok := ring.Key("")
+	assert.True(t, ok)
+	assert.True(t, key.Equal(newKey))
+	key, ok = ring.Key("k1")
+	assert.True(t, ok)
+	assert.True(t, key.Equal(oldKey))
+	_, ok = ring.Key("unknown")
+	assert.False(t, ok)
+
+	pemText, err := ring.PublicKeyPEM("k1")
+	assert.NoError(t, err)
+	block, _ := pem.Decode([]byte(pemText))
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	assert.NoError(t, err)
+	assert.True(t, oldKey.PublicKey.Equal(pub))
+	_, err = ring.PublicKeyPEM("unknown")
+	assert.Error(t, err)
+
+	// 使用公钥OAEP(SHA-1)加密的数据可以解密
+	encrypted, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, &oldKey.PublicKey, []byte("aes-key"), nil)
+	assert.NoError(t, err)
+	plain, err := RSADecrypt(oldKey, encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "aes-key", string(plain))
+	_, err = RSADecrypt(newKey, encrypted)
+	assert.Error(t, err)
+}
+
+func TestAESGCM(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	iv, ciphertext, tag, err := AESGCMEncrypt(key, []byte(`{"a":1}`))
+	assert.NoError(t, err)
+	assert.Len(t, tag, 16)
+
+	plain, err := AESGCMDecrypt(key, iv, ciphertext, tag)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(plain))
+
+	// 认证标签或密文被篡改时解密失败
+	tampered := append([]byte{}, tag...)
+	tampered[0] ^= 0xff
+	_, err = AESGCMDecrypt(key, iv, ciphertext, tampered)
+	assert.Error(t, err)
+	modified := append([]byte{}, ciphertext...)
+	modified[0] ^= 0xff
+	_, err = AESGCMDecrypt(key, iv, modified, tag)
+	assert.Error(t, err)
+
+	// 密钥长度错误
+	_, _, _, err = AESGCMEncrypt(key[:10], []byte("x"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// secretPattern 加密密钥格式: v{版本号}:{base64密文}
+var secretPattern = regexp.MustCompile(`^v(\d+):(.+)$`)
+
+// SecretCipher 设备密钥加解密
+// 密文带有密钥版本前缀，轮换AES密钥后旧版本密文仍可解密，并可按需重新加密
+type SecretCipher struct {
+	version int
+	keys    map[int][]byte
+}
+
+// NewSecretCipher 创建设备密钥加解密器
+// version为当前密钥版本，keys为全部可用密钥(含当前密钥)
+func NewSecretCipher(version int, keys map[int]string) (*SecretCipher, error) {
+	c := &SecretCipher{
+		version: version,
+		keys:    make(map[int][]byte, len(keys)),
+	}
+	for v, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("aes key version %d is empty", v)
+		}
+		c.keys[v] = normalizeAESKey(key)
+	}
+	if _, ok := c.keys[version]; !ok {
+		return nil, fmt.Errorf("aes key version %d not configured", version)
+	}
+	return c, nil
+}
+
+// Encrypt 使用当前版本密钥加密
+func (c *SecretCipher) Encrypt(plaintext string) (string, error) {
+	ciphertext, err := AESEncrypt(c.keys[c.version], plaintext)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("v%d:%s", c.version, ciphertext), nil
+}
+
+// Decrypt 解密密钥，不带版本前缀的旧数据视为明文直接返回
+func (c *SecretCipher) Decrypt(stored string) (string, error) {
+	matches := secretPattern.FindStringSubmatch(stored)
+	if matches == nil {
+		return stored, nil
+	}
+
+	version, _ := strconv.Atoi(matches[1])
+	key, ok := c.keys[version]
+	if !ok {
+		return "", fmt.Errorf("aes key version %d not configured", version)
+	}
+	return AESDecrypt(key, matches[2])
+}
+
+// NeedsReencrypt 是否需要使用当前版本密钥重新加密(明文或旧版本密文)
+func (c *SecretCipher) NeedsReencrypt(stored string) bool {
+	matches := secretPattern.FindStringSubmatch(stored)
+	return matches == nil || matches[1] != strconv.Itoa(c.version)
+}
+
+// normalizeAESKey 规范化AES密钥，长度不是16/24/32字节时取SHA-256摘要作为AES-256密钥
+func normalizeAESKey(key string) []byte {
+	switch len(key) {
+	case 16, 24, 32:
+		return []byte(key)
+	}
+	hash := sha256.Sum256([]byte(key))
+	return hash[:]
+}
+
+// Match 依次解密候选密钥并用check校验，返回第一个校验通过的候选下标，均未通过返回-1
+func (c *SecretCipher) Match(candidates []string, check func(secret string) bool) (int, error) {
+	for i, stored := range candidates {
+		secret, err := c.Decrypt(stored)
+		if err != nil {
+			return -1, err
+		}
+		if check(secret) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretCipher(t *testing.T) {
+	// 密文带当前版本前缀
+	v1, err := NewSecretCipher(1, map[int]string{1: "old_aes_key"})
+	assert.NoError(t, err)
+	stored, err := v1.Encrypt("device_secret")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored, "v1:"))
+	assert.NotContains(t, stored, "device_secret")
+
+	plain, err := v1.Decrypt(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, "device_secret", plain)
+	assert.False(t, v1.NeedsReencrypt(stored))
+
+	// 轮换到版本2后旧版本密文仍可解密，并标记需要重新加密
+	v2, err := NewSecretCipher(2, map[int]string{1: "old_aes_key", 2: "new_aes_key"})
+	assert.NoError(t, err)
+	plain, err = v2.Decrypt(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, "device_secret", plain)
+	assert.True(t, v2.NeedsReencrypt(stored))
+
+	rekeyed, err := v2.Encrypt(plain)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rekeyed, "v2:"))
+	assert.False(t, v2.NeedsReencrypt(rekeyed))
+
+	// 未配置的版本拒绝解密
+	_, err = v1.Decrypt(rekeyed)
+	assert.Error(t, err)
+	_, err = v2.Decrypt("v9:" + strings.TrimPrefix(rekeyed, "v2:"))
+	assert.Error(t, err)
+
+	// 版本号对应的密钥错误时解密失败
+	wrong, err := NewSecretCipher(1, map[int]string{1: "another_aes_key"})
+	assert.NoError(t, err)
+	_, err = wrong.Decrypt(stored)
+	assert.Error(t, err)
+
+	// 不带版本前缀的旧数据视为明文
+	plain, err = v2.Decrypt("legacy_plain_secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy_plain_secret", plain)
+	assert.True(t, v2.NeedsReencrypt("legacy_plain_secret"))
+
+	// 配置错误
+	_, err = NewSecretCipher(2, map[int]string{1: "old_aes_key"})
+	assert.Error(t, err)
+	_, err = NewSecretCipher(1, map[int]string{1: ""})
+	assert.Error(t, err)
+}
+
+func TestSecretCipher_KeyNormalization(t *testing.T) {
+	// 16/24/32字节的密钥直接使用
+	for _, key := range []string{"0123456789abcdef", "0123456789abcdef01234567", "0123456789abcdef0123456789abcdef"} {
+		c, err := NewSecretCipher(1, map[int]string{1: key})
+		assert.NoError(t, err)
+		stored, err := c.Encrypt("device_secret")
+		assert.NoError(t, err)
+		plain, err := AESDecrypt([]byte(key), strings.TrimPrefix(stored, "v1:"))
+		assert.NoError(t, err, "key length %d", len(key))
+		assert.Equal(t, "device_secret", plain)
+	}
+
+	// 其他长度的密钥取SHA-256摘要作为AES-256密钥
+	for _, key := range []string{"short", "0123456789abcdef0", strings.Repeat("k", 33)} {
+		c, err := NewSecretCipher(1, map[int]string{1: key})
+		assert.NoError(t, err)
+		stored, err := c.Encrypt("device_secret")
+		assert.NoError(t, err)
+		hash := sha256.Sum256([]byte(key))
+		plain, err := AESDecrypt(hash[:], strings.TrimPrefix(stored, "v1:"))
+		assert.NoError(t, err, "key length %d", len(key))
+		assert.Equal(t, "device_secret", plain)
+	}
+}
+
+func TestSecretCipher_Match(t *testing.T) {
+	c, err := NewSecretCipher(1, map[int]string{1: "test_aes_key"})
+	assert.NoError(t, err)
+	current, _ := c.Encrypt("new_secret")
+	previous, _ := c.Encrypt("old_secret")
+
+	check := func(want string) func(string) bool {
+		return func(secret string) bool { return secret == want }
+	}
+
+	matched, err := c.Match([]string{current, previous}, check("new_secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, matched)
+	matched, err = c.Match([]string{current, previous}, check("old_secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, matched)
+	matched, err = c.Match([]string{current, previous}, check("unknown"))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, matched)
+
+	// 候选密钥无法解密时返回错误
+	_, err = c.Match([]string{"v5:abc"}, check("new_secret"))
+	assert.Error(t, err)
+}
@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"bytes"
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // GenerateSign 生成签名
@@ -17,4 +21,53 @@ func GenerateSign(sn, secret string, timestamp int64) string {
 func ValidateSign(sn, secret string, timestamp int64, sign string) bool {
 	expectedSign := GenerateSign(sn, secret, timestamp)
 	return sign == expectedSign
-} 
\ No newline at end of file
+}
+
+// HashToken 计算令牌摘要，数据库中只保存摘要而不保存令牌原文
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// HMACSign 计算HMAC-SHA256签名，返回十六进制字符串
+func HMACSign(secret, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateRequestSign 生成请求签名
+// 签名字符串: timestamp + nonce + deviceSN + canonicalBody
+func GenerateRequestSign(secret, timestamp, nonce, sn, canonicalBody string) string {
+	return HMACSign(secret, timestamp+nonce+sn+canonicalBody)
+}
+
+// ValidateRequestSign 验证请求签名
+func ValidateRequestSign(secret, timestamp, nonce, sn, canonicalBody, sign string) bool {
+	expectedSign := GenerateRequestSign(secret, timestamp, nonce, sn, canonicalBody)
+	return hmac.Equal([]byte(expectedSign), []byte(sign))
+}
+
+// CanonicalJSON 将JSON规范化为键名有序、无多余空白的形式
+func CanonicalJSON(body []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // 保留数值原始格式
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return "", err
+	}
+
+	// encoding/json对map按键名排序输出
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(data); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// ValidateHMACSign 验证HMAC-SHA256签名
+func ValidateHMACSign(secret, data, sign string) bool {
+	return hmac.Equal([]byte(HMACSign(secret, data)), []byte(sign))
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "顶层键名排序",
+			body: `{"b":1,"a":2}`,
+			want: `{"a":2,"b":1}`,
+		},
+		{
+			name: "嵌套对象键名排序",
+			body: `{"z":{"y":1,"x":{"d":true,"c":null}},"a":"v"}`,
+			want: `{"a":"v","z":{"x":{"c":null,"d":true},"y":1}}`,
+		},
+		{
+			name: "数组保持顺序，数组内对象键名排序",
+			body: `{"list":[3,1,{"b":"2","a":"1"},[{"d":0,"c":0}]]}`,
+			want: `{"list":[3,1,{"a":"1","b":"2"},[{"c":0,"d":0}]]}`,
+		},
+		{
+			name: "去除空白并保留数值原始格式",
+			body: "{\n  \"f\": 1.50,\n  \"i\": 12345678901234567890,\n  \"e\": 1e3\n}",
+			want: `{"e":1e3,"f":1.50,"i":12345678901234567890}`,
+		},
+		{
+			name: "不转义HTML字符",
+			body: `{"url":"http://a.com/?x=1&y=<2>"}`,
+			want: `{"url":"http://a.com/?x=1&y=<2>"}`,
+		},
+		{
+			name: "顶层数组",
+			body: `[{"b":1,"a":1}]`,
+			want: `[{"a":1,"b":1}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalJSON([]byte(tt.body))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// 键顺序不同的等价请求体规范化结果相同
+	a, _ := CanonicalJSON([]byte(`{"a":{"x":1,"y":[1,2]},"b":"s"}`))
+	b, _ := CanonicalJSON([]byte(`{"b": "s", "a": {"y": [1, 2], "x": 1}}`))
+	assert.Equal(t, a, b)
+
+	_, err := CanonicalJSON([]byte(`{"a":`))
+	assert.Error(t, err)
+}
+
+func TestValidateRequestSign(t *testing.T) {
+	sign := GenerateRequestSign("secret", "1700000000000", "nonce1", "M1A2401A0100001", `{"a":1}`)
+
+	assert.True(t, ValidateRequestSign("secret", "1700000000000", "nonce1", "M1A2401A0100001", `{"a":1}`, sign))
+	assert.False(t, ValidateRequestSign("other", "1700000000000", "nonce1", "M1A2401A0100001", `{"a":1}`, sign))
+	assert.False(t, ValidateRequestSign("secret", "1700000000001", "nonce1", "M1A2401A0100001", `{"a":1}`, sign))
+	assert.False(t, ValidateRequestSign("secret", "1700000000000", "nonce2", "M1A2401A0100001", `{"a":1}`, sign))
+	assert.False(t, ValidateRequestSign("secret", "1700000000000", "nonce1", "M1A2401A0100002", `{"a":1}`, sign))
+	assert.False(t, ValidateRequestSign("secret", "1700000000000", "nonce1", "M1A2401A0100001", `{"a":2}`, sign))
+}
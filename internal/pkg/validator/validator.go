@@ -67,18 +67,25 @@ func ValidateDeviceSN(sn string) error {
 	return nil
 }
 
-// isValidModelCode 验证机型代码
+// ModelRegistry 机型注册表，机型数据由业务层维护
+type ModelRegistry interface {
+	// IsValidModelCode 机型代码是否已登记且启用
+	IsValidModelCode(code string) bool
+}
+
+var modelRegistry ModelRegistry
+
+// SetModelRegistry 设置SN校验使用的机型注册表
+func SetModelRegistry(registry ModelRegistry) {
+	modelRegistry = registry
+}
+
+// isValidModelCode 验证机型代码，未设置机型注册表时不接受任何机型
 func isValidModelCode(code string) bool {
-	// 目前支持的机型代码列表
-	validCodes := map[string]bool{
-		"M1P": true, // MD-1000 PRO
-		"M6P": true, // MD-600 PRO
-		"M1D": true, // MD-1000D
-		"M4D": true, // MD-400D
-		"M6D": true, // MD-600D
-		// 可以添加更多机型
+	if modelRegistry == nil {
+		return false
 	}
-	return validCodes[code]
+	return modelRegistry.IsValidModelCode(code)
 }
 
 // isValidDate 验证日期是否有效
@@ -26,12 +26,12 @@ trap cleanup EXIT
 # 生成15位设备SN
 generate_sn() {
     local index=$1
-    # M1P + YYMM + 5位序列号 + 2位随机数
+    # M4D + YYMM + 5位序列号 + 2位随机数
     local year_month=$(date +%y%m)  # 当前年月，如2401
     local seq=$(printf "%05d" $index)  # 5位序列号，如00001
     local random=$(printf "%04d" $(( RANDOM % 10000 )))  # 2位随机数
-    # echo "M1P${year_month}${seq}${random}"  # 固定15位：M1P + 4 + 5 + 2 = 15位
-    echo "M1P2204A101${random}"  # 固定15位：M1P + 4 + 5 + 2 = 15位
+    # echo "M4D${year_month}${seq}${random}"  # 固定15位：M4D + 4 + 5 + 2 = 15位
+    echo "M4D2204A101${random}"  # 固定15位：M4D + 4 + 5 + 2 = 15位
 }
 
 # 测试单个设备的完整流程
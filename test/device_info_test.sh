@@ -10,7 +10,7 @@ YELLOW='\033[1;33m'
 NC='\033[0m'
 
 # 测试设备信息
-DEVICE_SN="M1P2401A0100001"
+DEVICE_SN="M4D2401A0100001"
 DEVICE_MODEL="MD-400D"
 
 # 临时文件
@@ -159,7 +159,7 @@ test_error_cases() {
         -H "Authorization: Bearer ${TOKEN}" \
         -d "{
             \"device_info\": {
-                \"device_sn\": \"M1P2401A0100002\",
+                \"device_sn\": \"M4D2401A0100002\",
                 \"device_model\": \"${DEVICE_MODEL}\",
                 \"hardware_version\": \"V1.0\"
             },
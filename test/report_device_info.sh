@@ -9,7 +9,7 @@ RED='\033[0;31m'
 NC='\033[0m'
 
 # 设备信息
-DEVICE_SN="M1P2401A0100005"
+DEVICE_SN="M4D2401A0100005"
 DEVICE_MODEL="MD-400D"
 
 # 检查是否提供了token参数
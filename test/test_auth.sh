@@ -5,7 +5,7 @@ BASE_URL="http://localhost:8080/api/v1"
 
 # 生成唯一的设备SN
 TIMESTAMP_SUFFIX=$(date +%H%M%S)
-DEVICE_SN="M1P2004A1${TIMESTAMP_SUFFIX}"
+DEVICE_SN="M4D2004A1${TIMESTAMP_SUFFIX}"
 DEVICE_MODEL="MD-400D"
 TIMESTAMP=$(date +%s)
 
@@ -57,6 +57,10 @@ fi
 
 echo -e "\n获取到的token: ${TOKEN}"
 
+# 提取刷新令牌
+REFRESH_TOKEN=$(echo $auth_response | jq -r '.data.refresh_token')
+echo -e "\n获取到的refresh_token: ${REFRESH_TOKEN}"
+
 # 3. 使用token访问健康检查接口
 echo -e "\n${GREEN}3. 访问健康检查接口${NC}"
 health_response=$(curl -s -X GET "${BASE_URL}/health" \
@@ -66,5 +70,26 @@ echo $health_response
 # 4. 刷新token
 echo -e "\n${GREEN}4. 刷新token${NC}"
 refresh_response=$(curl -s -X POST "${BASE_URL}/devices/refresh" \
-  -H "Authorization: Bearer ${TOKEN}")
-echo $refresh_response 
\ No newline at end of file
+  -H "Content-Type: application/json" \
+  -d "{\"refresh_token\": \"${REFRESH_TOKEN}\"}")
+echo $refresh_response
+
+# 5. 重复使用旧的刷新令牌（应被拒绝，且整个令牌族被撤销）
+echo -e "\n${GREEN}5. 重复使用旧的刷新令牌${NC}"
+reuse_response=$(curl -s -X POST "${BASE_URL}/devices/refresh" \
+  -H "Content-Type: application/json" \
+  -d "{\"refresh_token\": \"${REFRESH_TOKEN}\"}")
+echo $reuse_response 
+
+# 6. 设备登出
+echo -e "\n${GREEN}6. 设备登出${NC}"
+NEW_TOKEN=$(echo $refresh_response | jq -r '.data.token')
+logout_response=$(curl -s -X POST "${BASE_URL}/devices/logout" \
+  -H "Authorization: Bearer ${NEW_TOKEN}")
+echo $logout_response
+
+# 7. 登出后再次使用令牌（应被拒绝）
+echo -e "\n${GREEN}7. 登出后访问受保护接口${NC}"
+after_logout_response=$(curl -s -X GET "${BASE_URL}/device/alarms" \
+  -H "Authorization: Bearer ${NEW_TOKEN}")
+echo $after_logout_response